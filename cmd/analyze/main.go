@@ -0,0 +1,131 @@
+// Command analyze reports duplicate, shadowed, conflicting and unreachable
+// policies, and policies of roles or groups that do not exist, as the policy
+// analysis of a running server finds them. Conflicting policies grant the
+// same thing under different conditions; policies cannot deny, so there are
+// no allow/deny conflicts to report.
+//
+//	analyze [-tenant name] [-json] [-strict]
+//
+// With -strict it exits with status 1 if anything is found, so that it can
+// gate a CI job. The server and token are taken from -url and -token, or
+// from ACCESSMESH_URL and ACCESSMESH_TOKEN.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/knakul853/accessmesh/internal/services"
+)
+
+func main() {
+	log.SetFlags(0)
+	serverURL := flag.String("url", envOr("ACCESSMESH_URL", "http://localhost:8080"), "server URL")
+	token := flag.String("token", os.Getenv("ACCESSMESH_TOKEN"), "bearer token")
+	tenant := flag.String("tenant", "", "tenant to analyse, for super admins; by default every tenant")
+	asJSON := flag.Bool("json", false, "print the report as JSON")
+	strict := flag.Bool("strict", false, "exit with status 1 if anything is found")
+	flag.Parse()
+
+	data, err := fetch(*serverURL, *token, *tenant)
+	if err != nil {
+		log.Fatal(err)
+	}
+	var report services.AnalysisReport
+	if err := json.Unmarshal(data, &report); err != nil {
+		log.Fatal(err)
+	}
+
+	if *asJSON {
+		_, err = os.Stdout.Write(data)
+	} else {
+		printReport(os.Stdout, &report)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	if *strict && len(report.Findings) > 0 {
+		os.Exit(1)
+	}
+}
+
+func fetch(serverURL, token, tenant string) ([]byte, error) {
+	query := url.Values{}
+	if tenant != "" {
+		query.Set("tenant", tenant)
+	}
+	req, err := http.NewRequest(http.MethodGet, strings.TrimSuffix(serverURL, "/")+"/api/v1/admin/policy-analysis?"+query.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		var failure struct {
+			Error string `json:"error"`
+		}
+		if json.Unmarshal(data, &failure) == nil && failure.Error != "" {
+			return nil, fmt.Errorf("%s: %s", resp.Status, failure.Error)
+		}
+		return nil, fmt.Errorf("%s", resp.Status)
+	}
+	return data, nil
+}
+
+// printReport writes the findings grouped by kind, one policy per line with
+// the reason below it.
+func printReport(w io.Writer, report *services.AnalysisReport) {
+	kinds := []string{
+		services.FindingUnknownRole,
+		services.FindingUnknownGroup,
+		services.FindingConflict,
+		services.FindingDuplicate,
+		services.FindingShadowed,
+		services.FindingUnreachable,
+	}
+	for _, kind := range kinds {
+		var found []services.Finding
+		for _, finding := range report.Findings {
+			if finding.Kind == kind {
+				found = append(found, finding)
+			}
+		}
+		if len(found) == 0 {
+			continue
+		}
+
+		fmt.Fprintf(w, "%s (%d)\n", kind, len(found))
+		for _, finding := range found {
+			fmt.Fprintf(w, "  %s/%s  %s %s %s\n", finding.TenantID, finding.Policy, finding.Subject, finding.Resource, finding.Action)
+			fmt.Fprintf(w, "      %s", finding.Message)
+			if len(finding.Related) > 0 {
+				fmt.Fprintf(w, " (%s)", strings.Join(finding.Related, ", "))
+			}
+			fmt.Fprintln(w)
+		}
+	}
+	fmt.Fprintf(w, "%d findings in %d policies\n", len(report.Findings), report.Policies)
+}
+
+func envOr(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
@@ -0,0 +1,193 @@
+// Command bundle exports and imports policy bundles through the API of a
+// running server, so that imports are checked and enforced exactly as API
+// edits are.
+//
+//	bundle export [-format yaml|json|csv] [-o file]
+//	bundle import [-mode merge|replace] [-dry-run] [-format yaml|json|csv] file
+//
+// The server and token are taken from -url and -token, or from
+// ACCESSMESH_URL and ACCESSMESH_TOKEN.
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/knakul853/accessmesh/internal/services"
+	"github.com/knakul853/accessmesh/pkg/bundle"
+)
+
+const usage = `usage:
+  bundle export [-format yaml|json|csv] [-o file]
+  bundle import [-mode merge|replace] [-dry-run] [-format yaml|json|csv] file`
+
+func main() {
+	log.SetFlags(0)
+	if len(os.Args) < 2 {
+		log.Fatal(usage)
+	}
+
+	var err error
+	switch os.Args[1] {
+	case "export":
+		err = export(os.Args[2:])
+	case "import":
+		err = importBundle(os.Args[2:])
+	default:
+		log.Fatal(usage)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// client talks to the bundle endpoint of a server.
+type client struct {
+	url   string
+	token string
+}
+
+func (c *client) register(flags *flag.FlagSet) {
+	flags.StringVar(&c.url, "url", envOr("ACCESSMESH_URL", "http://localhost:8080"), "server URL")
+	flags.StringVar(&c.token, "token", os.Getenv("ACCESSMESH_TOKEN"), "bearer token")
+}
+
+func (c *client) do(method string, query url.Values, contentType string, body io.Reader) ([]byte, error) {
+	req, err := http.NewRequest(method, strings.TrimSuffix(c.url, "/")+"/api/v1/bundle?"+query.Encode(), body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.token)
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		var failure struct {
+			Error string `json:"error"`
+		}
+		if json.Unmarshal(data, &failure) == nil && failure.Error != "" {
+			return nil, fmt.Errorf("%s: %s", resp.Status, failure.Error)
+		}
+		return nil, fmt.Errorf("%s", resp.Status)
+	}
+	return data, nil
+}
+
+func export(args []string) error {
+	var c client
+	flags := flag.NewFlagSet("export", flag.ExitOnError)
+	c.register(flags)
+	format := flags.String("format", string(bundle.FormatYAML), "yaml, json or csv")
+	output := flags.String("o", "", "file to write instead of standard output")
+	flags.Parse(args)
+
+	data, err := c.do(http.MethodGet, url.Values{"format": {*format}}, "", nil)
+	if err != nil {
+		return err
+	}
+	if *output == "" {
+		_, err = os.Stdout.Write(data)
+		return err
+	}
+	return os.WriteFile(*output, data, 0o644)
+}
+
+func importBundle(args []string) error {
+	var c client
+	flags := flag.NewFlagSet("import", flag.ExitOnError)
+	c.register(flags)
+	mode := flags.String("mode", services.ImportMerge, "merge or replace")
+	dryRun := flags.Bool("dry-run", false, "report the changes without making them")
+	formatName := flags.String("format", "", "yaml, json or csv; by default taken from the file extension")
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		return fmt.Errorf("%s", usage)
+	}
+
+	path := flags.Arg(0)
+	name := *formatName
+	if name == "" {
+		name = strings.TrimPrefix(filepath.Ext(path), ".")
+	}
+	format, err := bundle.ParseFormat(name)
+	if err != nil {
+		return err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	// Checking locally first gives errors with the file's own line numbers.
+	imported, err := bundle.Decode(bytes.NewReader(data), format)
+	if err != nil {
+		return err
+	}
+	if err := imported.Validate(); err != nil {
+		return err
+	}
+
+	query := url.Values{"mode": {*mode}, "dry_run": {fmt.Sprint(*dryRun)}}
+	body, err := c.do(http.MethodPost, query, format.MediaType(), bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	var result services.ImportResult
+	if err := json.Unmarshal(body, &result); err != nil {
+		return err
+	}
+	printResult(os.Stdout, &result)
+	return nil
+}
+
+// printResult writes the changes as a diff: + for created, ~ for updated
+// and - for deleted roles, groups and policies, with the changed fields of
+// each below it.
+func printResult(w io.Writer, result *services.ImportResult) {
+	marks := map[string]string{"create": "+", "update": "~", "delete": "-"}
+	for _, change := range result.Changes {
+		fmt.Fprintf(w, "%s %s %s\n", marks[change.Op], change.Kind, change.Name)
+		for _, field := range change.Changes {
+			fmt.Fprintf(w, "    %s: %s -> %s\n", field.Field, jsonOf(field.From), jsonOf(field.To))
+		}
+	}
+
+	verb := "applied"
+	if result.DryRun {
+		verb = "would be applied (dry run)"
+	}
+	fmt.Fprintf(w, "%d changes %s in %s mode\n", len(result.Changes), verb, result.Mode)
+}
+
+func jsonOf(value interface{}) string {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprint(value)
+	}
+	return string(data)
+}
+
+func envOr(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
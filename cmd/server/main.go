@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"fmt"
 	"log"
 	"net/http"
 	"os"
@@ -12,9 +13,13 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/joho/godotenv"
 	"github.com/knakul853/accessmesh/internal/api"
+	"github.com/knakul853/accessmesh/internal/authn"
 	"github.com/knakul853/accessmesh/internal/config"
+	"github.com/knakul853/accessmesh/internal/services"
 	"github.com/knakul853/accessmesh/internal/store"
+	"github.com/knakul853/accessmesh/pkg/abac"
 	"github.com/knakul853/accessmesh/pkg/enforcer"
+	"github.com/knakul853/accessmesh/pkg/rebac"
 )
 
 func main() {
@@ -25,18 +30,92 @@ func main() {
 
 	cfg := config.Load()
 
-	db, err := store.NewMongoStore(cfg.MongoURI)
+	// "server migrate" applies pending schema migrations and exits.
+	migrateOnly := len(os.Args) > 1 && os.Args[1] == "migrate"
+	if migrateOnly {
+		cfg.MongoAutoMigrate = true
+	}
+
+	db, e, err := openStore(cfg)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if migrateOnly {
+		log.Println("Migrations complete.")
+		return
+	}
+
+	roleIntegrity, err := services.NewRoleIntegrity(db, e, cfg.RoleDeleteMode, cfg.RoleDeleteFallback)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	elevations := services.NewElevations(db, e, cfg.ElevationMaxDuration)
+
+	schema, err := abac.LoadSchema(cfg.AttributeSchemaFile)
+	if err != nil {
+		log.Fatal(err)
+	}
+	access := services.NewAccess(db, e, schema)
+	attributeProviders, err := abac.LoadProviders(cfg.AttributeProvidersFile)
+	if err != nil {
+		log.Fatal(err)
+	}
+	for prefix, provider := range attributeProviders {
+		access.RegisterProvider(prefix, provider)
+		log.Printf("Registered attribute provider for %s", prefix)
+	}
+
+	namespaces, err := rebac.LoadNamespaces(cfg.RelationNamespacesFile)
+	if err != nil {
+		log.Fatal(err)
+	}
+	relations := rebac.NewEngine(db.Tuples(), namespaces)
+
+	authenticator, err := authn.NewChainFromConfig(cfg, db.Users())
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	enforcer, err := enforcer.NewCasbinEnforcer(db)
+	samlProviders, err := authn.LoadSAMLProviders(cfg.PublicURL, cfg.SAML, db.Users())
 	if err != nil {
 		log.Fatal(err)
 	}
 
+	discoveryCtx, cancelDiscovery := context.WithTimeout(context.Background(), 30*time.Second)
+	oidcProviders, err := authn.LoadOIDCProviders(discoveryCtx, cfg.PublicURL, cfg.OIDC, db.Users())
+	cancelDiscovery()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	background, stopBackground := context.WithCancel(context.Background())
+	defer stopBackground()
+	if cfg.SoftDeleteRetention > 0 && cfg.PurgeInterval > 0 {
+		go services.NewPurger(db, cfg.SoftDeleteRetention, cfg.PurgeInterval).Run(background)
+	}
+	if cfg.ElevationExpiryInterval > 0 {
+		go elevations.Run(background, cfg.ElevationExpiryInterval)
+	}
+	if mongoStore, ok := db.(*store.MongoStore); ok && cfg.EnforcerWatch {
+		watcher, err := enforcer.NewMongoWatcher(e, mongoStore, cfg.ReplicaID, cfg.EnforcerPollInterval)
+		if err != nil {
+			log.Fatal(err)
+		}
+		go watcher.Run(background)
+	}
+
+	var gitops *services.GitOps
+	if cfg.GitOpsDir != "" {
+		if cfg.GitOpsInterval <= 0 {
+			log.Fatal("GITOPS_INTERVAL must be positive when GITOPS_DIR is set")
+		}
+		gitops = services.NewGitOps(services.NewBundles(db, e, roleIntegrity, schema), cfg.GitOpsDir, cfg.GitOpsInterval, cfg.GitOpsLock)
+		go gitops.Run(background)
+	}
+
 	router := gin.Default()
-	api.SetupRoutes(router, db, enforcer)
+	api.SetupRoutes(router, db, e, roleIntegrity, elevations, access, relations, gitops, authenticator, samlProviders, oidcProviders)
 
 	srv := &http.Server{
 		Addr:    ":8080",
@@ -52,6 +131,7 @@ func main() {
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
 	<-quit
+	stopBackground()
 
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
@@ -60,3 +140,57 @@ func main() {
 		log.Fatal("Server forced to shutdown:", err)
 	}
 }
+
+// openStore connects the storage backend selected by cfg.Store together with
+// a Casbin enforcer persisting to the same place.
+func openStore(cfg *config.Config) (store.Store, *enforcer.Enforcer, error) {
+	switch cfg.Store {
+	case config.StoreMemory:
+		log.Println("Using in-memory store; data is lost on restart.")
+		e, err := enforcer.NewMemoryEnforcer()
+		if err != nil {
+			return nil, nil, err
+		}
+		return store.NewMemoryStore(), e, nil
+	case config.StoreMongo:
+		db, err := store.NewMongoStore(cfg.MongoURI)
+		if err != nil {
+			return nil, nil, err
+		}
+		if cfg.MongoAutoMigrate {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+			err := db.Migrate(ctx)
+			cancel()
+			if err != nil {
+				return nil, nil, err
+			}
+		}
+		e, err := enforcer.NewCasbinEnforcer(db)
+		if err != nil {
+			return nil, nil, err
+		}
+		return db, e, nil
+	case config.StorePostgres:
+		db, err := store.NewPostgresStore(cfg.PostgresURL)
+		if err != nil {
+			return nil, nil, err
+		}
+		e, err := enforcer.NewSQLEnforcer(db.DB)
+		if err != nil {
+			return nil, nil, err
+		}
+		return db, e, nil
+	case config.StoreSQLite:
+		db, err := store.NewSQLiteStore(cfg.SQLitePath)
+		if err != nil {
+			return nil, nil, err
+		}
+		e, err := enforcer.NewSQLEnforcer(db.DB)
+		if err != nil {
+			return nil, nil, err
+		}
+		return db, e, nil
+	default:
+		return nil, nil, fmt.Errorf("unknown STORE %q", cfg.Store)
+	}
+}
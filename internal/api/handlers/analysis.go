@@ -0,0 +1,85 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/knakul853/accessmesh/internal/api/middleware"
+	"github.com/knakul853/accessmesh/internal/services"
+	"github.com/knakul853/accessmesh/pkg/auth"
+	"github.com/knakul853/accessmesh/pkg/enforcer"
+)
+
+// Casbin object/action a role must be granted explicitly to analyse
+// policies.
+const (
+	AnalysisResource = "analysis"
+	AnalysisAction   = "read"
+)
+
+// Permissions returns the objects and actions handlers and middleware check
+// explicitly, as opposed to the route paths and methods access control
+// checks.
+func Permissions() []services.Permission {
+	return []services.Permission{
+		{Resource: AnalysisResource, Action: AnalysisAction},
+		{Resource: BackupResource, Action: BackupAction},
+		{Resource: BundlesResource, Action: BundlesExportAction},
+		{Resource: BundlesResource, Action: BundlesImportAction},
+		{Resource: ChecksResource, Action: ChecksAction},
+		{Resource: ConsistencyResource, Action: ConsistencyAction},
+		{Resource: ElevationsResource, Action: ElevationsAction},
+		{Resource: GitOpsResource, Action: GitOpsReadAction},
+		{Resource: GitOpsResource, Action: GitOpsSyncAction},
+		{Resource: ImpersonationResource, Action: ImpersonationAction},
+		{Resource: RelationsResource, Action: RelationsReadAction},
+		{Resource: RelationsResource, Action: RelationsWriteAction},
+		{Resource: middleware.TenantsResource, Action: middleware.TenantsAction},
+	}
+}
+
+type AnalysisHandler struct {
+	analyzer *services.Analyzer
+	enforcer *enforcer.Enforcer
+}
+
+func NewAnalysisHandler(analyzer *services.Analyzer, enforcer *enforcer.Enforcer) *AnalysisHandler {
+	return &AnalysisHandler{
+		analyzer: analyzer,
+		enforcer: enforcer,
+	}
+}
+
+// Analyze reports duplicate, shadowed, conflicting and unreachable policies
+// of the caller's tenant, and policies of roles or groups that do not exist.
+// Conflicts are grants of the same thing under different conditions, as
+// policies cannot deny.
+// Super admins analyse every tenant, or the one given by the tenant query
+// parameter.
+func (h *AnalysisHandler) Analyze(c *gin.Context) {
+	caller, err := auth.ValidateToken(c.GetHeader("Authorization"))
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid token"})
+		return
+	}
+
+	allowed, err := h.enforcer.EnforceUser(caller.Subject, caller.RoleNames(), caller.Domain(), AnalysisResource, AnalysisAction)
+	if err != nil {
+		log.Printf("Error enforcing policy analysis permission: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
+		return
+	}
+	if !allowed {
+		c.JSON(http.StatusForbidden, gin.H{"error": "access denied"})
+		return
+	}
+
+	report, err := h.analyzer.Analyze(c.Request.Context(), scopeOf(c).listTenant(c))
+	if err != nil {
+		log.Printf("Error analysing policies: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to analyse policies"})
+		return
+	}
+	c.JSON(http.StatusOK, report)
+}
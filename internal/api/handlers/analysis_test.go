@@ -0,0 +1,117 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/knakul853/accessmesh/internal/api/middleware"
+	"github.com/knakul853/accessmesh/internal/models"
+	"github.com/knakul853/accessmesh/internal/services"
+	"github.com/knakul853/accessmesh/internal/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestAnalysisHandler(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	e := newTestEnforcer(t)
+	_, err := e.AddPolicy("admin", "acme", AnalysisResource, AnalysisAction)
+	require.NoError(t, err)
+
+	testStore := store.NewMemoryStore()
+	ctx := context.Background()
+	for _, name := range []string{"manager", "viewer"} {
+		require.NoError(t, testStore.Roles().Create(ctx, &models.Role{TenantID: "acme", Name: name}))
+	}
+	eng := &models.Group{TenantID: "acme", Name: "eng", Roles: []string{"viewer"}}
+	require.NoError(t, testStore.Groups().Create(ctx, eng))
+	oncall := &models.Group{TenantID: "acme", Name: "oncall"}
+	require.NoError(t, testStore.Groups().Create(ctx, oncall))
+	eng.Subgroups = []string{oncall.ID.Hex()}
+	require.NoError(t, testStore.Groups().Update(ctx, eng))
+
+	var ids []string
+	add := func(policy models.Policy) {
+		if policy.TenantID == "" {
+			policy.TenantID = "acme"
+		}
+		require.NoError(t, testStore.Policies().Create(ctx, &policy))
+		ids = append(ids, policy.ID.Hex())
+	}
+	add(models.Policy{Role: "manager", Resource: "/api/v1/orders", Action: "GET"})
+	add(models.Policy{Role: "manager", Resource: "/api/v1/orders", Action: "GET"})
+	add(models.Policy{Role: "viewer", Resource: "/api/v1/orders/42", Action: "GET"})
+	// oncall is nested in eng, which holds viewer.
+	add(models.Policy{Group: oncall.ID.Hex(), Resource: "/api/v1/orders/42", Action: "GET"})
+	add(models.Policy{Role: "viewer", Resource: "/api/v1/orders", Action: "POST",
+		Conditions: models.PolicyConditions{IPRange: []string{"10.0.0.0/8"}}})
+	add(models.Policy{Group: eng.ID.Hex(), Resource: "/api/v1/orders", Action: "POST",
+		Conditions: models.PolicyConditions{TimeRange: []string{"08:00-20:00"}}})
+	add(models.Policy{Role: "ghost", Resource: "/api/v1/orders", Action: "GET"})
+	add(models.Policy{Group: primitive.NewObjectID().Hex(), Resource: "/api/v1/orders", Action: "GET"})
+	add(models.Policy{Role: "manager", Resource: "/api/v1/orders", Action: "DELETE"})
+	add(models.Policy{Role: "manager", Resource: BundlesResource, Action: BundlesExportAction})
+	add(models.Policy{Role: "manager", Resource: "/api/v1/reports", Action: "read"})
+	add(models.Policy{Role: "manager", Resource: BundlesResource, Action: "delete"})
+	// Other tenants are not analysed.
+	add(models.Policy{TenantID: "globex", Role: "ghost", Resource: "/elsewhere", Action: "GET"})
+
+	routes := func() []services.Route {
+		return []services.Route{
+			{Method: "GET", Path: "/api/v1/orders"},
+			{Method: "POST", Path: "/api/v1/orders"},
+			{Method: "GET", Path: "/api/v1/orders/:id"},
+		}
+	}
+	handler := NewAnalysisHandler(services.NewAnalyzer(testStore, routes, Permissions()), e)
+	router := gin.New()
+	router.Use(middleware.TenantScope(e))
+	router.GET("/admin/policy-analysis", handler.Analyze)
+
+	do := func(token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/admin/policy-analysis", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+	assert.Equal(t, http.StatusForbidden, do(testTenantToken(t, "viewer", "acme")).Code)
+
+	w := do(testTenantToken(t, "admin", "acme"))
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var report services.AnalysisReport
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &report))
+	assert.Equal(t, 12, report.Policies)
+
+	type flagged struct{ kind, policy string }
+	var got []flagged
+	for _, finding := range report.Findings {
+		got = append(got, flagged{finding.Kind, finding.Policy})
+	}
+	assert.Equal(t, []flagged{
+		{services.FindingDuplicate, ids[1]},
+		{services.FindingShadowed, ids[3]},
+		{services.FindingConflict, ids[5]},
+		{services.FindingUnknownRole, ids[6]},
+		{services.FindingUnknownGroup, ids[7]},
+		{services.FindingUnreachable, ids[8]},
+		{services.FindingUnreachable, ids[10]},
+		{services.FindingUnreachable, ids[11]},
+	}, got)
+
+	if assert.Len(t, report.Findings, 8) {
+		assert.Equal(t, []string{ids[0]}, report.Findings[0].Related)
+		assert.Equal(t, []string{ids[2]}, report.Findings[1].Related)
+		assert.Equal(t, "group:oncall", report.Findings[1].Subject)
+		assert.Equal(t, "already granted by viewer", report.Findings[1].Message)
+		assert.Equal(t, []string{ids[4]}, report.Findings[2].Related)
+		assert.Equal(t, "routes matching /api/v1/orders take GET, POST, not DELETE", report.Findings[5].Message)
+		assert.Equal(t, "no route or permission check matches /api/v1/reports", report.Findings[6].Message)
+		assert.Equal(t, "bundles is only checked for export, import", report.Findings[7].Message)
+	}
+}
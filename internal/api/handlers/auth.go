@@ -1,23 +1,24 @@
 package handlers
 
 import (
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/knakul853/accessmesh/internal/authn"
 	"github.com/knakul853/accessmesh/internal/models"
 	"github.com/knakul853/accessmesh/internal/services"
 	"github.com/knakul853/accessmesh/internal/store"
 	"github.com/knakul853/accessmesh/pkg/auth"
-	"go.mongodb.org/mongo-driver/bson"
-	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 type AuthHandler struct {
-	store        *store.MongoStore
-	emailService *services.EmailService
+	store         store.Store
+	emailService  *services.EmailService
+	authenticator authn.Authenticator
 }
 
 type LoginRequest struct {
@@ -29,7 +30,12 @@ type RegisterRequest struct {
 	Username string `json:"username" binding:"required"`
 	Email    string `json:"email" binding:"required,email"`
 	Password string `json:"password" binding:"required"`
-	Role     string `json:"role" binding:"required"`
+	// Roles are the roles to hold; at least one is required. Role is still
+	// accepted for a single role.
+	Roles []string `json:"roles"`
+	Role  string   `json:"role"`
+	// Tenant is the tenant to join; the default tenant if empty.
+	Tenant string `json:"tenant"`
 }
 
 type AuthResponse struct {
@@ -50,10 +56,11 @@ type VerifyEmailRequest struct {
 	Token string `json:"token" binding:"required"`
 }
 
-func NewAuthHandler(store *store.MongoStore, emailService *services.EmailService) *AuthHandler {
+func NewAuthHandler(store store.Store, emailService *services.EmailService, authenticator authn.Authenticator) *AuthHandler {
 	return &AuthHandler{
-		store:        store,
-		emailService: emailService,
+		store:         store,
+		emailService:  emailService,
+		authenticator: authenticator,
 	}
 }
 
@@ -67,11 +74,25 @@ func (h *AuthHandler) Register(c *gin.Context) {
 
 	log.Printf("Processing registration for user: %s, email: %s", req.Username, req.Email)
 
-	var existingUser models.User
-	err := h.store.Users().FindOne(c.Request.Context(), bson.M{"username": req.Username}).Decode(&existingUser)
-	if err == nil {
-		log.Printf("Username already exists: %s", req.Username)
-		c.JSON(http.StatusConflict, gin.H{"error": "username already exists"})
+	tenant := req.Tenant
+	if tenant == "" {
+		tenant = models.DefaultTenant
+	}
+	if _, err := h.store.Tenants().Get(c.Request.Context(), tenant); err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("unknown tenant %q", tenant)})
+			return
+		}
+		log.Printf("Failed to look up tenant %s: %v", tenant, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to look up tenant"})
+		return
+	}
+	roles := models.AssignRoles(append(req.Roles, req.Role)...)
+	if len(roles) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "at least one role is required"})
+		return
+	}
+	if !checkAssignments(c, h.store.Roles(), tenant, nil, roles) {
 		return
 	}
 
@@ -84,10 +105,11 @@ func (h *AuthHandler) Register(c *gin.Context) {
 	log.Printf("Generated verification token for user: %s", req.Username)
 
 	user := models.User{
+		TenantID:          tenant,
 		Username:          req.Username,
 		Email:             req.Email,
 		Password:         req.Password,
-		Role:              req.Role,
+		Roles:             roles,
 		EmailVerified:     false,
 		VerificationToken: verificationToken,
 		CreatedAt:         time.Now(),
@@ -100,14 +122,19 @@ func (h *AuthHandler) Register(c *gin.Context) {
 		return
 	}
 
-	result, err := h.store.Users().InsertOne(c.Request.Context(), user)
-	if err != nil {
+	if err := h.store.Users().Create(c.Request.Context(), &user); err != nil {
+		// Uniqueness is enforced by the store so concurrent registrations
+		// cannot both succeed.
+		if errors.Is(err, store.ErrDuplicate) {
+			log.Printf("Username or email already exists: %s", req.Username)
+			c.JSON(http.StatusConflict, gin.H{"error": "username or email already exists"})
+			return
+		}
 		log.Printf("Failed to create user in database: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create user"})
 		return
 	}
 
-	user.ID = result.InsertedID.(primitive.ObjectID)
 	log.Printf("Successfully created user in database with ID: %s", user.ID.Hex())
 
 	if err := h.emailService.SendVerificationEmail(user.Email, verificationToken); err != nil {
@@ -128,21 +155,7 @@ func (h *AuthHandler) VerifyEmail(c *gin.Context) {
 		return
 	}
 
-	update := bson.M{
-		"$set": bson.M{
-			"email_verified":     true,
-			"verification_token": "",
-			"updated_at":        time.Now(),
-		},
-	}
-
-	result, err := h.store.Users().UpdateOne(
-		c.Request.Context(),
-		bson.M{"verification_token": req.Token},
-		update,
-	)
-
-	if err != nil || result.ModifiedCount == 0 {
+	if err := h.store.Users().VerifyEmail(c.Request.Context(), req.Token); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid verification token"})
 		return
 	}
@@ -157,8 +170,7 @@ func (h *AuthHandler) ForgotPassword(c *gin.Context) {
 		return
 	}
 
-	var user models.User
-	err := h.store.Users().FindOne(c.Request.Context(), bson.M{"email": req.Email}).Decode(&user)
+	user, err := h.store.Users().GetByEmail(c.Request.Context(), req.Email)
 	if err != nil {
 		c.JSON(http.StatusOK, gin.H{"message": "if email exists, password reset link will be sent"})
 		return
@@ -170,16 +182,10 @@ func (h *AuthHandler) ForgotPassword(c *gin.Context) {
 		return
 	}
 
-	update := bson.M{
-		"$set": bson.M{
-			"reset_token":        token.Token,
-			"reset_token_expiry": token.ExpiresAt,
-			"updated_at":         time.Now(),
-		},
-	}
+	user.ResetToken = token.Token
+	user.ResetTokenExpiry = token.ExpiresAt
 
-	_, err = h.store.Users().UpdateByID(c.Request.Context(), user.ID, update)
-	if err != nil {
+	if err := h.store.Users().Update(c.Request.Context(), user); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update user"})
 		return
 	}
@@ -199,12 +205,7 @@ func (h *AuthHandler) ResetPassword(c *gin.Context) {
 		return
 	}
 
-	var user models.User
-	err := h.store.Users().FindOne(c.Request.Context(), bson.M{
-		"reset_token": req.Token,
-		"reset_token_expiry": bson.M{"$gt": time.Now()},
-	}).Decode(&user)
-
+	user, err := h.store.Users().GetByResetToken(c.Request.Context(), req.Token)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid or expired reset token"})
 		return
@@ -216,17 +217,10 @@ func (h *AuthHandler) ResetPassword(c *gin.Context) {
 		return
 	}
 
-	update := bson.M{
-		"$set": bson.M{
-			"password":          user.Password,
-			"reset_token":       "",
-			"reset_token_expiry": time.Time{},
-			"updated_at":        time.Now(),
-		},
-	}
+	user.ResetToken = ""
+	user.ResetTokenExpiry = time.Time{}
 
-	_, err = h.store.Users().UpdateByID(c.Request.Context(), user.ID, update)
-	if err != nil {
+	if err := h.store.Users().Update(c.Request.Context(), user); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update password"})
 		return
 	}
@@ -241,19 +235,13 @@ func (h *AuthHandler) Login(c *gin.Context) {
 		return
 	}
 
-	var user models.User
-	err := h.store.Users().FindOne(c.Request.Context(), bson.M{"username": req.Username}).Decode(&user)
+	user, err := h.authenticator.Authenticate(c.Request.Context(), req.Username, req.Password)
 	if err != nil {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid credentials"})
 		return
 	}
 
-	if err := user.ComparePassword(req.Password); err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid credentials"})
-		return
-	}
-
-	token, err := auth.GenerateToken(user.Role)
+	token, err := issueUserToken(user)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to generate token"})
 		return
@@ -263,10 +251,18 @@ func (h *AuthHandler) Login(c *gin.Context) {
 
 	c.JSON(http.StatusOK, AuthResponse{
 		Token: token,
-		User:  user,
+		User:  *user,
 	})
 }
 
+// issueUserToken issues a login token for the roles assigned to the user
+// now. It expires after auth.UserTTL, or sooner when one of the user's role
+// assignments starts or ends, so that the next login picks up the change.
+func issueUserToken(user *models.User) (string, error) {
+	now := time.Now()
+	return auth.IssueUserToken(user.ID.Hex(), user.ActiveRoles(now), user.TenantID, user.TokenExpiry(now, auth.UserTTL))
+}
+
 // Logout handles user logout
 func (h *AuthHandler) Logout(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{
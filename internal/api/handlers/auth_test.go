@@ -0,0 +1,43 @@
+package handlers
+
+import (
+	"testing"
+	"time"
+
+	"github.com/knakul853/accessmesh/internal/models"
+	"github.com/knakul853/accessmesh/pkg/auth"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestIssueUserToken(t *testing.T) {
+	now := time.Now()
+	past, soon, later := now.Add(-time.Hour), now.Add(time.Hour), now.Add(48*time.Hour)
+	user := &models.User{
+		ID:       primitive.NewObjectID(),
+		TenantID: "acme",
+		Roles: []models.RoleAssignment{
+			{Role: "support"},
+			{Role: "billing", StartsAt: &past, ExpiresAt: &soon},
+			{Role: "auditor", StartsAt: &later},
+			{Role: "intern", ExpiresAt: &past},
+		},
+	}
+
+	token, err := issueUserToken(user)
+	require.NoError(t, err)
+	claims, err := auth.ValidateToken(token)
+	require.NoError(t, err)
+	assert.Equal(t, user.ID.Hex(), claims.Subject)
+	assert.Equal(t, "acme", claims.Domain())
+	assert.Equal(t, []string{"support", "billing"}, claims.RoleNames(), "only roles active now")
+	assert.WithinDuration(t, soon, claims.ExpiresAt.Time, time.Second, "expires with the billing role")
+
+	user.Roles = models.AssignRoles("support")
+	token, err = issueUserToken(user)
+	require.NoError(t, err)
+	claims, err = auth.ValidateToken(token)
+	require.NoError(t, err)
+	assert.WithinDuration(t, now.Add(auth.UserTTL), claims.ExpiresAt.Time, time.Second)
+}
@@ -0,0 +1,78 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/knakul853/accessmesh/internal/models"
+	"github.com/knakul853/accessmesh/internal/store"
+	"github.com/knakul853/accessmesh/pkg/auth"
+	"github.com/knakul853/accessmesh/pkg/enforcer"
+)
+
+// Casbin object/action a role must be granted explicitly to download backups.
+const (
+	BackupResource = "backup"
+	BackupAction   = "create"
+)
+
+type BackupHandler struct {
+	backuper store.Backuper
+	enforcer *enforcer.Enforcer
+}
+
+func NewBackupHandler(backuper store.Backuper, enforcer *enforcer.Enforcer) *BackupHandler {
+	return &BackupHandler{
+		backuper: backuper,
+		enforcer: enforcer,
+	}
+}
+
+// Backup streams an online backup of the database as a file download.
+func (h *BackupHandler) Backup(c *gin.Context) {
+	caller, err := auth.ValidateToken(c.GetHeader("Authorization"))
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid token"})
+		return
+	}
+
+	if caller.IsImpersonated() {
+		c.JSON(http.StatusForbidden, gin.H{"error": "cannot take backups from an impersonated session"})
+		return
+	}
+
+	// A backup holds every tenant's data, so only the platform tenant may
+	// take one.
+	allowed := false
+	if caller.Domain() == models.DefaultTenant {
+		allowed, err = h.enforcer.EnforceUser(caller.Subject, caller.RoleNames(), models.DefaultTenant, BackupResource, BackupAction)
+	}
+	if err != nil {
+		log.Printf("Error enforcing backup permission: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
+		return
+	}
+	if !allowed {
+		log.Printf("Backup denied for roles %v", caller.RoleNames())
+		c.JSON(http.StatusForbidden, gin.H{"error": "access denied"})
+		return
+	}
+
+	filename := fmt.Sprintf("accessmesh-%s.db", time.Now().UTC().Format("20060102T150405Z"))
+	c.Header("Content-Type", "application/octet-stream")
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+
+	log.Printf("Starting database backup for %s", caller.Subject)
+	if err := h.backuper.Backup(c.Request.Context(), c.Writer); err != nil {
+		log.Printf("Error taking backup: %v", err)
+		// Headers are only committed once the first byte is written.
+		if !c.Writer.Written() {
+			c.Header("Content-Disposition", "")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to take backup"})
+		}
+		return
+	}
+}
@@ -0,0 +1,56 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/knakul853/accessmesh/internal/models"
+	"github.com/knakul853/accessmesh/internal/store"
+	"github.com/knakul853/accessmesh/pkg/auth"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBackupHandler(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	e := newTestEnforcer(t)
+	_, err := e.AddPolicy("admin", "default", BackupResource, BackupAction)
+	require.NoError(t, err)
+	_, err = e.AddPolicy("admin", "acme", BackupResource, BackupAction)
+	require.NoError(t, err)
+
+	db, err := store.NewSQLiteStore(filepath.Join(t.TempDir(), "accessmesh.db"))
+	require.NoError(t, err)
+	defer db.Close()
+	require.NoError(t, db.Users().Create(context.Background(), &models.User{Username: "alice"}))
+
+	router := gin.New()
+	router.GET("/admin/backup", NewBackupHandler(db, e).Backup)
+
+	backup := func(role, tenant string) *httptest.ResponseRecorder {
+		token, err := auth.GenerateUserToken("user-1", []string{role}, tenant)
+		require.NoError(t, err)
+		req := httptest.NewRequest(http.MethodGet, "/admin/backup", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := backup("support", "")
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	// Backups hold every tenant's data.
+	w = backup("admin", "acme")
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	w = backup("admin", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Header().Get("Content-Disposition"), "attachment")
+	assert.Equal(t, "SQLite format 3\x00", w.Body.String()[:16])
+}
@@ -0,0 +1,142 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/knakul853/accessmesh/internal/services"
+	"github.com/knakul853/accessmesh/internal/store"
+	"github.com/knakul853/accessmesh/pkg/auth"
+	"github.com/knakul853/accessmesh/pkg/bundle"
+	"github.com/knakul853/accessmesh/pkg/enforcer"
+)
+
+// The Casbin permissions that let a role export the roles, groups and
+// policies of its tenant as a bundle, and import bundles into it.
+const (
+	BundlesResource     = "bundles"
+	BundlesExportAction = "export"
+	BundlesImportAction = "import"
+)
+
+// BundleHandler exports and imports policy bundles.
+type BundleHandler struct {
+	enforcer *enforcer.Enforcer
+	bundles  *services.Bundles
+}
+
+func NewBundleHandler(enforcer *enforcer.Enforcer, bundles *services.Bundles) *BundleHandler {
+	return &BundleHandler{enforcer: enforcer, bundles: bundles}
+}
+
+// Export downloads the caller's tenant as a bundle in the format query
+// parameter: yaml, the default, json or csv.
+func (h *BundleHandler) Export(c *gin.Context) {
+	if !h.authorize(c, BundlesExportAction) {
+		return
+	}
+	format, err := bundle.ParseFormat(c.DefaultQuery("format", string(bundle.FormatYAML)))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	tenant := scopeOf(c).assign(c.Query("tenant"))
+	exported, err := h.bundles.Export(c.Request.Context(), tenant)
+	if err != nil {
+		log.Printf("Error exporting bundle: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to export bundle"})
+		return
+	}
+	data, err := bundle.Marshal(exported, format)
+	if errors.Is(err, bundle.ErrInvalid) {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		log.Printf("Error encoding bundle: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to export bundle"})
+		return
+	}
+
+	filename := fmt.Sprintf("accessmesh-%s-%s.%s", tenant, time.Now().UTC().Format("20060102T150405Z"), format)
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+	c.Data(http.StatusOK, format.MediaType(), data)
+}
+
+// Import reads a bundle from the request body, in the format of the format
+// query parameter or else of the Content-Type, and imports it into the
+// caller's tenant. The mode query parameter is merge, the default, or
+// replace; with dry_run=true the changes are reported but not made.
+func (h *BundleHandler) Import(c *gin.Context) {
+	if !h.authorize(c, BundlesImportAction) {
+		return
+	}
+
+	var (
+		format bundle.Format
+		err    error
+	)
+	if name := c.Query("format"); name != "" {
+		format, err = bundle.ParseFormat(name)
+	} else {
+		format, err = bundle.FormatOf(c.ContentType())
+	}
+	if err != nil {
+		c.JSON(http.StatusUnsupportedMediaType, gin.H{"error": err.Error()})
+		return
+	}
+	dryRun, err := strconv.ParseBool(c.DefaultQuery("dry_run", "false"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "dry_run must be true or false"})
+		return
+	}
+	imported, err := bundle.Decode(c.Request.Body, format)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	tenant := scopeOf(c).assign(c.Query("tenant"))
+	mode := c.DefaultQuery("mode", services.ImportMerge)
+	result, err := h.bundles.Import(c.Request.Context(), tenant, imported, mode, dryRun, actorOf(c))
+	switch {
+	case errors.Is(err, bundle.ErrInvalid):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, store.ErrVersionConflict):
+		c.JSON(http.StatusConflict, gin.H{"error": "the tenant changed during the import, try again"})
+		return
+	case err != nil:
+		log.Printf("Error importing bundle into %s: %v", tenant, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to import bundle"})
+		return
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+// authorize responds 403 unless a role of the caller has the bundles
+// permission for action in the caller's tenant.
+func (h *BundleHandler) authorize(c *gin.Context, action string) bool {
+	claims, err := auth.ValidateToken(c.GetHeader("Authorization"))
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid token"})
+		return false
+	}
+	allowed, err := h.enforcer.EnforceUser(claims.Subject, claims.RoleNames(), claims.Domain(), BundlesResource, action)
+	if err != nil {
+		log.Printf("Error enforcing bundles permission: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
+		return false
+	}
+	if !allowed {
+		c.JSON(http.StatusForbidden, gin.H{"error": "access denied"})
+		return false
+	}
+	return true
+}
@@ -0,0 +1,159 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/knakul853/accessmesh/internal/api/middleware"
+	"github.com/knakul853/accessmesh/internal/models"
+	"github.com/knakul853/accessmesh/internal/services"
+	"github.com/knakul853/accessmesh/internal/store"
+	"github.com/knakul853/accessmesh/pkg/abac"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBundleHandler(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	e := newTestEnforcer(t)
+	for _, action := range []string{BundlesExportAction, BundlesImportAction} {
+		_, err := e.AddPolicy("admin", "acme", BundlesResource, action)
+		require.NoError(t, err)
+	}
+	_, err := e.AddPolicy("auditor", "acme", BundlesResource, BundlesExportAction)
+	require.NoError(t, err)
+
+	testStore := store.NewMemoryStore()
+	ctx := context.Background()
+	legacy := &models.Role{TenantID: "acme", Name: "legacy"}
+	require.NoError(t, testStore.Roles().Create(ctx, legacy))
+	legacyPolicy := &models.Policy{TenantID: "acme", Role: "legacy", Resource: "/api/v1/old", Action: "read"}
+	require.NoError(t, testStore.Policies().Create(ctx, legacyPolicy))
+	require.NoError(t, e.Grant(legacyPolicy))
+
+	integrity, err := services.NewRoleIntegrity(testStore, e, services.RoleDeleteCascade, "")
+	require.NoError(t, err)
+	handler := NewBundleHandler(e, services.NewBundles(testStore, e, integrity, &abac.Schema{}))
+	router := gin.New()
+	router.Use(middleware.TenantScope(e))
+	router.GET("/bundle", handler.Export)
+	router.POST("/bundle", handler.Import)
+
+	do := func(token, method, path, contentType, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", contentType)
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+	importBundle := func(query, body string) services.ImportResult {
+		w := do(testTenantToken(t, "admin", "acme"), "POST", "/bundle?"+query, "application/yaml", body)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		var result services.ImportResult
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &result))
+		return result
+	}
+	allowed := func(subject, resource, action string) bool {
+		ok, err := e.Enforce(subject, "acme", resource, action)
+		require.NoError(t, err)
+		return ok
+	}
+
+	staging := `version: 1
+roles:
+  - name: manager
+    description: Manages orders
+groups:
+  - name: eng
+    roles: [manager]
+policies:
+  - role: manager
+    resource: /api/v1/orders
+    action: read
+  - group: eng
+    resource: /api/v1/deploys
+    action: create
+`
+	auditor := testTenantToken(t, "auditor", "acme")
+	assert.Equal(t, http.StatusForbidden, do(auditor, "POST", "/bundle", "application/yaml", staging).Code)
+	assert.Equal(t, http.StatusUnsupportedMediaType, do(testTenantToken(t, "admin", "acme"), "POST", "/bundle", "text/plain", staging).Code)
+
+	// References are checked before anything is written.
+	w := do(testTenantToken(t, "admin", "acme"), "POST", "/bundle", "application/yaml",
+		"version: 1\npolicies:\n  - role: ghost\n    resource: /a\n    action: read\n")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), `unknown role \"ghost\"`)
+
+	result := importBundle("dry_run=true", staging)
+	assert.True(t, result.DryRun)
+	assert.Len(t, result.Changes, 4)
+	assert.False(t, allowed("manager", "/api/v1/orders", "read"))
+
+	result = importBundle("", staging)
+	assert.Equal(t, services.ImportMerge, result.Mode)
+	assert.Len(t, result.Changes, 4)
+	assert.True(t, allowed("manager", "/api/v1/orders", "read"))
+	assert.True(t, allowed("legacy", "/api/v1/old", "read"))
+	assert.Empty(t, importBundle("", staging).Changes)
+
+	// Exports are sorted and round-trip.
+	w = do(auditor, "GET", "/bundle?format=json", "", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+	var exported struct {
+		Tenant string `json:"tenant"`
+		Roles  []struct {
+			Name string `json:"name"`
+		} `json:"roles"`
+		Policies []json.RawMessage `json:"policies"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &exported))
+	assert.Equal(t, "acme", exported.Tenant)
+	if assert.Len(t, exported.Roles, 2) {
+		assert.Equal(t, "legacy", exported.Roles[0].Name)
+	}
+	assert.Len(t, exported.Policies, 3)
+	w = do(auditor, "GET", "/bundle?format=csv", "", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "g, group:eng, manager, acme\n")
+
+	// Replacing removes what the bundle does not hold and reports field
+	// changes.
+	production := `version: 1
+roles:
+  - name: manager
+    description: Manages orders
+groups:
+  - name: eng
+    roles: [manager]
+policies:
+  - role: manager
+    resource: /api/v1/orders
+    action: read
+    conditions:
+      ip_range: ["10.0.0.0/8"]
+`
+	result = importBundle("mode=replace&dry_run=true", production)
+	assert.Contains(t, result.Changes, services.BundleChange{Kind: services.BundleKindRole, Name: "legacy", Op: "delete",
+		Changes: []models.FieldChange{{Field: "name", From: "legacy"}}})
+	assert.Contains(t, result.Changes, services.BundleChange{Kind: services.BundleKindPolicy, Name: "role:manager /api/v1/orders read", Op: "update",
+		Changes: []models.FieldChange{{Field: "conditions.ip_range", To: []interface{}{"10.0.0.0/8"}}}})
+	assert.True(t, allowed("legacy", "/api/v1/old", "read"))
+
+	importBundle("mode=replace", production)
+	assert.False(t, allowed("legacy", "/api/v1/old", "read"))
+	assert.False(t, allowed("group:eng", "/api/v1/deploys", "create"))
+	roles, err := testStore.Roles().List(ctx, store.RoleQuery{TenantID: "acme"})
+	require.NoError(t, err)
+	assert.Len(t, roles.Items, 1)
+	assert.Empty(t, importBundle("mode=replace", production).Changes)
+
+	assert.Equal(t, http.StatusBadRequest,
+		do(testTenantToken(t, "admin", "acme"), "POST", "/bundle?mode=overwrite", "application/yaml", production).Code)
+}
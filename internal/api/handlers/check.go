@@ -0,0 +1,108 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/knakul853/accessmesh/internal/services"
+	"github.com/knakul853/accessmesh/internal/store"
+	"github.com/knakul853/accessmesh/pkg/abac"
+	"github.com/knakul853/accessmesh/pkg/auth"
+	"github.com/knakul853/accessmesh/pkg/enforcer"
+)
+
+// The Casbin permission that lets a role check the access of other users of
+// its tenant.
+const (
+	ChecksResource = "checks"
+	ChecksAction   = "evaluate"
+)
+
+// CheckHandler answers access checks for services enforcing AccessMesh
+// policies, including the conditions of attribute-based ones.
+type CheckHandler struct {
+	users    store.UserRepository
+	enforcer *enforcer.Enforcer
+	access   *services.Access
+}
+
+// CheckRequest asks whether the caller, or the user named by UserID, may
+// perform Action on Resource. Attributes are the resource.* attributes the
+// caller knows.
+type CheckRequest struct {
+	UserID     string                 `json:"user_id"`
+	Resource   string                 `json:"resource" binding:"required"`
+	Action     string                 `json:"action" binding:"required"`
+	Attributes map[string]interface{} `json:"attributes"`
+}
+
+func NewCheckHandler(users store.UserRepository, enforcer *enforcer.Enforcer, access *services.Access) *CheckHandler {
+	return &CheckHandler{users: users, enforcer: enforcer, access: access}
+}
+
+// Check decides a CheckRequest. Checking another user takes the
+// checks/evaluate permission, and the user must belong to the caller's
+// tenant.
+func (h *CheckHandler) Check(c *gin.Context) {
+	claims, err := auth.ValidateToken(c.GetHeader("Authorization"))
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid token"})
+		return
+	}
+
+	var req CheckRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	now := time.Now()
+	access := services.AccessRequest{
+		UserID:     claims.Subject,
+		Roles:      claims.RoleNames(),
+		TenantID:   claims.Domain(),
+		Resource:   req.Resource,
+		Action:     req.Action,
+		Attributes: req.Attributes,
+		IP:         c.ClientIP(),
+		Time:       now,
+	}
+	if req.UserID != "" && req.UserID != claims.Subject {
+		allowed, err := h.enforcer.EnforceUser(claims.Subject, claims.RoleNames(), claims.Domain(), ChecksResource, ChecksAction)
+		if err != nil {
+			log.Printf("Error enforcing check permission: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
+			return
+		}
+		if !allowed {
+			c.JSON(http.StatusForbidden, gin.H{"error": "access denied"})
+			return
+		}
+
+		user, err := h.users.Get(c.Request.Context(), req.UserID)
+		if err == nil {
+			err = scopeOf(c).check(user.TenantID)
+		}
+		if err != nil {
+			writeUserError(c, err)
+			return
+		}
+		access.UserID = req.UserID
+		access.Roles = user.ActiveRoles(now)
+		access.TenantID = user.TenantID
+	}
+
+	decision, err := h.access.Check(c.Request.Context(), access)
+	switch {
+	case errors.Is(err, abac.ErrInvalidAttributes):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case err != nil:
+		log.Printf("Error checking access: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to check access"})
+	default:
+		c.JSON(http.StatusOK, decision)
+	}
+}
@@ -0,0 +1,133 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/knakul853/accessmesh/internal/api/middleware"
+	"github.com/knakul853/accessmesh/internal/models"
+	"github.com/knakul853/accessmesh/internal/services"
+	"github.com/knakul853/accessmesh/internal/store"
+	"github.com/knakul853/accessmesh/pkg/abac"
+	"github.com/knakul853/accessmesh/pkg/auth"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckHandler(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	ctx := context.Background()
+	testStore := store.NewMemoryStore()
+	e := newTestEnforcer(t)
+
+	require.NoError(t, testStore.Tenants().Create(ctx, &models.Tenant{ID: "acme", Name: "Acme", CreatedAt: time.Now()}))
+	require.NoError(t, testStore.Roles().Create(ctx, &models.Role{TenantID: "acme", Name: "analyst"}))
+	for _, tenant := range []string{"acme", "globex"} {
+		_, err := e.AddPolicy("auditor", tenant, ChecksResource, ChecksAction)
+		require.NoError(t, err)
+	}
+
+	schema := &abac.Schema{
+		Subject:  map[string]abac.Type{"department": abac.TypeString, "clearance": abac.TypeNumber},
+		Resource: map[string]abac.Type{"department": abac.TypeString, "classification": abac.TypeNumber},
+	}
+	access := services.NewAccess(testStore, e, schema)
+	access.RegisterProvider("/reports/secret", abac.ProviderFunc(
+		func(ctx context.Context, tenant, resource string) (map[string]interface{}, error) {
+			return map[string]interface{}{"classification": 5}, nil
+		}))
+	access.RegisterProvider("/reports/broken", abac.ProviderFunc(
+		func(ctx context.Context, tenant, resource string) (map[string]interface{}, error) {
+			return map[string]interface{}{"owner": "ann"}, nil
+		}))
+
+	analyst := &models.User{TenantID: "acme", Username: "ann", Roles: models.AssignRoles("analyst")}
+	require.NoError(t, testStore.Users().Create(ctx, analyst))
+
+	policies := NewPolicyHandler(testStore.Policies(), testStore.Roles(), testStore.Groups(), e, schema, services.NewHistory(testStore, e))
+	checks := NewCheckHandler(testStore.Users(), e, access)
+	router := gin.New()
+	router.Use(middleware.TenantScope(e))
+	router.POST("/policies", policies.Create)
+	router.PUT("/users/:id", UpdateUser(testStore.Users(), testStore.Roles(), schema))
+	router.POST("/check", checks.Check)
+
+	admin := testTenantToken(t, "admin", "acme")
+	ann, err := auth.GenerateUserToken(analyst.ID.Hex(), []string{"analyst"}, "acme")
+	require.NoError(t, err)
+	do := func(token, method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+	check := func(token, body string) services.Decision {
+		w := do(token, "POST", "/check", body)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		var decision services.Decision
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &decision))
+		return decision
+	}
+
+	// Expressions are type-checked against the schema when written.
+	for _, expression := range []string{
+		`subject.department == 3`,
+		`subject.salary > 10`,
+		`subject.department ==`,
+	} {
+		body, _ := json.Marshal(map[string]interface{}{
+			"role": "analyst", "resource": "/reports", "action": "read",
+			"conditions": map[string]string{"expression": expression},
+		})
+		assert.Equal(t, http.StatusBadRequest, do(admin, "POST", "/policies", string(body)).Code, expression)
+	}
+	for _, resource := range []string{"/reports", "/reports/secret", "/reports/broken"} {
+		body, _ := json.Marshal(map[string]interface{}{
+			"role": "analyst", "resource": resource, "action": "read",
+			"conditions": map[string]string{"expression": `subject.department == resource.department && subject.clearance >= resource.classification`},
+		})
+		w := do(admin, "POST", "/policies", string(body))
+		require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	}
+
+	// Conditional policies have no plain Casbin rule.
+	allowed, err := e.Enforce("analyst", "acme", "/reports", "read")
+	require.NoError(t, err)
+	assert.False(t, allowed)
+
+	request := `{"resource": "/reports", "action": "read", "attributes": {"department": "finance", "classification": 2}}`
+	assert.False(t, check(ann, request).Allowed, "the user has no attributes yet")
+
+	assert.Equal(t, http.StatusBadRequest, do(admin, "PUT", "/users/"+analyst.ID.Hex(),
+		`{"username": "ann", "roles": [{"role": "analyst"}], "attributes": {"clearance": "top"}}`).Code)
+	require.Equal(t, http.StatusOK, do(admin, "PUT", "/users/"+analyst.ID.Hex(),
+		`{"username": "ann", "roles": [{"role": "analyst"}], "attributes": {"department": "finance", "clearance": 3}}`).Code)
+
+	decision := check(ann, request)
+	assert.True(t, decision.Allowed)
+	assert.NotEmpty(t, decision.PolicyID)
+	assert.False(t, check(ann, `{"resource": "/reports", "action": "read", "attributes": {"department": "legal", "classification": 2}}`).Allowed)
+	assert.False(t, check(ann, `{"resource": "/reports", "action": "write", "attributes": {"department": "finance", "classification": 2}}`).Allowed)
+	assert.Equal(t, http.StatusBadRequest,
+		do(ann, "POST", "/check", `{"resource": "/reports", "action": "read", "attributes": {"owner": "ann"}}`).Code)
+
+	// The provider's attributes win over the caller's.
+	assert.False(t, check(ann, `{"resource": "/reports/secret", "action": "read", "attributes": {"department": "finance", "classification": 1}}`).Allowed)
+	// Their attributes must match the schema as well.
+	assert.Equal(t, http.StatusInternalServerError,
+		do(ann, "POST", "/check", `{"resource": "/reports/broken", "action": "read", "attributes": {"department": "finance"}}`).Code)
+
+	// Checking someone else takes checks/evaluate.
+	other := `{"user_id": "` + analyst.ID.Hex() + `", "resource": "/reports", "action": "read", "attributes": {"department": "finance", "classification": 2}}`
+	assert.Equal(t, http.StatusForbidden, do(testTenantToken(t, "clerk", "acme"), "POST", "/check", other).Code)
+	assert.True(t, check(testTenantToken(t, "auditor", "acme"), other).Allowed)
+	assert.Equal(t, http.StatusNotFound, do(testTenantToken(t, "auditor", "globex"), "POST", "/check", other).Code)
+}
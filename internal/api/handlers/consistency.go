@@ -0,0 +1,61 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/knakul853/accessmesh/internal/services"
+	"github.com/knakul853/accessmesh/pkg/auth"
+	"github.com/knakul853/accessmesh/pkg/enforcer"
+)
+
+// Casbin object/action a role must be granted explicitly to run the
+// consistency check.
+const (
+	ConsistencyResource = "consistency"
+	ConsistencyAction   = "read"
+)
+
+type ConsistencyHandler struct {
+	integrity *services.RoleIntegrity
+	enforcer  *enforcer.Enforcer
+}
+
+func NewConsistencyHandler(integrity *services.RoleIntegrity, enforcer *enforcer.Enforcer) *ConsistencyHandler {
+	return &ConsistencyHandler{
+		integrity: integrity,
+		enforcer:  enforcer,
+	}
+}
+
+// Check reports users, policies and enforcer rules of the caller's tenant
+// that name a role which does not exist. Super admins check every tenant, or
+// the one given by the tenant query parameter.
+func (h *ConsistencyHandler) Check(c *gin.Context) {
+	caller, err := auth.ValidateToken(c.GetHeader("Authorization"))
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid token"})
+		return
+	}
+
+	allowed, err := h.enforcer.EnforceUser(caller.Subject, caller.RoleNames(), caller.Domain(), ConsistencyResource, ConsistencyAction)
+	if err != nil {
+		log.Printf("Error enforcing consistency check permission: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
+		return
+	}
+	if !allowed {
+		log.Printf("Consistency check denied for roles %v", caller.RoleNames())
+		c.JSON(http.StatusForbidden, gin.H{"error": "access denied"})
+		return
+	}
+
+	report, err := h.integrity.Orphans(c.Request.Context(), scopeOf(c).listTenant(c))
+	if err != nil {
+		log.Printf("Error checking consistency: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to check consistency"})
+		return
+	}
+	c.JSON(http.StatusOK, report)
+}
@@ -0,0 +1,268 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/knakul853/accessmesh/internal/models"
+	"github.com/knakul853/accessmesh/internal/services"
+	"github.com/knakul853/accessmesh/internal/store"
+	"github.com/knakul853/accessmesh/pkg/auth"
+	"github.com/knakul853/accessmesh/pkg/enforcer"
+)
+
+// The Casbin permission that lets a role approve, deny and revoke the
+// elevations of its tenant.
+const (
+	ElevationsResource = "elevations"
+	ElevationsAction   = "approve"
+)
+
+// ElevationHandler lets users request temporary roles and approvers decide
+// on the requests.
+type ElevationHandler struct {
+	store      store.Store
+	enforcer   *enforcer.Enforcer
+	elevations *services.Elevations
+}
+
+type ElevationRequest struct {
+	Role          string `json:"role" binding:"required"`
+	Hours         int    `json:"hours" binding:"required"`
+	Justification string `json:"justification" binding:"required"`
+}
+
+// ElevationDecision carries an optional note explaining an approval, denial
+// or revocation.
+type ElevationDecision struct {
+	Note string `json:"note"`
+}
+
+func NewElevationHandler(store store.Store, enforcer *enforcer.Enforcer, elevations *services.Elevations) *ElevationHandler {
+	return &ElevationHandler{store: store, enforcer: enforcer, elevations: elevations}
+}
+
+// Request asks for the caller to hold a role of their tenant for a number of
+// hours.
+func (h *ElevationHandler) Request(c *gin.Context) {
+	caller, ok := h.caller(c)
+	if !ok {
+		return
+	}
+
+	var req ElevationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	elevation := models.Elevation{
+		TenantID:      caller.Domain(),
+		UserID:        caller.Subject,
+		Role:          req.Role,
+		Hours:         req.Hours,
+		Justification: req.Justification,
+	}
+	if err := h.elevations.Request(c.Request.Context(), &elevation); err != nil {
+		writeElevationError(c, err, "failed to request elevation")
+		return
+	}
+
+	setETag(c, elevation.Version)
+	c.JSON(http.StatusCreated, elevation)
+}
+
+// List returns a page of elevations. Approvers see those of the tenant and
+// may filter by user_id; everyone else only sees their own. Both may filter
+// by role and status.
+func (h *ElevationHandler) List(c *gin.Context) {
+	caller, ok := h.caller(c)
+	if !ok {
+		return
+	}
+	opts, err := listOptions(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	query := store.ElevationQuery{
+		ListOptions: opts,
+		TenantID:    scopeOf(c).listTenant(c),
+		UserID:      c.Query("user_id"),
+		Role:        c.Query("role"),
+		Status:      c.Query("status"),
+	}
+	approver, err := h.isApprover(caller)
+	if err != nil {
+		log.Printf("Error enforcing elevation permission: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
+		return
+	}
+	if !approver {
+		query.UserID = caller.Subject
+	}
+
+	page, err := h.store.Elevations().List(c.Request.Context(), query)
+	if err != nil {
+		log.Printf("Error listing elevations: %v", err)
+		writeListError(c, err, "failed to list elevations")
+		return
+	}
+	writePage(c, page)
+}
+
+// Get returns an elevation of the caller, or of the tenant to approvers.
+func (h *ElevationHandler) Get(c *gin.Context) {
+	caller, ok := h.caller(c)
+	if !ok {
+		return
+	}
+	elevation, err := h.get(c)
+	if err != nil {
+		writeElevationError(c, err, "failed to get elevation")
+		return
+	}
+	if elevation.UserID != caller.Subject && !h.requireApprover(c, caller) {
+		return
+	}
+
+	setETag(c, elevation.Version)
+	c.JSON(http.StatusOK, elevation)
+}
+
+// Approve grants a pending elevation for its hours, starting now.
+func (h *ElevationHandler) Approve(c *gin.Context) {
+	h.decide(c, true, func(ctx context.Context, elevation *models.Elevation, caller *auth.Claims, note string) error {
+		return h.elevations.Approve(ctx, elevation, caller.Subject, caller.RoleNames(), note)
+	})
+}
+
+// Deny turns a pending elevation down.
+func (h *ElevationHandler) Deny(c *gin.Context) {
+	h.decide(c, true, func(ctx context.Context, elevation *models.Elevation, caller *auth.Claims, note string) error {
+		return h.elevations.Deny(ctx, elevation, caller.Subject, note)
+	})
+}
+
+// Revoke ends an approved elevation early. Users may revoke their own.
+func (h *ElevationHandler) Revoke(c *gin.Context) {
+	h.decide(c, false, func(ctx context.Context, elevation *models.Elevation, caller *auth.Claims, note string) error {
+		return h.elevations.Revoke(ctx, elevation, caller.Subject, note)
+	})
+}
+
+// decide loads the elevation, checks that the caller may act on it and
+// If-Match, and applies the step. Approvers may always act, and the
+// elevation's own user too unless approverOnly is set.
+func (h *ElevationHandler) decide(c *gin.Context, approverOnly bool,
+	step func(ctx context.Context, elevation *models.Elevation, caller *auth.Claims, note string) error,
+) {
+	caller, ok := h.caller(c)
+	if !ok {
+		return
+	}
+
+	var req ElevationDecision
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	elevation, err := h.get(c)
+	if err != nil {
+		writeElevationError(c, err, "failed to update elevation")
+		return
+	}
+	if (approverOnly || elevation.UserID != caller.Subject) && !h.requireApprover(c, caller) {
+		return
+	}
+	if !checkIfMatch(c, elevation.Version) {
+		return
+	}
+
+	if err := step(c.Request.Context(), elevation, caller, req.Note); err != nil {
+		writeElevationError(c, err, "failed to update elevation")
+		return
+	}
+
+	setETag(c, elevation.Version)
+	c.JSON(http.StatusOK, elevation)
+}
+
+// caller returns the claims of the user making the request, responding 401
+// or 403 for tokens that do not name a user or that impersonate one.
+func (h *ElevationHandler) caller(c *gin.Context) (*auth.Claims, bool) {
+	claims, err := auth.ValidateToken(c.GetHeader("Authorization"))
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid token"})
+		return nil, false
+	}
+	if claims.Subject == "" {
+		c.JSON(http.StatusForbidden, gin.H{"error": "token does not identify a user"})
+		return nil, false
+	}
+	if claims.IsImpersonated() {
+		c.JSON(http.StatusForbidden, gin.H{"error": "elevations cannot be handled from an impersonated session"})
+		return nil, false
+	}
+	return claims, true
+}
+
+// isApprover reports whether the caller may decide on elevations.
+func (h *ElevationHandler) isApprover(caller *auth.Claims) (bool, error) {
+	return h.enforcer.EnforceUser(caller.Subject, caller.RoleNames(), caller.Domain(), ElevationsResource, ElevationsAction)
+}
+
+// requireApprover responds 403 unless the caller may decide on elevations.
+func (h *ElevationHandler) requireApprover(c *gin.Context, caller *auth.Claims) bool {
+	approver, err := h.isApprover(caller)
+	if err != nil {
+		log.Printf("Error enforcing elevation permission: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
+		return false
+	}
+	if !approver {
+		c.JSON(http.StatusForbidden, gin.H{"error": "access denied"})
+		return false
+	}
+	return true
+}
+
+// get loads the elevation named in the URL if it belongs to the caller's
+// tenant.
+func (h *ElevationHandler) get(c *gin.Context) (*models.Elevation, error) {
+	elevation, err := h.store.Elevations().Get(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		return nil, err
+	}
+	if err := scopeOf(c).check(elevation.TenantID); err != nil {
+		return nil, err
+	}
+	return elevation, nil
+}
+
+func writeElevationError(c *gin.Context, err error, message string) {
+	switch {
+	case errors.Is(err, store.ErrInvalidID):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid elevation ID"})
+	case errors.Is(err, store.ErrNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "elevation not found"})
+	case errors.Is(err, store.ErrVersionConflict):
+		writeVersionConflict(c)
+	case errors.Is(err, services.ErrElevationHours), errors.Is(err, services.ErrUnknownRole):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrElevationOpen), errors.Is(err, services.ErrElevationState):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrSelfDecision), errors.Is(err, services.ErrElevationNotCovered):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	default:
+		log.Printf("Error handling elevation: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": message})
+	}
+}
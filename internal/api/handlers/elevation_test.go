@@ -0,0 +1,274 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/casbin/casbin/v2"
+	"github.com/casbin/casbin/v2/model"
+	"github.com/gin-gonic/gin"
+	"github.com/knakul853/accessmesh/internal/api/middleware"
+	"github.com/knakul853/accessmesh/internal/models"
+	"github.com/knakul853/accessmesh/internal/services"
+	"github.com/knakul853/accessmesh/internal/store"
+	"github.com/knakul853/accessmesh/pkg/enforcer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestElevationHandler(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	ctx := context.Background()
+	testStore := store.NewMemoryStore()
+	e := newTestEnforcer(t)
+
+	require.NoError(t, testStore.Tenants().Create(ctx, &models.Tenant{ID: "acme", Name: "Acme", CreatedAt: time.Now()}))
+	require.NoError(t, testStore.Roles().Create(ctx, &models.Role{TenantID: "acme", Name: "dba"}))
+	_, err := e.AddPolicy("dba", "acme", "/api/v1/db", "GET")
+	require.NoError(t, err)
+	_, err = e.AddPolicy("lead", "acme", ElevationsResource, ElevationsAction)
+	require.NoError(t, err)
+	_, err = e.AddPolicy("auditor", "acme", ElevationsResource, ElevationsAction)
+	require.NoError(t, err)
+	_, err = e.AddPolicy("lead", "acme", "/api/v1/db", "GET")
+	require.NoError(t, err)
+
+	elevations := services.NewElevations(testStore, e, 8*time.Hour)
+	handler := NewElevationHandler(testStore, e, elevations)
+	router := gin.New()
+	router.Use(middleware.TenantScope(e))
+	router.POST("/elevations", handler.Request)
+	router.GET("/elevations", handler.List)
+	router.GET("/elevations/:id", handler.Get)
+	router.POST("/elevations/:id/approve", handler.Approve)
+	router.POST("/elevations/:id/deny", handler.Deny)
+	router.POST("/elevations/:id/revoke", handler.Revoke)
+
+	clerk := testTenantToken(t, "clerk", "acme")
+	lead := testTenantToken(t, "lead", "acme")
+	auditor := testTenantToken(t, "auditor", "acme")
+	do := func(token, method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+	decode := func(w *httptest.ResponseRecorder) *models.Elevation {
+		var elevation models.Elevation
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &elevation))
+		return &elevation
+	}
+	request := func() *models.Elevation {
+		w := do(clerk, "POST", "/elevations", `{"role": "dba", "hours": 2, "justification": "fix the orders table"}`)
+		require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+		return decode(w)
+	}
+	canReadDB := func() bool {
+		ok, err := e.EnforceUser("clerk-1", []string{"clerk"}, "acme", "/api/v1/db", "GET")
+		require.NoError(t, err)
+		return ok
+	}
+
+	elevation := request()
+	assert.Equal(t, models.ElevationPending, elevation.Status)
+	assert.Equal(t, "clerk-1", elevation.UserID)
+	assert.Equal(t, "acme", elevation.TenantID)
+
+	assert.Equal(t, http.StatusConflict,
+		do(clerk, "POST", "/elevations", `{"role": "dba", "hours": 1, "justification": "again"}`).Code)
+	assert.Equal(t, http.StatusBadRequest,
+		do(clerk, "POST", "/elevations", `{"role": "ghost", "hours": 1, "justification": "x"}`).Code)
+	assert.Equal(t, http.StatusBadRequest,
+		do(clerk, "POST", "/elevations", `{"role": "dba", "hours": 9, "justification": "x"}`).Code)
+
+	// Only approvers decide, and never on their own requests.
+	path := "/elevations/" + elevation.ID.Hex()
+	assert.Equal(t, http.StatusForbidden, do(clerk, "POST", path+"/approve", "").Code)
+	assert.False(t, canReadDB())
+
+	// Approvers cannot hand out privileges they lack themselves.
+	w := do(auditor, "POST", path+"/approve", "")
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Contains(t, w.Body.String(), "privileges you do not hold")
+	assert.False(t, canReadDB())
+
+	w = do(lead, "POST", path+"/approve", `{"note": "go ahead"}`)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	approved := decode(w)
+	assert.Equal(t, models.ElevationApproved, approved.Status)
+	assert.Equal(t, "lead-1", approved.DecidedBy)
+	require.NotNil(t, approved.ExpiresAt)
+	assert.WithinDuration(t, time.Now().Add(2*time.Hour), *approved.ExpiresAt, time.Minute)
+	assert.True(t, canReadDB(), "the role applies without a new token")
+	assert.Equal(t, http.StatusConflict, do(lead, "POST", path+"/approve", "").Code)
+
+	// Users only see their own elevations.
+	require.NoError(t, testStore.Elevations().Create(ctx, &models.Elevation{
+		TenantID: "acme", UserID: "other-1", Role: "dba", Hours: 1, Status: models.ElevationPending,
+	}))
+	var page []models.Elevation
+	require.NoError(t, json.Unmarshal(do(clerk, "GET", "/elevations", "").Body.Bytes(), &page))
+	assert.Len(t, page, 1)
+	require.NoError(t, json.Unmarshal(do(lead, "GET", "/elevations?status=pending", "").Body.Bytes(), &page))
+	require.Len(t, page, 1)
+	assert.Equal(t, "other-1", page[0].UserID)
+	assert.Equal(t, http.StatusForbidden, do(clerk, "GET", "/elevations/"+page[0].ID.Hex(), "").Code)
+
+	// The expiry job takes the role away once the elevation runs out.
+	stored, err := testStore.Elevations().Get(ctx, elevation.ID.Hex())
+	require.NoError(t, err)
+	past := time.Now().Add(-time.Second)
+	stored.ExpiresAt = &past
+	require.NoError(t, testStore.Elevations().Update(ctx, stored))
+	ended, err := elevations.ExpireOnce(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, ended)
+	assert.False(t, canReadDB())
+	w = do(clerk, "GET", path, "")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, models.ElevationExpired, decode(w).Status)
+
+	// Users may end their own elevation early.
+	elevation = request()
+	path = "/elevations/" + elevation.ID.Hex()
+	require.Equal(t, http.StatusOK, do(lead, "POST", path+"/approve", "").Code)
+	assert.True(t, canReadDB())
+	w = do(clerk, "POST", path+"/revoke", `{"note": "done"}`)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, models.ElevationRevoked, decode(w).Status)
+	assert.False(t, canReadDB())
+
+	elevation = request()
+	w = do(lead, "POST", "/elevations/"+elevation.ID.Hex()+"/deny", `{"note": "use the replica"}`)
+	require.Equal(t, http.StatusOK, w.Code)
+	denied := decode(w)
+	assert.Equal(t, models.ElevationDenied, denied.Status)
+	assert.Equal(t, "use the replica", denied.Note)
+	assert.Nil(t, denied.ExpiresAt)
+	assert.False(t, canReadDB())
+}
+
+// failingAdapter refuses to store grouping rules while fail is set.
+type failingAdapter struct {
+	*enforcer.MemoryAdapter
+	fail bool
+}
+
+func (a *failingAdapter) AddPolicy(sec, ptype string, rule []string) error {
+	if a.fail && sec == "g" {
+		return errors.New("adapter unavailable")
+	}
+	return a.MemoryAdapter.AddPolicy(sec, ptype, rule)
+}
+
+func TestElevations_ApproveFailures(t *testing.T) {
+	ctx := context.Background()
+	testStore := store.NewMemoryStore()
+
+	conf, err := os.ReadFile("../../../model.conf")
+	require.NoError(t, err)
+	m, err := model.NewModelFromString(string(conf))
+	require.NoError(t, err)
+	adapter := &failingAdapter{MemoryAdapter: enforcer.NewMemoryAdapter()}
+	synced, err := casbin.NewSyncedEnforcer(m, adapter)
+	require.NoError(t, err)
+	e := &enforcer.Enforcer{SyncedEnforcer: synced}
+	_, err = e.AddPolicy("dba", "acme", "/api/v1/db", "GET")
+	require.NoError(t, err)
+	require.NoError(t, testStore.Roles().Create(ctx, &models.Role{TenantID: "acme", Name: "dba"}))
+	lead := []string{"dba"}
+
+	elevations := services.NewElevations(testStore, e, 8*time.Hour)
+	elevation := &models.Elevation{TenantID: "acme", UserID: "clerk-1", Role: "dba", Hours: 1}
+	require.NoError(t, elevations.Request(ctx, elevation))
+	canReadDB := func() bool {
+		ok, err := e.EnforceUser("clerk-1", []string{"clerk"}, "acme", "/api/v1/db", "GET")
+		require.NoError(t, err)
+		return ok
+	}
+	stored := func() *models.Elevation {
+		stored, err := testStore.Elevations().Get(ctx, elevation.ID.Hex())
+		require.NoError(t, err)
+		return stored
+	}
+
+	// An elevation whose role could not be granted goes back to pending.
+	adapter.fail = true
+	failed := stored()
+	assert.Error(t, elevations.Approve(ctx, failed, "lead-1", lead, ""))
+	assert.Equal(t, models.ElevationPending, failed.Status)
+	assert.Equal(t, models.ElevationPending, stored().Status)
+	assert.Nil(t, stored().ExpiresAt)
+	assert.False(t, canReadDB())
+
+	// An approval that cannot be recorded grants nothing.
+	adapter.fail = false
+	stale := stored()
+	changed := stored()
+	changed.Note = "edited elsewhere"
+	require.NoError(t, testStore.Elevations().Update(ctx, changed))
+	assert.ErrorIs(t, elevations.Approve(ctx, stale, "lead-1", lead, ""), store.ErrVersionConflict)
+	assert.Equal(t, models.ElevationPending, stored().Status)
+	assert.False(t, canReadDB())
+
+	require.NoError(t, elevations.Approve(ctx, stored(), "lead-1", lead, ""))
+	assert.Equal(t, models.ElevationApproved, stored().Status)
+	assert.True(t, canReadDB())
+}
+
+func TestElevations_ConcurrentApprovals(t *testing.T) {
+	ctx := context.Background()
+	testStore := store.NewMemoryStore()
+	e := newTestEnforcer(t)
+	_, err := e.AddPolicy("dba", "acme", "/api/v1/db", "GET")
+	require.NoError(t, err)
+	require.NoError(t, testStore.Roles().Create(ctx, &models.Role{TenantID: "acme", Name: "dba"}))
+	elevations := services.NewElevations(testStore, e, 8*time.Hour)
+
+	for i := 0; i < 20; i++ {
+		elevation := &models.Elevation{TenantID: "acme", UserID: fmt.Sprintf("clerk-%d", i), Role: "dba", Hours: 1}
+		require.NoError(t, elevations.Request(ctx, elevation))
+
+		// Two approvers, or one submitting twice, act on the same version.
+		errs := make([]error, 2)
+		var wg sync.WaitGroup
+		for j := range errs {
+			loaded, err := testStore.Elevations().Get(ctx, elevation.ID.Hex())
+			require.NoError(t, err)
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				errs[j] = elevations.Approve(ctx, loaded, fmt.Sprintf("lead-%d", j), []string{"dba"}, "")
+			}()
+		}
+		wg.Wait()
+
+		succeeded := 0
+		for _, err := range errs {
+			if err == nil {
+				succeeded++
+			} else {
+				assert.ErrorIs(t, err, store.ErrVersionConflict)
+			}
+		}
+		assert.Equal(t, 1, succeeded)
+
+		stored, err := testStore.Elevations().Get(ctx, elevation.ID.Hex())
+		require.NoError(t, err)
+		assert.Equal(t, models.ElevationApproved, stored.Status)
+		ok, err := e.EnforceUser(elevation.UserID, nil, "acme", "/api/v1/db", "GET")
+		require.NoError(t, err)
+		assert.True(t, ok, "the winning approval keeps its role")
+	}
+}
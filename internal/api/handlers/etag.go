@@ -0,0 +1,136 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// MergePatchContentType is the media type of JSON Merge Patch (RFC 7396)
+// bodies. PATCH endpoints also accept plain application/json.
+const MergePatchContentType = "application/merge-patch+json"
+
+var errUnsupportedPatch = errors.New("PATCH body must be " + MergePatchContentType)
+
+// etag formats a document version as a strong entity tag.
+func etag(version int64) string {
+	return `"` + strconv.FormatInt(version, 10) + `"`
+}
+
+func setETag(c *gin.Context, version int64) {
+	c.Header("ETag", etag(version))
+}
+
+// checkIfMatch reports whether the If-Match header, if sent, names the
+// stored version. Otherwise it responds with 412.
+func checkIfMatch(c *gin.Context, version int64) bool {
+	header := c.GetHeader("If-Match")
+	if header == "" || strings.TrimSpace(header) == "*" {
+		return true
+	}
+	for _, tag := range strings.Split(header, ",") {
+		if strings.TrimSpace(tag) == etag(version) {
+			return true
+		}
+	}
+
+	c.JSON(http.StatusPreconditionFailed, gin.H{"error": "resource has been modified; fetch it again and retry"})
+	return false
+}
+
+// writeVersionConflict reports a write that lost a race with another one. It
+// is a failed precondition if the client sent If-Match, and a plain conflict
+// otherwise.
+func writeVersionConflict(c *gin.Context) {
+	status := http.StatusConflict
+	if c.GetHeader("If-Match") != "" {
+		status = http.StatusPreconditionFailed
+	}
+	c.JSON(status, gin.H{"error": "resource has been modified; fetch it again and retry"})
+}
+
+// decodeReplacement reads a full document for PUT.
+func decodeReplacement[T any](c *gin.Context, _ *T) (*T, error) {
+	var doc T
+	if err := c.ShouldBindJSON(&doc); err != nil {
+		return nil, err
+	}
+	return &doc, nil
+}
+
+// decodeMergePatch applies the request body to current as a JSON Merge Patch
+// and returns the patched copy.
+func decodeMergePatch[T any](c *gin.Context, current *T) (*T, error) {
+	if contentType := c.GetHeader("Content-Type"); contentType != "" {
+		mediaType, _, err := mime.ParseMediaType(contentType)
+		if err != nil || (mediaType != MergePatchContentType && mediaType != "application/json") {
+			return nil, errUnsupportedPatch
+		}
+	}
+
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		return nil, err
+	}
+	var patch interface{}
+	if err := json.Unmarshal(body, &patch); err != nil {
+		return nil, err
+	}
+
+	original, err := json.Marshal(current)
+	if err != nil {
+		return nil, err
+	}
+	var doc interface{}
+	if err := json.Unmarshal(original, &doc); err != nil {
+		return nil, err
+	}
+
+	merged, err := json.Marshal(mergePatch(doc, patch))
+	if err != nil {
+		return nil, err
+	}
+	var patched T
+	if err := json.Unmarshal(merged, &patched); err != nil {
+		return nil, err
+	}
+	return &patched, nil
+}
+
+// mergePatch implements the MergePatch algorithm of RFC 7396: objects are
+// merged member by member, null removes a member and anything else replaces
+// the target.
+func mergePatch(target, patch interface{}) interface{} {
+	patchObject, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+	targetObject, ok := target.(map[string]interface{})
+	if !ok {
+		targetObject = map[string]interface{}{}
+	}
+
+	for name, value := range patchObject {
+		if value == nil {
+			delete(targetObject, name)
+			continue
+		}
+		targetObject[name] = mergePatch(targetObject[name], value)
+	}
+	return targetObject
+}
+
+// writeDecodeError reports a body that could not be read or patched.
+func writeDecodeError(c *gin.Context, err error) {
+	if errors.Is(err, errUnsupportedPatch) {
+		c.JSON(http.StatusUnsupportedMediaType, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+}
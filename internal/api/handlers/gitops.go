@@ -0,0 +1,77 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/knakul853/accessmesh/internal/models"
+	"github.com/knakul853/accessmesh/internal/services"
+	"github.com/knakul853/accessmesh/pkg/auth"
+	"github.com/knakul853/accessmesh/pkg/enforcer"
+)
+
+// Casbin object/actions a role of the platform tenant must be granted to see
+// the GitOps status and to sync on demand. GitOps covers every tenant, so
+// other tenants cannot be granted them.
+const (
+	GitOpsResource   = "gitops"
+	GitOpsReadAction = "read"
+	GitOpsSyncAction = "sync"
+)
+
+// GitOpsHandler reports on and triggers syncs of the policy directory.
+type GitOpsHandler struct {
+	enforcer *enforcer.Enforcer
+	gitops   *services.GitOps
+}
+
+func NewGitOpsHandler(enforcer *enforcer.Enforcer, gitops *services.GitOps) *GitOpsHandler {
+	return &GitOpsHandler{enforcer: enforcer, gitops: gitops}
+}
+
+// Status returns the status of the last sync, including drift it reverted.
+func (h *GitOpsHandler) Status(c *gin.Context) {
+	if !h.authorize(c, GitOpsReadAction) {
+		return
+	}
+	c.JSON(http.StatusOK, h.gitops.Status())
+}
+
+// Sync syncs the policy directory now and returns the new status. Invalid
+// policy files fail with 422 and change nothing.
+func (h *GitOpsHandler) Sync(c *gin.Context) {
+	if !h.authorize(c, GitOpsSyncAction) {
+		return
+	}
+	status, err := h.gitops.Sync(c.Request.Context())
+	if err != nil {
+		log.Printf("Error syncing policy directory: %v", err)
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error(), "status": status})
+		return
+	}
+	c.JSON(http.StatusOK, status)
+}
+
+func (h *GitOpsHandler) authorize(c *gin.Context, action string) bool {
+	claims, err := auth.ValidateToken(c.GetHeader("Authorization"))
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid token"})
+		return false
+	}
+
+	allowed := false
+	if claims.Domain() == models.DefaultTenant {
+		allowed, err = h.enforcer.EnforceUser(claims.Subject, claims.RoleNames(), models.DefaultTenant, GitOpsResource, action)
+	}
+	if err != nil {
+		log.Printf("Error enforcing gitops permission: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
+		return false
+	}
+	if !allowed {
+		c.JSON(http.StatusForbidden, gin.H{"error": "access denied"})
+		return false
+	}
+	return true
+}
@@ -0,0 +1,178 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/knakul853/accessmesh/internal/api/middleware"
+	"github.com/knakul853/accessmesh/internal/models"
+	"github.com/knakul853/accessmesh/internal/services"
+	"github.com/knakul853/accessmesh/internal/store"
+	"github.com/knakul853/accessmesh/pkg/abac"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGitOpsHandler(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	e := newTestEnforcer(t)
+	for _, action := range []string{GitOpsReadAction, GitOpsSyncAction} {
+		_, err := e.AddPolicy("admin", models.DefaultTenant, GitOpsResource, action)
+		require.NoError(t, err)
+		_, err = e.AddPolicy("admin", "acme", GitOpsResource, action)
+		require.NoError(t, err)
+	}
+
+	dir := t.TempDir()
+	write := func(name, content string) {
+		require.NoError(t, os.MkdirAll(filepath.Dir(filepath.Join(dir, name)), 0o755))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644))
+	}
+	write(".git/HEAD", "ref: refs/heads/main\n")
+	write(".git/refs/heads/main", "0123456789abcdef0123456789abcdef01234567\n")
+	write(".git/config.yaml", "not: a bundle\n")
+	write("acme/roles.yaml", "version: 1\ntenant: acme\nroles:\n  - name: manager\n")
+	write("acme/policies.csv", "p, manager, acme, /api/v1/orders, read\n")
+	write("README.md", "Policies of every tenant.\n")
+
+	testStore := store.NewMemoryStore()
+	integrity, err := services.NewRoleIntegrity(testStore, e, services.RoleDeleteCascade, "")
+	require.NoError(t, err)
+	gitops := services.NewGitOps(services.NewBundles(testStore, e, integrity, &abac.Schema{}), dir, time.Minute, true)
+	handler := NewGitOpsHandler(e, gitops)
+	router := gin.New()
+	router.GET("/gitops", handler.Status)
+	router.POST("/gitops/sync", handler.Sync)
+	router.POST("/policies", middleware.WriteLock(gitops.Locked, "locked"), func(c *gin.Context) { c.Status(http.StatusCreated) })
+	router.GET("/policies", middleware.WriteLock(gitops.Locked, "locked"), func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	do := func(token, method, path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+	admin := testToken(t, "admin")
+	sync := func() *services.GitOpsStatus {
+		w := do(admin, "POST", "/gitops/sync")
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		var status services.GitOpsStatus
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &status))
+		return &status
+	}
+	allowed := func(role, action string) bool {
+		ok, err := e.Enforce(role, "acme", "/api/v1/orders", action)
+		require.NoError(t, err)
+		return ok
+	}
+
+	// GitOps spans tenants, so only the platform tenant may use it.
+	assert.Equal(t, http.StatusForbidden, do(testTenantToken(t, "admin", "acme"), "GET", "/gitops").Code)
+
+	status := sync()
+	assert.True(t, status.Locked)
+	assert.Equal(t, "0123456789abcdef0123456789abcdef01234567", status.Commit)
+	require.Contains(t, status.Tenants, "acme")
+	assert.Equal(t, []string{filepath.Join("acme", "policies.csv"), filepath.Join("acme", "roles.yaml")}, status.Tenants["acme"].Files)
+	assert.Len(t, status.Tenants["acme"].Applied, 2)
+	assert.Empty(t, status.Tenants["acme"].Drift)
+	assert.True(t, allowed("manager", "read"))
+
+	// An edit made elsewhere is reverted and reported as drift.
+	ctx := context.Background()
+	extra := &models.Policy{TenantID: "acme", Role: "manager", Resource: "/api/v1/orders", Action: "delete"}
+	require.NoError(t, testStore.Policies().Create(ctx, extra))
+	require.NoError(t, e.Grant(extra))
+	status = sync()
+	if assert.Len(t, status.Tenants["acme"].Drift, 1) {
+		assert.Equal(t, services.BundleChange{
+			Kind: services.BundleKindPolicy, Name: "role:manager /api/v1/orders delete", Op: "delete",
+			Changes: []models.FieldChange{
+				{Field: "action", From: "delete"},
+				{Field: "resource", From: "/api/v1/orders"},
+				{Field: "role", From: "manager"},
+			},
+		}, status.Tenants["acme"].Drift[0])
+	}
+	assert.False(t, allowed("manager", "delete"))
+
+	// Invalid files change nothing.
+	write("acme/extra.yaml", "version: 1\ntenant: acme\npolicies:\n  - role: ghost\n    resource: /api/v1/orders\n    action: write\n")
+	w := do(admin, "POST", "/gitops/sync")
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+	assert.Contains(t, w.Body.String(), `unknown role`)
+	assert.True(t, allowed("manager", "read"))
+	assert.False(t, allowed("ghost", "write"))
+
+	w = do(admin, "GET", "/gitops")
+	require.Equal(t, http.StatusOK, w.Code)
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), status))
+	assert.NotEmpty(t, status.LastError)
+
+	// New files are applied, not reported as drift.
+	require.NoError(t, os.Remove(filepath.Join(dir, "acme/extra.yaml")))
+	write("acme/policies.csv", "p, manager, acme, /api/v1/orders, write\n")
+	status = sync()
+	assert.Empty(t, status.LastError)
+	assert.Len(t, status.Tenants["acme"].Applied, 2)
+	assert.True(t, allowed("manager", "write"))
+	assert.False(t, allowed("manager", "read"))
+
+	assert.Equal(t, http.StatusLocked, do(admin, "POST", "/policies").Code)
+	assert.Equal(t, http.StatusOK, do(admin, "GET", "/policies").Code)
+}
+
+func TestGitOpsWriteLock(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	ctx := context.Background()
+	e := newTestEnforcer(t)
+	testStore := store.NewMemoryStore()
+	require.NoError(t, testStore.Roles().Create(ctx, &models.Role{Name: "manager"}))
+	alice := &models.User{Username: "alice"}
+	require.NoError(t, testStore.Users().Create(ctx, alice))
+	ops := &models.Group{Name: "ops"}
+	require.NoError(t, testStore.Groups().Create(ctx, ops))
+
+	integrity, err := services.NewRoleIntegrity(testStore, e, services.RoleDeleteCascade, "")
+	require.NoError(t, err)
+	gitops := services.NewGitOps(services.NewBundles(testStore, e, integrity, &abac.Schema{}), t.TempDir(), time.Minute, true)
+	policies := NewPolicyHandler(testStore.Policies(), testStore.Roles(), testStore.Groups(), e, &abac.Schema{}, services.NewHistory(testStore, e))
+	groups := NewGroupHandler(testStore, e)
+
+	// Wired as in the API routes.
+	writeLock := middleware.WriteLock(gitops.Locked, "locked")
+	router := gin.New()
+	router.Use(middleware.TenantScope(e))
+	router.POST("/policies", writeLock, policies.Create)
+	router.GET("/policies", writeLock, policies.List)
+	router.POST("/groups/:id/members", groups.AddMember)
+	router.DELETE("/groups/:id/members/:user_id", groups.RemoveMember)
+
+	admin := testToken(t, "admin")
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+admin)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+	createPolicy := func() int {
+		return do("POST", "/policies", `{"role": "manager", "resource": "/api/v1/orders", "action": "read"}`).Code
+	}
+
+	assert.Equal(t, http.StatusLocked, createPolicy())
+	assert.Equal(t, http.StatusOK, do("GET", "/policies", "").Code)
+	members := "/groups/" + ops.ID.Hex() + "/members"
+	require.Equal(t, http.StatusOK, do("POST", members, `{"user_id": "`+alice.ID.Hex()+`"}`).Code)
+	require.Equal(t, http.StatusOK, do("DELETE", members+"/"+alice.ID.Hex(), "").Code)
+}
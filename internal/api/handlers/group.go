@@ -0,0 +1,350 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/knakul853/accessmesh/internal/models"
+	"github.com/knakul853/accessmesh/internal/services"
+	"github.com/knakul853/accessmesh/internal/store"
+	"github.com/knakul853/accessmesh/pkg/enforcer"
+)
+
+// GroupHandler manages groups and their membership, and keeps the enforcer's
+// grouping rules in step with the live groups.
+type GroupHandler struct {
+	store    store.Store
+	enforcer *enforcer.Enforcer
+}
+
+type GroupMemberRequest struct {
+	UserID string `json:"user_id" binding:"required"`
+}
+
+type SubgroupRequest struct {
+	GroupID string `json:"group_id" binding:"required"`
+}
+
+func NewGroupHandler(store store.Store, enforcer *enforcer.Enforcer) *GroupHandler {
+	return &GroupHandler{store: store, enforcer: enforcer}
+}
+
+func (h *GroupHandler) Create(c *gin.Context) {
+	var group models.Group
+	if err := c.ShouldBindJSON(&group); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	group.TenantID = scopeOf(c).assign(group.TenantID)
+	if !h.check(c, nil, &group) {
+		return
+	}
+
+	group.CreatedAt = time.Now()
+	group.UpdatedAt = group.CreatedAt
+	if err := h.store.Groups().Create(c.Request.Context(), &group); err != nil {
+		log.Printf("Error creating group: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create group"})
+		return
+	}
+	if err := h.enforcer.SyncGroup(nil, &group); err != nil {
+		log.Printf("Error applying group %s: %v", group.ID.Hex(), err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to apply group"})
+		return
+	}
+
+	setETag(c, group.Version)
+	c.JSON(http.StatusCreated, group)
+}
+
+// List returns a page of groups, optionally only those with a given member,
+// subgroup or role.
+func (h *GroupHandler) List(c *gin.Context) {
+	opts, err := listOptions(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	page, err := h.store.Groups().List(c.Request.Context(), store.GroupQuery{
+		ListOptions: opts,
+		TenantID:    scopeOf(c).listTenant(c),
+		Name:        c.Query("name"),
+		Member:      c.Query("member"),
+		Subgroup:    c.Query("subgroup"),
+		Role:        c.Query("role"),
+	})
+	if err != nil {
+		log.Printf("Error listing groups: %v", err)
+		writeListError(c, err, "failed to list groups")
+		return
+	}
+
+	writePage(c, page)
+}
+
+func (h *GroupHandler) Get(c *gin.Context) {
+	group, err := h.get(c)
+	if err != nil {
+		writeGroupError(c, err, "failed to get group")
+		return
+	}
+	setETag(c, group.Version)
+	c.JSON(http.StatusOK, group)
+}
+
+// Update replaces the group's name, description, roles, members and
+// subgroups.
+func (h *GroupHandler) Update(c *gin.Context) {
+	h.save(c, decodeReplacement[models.Group])
+}
+
+// Patch applies a JSON Merge Patch to the group.
+func (h *GroupHandler) Patch(c *gin.Context) {
+	h.save(c, decodeMergePatch[models.Group])
+}
+
+// save loads the group, checks If-Match, and writes the editable fields of
+// the decoded request back under the loaded version.
+func (h *GroupHandler) save(c *gin.Context, decode func(*gin.Context, *models.Group) (*models.Group, error)) {
+	existing, err := h.get(c)
+	if err != nil {
+		writeGroupError(c, err, "failed to update group")
+		return
+	}
+	if !checkIfMatch(c, existing.Version) {
+		return
+	}
+
+	group, err := decode(c, existing)
+	if err != nil {
+		writeDecodeError(c, err)
+		return
+	}
+
+	previous := snapshotGroup(existing)
+	existing.Name = group.Name
+	existing.Description = group.Description
+	existing.Roles = group.Roles
+	existing.Members = group.Members
+	existing.Subgroups = group.Subgroups
+	h.update(c, &previous, existing)
+}
+
+// AddMember puts a user of the group's tenant in the group.
+func (h *GroupHandler) AddMember(c *gin.Context) {
+	var req GroupMemberRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	h.edit(c, func(group *models.Group) bool {
+		group.Members = append(group.Members, req.UserID)
+		return true
+	})
+}
+
+// RemoveMember takes a user out of the group.
+func (h *GroupHandler) RemoveMember(c *gin.Context) {
+	h.edit(c, func(group *models.Group) bool {
+		return removeValue(&group.Members, c.Param("user_id"))
+	})
+}
+
+// AddSubgroup nests another group of the tenant in the group, making its
+// members members of the group too.
+func (h *GroupHandler) AddSubgroup(c *gin.Context) {
+	var req SubgroupRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	h.edit(c, func(group *models.Group) bool {
+		group.Subgroups = append(group.Subgroups, req.GroupID)
+		return true
+	})
+}
+
+// RemoveSubgroup stops nesting a group in the group.
+func (h *GroupHandler) RemoveSubgroup(c *gin.Context) {
+	h.edit(c, func(group *models.Group) bool {
+		return removeValue(&group.Subgroups, c.Param("group_id"))
+	})
+}
+
+// edit loads the group, checks If-Match and saves the change made by apply,
+// which reports false if what it was to remove is not there.
+func (h *GroupHandler) edit(c *gin.Context, apply func(*models.Group) bool) {
+	existing, err := h.get(c)
+	if err != nil {
+		writeGroupError(c, err, "failed to update group")
+		return
+	}
+	if !checkIfMatch(c, existing.Version) {
+		return
+	}
+
+	previous := snapshotGroup(existing)
+	if !apply(existing) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "not in group"})
+		return
+	}
+	h.update(c, &previous, existing)
+}
+
+// update checks and stores the group and swaps the rules of the group as it
+// was for its current ones.
+func (h *GroupHandler) update(c *gin.Context, previous, group *models.Group) {
+	if !h.check(c, previous, group) {
+		return
+	}
+	if err := h.store.Groups().Update(c.Request.Context(), group); err != nil {
+		writeGroupError(c, err, "failed to update group")
+		return
+	}
+	if err := h.enforcer.SyncGroup(previous, group); err != nil {
+		log.Printf("Error applying group %s: %v", group.ID.Hex(), err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to apply group"})
+		return
+	}
+
+	setETag(c, group.Version)
+	c.JSON(http.StatusOK, group)
+}
+
+// Delete moves the group to the trash. Its members lose what the group
+// granted them.
+func (h *GroupHandler) Delete(c *gin.Context) {
+	existing, err := h.get(c)
+	if err != nil {
+		writeGroupError(c, err, "failed to delete group")
+		return
+	}
+	if !checkIfMatch(c, existing.Version) {
+		return
+	}
+
+	if err := h.store.Groups().SoftDelete(c.Request.Context(), c.Param("id"), existing.Version, deletedBy(c)); err != nil {
+		writeGroupError(c, err, "failed to delete group")
+		return
+	}
+	if err := h.enforcer.SyncGroup(existing, nil); err != nil {
+		log.Printf("Error revoking group %s: %v", existing.ID.Hex(), err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to revoke group"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "group deleted"})
+}
+
+// Restore takes the group out of the trash and applies it again.
+func (h *GroupHandler) Restore(c *gin.Context) {
+	if err := h.store.Groups().Restore(c.Request.Context(), c.Param("id"), scopeOf(c).restoreTenant()); err != nil {
+		writeGroupError(c, err, "failed to restore group")
+		return
+	}
+
+	group, err := h.store.Groups().Get(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		writeGroupError(c, err, "failed to restore group")
+		return
+	}
+	if err := h.enforcer.SyncGroup(nil, group); err != nil {
+		log.Printf("Error applying group %s: %v", group.ID.Hex(), err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to apply group"})
+		return
+	}
+
+	setETag(c, group.Version)
+	c.JSON(http.StatusOK, group)
+}
+
+// get loads the group named in the URL if it belongs to the caller's tenant.
+func (h *GroupHandler) get(c *gin.Context) (*models.Group, error) {
+	group, err := h.store.Groups().Get(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		return nil, err
+	}
+	if err := scopeOf(c).check(group.TenantID); err != nil {
+		return nil, err
+	}
+	return group, nil
+}
+
+// check drops duplicate references from the group and responds with an
+// error unless it has a name and services.CheckGroup accepts it.
+func (h *GroupHandler) check(c *gin.Context, previous, group *models.Group) bool {
+	group.Name = strings.TrimSpace(group.Name)
+	if group.Name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "name is required"})
+		return false
+	}
+	group.Roles = distinct(group.Roles)
+	group.Members = distinct(group.Members)
+	group.Subgroups = distinct(group.Subgroups)
+
+	err := services.CheckGroup(c.Request.Context(), h.store, previous, group)
+	switch {
+	case errors.Is(err, services.ErrUnknownUser), errors.Is(err, services.ErrUnknownGroup),
+		errors.Is(err, services.ErrUnknownRole):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return false
+	case errors.Is(err, services.ErrGroupCycle):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return false
+	case err != nil:
+		log.Printf("Error checking group %s: %v", group.Name, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to check group"})
+		return false
+	}
+	return true
+}
+
+// snapshotGroup copies a group so that it is not changed along with the
+// original.
+func snapshotGroup(group *models.Group) models.Group {
+	snapshot := *group
+	snapshot.Roles = slices.Clone(group.Roles)
+	snapshot.Members = slices.Clone(group.Members)
+	snapshot.Subgroups = slices.Clone(group.Subgroups)
+	return snapshot
+}
+
+// distinct returns the non-empty values in order of first appearance.
+func distinct(values []string) []string {
+	out := []string{}
+	for _, v := range values {
+		if v != "" && !slices.Contains(out, v) {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+// removeValue removes value from values and reports whether it was there.
+func removeValue(values *[]string, value string) bool {
+	i := slices.Index(*values, value)
+	if i < 0 {
+		return false
+	}
+	*values = slices.Delete(*values, i, i+1)
+	return true
+}
+
+func writeGroupError(c *gin.Context, err error, message string) {
+	switch {
+	case errors.Is(err, store.ErrInvalidID):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid group ID"})
+	case errors.Is(err, store.ErrNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "group not found"})
+	case errors.Is(err, store.ErrVersionConflict):
+		writeVersionConflict(c)
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": message})
+	}
+}
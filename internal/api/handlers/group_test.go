@@ -0,0 +1,133 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/knakul853/accessmesh/internal/api/middleware"
+	"github.com/knakul853/accessmesh/internal/models"
+	"github.com/knakul853/accessmesh/internal/services"
+	"github.com/knakul853/accessmesh/internal/store"
+	"github.com/knakul853/accessmesh/pkg/abac"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGroupHandler(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	ctx := context.Background()
+	testStore := store.NewMemoryStore()
+	e := newTestEnforcer(t)
+
+	require.NoError(t, testStore.Tenants().Create(ctx, &models.Tenant{ID: "acme", Name: "Acme", CreatedAt: time.Now()}))
+	require.NoError(t, testStore.Roles().Create(ctx, &models.Role{TenantID: "acme", Name: "developer"}))
+	_, err := e.AddPolicy("developer", "acme", "/api/v1/builds", "GET")
+	require.NoError(t, err)
+	alice := &models.User{TenantID: "acme", Username: "alice"}
+	bob := &models.User{TenantID: "acme", Username: "bob"}
+	outsider := &models.User{Username: "eve"}
+	for _, user := range []*models.User{alice, bob, outsider} {
+		require.NoError(t, testStore.Users().Create(ctx, user))
+	}
+
+	integrity, err := services.NewRoleIntegrity(testStore, e, services.RoleDeleteCascade, "")
+	require.NoError(t, err)
+	groups := NewGroupHandler(testStore, e)
+	policies := NewPolicyHandler(testStore.Policies(), testStore.Roles(), testStore.Groups(), e, &abac.Schema{}, services.NewHistory(testStore, e))
+	roles := NewRoleHandler(testStore.Roles(), testStore.Policies(), e, integrity, services.NewHistory(testStore, e))
+	router := gin.New()
+	router.Use(middleware.TenantScope(e))
+	router.POST("/groups", groups.Create)
+	router.GET("/groups", groups.List)
+	router.PATCH("/groups/:id", groups.Patch)
+	router.DELETE("/groups/:id", groups.Delete)
+	router.POST("/groups/:id/restore", groups.Restore)
+	router.POST("/groups/:id/members", groups.AddMember)
+	router.DELETE("/groups/:id/members/:user_id", groups.RemoveMember)
+	router.POST("/groups/:id/subgroups", groups.AddSubgroup)
+	router.POST("/policies", policies.Create)
+	router.DELETE("/roles/:id", roles.Delete)
+
+	token := testTenantToken(t, "manager", "acme")
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+	create := func(body string) *models.Group {
+		w := do("POST", "/groups", body)
+		require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+		var group models.Group
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &group))
+		return &group
+	}
+	allowed := func(user *models.User, obj, act string) bool {
+		ok, err := e.EnforceUser(user.ID.Hex(), nil, "acme", obj, act)
+		require.NoError(t, err)
+		return ok
+	}
+
+	backend := create(`{"name": "backend", "roles": ["developer", "developer"], "members": ["` + alice.ID.Hex() + `"]}`)
+	assert.Equal(t, "acme", backend.TenantID)
+	assert.Equal(t, []string{"developer"}, backend.Roles, "duplicates are dropped")
+	eng := create(`{"name": "engineering", "subgroups": ["` + backend.ID.Hex() + `"]}`)
+	assert.True(t, allowed(alice, "/api/v1/builds", "GET"))
+	assert.False(t, allowed(bob, "/api/v1/builds", "GET"))
+
+	// References must exist in the tenant.
+	assert.Equal(t, http.StatusBadRequest, do("POST", "/groups", `{"name": "x", "members": ["`+outsider.ID.Hex()+`"]}`).Code)
+	assert.Equal(t, http.StatusBadRequest, do("POST", "/groups", `{"name": "x", "roles": ["admin"]}`).Code)
+	assert.Equal(t, http.StatusBadRequest, do("POST", "/groups", `{"name": "x", "subgroups": ["nope"]}`).Code)
+	assert.Equal(t, http.StatusBadRequest, do("POST", "/groups", `{"name": " "}`).Code)
+
+	// Nesting may not loop back.
+	assert.Equal(t, http.StatusConflict,
+		do("POST", "/groups/"+backend.ID.Hex()+"/subgroups", `{"group_id": "`+eng.ID.Hex()+`"}`).Code)
+	assert.Equal(t, http.StatusConflict,
+		do("POST", "/groups/"+eng.ID.Hex()+"/subgroups", `{"group_id": "`+eng.ID.Hex()+`"}`).Code)
+
+	// Policies can apply to a group and reach the members of its subgroups.
+	assert.Equal(t, http.StatusBadRequest, do("POST", "/policies",
+		`{"role": "developer", "group_id": "`+eng.ID.Hex()+`", "resource": "/api/v1/wiki", "action": "PUT"}`).Code)
+	require.Equal(t, http.StatusCreated, do("POST", "/policies",
+		`{"group_id": "`+eng.ID.Hex()+`", "resource": "/api/v1/wiki", "action": "PUT"}`).Code)
+	assert.True(t, allowed(alice, "/api/v1/wiki", "PUT"))
+
+	w := do("POST", "/groups/"+eng.ID.Hex()+"/members", `{"user_id": "`+bob.ID.Hex()+`"}`)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.True(t, allowed(bob, "/api/v1/wiki", "PUT"))
+	w = do("GET", "/groups?member="+bob.ID.Hex(), "")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "1", w.Header().Get("X-Total-Count"))
+
+	require.Equal(t, http.StatusOK, do("DELETE", "/groups/"+eng.ID.Hex()+"/members/"+bob.ID.Hex(), "").Code)
+	assert.False(t, allowed(bob, "/api/v1/wiki", "PUT"))
+	assert.Equal(t, http.StatusNotFound, do("DELETE", "/groups/"+eng.ID.Hex()+"/members/"+bob.ID.Hex(), "").Code)
+
+	// Trashing a group takes away what it granted, restoring gives it back.
+	require.Equal(t, http.StatusOK, do("DELETE", "/groups/"+backend.ID.Hex(), "").Code)
+	assert.False(t, allowed(alice, "/api/v1/builds", "GET"))
+	assert.False(t, allowed(alice, "/api/v1/wiki", "PUT"))
+	require.Equal(t, http.StatusOK, do("POST", "/groups/"+backend.ID.Hex()+"/restore", "").Code)
+	assert.True(t, allowed(alice, "/api/v1/builds", "GET"))
+
+	// Deleting a role takes it out of the groups holding it.
+	developers, err := testStore.Roles().List(ctx, store.RoleQuery{TenantID: "acme", Name: "developer"})
+	require.NoError(t, err)
+	w = do("DELETE", "/roles/"+developers.Items[0].ID.Hex(), "")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Contains(t, w.Body.String(), `"groups":1`)
+	got, err := testStore.Groups().Get(ctx, backend.ID.Hex())
+	require.NoError(t, err)
+	assert.Empty(t, got.Roles)
+	assert.False(t, allowed(alice, "/api/v1/builds", "GET"))
+}
@@ -0,0 +1,163 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/knakul853/accessmesh/internal/api/middleware"
+	"github.com/knakul853/accessmesh/internal/models"
+	"github.com/knakul853/accessmesh/internal/store"
+	"github.com/knakul853/accessmesh/pkg/auth"
+	"github.com/knakul853/accessmesh/pkg/enforcer"
+)
+
+// Casbin object/action a role must be granted explicitly to impersonate users.
+const (
+	ImpersonationResource = "impersonation"
+	ImpersonationAction   = "create"
+)
+
+type ImpersonationHandler struct {
+	store    store.Store
+	enforcer *enforcer.Enforcer
+}
+
+type ImpersonateRequest struct {
+	UserID string `json:"user_id" binding:"required"`
+	Reason string `json:"reason" binding:"required"`
+}
+
+func NewImpersonationHandler(store store.Store, enforcer *enforcer.Enforcer) *ImpersonationHandler {
+	return &ImpersonationHandler{
+		store:    store,
+		enforcer: enforcer,
+	}
+}
+
+// Impersonate mints a short-lived token for the target user carrying the
+// caller's identity in the act claim.
+func (h *ImpersonationHandler) Impersonate(c *gin.Context) {
+	var req ImpersonateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	caller, err := auth.ValidateToken(c.GetHeader("Authorization"))
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid token"})
+		return
+	}
+
+	if caller.IsImpersonated() {
+		c.JSON(http.StatusForbidden, gin.H{"error": "cannot impersonate from an impersonated session"})
+		return
+	}
+
+	if caller.Subject == "" {
+		c.JSON(http.StatusForbidden, gin.H{"error": "token does not identify a user"})
+		return
+	}
+
+	allowed, err := h.enforcer.EnforceUser(caller.Subject, caller.RoleNames(), caller.Domain(), ImpersonationResource, ImpersonationAction)
+	if err != nil {
+		log.Printf("Error enforcing impersonation permission: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
+		return
+	}
+	if !allowed {
+		log.Printf("Impersonation denied for roles %v", caller.RoleNames())
+		c.JSON(http.StatusForbidden, gin.H{"error": "access denied"})
+		return
+	}
+
+	if req.UserID == caller.Subject {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "cannot impersonate yourself"})
+		return
+	}
+
+	target, err := h.store.Users().Get(c.Request.Context(), req.UserID)
+	if errors.Is(err, store.ErrInvalidID) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user ID"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+		return
+	}
+
+	// Users of other tenants are invisible except to super admins, who
+	// outrank them.
+	covers := true
+	if target.TenantID == caller.Domain() {
+		covers, err = h.covers(caller, target)
+	} else {
+		var superAdmin bool
+		superAdmin, err = middleware.IsSuperAdmin(h.enforcer, caller)
+		if err == nil && !superAdmin {
+			c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+			return
+		}
+	}
+	if err != nil {
+		log.Printf("Error comparing role privileges: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
+		return
+	}
+	if !covers {
+		log.Printf("Roles %v may not impersonate higher-privileged user %s", caller.RoleNames(), target.ID.Hex())
+		c.JSON(http.StatusForbidden, gin.H{"error": "cannot impersonate a user with higher privileges"})
+		return
+	}
+
+	now := time.Now()
+	token, err := auth.GenerateImpersonationToken(target.ID.Hex(), target.ActiveRoles(now), target.TenantID,
+		target.TokenExpiry(now, auth.ImpersonationTTL), auth.Actor{
+			Subject: caller.Subject,
+			Roles:   caller.RoleNames(),
+		})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to generate token"})
+		return
+	}
+
+	err = h.store.AuditLogs().Write(c.Request.Context(), &models.AuditEntry{
+		Event:       models.AuditEventImpersonationStart,
+		SubjectID:   target.ID.Hex(),
+		SubjectRole: strings.Join(target.ActiveRoles(now), ","),
+		ActorID:     caller.Subject,
+		ActorRole:   strings.Join(caller.RoleNames(), ","),
+		ClientIP:    c.ClientIP(),
+		Reason:      req.Reason,
+	})
+	if err != nil {
+		// Never hand out an impersonation token that was not audited.
+		log.Printf("Error writing impersonation audit entry: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to record audit entry"})
+		return
+	}
+
+	target.Password = ""
+	c.JSON(http.StatusOK, AuthResponse{
+		Token: token,
+		User:  *target,
+	})
+}
+
+// covers reports whether the caller holds every privilege the target holds
+// in the target's tenant, counting those either has through groups.
+func (h *ImpersonationHandler) covers(caller *auth.Claims, target *models.User) (bool, error) {
+	actors, err := h.enforcer.Subjects(caller.Subject, caller.RoleNames(), target.TenantID)
+	if err != nil {
+		return false, err
+	}
+	targets, err := h.enforcer.Subjects(target.ID.Hex(), target.ActiveRoles(time.Now()), target.TenantID)
+	if err != nil {
+		return false, err
+	}
+	return h.enforcer.Covers(actors, targets, target.TenantID)
+}
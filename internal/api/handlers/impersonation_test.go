@@ -0,0 +1,73 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/knakul853/accessmesh/internal/models"
+	"github.com/knakul853/accessmesh/internal/store"
+	"github.com/knakul853/accessmesh/pkg/auth"
+	"github.com/knakul853/accessmesh/pkg/enforcer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestImpersonationHandler_CountsGroups(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	ctx := context.Background()
+	testStore := store.NewMemoryStore()
+	e := newTestEnforcer(t)
+	for _, p := range [][]string{
+		{"support", "default", "/api/v1/users", "GET"},
+		{"admin", "default", "/api/v1/users", "DELETE"},
+	} {
+		_, err := e.AddPolicy(p)
+		require.NoError(t, err)
+	}
+
+	alice := &models.User{Username: "alice", Roles: models.AssignRoles("support")}
+	bob := &models.User{Username: "bob", Roles: models.AssignRoles("support")}
+	for _, user := range []*models.User{alice, bob} {
+		require.NoError(t, testStore.Users().Create(ctx, user))
+	}
+
+	// alice may impersonate only as a member of leads, and bob holds admin
+	// only as a member of ops.
+	leads := &models.Group{Name: "leads", Members: []string{alice.ID.Hex()}}
+	ops := &models.Group{Name: "ops", Members: []string{bob.ID.Hex()}, Roles: []string{"admin"}}
+	for _, group := range []*models.Group{leads, ops} {
+		require.NoError(t, testStore.Groups().Create(ctx, group))
+		require.NoError(t, e.SyncGroup(nil, group))
+	}
+	_, err := e.AddPolicy(enforcer.GroupSubject(leads.ID.Hex()), "default", ImpersonationResource, ImpersonationAction)
+	require.NoError(t, err)
+
+	handler := NewImpersonationHandler(testStore, e)
+	router := gin.New()
+	router.POST("/impersonate", handler.Impersonate)
+
+	token, err := auth.GenerateUserToken(alice.ID.Hex(), []string{"support"}, "")
+	require.NoError(t, err)
+	impersonate := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/impersonate",
+			bytes.NewBufferString(`{"user_id": "`+bob.ID.Hex()+`", "reason": "ticket 42"}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := impersonate()
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Contains(t, w.Body.String(), "higher privileges")
+
+	// Without ops bob holds nothing alice lacks.
+	require.NoError(t, e.SyncGroup(ops, nil))
+	w = impersonate()
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+}
@@ -0,0 +1,69 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/knakul853/accessmesh/internal/store"
+)
+
+// Page sizes for list endpoints.
+const (
+	DefaultPageSize = 50
+	MaxPageSize     = 200
+)
+
+// listOptions reads the limit, after, sort, search and deleted query
+// parameters. deleted=true lists the trash instead of live documents.
+func listOptions(c *gin.Context) (store.ListOptions, error) {
+	opts := store.ListOptions{
+		Limit:  DefaultPageSize,
+		After:  c.Query("after"),
+		Sort:   c.Query("sort"),
+		Search: c.Query("search"),
+	}
+
+	if raw := c.Query("limit"); raw != "" {
+		limit, err := strconv.Atoi(raw)
+		if err != nil || limit < 1 || limit > MaxPageSize {
+			return opts, fmt.Errorf("limit must be between 1 and %d", MaxPageSize)
+		}
+		opts.Limit = limit
+	}
+	if raw := c.Query("deleted"); raw != "" {
+		deleted, err := strconv.ParseBool(raw)
+		if err != nil {
+			return opts, errors.New("deleted must be true or false")
+		}
+		opts.Deleted = deleted
+	}
+	return opts, nil
+}
+
+// writePage sends the page items as a plain JSON array. The total and the
+// cursor for the next page travel in headers so existing clients keep working.
+func writePage[T any](c *gin.Context, page *store.Page[T]) {
+	c.Header("X-Total-Count", strconv.FormatInt(page.Total, 10))
+	if page.NextCursor != "" {
+		c.Header("X-Next-Cursor", page.NextCursor)
+
+		query := c.Request.URL.Query()
+		query.Set("after", page.NextCursor)
+		next := url.URL{Path: c.Request.URL.Path, RawQuery: query.Encode()}
+		c.Header("Link", fmt.Sprintf(`<%s>; rel="next"`, next.String()))
+	}
+	c.JSON(http.StatusOK, page.Items)
+}
+
+// writeListError reports a bad query as 400 and anything else as 500.
+func writeListError(c *gin.Context, err error, message string) {
+	if errors.Is(err, store.ErrInvalidQuery) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{"error": message})
+}
@@ -0,0 +1,167 @@
+package handlers
+
+import (
+	"context"
+	"crypto/subtle"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/knakul853/accessmesh/internal/models"
+	"github.com/knakul853/accessmesh/internal/services"
+)
+
+const (
+	magicLinkTTL        = 15 * time.Minute
+	magicLinkNonceName  = "magic_link_nonce"
+	magicLinkCookiePath = "/api/v1/auth/magic-link"
+
+	// At most magicLinkMaxPerWindow links are requested per email in each
+	// magicLinkWindow, whether or not the email belongs to an account.
+	magicLinkWindow       = time.Hour
+	magicLinkMaxPerWindow = 5
+)
+
+type MagicLinkRequest struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+type VerifyMagicLinkRequest struct {
+	Token string `json:"token" binding:"required"`
+}
+
+// RequestMagicLink emails a single-use login link and binds it to the
+// requesting browser through a nonce cookie. Every request gets the same
+// answer, in about the same time, whether or not the email belongs to an
+// account, and is counted against the email's rate limit either way.
+func (h *AuthHandler) RequestMagicLink(c *gin.Context) {
+	var req MagicLinkRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx := c.Request.Context()
+	window := time.Now().Truncate(magicLinkWindow)
+
+	allowed, err := h.store.MagicLinks().RecordRequest(ctx, req.Email, window, magicLinkMaxPerWindow)
+	if err != nil {
+		log.Printf("Error recording magic link request: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create login link"})
+		return
+	}
+	if !allowed {
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "too many login link requests, try again later"})
+		return
+	}
+
+	// Browsers get a nonce whether or not a link is sent; it only matches a
+	// link if one was.
+	nonce, err := services.GenerateToken()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to generate login token"})
+		return
+	}
+	// Looking up the account and mailing the link take time only when the
+	// account exists, so they happen after the response.
+	go h.sendMagicLink(context.WithoutCancel(ctx), req.Email, nonce)
+	setMagicLinkCookie(c, nonce, int(magicLinkTTL.Seconds()))
+	c.JSON(http.StatusOK, gin.H{"message": "if email exists, a login link will be sent"})
+}
+
+// sendMagicLink issues and emails a link bound to nonce if the email
+// belongs to an account. Failures are only logged, so that they do not
+// reveal that the account exists.
+func (h *AuthHandler) sendMagicLink(ctx context.Context, email, nonce string) {
+	user, err := h.store.Users().GetByEmail(ctx, email)
+	if err != nil {
+		return
+	}
+
+	token, err := services.NewToken(magicLinkTTL)
+	if err != nil {
+		log.Printf("Error generating magic link token: %v", err)
+		return
+	}
+
+	link := models.MagicLink{
+		UserID:    user.ID,
+		Email:     user.Email,
+		TokenHash: services.HashToken(token.Token),
+		NonceHash: services.HashToken(nonce),
+		ExpiresAt: token.ExpiresAt,
+		CreatedAt: time.Now(),
+	}
+	if err := h.store.MagicLinks().Create(ctx, &link); err != nil {
+		log.Printf("Error storing magic link: %v", err)
+		return
+	}
+
+	if err := h.emailService.SendMagicLinkEmail(user.Email, token.Token, magicLinkTTL); err != nil {
+		log.Printf("Error sending magic link email: %v", err)
+	}
+}
+
+// VerifyMagicLink exchanges a login link token for a session token. It only
+// succeeds from the browser that requested the link.
+func (h *AuthHandler) VerifyMagicLink(c *gin.Context) {
+	var req VerifyMagicLinkRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx := c.Request.Context()
+
+	link, err := h.store.MagicLinks().GetActive(ctx, services.HashToken(req.Token))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid or expired login link"})
+		return
+	}
+
+	nonce, err := c.Cookie(magicLinkNonceName)
+	if err != nil || subtle.ConstantTimeCompare([]byte(services.HashToken(nonce)), []byte(link.NonceHash)) != 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "login link must be opened in the browser that requested it"})
+		return
+	}
+
+	// Claim the link atomically so concurrent verifications cannot both succeed.
+	if err := h.store.MagicLinks().Claim(ctx, link.ID.Hex()); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid or expired login link"})
+		return
+	}
+
+	user, err := h.store.Users().Get(ctx, link.UserID.Hex())
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid or expired login link"})
+		return
+	}
+
+	// Receiving the link proves ownership of the address.
+	if !user.EmailVerified {
+		user.EmailVerified = true
+		if err := h.store.Users().Update(ctx, user); err != nil {
+			log.Printf("Error marking email verified: %v", err)
+		}
+	}
+
+	token, err := issueUserToken(user)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to generate token"})
+		return
+	}
+
+	setMagicLinkCookie(c, "", -1)
+	user.Password = ""
+
+	c.JSON(http.StatusOK, AuthResponse{
+		Token: token,
+		User:  *user,
+	})
+}
+
+func setMagicLinkCookie(c *gin.Context, value string, maxAge int) {
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(magicLinkNonceName, value, maxAge, magicLinkCookiePath, "", c.Request.TLS != nil, true)
+}
@@ -0,0 +1,46 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/knakul853/accessmesh/internal/models"
+	"github.com/knakul853/accessmesh/internal/services"
+	"github.com/knakul853/accessmesh/internal/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRequestMagicLink_SameAnswerForEveryEmail(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	testStore := store.NewMemoryStore()
+	require.NoError(t, testStore.Users().Create(context.Background(), &models.User{Username: "alice", Email: "alice@example.org"}))
+
+	// Nothing listens on the SMTP port, so sending fails for alice.
+	emailService := services.NewEmailService("127.0.0.1", 1, "user", "password", "noreply@example.org")
+	handler := NewAuthHandler(testStore, emailService, nil)
+	router := gin.New()
+	router.POST("/magic-link", handler.RequestMagicLink)
+
+	request := func(email string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/magic-link", bytes.NewBufferString(`{"email": "`+email+`"}`))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	for _, email := range []string{"alice@example.org", "nobody@example.org"} {
+		for i := 0; i < magicLinkMaxPerWindow; i++ {
+			w := request(email)
+			assert.Equal(t, http.StatusOK, w.Code, email)
+			assert.JSONEq(t, `{"message": "if email exists, a login link will be sent"}`, w.Body.String())
+			assert.Contains(t, w.Header().Get("Set-Cookie"), magicLinkNonceName+"=")
+		}
+		assert.Equal(t, http.StatusTooManyRequests, request(email).Code, email)
+	}
+}
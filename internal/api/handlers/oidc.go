@@ -0,0 +1,126 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/knakul853/accessmesh/internal/authn"
+	"github.com/knakul853/accessmesh/internal/services"
+	"golang.org/x/oauth2"
+)
+
+const (
+	oidcFlowCookie    = "oidc_flow"
+	oidcFlowCookieTTL = 600
+)
+
+type OIDCHandler struct {
+	providers map[string]*authn.OIDCProvider
+}
+
+func NewOIDCHandler(providers map[string]*authn.OIDCProvider) *OIDCHandler {
+	return &OIDCHandler{providers: providers}
+}
+
+func (h *OIDCHandler) provider(c *gin.Context) (*authn.OIDCProvider, bool) {
+	provider, ok := h.providers[c.Param("provider")]
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "unknown identity provider"})
+	}
+	return provider, ok
+}
+
+// Login redirects to the upstream issuer. The state, nonce and PKCE verifier
+// are kept in a short-lived cookie bound to this browser.
+func (h *OIDCHandler) Login(c *gin.Context) {
+	provider, ok := h.provider(c)
+	if !ok {
+		return
+	}
+
+	state, err := services.GenerateToken()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to start login"})
+		return
+	}
+	nonce, err := services.GenerateToken()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to start login"})
+		return
+	}
+	verifier := oauth2.GenerateVerifier()
+
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(oidcFlowCookie, strings.Join([]string{state, nonce, verifier}, "."), oidcFlowCookieTTL,
+		oidcCookiePath(provider), "", c.Request.TLS != nil, true)
+	c.Redirect(http.StatusFound, provider.AuthCodeURL(state, nonce, verifier))
+}
+
+// Callback completes the authorization code flow and issues an AccessMesh token.
+func (h *OIDCHandler) Callback(c *gin.Context) {
+	provider, ok := h.provider(c)
+	if !ok {
+		return
+	}
+
+	if errCode := c.Query("error"); errCode != "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "identity provider returned " + errCode})
+		return
+	}
+
+	flow, err := c.Cookie(oidcFlowCookie)
+	parts := strings.Split(flow, ".")
+	if err != nil || len(parts) != 3 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "login session not found"})
+		return
+	}
+	state, nonce, verifier := parts[0], parts[1], parts[2]
+
+	if !equalTokens(state, c.Query("state")) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid state"})
+		return
+	}
+
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(oidcFlowCookie, "", -1, oidcCookiePath(provider), "", c.Request.TLS != nil, true)
+
+	user, err := provider.Exchange(c.Request.Context(), c.Query("code"), verifier, nonce)
+	if err != nil {
+		log.Printf("OIDC login via %s failed: %v", provider.ID(), err)
+		switch {
+		case errors.Is(err, authn.ErrNoRole), errors.Is(err, authn.ErrAccountConflict), errors.Is(err, authn.ErrUnverifiedEmail):
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		case errors.Is(err, authn.ErrInvalidCredentials):
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid login"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to complete login"})
+		}
+		return
+	}
+
+	token, err := issueUserToken(user)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to generate token"})
+		return
+	}
+
+	user.Password = ""
+	c.JSON(http.StatusOK, AuthResponse{
+		Token: token,
+		User:  *user,
+	})
+}
+
+func oidcCookiePath(provider *authn.OIDCProvider) string {
+	return "/api/v1/auth/oidc/" + provider.ID()
+}
+
+func equalTokens(a, b string) bool {
+	ha, hb := sha256.Sum256([]byte(a)), sha256.Sum256([]byte(b))
+	return subtle.ConstantTimeCompare(ha[:], hb[:]) == 1
+}
@@ -1,21 +1,33 @@
 package handlers
 
 import (
+	"errors"
 	"log"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/knakul853/accessmesh/internal/models"
+	"github.com/knakul853/accessmesh/internal/services"
 	"github.com/knakul853/accessmesh/internal/store"
-	"go.mongodb.org/mongo-driver/bson/primitive"
+	"github.com/knakul853/accessmesh/pkg/abac"
+	"github.com/knakul853/accessmesh/pkg/enforcer"
 )
 
+// PolicyHandler manages stored policies, keeps the enforcer's rules in step
+// with the live ones and records every change in the policy's history.
 type PolicyHandler struct {
-	store *store.MongoStore
+	policies store.PolicyRepository
+	roles    store.RoleRepository
+	groups   store.GroupRepository
+	enforcer *enforcer.Enforcer
+	schema   *abac.Schema
+	history  *services.History
 }
 
-func NewPolicyHandler(store *store.MongoStore) *PolicyHandler {
-	return &PolicyHandler{store: store}
+func NewPolicyHandler(policies store.PolicyRepository, roles store.RoleRepository, groups store.GroupRepository, enforcer *enforcer.Enforcer, schema *abac.Schema, history *services.History) *PolicyHandler {
+	return &PolicyHandler{policies: policies, roles: roles, groups: groups, enforcer: enforcer, schema: schema, history: history}
 }
 
 func (h *PolicyHandler) Create(c *gin.Context) {
@@ -26,97 +38,293 @@ func (h *PolicyHandler) Create(c *gin.Context) {
 		return
 	}
 
-	result, err := h.store.Policies().InsertOne(c.Request.Context(), policy)
-	if err != nil {
+	policy.TenantID = scopeOf(c).assign(policy.TenantID)
+	if !h.checkSubject(c, policy.TenantID, &policy) || !h.checkExpression(c, &policy) {
+		return
+	}
+
+	policy.CreatedAt = time.Now()
+	policy.UpdatedAt = policy.CreatedAt
+	if err := h.policies.Create(recording(c, models.RevisionCreate), &policy); err != nil {
 		log.Printf("Error creating policy: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create policy"})
 		return
 	}
+	if err := h.enforcer.Grant(&policy); err != nil {
+		log.Printf("Error granting policy: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to apply policy"})
+		return
+	}
 
-	policy.ID = result.InsertedID.(primitive.ObjectID)
+	setETag(c, policy.Version)
 	c.JSON(http.StatusCreated, policy)
 }
 
 func (h *PolicyHandler) List(c *gin.Context) {
 	log.Println("Listing policies...")
-	cur, err := h.store.Policies().Find(c.Request.Context(), primitive.D{})
+	opts, err := listOptions(c)
 	if err != nil {
-		log.Printf("Error listing policies: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list policies"})
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
-	defer cur.Close(c.Request.Context())
-	
-	policies := []models.Policy{}
-	if err := cur.All(c.Request.Context(), &policies); err != nil {
-		log.Printf("Error decoding policies: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to decode policies"})
+
+	page, err := h.policies.List(c.Request.Context(), store.PolicyQuery{
+		ListOptions: opts,
+		TenantID:    scopeOf(c).listTenant(c),
+		Role:        c.Query("role"),
+		Group:       c.Query("group_id"),
+		Resource:    c.Query("resource"),
+		Action:      c.Query("action"),
+	})
+	if err != nil {
+		log.Printf("Error listing policies: %v", err)
+		writeListError(c, err, "failed to list policies")
 		return
 	}
 
-	c.JSON(http.StatusOK, policies)
+	writePage(c, page)
 }
 
 func (h *PolicyHandler) Get(c *gin.Context) {
 	log.Println("Getting policy...")
-	id, err := primitive.ObjectIDFromHex(c.Param("id"))
-	if err != nil {
-		log.Printf("Error parsing ID: %v", err)
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid policy ID"})
-		return
-	}
-
-	var policy models.Policy
-	err = h.store.Policies().FindOne(c.Request.Context(), map[string]interface{}{"_id": id}).Decode(&policy)
+	policy, err := h.get(c)
 	if err != nil {
 		log.Printf("Error getting policy: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get policy"})
+		writePolicyError(c, err, "failed to get policy")
 		return
 	}
+	setETag(c, policy.Version)
 	c.JSON(http.StatusOK, policy)
 }
 
-
+// Update replaces the policy's role or group, resource, action and
+// conditions.
 func (h *PolicyHandler) Update(c *gin.Context) {
 	log.Println("Updating policy...")
-	id, err := primitive.ObjectIDFromHex(c.Param("id"))
+	h.save(c, models.RevisionUpdate, decodeReplacement[models.Policy])
+}
+
+// Patch applies a JSON Merge Patch to the policy.
+func (h *PolicyHandler) Patch(c *gin.Context) {
+	log.Println("Patching policy...")
+	h.save(c, models.RevisionUpdate, decodeMergePatch[models.Policy])
+}
+
+// History returns the revisions of the policy, oldest first, each with the
+// fields it changed. It covers trashed and purged policies too.
+func (h *PolicyHandler) History(c *gin.Context) {
+	revisions, err := h.history.Revisions(c.Request.Context(), models.RevisionKindPolicy, c.Param("id"))
 	if err != nil {
-		log.Printf("Error parsing ID: %v", err)
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid policy ID"})
+		log.Printf("Error getting policy history: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get policy history"})
+		return
+	}
+	if len(revisions) == 0 {
+		// A policy from before history was kept has none.
+		if _, err := h.get(c); err != nil {
+			writePolicyError(c, err, "failed to get policy history")
+			return
+		}
+	} else if err := scopeOf(c).check(revisions[0].TenantID); err != nil {
+		writePolicyError(c, err, "failed to get policy history")
 		return
 	}
+	c.JSON(http.StatusOK, revisions)
+}
 
-	var policy models.Policy
-	if err := c.ShouldBindJSON(&policy); err != nil {
-		log.Printf("Error binding JSON: %v", err)
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+// Revert sets the policy's role or group, resource, action and conditions
+// back to those of the revision that produced the version in the URL.
+func (h *PolicyHandler) Revert(c *gin.Context) {
+	log.Println("Reverting policy...")
+	version, err := strconv.ParseInt(c.Param("version"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid version"})
 		return
 	}
+	revision, err := h.history.Revision(c.Request.Context(), models.RevisionKindPolicy, c.Param("id"), version)
+	if errors.Is(err, services.ErrUnknownRevision) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		log.Printf("Error getting policy revision: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to revert policy"})
+		return
+	}
+
+	h.save(c, models.RevisionRevert, func(*gin.Context, *models.Policy) (*models.Policy, error) {
+		return revision.Policy, nil
+	})
+}
 
-	policy.ID = id
-	_, err = h.store.Policies().UpdateOne(c.Request.Context(), map[string]interface{}{"_id": id}, map[string]interface{}{"$set": policy})
+// save loads the policy, checks If-Match, and writes the editable fields of
+// the decoded request back under the loaded version, recording the change as
+// action.
+func (h *PolicyHandler) save(c *gin.Context, action string, decode func(*gin.Context, *models.Policy) (*models.Policy, error)) {
+	existing, err := h.get(c)
 	if err != nil {
+		log.Printf("Error getting policy: %v", err)
+		writePolicyError(c, err, "failed to update policy")
+		return
+	}
+	if !checkIfMatch(c, existing.Version) {
+		return
+	}
+
+	policy, err := decode(c, existing)
+	if err != nil {
+		log.Printf("Error decoding policy: %v", err)
+		writeDecodeError(c, err)
+		return
+	}
+
+	if (policy.Role != existing.Role || policy.Group != existing.Group) &&
+		!h.checkSubject(c, existing.TenantID, policy) {
+		return
+	}
+	if !h.checkExpression(c, policy) {
+		return
+	}
+
+	previous := *existing
+	existing.Role = policy.Role
+	existing.Group = policy.Group
+	existing.Resource = policy.Resource
+	existing.Action = policy.Action
+	existing.Conditions = policy.Conditions
+	if err := h.policies.Update(recording(c, action), existing); err != nil {
 		log.Printf("Error updating policy: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update policy"})
+		writePolicyError(c, err, "failed to update policy")
 		return
 	}
-	c.JSON(http.StatusOK, policy)
+	if err := h.regrant(c, &previous, existing); err != nil {
+		log.Printf("Error applying policy: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to apply policy"})
+		return
+	}
+
+	setETag(c, existing.Version)
+	c.JSON(http.StatusOK, existing)
+}
+
+// get loads the policy named in the URL if it belongs to the caller's tenant.
+func (h *PolicyHandler) get(c *gin.Context) (*models.Policy, error) {
+	policy, err := h.policies.Get(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		return nil, err
+	}
+	if err := scopeOf(c).check(policy.TenantID); err != nil {
+		return nil, err
+	}
+	return policy, nil
+}
+
+// checkSubject responds 400 unless the policy names either a live role or a
+// live group of the tenant.
+func (h *PolicyHandler) checkSubject(c *gin.Context, tenant string, policy *models.Policy) bool {
+	switch {
+	case policy.Role != "" && policy.Group != "":
+		c.JSON(http.StatusBadRequest, gin.H{"error": "a policy applies to either a role or a group"})
+		return false
+	case policy.Group == "":
+		return checkRole(c, h.roles, tenant, policy.Role)
+	}
+
+	err := services.CheckGroupRef(c.Request.Context(), h.groups, tenant, policy.Group)
+	switch {
+	case errors.Is(err, services.ErrUnknownGroup):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return false
+	case err != nil:
+		log.Printf("Error checking group %s: %v", policy.Group, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to check group"})
+		return false
+	}
+	return true
+}
+
+// checkExpression responds 400 unless the policy's expression, if it has
+// one, parses and type-checks against the attribute schema.
+func (h *PolicyHandler) checkExpression(c *gin.Context, policy *models.Policy) bool {
+	if !policy.Conditional() {
+		return true
+	}
+	if _, err := abac.Compile(policy.Conditions.Expression, h.schema); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return false
+	}
+	return true
+}
+
+// regrant swaps the rule of the policy as it was for the rule of the policy as
+// it is now.
+func (h *PolicyHandler) regrant(c *gin.Context, previous, current *models.Policy) error {
+	if err := h.enforcer.Revoke(c.Request.Context(), h.policies, previous); err != nil {
+		return err
+	}
+	return h.enforcer.Grant(current)
 }
 
+// Delete moves the policy to the trash and stops enforcing it.
 func (h *PolicyHandler) Delete(c *gin.Context) {
 	log.Println("Deleting policy...")
-	id, err := primitive.ObjectIDFromHex(c.Param("id"))
+	existing, err := h.get(c)
 	if err != nil {
-		log.Printf("Error parsing ID: %v", err)
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid policy ID"})
+		log.Printf("Error getting policy: %v", err)
+		writePolicyError(c, err, "failed to delete policy")
+		return
+	}
+	if !checkIfMatch(c, existing.Version) {
 		return
 	}
 
-	_, err = h.store.Policies().DeleteOne(c.Request.Context(), map[string]interface{}{"_id": id})
-	if err != nil {
+	if err := h.policies.SoftDelete(recording(c, models.RevisionDelete), c.Param("id"), existing.Version, deletedBy(c)); err != nil {
 		log.Printf("Error deleting policy: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to delete policy"})
+		writePolicyError(c, err, "failed to delete policy")
+		return
+	}
+	if err := h.enforcer.Revoke(c.Request.Context(), h.policies, existing); err != nil {
+		log.Printf("Error revoking policy: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to revoke policy"})
 		return
 	}
 	c.JSON(http.StatusOK, gin.H{"message": "policy deleted"})
 }
+
+// Restore takes the policy out of the trash and enforces it again.
+func (h *PolicyHandler) Restore(c *gin.Context) {
+	log.Println("Restoring policy...")
+	if err := h.policies.Restore(recording(c, models.RevisionRestore), c.Param("id"), scopeOf(c).restoreTenant()); err != nil {
+		log.Printf("Error restoring policy: %v", err)
+		writePolicyError(c, err, "failed to restore policy")
+		return
+	}
+
+	policy, err := h.policies.Get(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		log.Printf("Error getting policy: %v", err)
+		writePolicyError(c, err, "failed to restore policy")
+		return
+	}
+	if err := h.enforcer.Grant(policy); err != nil {
+		log.Printf("Error granting policy: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to apply policy"})
+		return
+	}
+
+	setETag(c, policy.Version)
+	c.JSON(http.StatusOK, policy)
+}
+
+func writePolicyError(c *gin.Context, err error, message string) {
+	switch {
+	case errors.Is(err, store.ErrInvalidID):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid policy ID"})
+	case errors.Is(err, store.ErrNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "policy not found"})
+	case errors.Is(err, store.ErrVersionConflict):
+		writeVersionConflict(c)
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": message})
+	}
+}
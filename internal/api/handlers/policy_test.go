@@ -6,68 +6,56 @@ import (
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"os"
 	"testing"
-	"time"
 
+	"github.com/casbin/casbin/v2"
+	"github.com/casbin/casbin/v2/model"
 	"github.com/gin-gonic/gin"
 	"github.com/knakul853/accessmesh/internal/models"
+	"github.com/knakul853/accessmesh/internal/services"
 	"github.com/knakul853/accessmesh/internal/store"
+	"github.com/knakul853/accessmesh/pkg/abac"
+	"github.com/knakul853/accessmesh/pkg/auth"
+	"github.com/knakul853/accessmesh/pkg/enforcer"
 	"github.com/stretchr/testify/assert"
-	"go.mongodb.org/mongo-driver/mongo"
-	"go.mongodb.org/mongo-driver/mongo/options"
+	"github.com/stretchr/testify/require"
 )
 
-type TestStore struct {
-	*store.MongoStore
-	client *mongo.Client
-}
-
-func setupTestStore(t *testing.T) *TestStore {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
-
-	client, err := mongo.Connect(ctx, options.Client().ApplyURI("mongodb://localhost:27017"))
-	if err != nil {
-		t.Fatalf("Failed to connect to MongoDB: %v", err)
-	}
-
-	// Use a test database
-	db := client.Database("pbac_test")
-
-	// Clean up any existing data
-	err = db.Drop(ctx)
-	if err != nil {
-		t.Fatalf("Failed to drop test database: %v", err)
-	}
+func newTestEnforcer(t *testing.T) *enforcer.Enforcer {
+	t.Helper()
 
-	mongoStore := &store.MongoStore{
-		Client: client,
-		DB:     db,
-	}
+	conf, err := os.ReadFile("../../../model.conf")
+	require.NoError(t, err)
+	m, err := model.NewModelFromString(string(conf))
+	require.NoError(t, err)
+	e, err := casbin.NewSyncedEnforcer(m, enforcer.NewMemoryAdapter())
+	require.NoError(t, err)
+	return &enforcer.Enforcer{SyncedEnforcer: e}
+}
 
-	return &TestStore{
-		MongoStore: mongoStore,
-		client:     client,
-	}
+func testToken(t *testing.T, role string) string {
+	t.Helper()
+	return testTenantToken(t, role, "")
 }
 
-func (ts *TestStore) Cleanup(t *testing.T) {
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
+func testTenantToken(t *testing.T, role, tenant string) string {
+	t.Helper()
 
-	if err := ts.client.Disconnect(ctx); err != nil {
-		t.Errorf("Failed to disconnect from MongoDB: %v", err)
-	}
+	token, err := auth.GenerateUserToken(role+"-1", []string{role}, tenant)
+	require.NoError(t, err)
+	return token
 }
 
 func TestPolicyHandler_Create(t *testing.T) {
 
 	gin.SetMode(gin.TestMode)
 	router := gin.New()
-	testStore := setupTestStore(t)
-	defer testStore.Cleanup(t)
+	testStore := store.NewMemoryStore()
+	require.NoError(t, testStore.Roles().Create(context.Background(), &models.Role{Name: "manager"}))
 
-	handler := NewPolicyHandler(testStore.MongoStore)
+	e := newTestEnforcer(t)
+	handler := NewPolicyHandler(testStore.Policies(), testStore.Roles(), testStore.Groups(), e, &abac.Schema{}, services.NewHistory(testStore, e))
 	router.POST("/policies", handler.Create)
 
 	policy := models.Policy{
@@ -96,4 +84,254 @@ func TestPolicyHandler_Create(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, policy.Role, response.Role)
 	assert.NotEmpty(t, response.ID)
+
+	// Policies must name an existing role.
+	policy.Role = "ghost"
+	body, _ = json.Marshal(policy)
+	req = httptest.NewRequest("POST", "/policies", bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "unknown role")
+}
+
+func TestPolicyHandler_List(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	testStore := store.NewMemoryStore()
+
+	for _, role := range []string{"admin", "manager", "support"} {
+		err := testStore.Policies().Create(context.Background(), &models.Policy{Role: role, Resource: "/api/v1/orders", Action: "read"})
+		assert.NoError(t, err)
+	}
+
+	e := newTestEnforcer(t)
+	handler := NewPolicyHandler(testStore.Policies(), testStore.Roles(), testStore.Groups(), e, &abac.Schema{}, services.NewHistory(testStore, e))
+	router.GET("/policies", handler.List)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/policies?limit=2&sort=-role", nil))
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "3", w.Header().Get("X-Total-Count"))
+	cursor := w.Header().Get("X-Next-Cursor")
+	assert.NotEmpty(t, cursor)
+	assert.Contains(t, w.Header().Get("Link"), `rel="next"`)
+
+	var page []models.Policy
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &page))
+	if assert.Len(t, page, 2) {
+		assert.Equal(t, "support", page[0].Role)
+		assert.Equal(t, "manager", page[1].Role)
+	}
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/policies?limit=2&sort=-role&after="+cursor, nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, w.Header().Get("X-Next-Cursor"))
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &page))
+	if assert.Len(t, page, 1) {
+		assert.Equal(t, "admin", page[0].Role)
+	}
+
+	for _, query := range []string{"limit=0", "limit=500", "sort=conditions", "after=bogus"} {
+		w = httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", "/policies?"+query, nil))
+		assert.Equal(t, http.StatusBadRequest, w.Code, query)
+	}
+}
+
+func TestPolicyHandler_UpdateIfMatch(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	testStore := store.NewMemoryStore()
+	require.NoError(t, testStore.Roles().Create(context.Background(), &models.Role{Name: "manager"}))
+
+	e := newTestEnforcer(t)
+	handler := NewPolicyHandler(testStore.Policies(), testStore.Roles(), testStore.Groups(), e, &abac.Schema{}, services.NewHistory(testStore, e))
+	router.POST("/policies", handler.Create)
+	router.PUT("/policies/:id", handler.Update)
+	router.DELETE("/policies/:id", handler.Delete)
+
+	body, _ := json.Marshal(models.Policy{Role: "manager", Resource: "/api/v1/orders", Action: "read"})
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("POST", "/policies", bytes.NewBuffer(body)))
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.Equal(t, `"1"`, w.Header().Get("ETag"))
+
+	var created models.Policy
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+	assert.False(t, created.CreatedAt.IsZero())
+
+	put := func(ifMatch, action string) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(models.Policy{Role: "manager", Resource: "/api/v1/orders", Action: action})
+		req := httptest.NewRequest("PUT", "/policies/"+created.ID.Hex(), bytes.NewBuffer(body))
+		req.Header.Set("If-Match", ifMatch)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	w = put(`"1"`, "write")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, `"2"`, w.Header().Get("ETag"))
+
+	var updated models.Policy
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &updated))
+	assert.Equal(t, "write", updated.Action)
+	assert.True(t, updated.CreatedAt.Equal(created.CreatedAt))
+
+	// A second editor still holding the first version is turned away.
+	w = put(`"1"`, "delete")
+	assert.Equal(t, http.StatusPreconditionFailed, w.Code)
+
+	req := httptest.NewRequest("DELETE", "/policies/"+created.ID.Hex(), nil)
+	req.Header.Set("If-Match", `"1"`)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusPreconditionFailed, w.Code)
+
+	req.Header.Set("If-Match", `"2"`)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestPolicyHandler_UpdateRevisionFailure(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	testStore := store.NewMemoryStore()
+	ctx := context.Background()
+	require.NoError(t, testStore.Roles().Create(ctx, &models.Role{Name: "manager"}))
+	policy := &models.Policy{Role: "manager", Resource: "/api/v1/orders", Action: "read"}
+	require.NoError(t, testStore.Policies().Create(ctx, policy))
+
+	e := newTestEnforcer(t)
+	require.NoError(t, e.Grant(policy))
+	handler := NewPolicyHandler(testStore.Policies(), testStore.Roles(), testStore.Groups(), e, &abac.Schema{}, services.NewHistory(testStore, e))
+	router.PUT("/policies/:id", handler.Update)
+
+	// A revision for the version the update would produce already exists,
+	// so the update's own revision cannot be written.
+	require.NoError(t, testStore.Revisions().Append(ctx, &models.Revision{
+		Kind: models.RevisionKindPolicy, DocumentID: policy.ID.Hex(), Version: 2, Action: models.RevisionUpdate,
+	}))
+
+	body, _ := json.Marshal(models.Policy{Role: "manager", Resource: "/api/v1/orders", Action: "write"})
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("PUT", "/policies/"+policy.ID.Hex(), bytes.NewBuffer(body)))
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+
+	// The change is not made without its revision.
+	stored, err := testStore.Policies().Get(ctx, policy.ID.Hex())
+	require.NoError(t, err)
+	assert.Equal(t, "read", stored.Action)
+	assert.EqualValues(t, 1, stored.Version)
+	allowed, err := e.Enforce("manager", "default", "/api/v1/orders", "write")
+	require.NoError(t, err)
+	assert.False(t, allowed)
+	recorded, err := testStore.Revisions().List(ctx, models.RevisionKindPolicy, policy.ID.Hex())
+	require.NoError(t, err)
+	assert.Len(t, recorded, 1)
+}
+
+func TestPolicyHandler_Patch(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	testStore := store.NewMemoryStore()
+
+	policy := &models.Policy{
+		Role:     "manager",
+		Resource: "/api/v1/orders",
+		Action:   "read",
+		Conditions: models.PolicyConditions{
+			IPRange:   []string{"10.0.0.0/16"},
+			TimeRange: []string{"08:00-20:00"},
+		},
+	}
+	assert.NoError(t, testStore.Policies().Create(context.Background(), policy))
+
+	e := newTestEnforcer(t)
+	handler := NewPolicyHandler(testStore.Policies(), testStore.Roles(), testStore.Groups(), e, &abac.Schema{}, services.NewHistory(testStore, e))
+	router.PATCH("/policies/:id", handler.Patch)
+
+	patch := func(contentType, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("PATCH", "/policies/"+policy.ID.Hex(), bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", contentType)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := patch("application/merge-patch+json", `{"action": "write", "conditions": {"ip_range": null}, "version": 99}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var patched models.Policy
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &patched))
+	assert.Equal(t, "manager", patched.Role)
+	assert.Equal(t, "write", patched.Action)
+	assert.Empty(t, patched.Conditions.IPRange)
+	assert.Equal(t, []string{"08:00-20:00"}, patched.Conditions.TimeRange)
+	assert.EqualValues(t, 2, patched.Version)
+
+	assert.Equal(t, http.StatusUnsupportedMediaType, patch("text/plain", `{}`).Code)
+	assert.Equal(t, http.StatusBadRequest, patch("application/json", `{`).Code)
+}
+
+func TestPolicyHandler_DeleteRestore(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	testStore := store.NewMemoryStore()
+	require.NoError(t, testStore.Roles().Create(context.Background(), &models.Role{Name: "manager"}))
+	e := newTestEnforcer(t)
+
+	handler := NewPolicyHandler(testStore.Policies(), testStore.Roles(), testStore.Groups(), e, &abac.Schema{}, services.NewHistory(testStore, e))
+	router.POST("/policies", handler.Create)
+	router.GET("/policies", handler.List)
+	router.GET("/policies/:id", handler.Get)
+	router.DELETE("/policies/:id", handler.Delete)
+	router.POST("/policies/:id/restore", handler.Restore)
+
+	token := testToken(t, "admin")
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+	allowed := func() bool {
+		ok, err := e.Enforce("manager", "default", "/api/v1/orders", "read")
+		require.NoError(t, err)
+		return ok
+	}
+
+	w := do("POST", "/policies", `{"role": "manager", "resource": "/api/v1/orders", "action": "read"}`)
+	require.Equal(t, http.StatusCreated, w.Code)
+	var policy models.Policy
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &policy))
+	assert.True(t, allowed())
+
+	w = do("DELETE", "/policies/"+policy.ID.Hex(), "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.False(t, allowed())
+	assert.Equal(t, http.StatusNotFound, do("GET", "/policies/"+policy.ID.Hex(), "").Code)
+
+	w = do("GET", "/policies?deleted=true", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	var trash []models.Policy
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &trash))
+	if assert.Len(t, trash, 1) {
+		assert.Equal(t, "admin-1", trash[0].DeletedBy)
+		assert.NotNil(t, trash[0].DeletedAt)
+	}
+
+	w = do("POST", "/policies/"+policy.ID.Hex()+"/restore", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, `"3"`, w.Header().Get("ETag"))
+	assert.True(t, allowed())
+	assert.Equal(t, http.StatusNotFound, do("POST", "/policies/"+policy.ID.Hex()+"/restore", "").Code)
+	assert.Equal(t, http.StatusBadRequest, do("GET", "/policies?deleted=maybe", "").Code)
 }
@@ -0,0 +1,264 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/knakul853/accessmesh/internal/models"
+	"github.com/knakul853/accessmesh/internal/store"
+	"github.com/knakul853/accessmesh/pkg/auth"
+	"github.com/knakul853/accessmesh/pkg/enforcer"
+	"github.com/knakul853/accessmesh/pkg/rebac"
+)
+
+// The Casbin permissions that let a role read and write the relation tuples
+// of its tenant. Reading covers check, expand and list-objects.
+const (
+	RelationsResource    = "relations"
+	RelationsReadAction  = "read"
+	RelationsWriteAction = "write"
+)
+
+// RelationHandler serves the relation tuples of the caller's tenant and the
+// relationship-based access questions answered from them.
+type RelationHandler struct {
+	enforcer *enforcer.Enforcer
+	engine   *rebac.Engine
+}
+
+// WriteTuplesRequest inserts and deletes tuples, written as
+// "document:42#viewer@user:alice", as one revision.
+type WriteTuplesRequest struct {
+	Writes  []string `json:"writes"`
+	Deletes []string `json:"deletes"`
+}
+
+// RelationCheckRequest asks whether Subject has Relation to Object.
+type RelationCheckRequest struct {
+	Object      string            `json:"object" binding:"required"`
+	Relation    string            `json:"relation" binding:"required"`
+	Subject     string            `json:"subject" binding:"required"`
+	Consistency rebac.Consistency `json:"consistency"`
+}
+
+// ExpandRequest asks for the subjects having Relation to Object.
+type ExpandRequest struct {
+	Object      string            `json:"object" binding:"required"`
+	Relation    string            `json:"relation" binding:"required"`
+	Consistency rebac.Consistency `json:"consistency"`
+}
+
+// ListObjectsRequest asks for the objects of ObjectType that Subject has
+// Relation to.
+type ListObjectsRequest struct {
+	ObjectType  string            `json:"object_type" binding:"required"`
+	Relation    string            `json:"relation" binding:"required"`
+	Subject     string            `json:"subject" binding:"required"`
+	Consistency rebac.Consistency `json:"consistency"`
+}
+
+func NewRelationHandler(enforcer *enforcer.Enforcer, engine *rebac.Engine) *RelationHandler {
+	return &RelationHandler{enforcer: enforcer, engine: engine}
+}
+
+// Write applies a WriteTuplesRequest and returns the consistency token of
+// the revision it created.
+func (h *RelationHandler) Write(c *gin.Context) {
+	if !h.authorize(c, RelationsWriteAction) {
+		return
+	}
+
+	var req WriteTuplesRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if len(req.Writes) == 0 && len(req.Deletes) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "nothing to write"})
+		return
+	}
+	writes, err := parseTuples(req.Writes)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	deletes, err := parseTuples(req.Deletes)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	token, err := h.engine.Write(c.Request.Context(), scopeOf(c).tenant, writes, deletes)
+	if err != nil {
+		writeRelationError(c, err, "failed to write tuples")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"consistency_token": token})
+}
+
+// List returns the tuples matching the object_type, object_id, relation and
+// subject query parameters, at the revision chosen by the
+// at_least_as_fresh or at_exact_snapshot parameter.
+func (h *RelationHandler) List(c *gin.Context) {
+	if !h.authorize(c, RelationsReadAction) {
+		return
+	}
+
+	filter := store.TupleFilter{
+		TenantID:   scopeOf(c).tenant,
+		ObjectType: c.Query("object_type"),
+		ObjectID:   c.Query("object_id"),
+		Relation:   c.Query("relation"),
+	}
+	if raw := c.Query("subject"); raw != "" {
+		subject, err := models.ParseSubject(raw)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		filter.SubjectType, filter.SubjectID, filter.SubjectRelation = subject.Type, subject.ID, subject.Relation
+	}
+	consistency := rebac.Consistency{
+		AtLeastAsFresh:  c.Query("at_least_as_fresh"),
+		AtExactSnapshot: c.Query("at_exact_snapshot"),
+	}
+
+	tuples, token, err := h.engine.Read(c.Request.Context(), filter, consistency)
+	if err != nil {
+		writeRelationError(c, err, "failed to read tuples")
+		return
+	}
+	items := make([]string, len(tuples))
+	for i := range tuples {
+		items[i] = tuples[i].String()
+	}
+	c.JSON(http.StatusOK, gin.H{"tuples": items, "consistency_token": token})
+}
+
+// Check answers a RelationCheckRequest.
+func (h *RelationHandler) Check(c *gin.Context) {
+	if !h.authorize(c, RelationsReadAction) {
+		return
+	}
+
+	var req RelationCheckRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	object, err := models.ParseObject(req.Object)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	subject, err := models.ParseSubject(req.Subject)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	allowed, token, err := h.engine.Check(c.Request.Context(), scopeOf(c).tenant, object, req.Relation, subject, req.Consistency)
+	if err != nil {
+		writeRelationError(c, err, "failed to check relation")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"allowed": allowed, "consistency_token": token})
+}
+
+// Expand answers an ExpandRequest with the relation's userset tree.
+func (h *RelationHandler) Expand(c *gin.Context) {
+	if !h.authorize(c, RelationsReadAction) {
+		return
+	}
+
+	var req ExpandRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	object, err := models.ParseObject(req.Object)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	tree, token, err := h.engine.Expand(c.Request.Context(), scopeOf(c).tenant, object, req.Relation, req.Consistency)
+	if err != nil {
+		writeRelationError(c, err, "failed to expand relation")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"tree": tree, "consistency_token": token})
+}
+
+// ListObjects answers a ListObjectsRequest with the IDs of the objects.
+func (h *RelationHandler) ListObjects(c *gin.Context) {
+	if !h.authorize(c, RelationsReadAction) {
+		return
+	}
+
+	var req ListObjectsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	subject, err := models.ParseSubject(req.Subject)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ids, token, err := h.engine.ListObjects(c.Request.Context(), scopeOf(c).tenant, req.ObjectType, req.Relation, subject, req.Consistency)
+	if err != nil {
+		writeRelationError(c, err, "failed to list objects")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"object_ids": ids, "consistency_token": token})
+}
+
+// authorize responds 401 or 403 unless the caller holds relations/action.
+func (h *RelationHandler) authorize(c *gin.Context, action string) bool {
+	claims, err := auth.ValidateToken(c.GetHeader("Authorization"))
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid token"})
+		return false
+	}
+	allowed, err := h.enforcer.EnforceUser(claims.Subject, claims.RoleNames(), claims.Domain(), RelationsResource, action)
+	if err != nil {
+		log.Printf("Error enforcing relations permission: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
+		return false
+	}
+	if !allowed {
+		c.JSON(http.StatusForbidden, gin.H{"error": "access denied"})
+		return false
+	}
+	return true
+}
+
+func parseTuples(raw []string) ([]models.RelationTuple, error) {
+	tuples := make([]models.RelationTuple, 0, len(raw))
+	for _, r := range raw {
+		tuple, err := models.ParseTuple(r)
+		if err != nil {
+			return nil, err
+		}
+		tuples = append(tuples, tuple)
+	}
+	return tuples, nil
+}
+
+// writeRelationError responds 400 to undeclared tuples and relations, bad
+// consistency tokens and chains of relations too deep to follow, and 500 to
+// anything else.
+func writeRelationError(c *gin.Context, err error, message string) {
+	switch {
+	case errors.Is(err, rebac.ErrInvalidTuple), errors.Is(err, rebac.ErrUnknownRelation),
+		errors.Is(err, rebac.ErrInvalidToken), errors.Is(err, rebac.ErrDepthExceeded):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		log.Printf("Error handling relations: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": message})
+	}
+}
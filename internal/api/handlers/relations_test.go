@@ -0,0 +1,115 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/knakul853/accessmesh/internal/api/middleware"
+	"github.com/knakul853/accessmesh/internal/store"
+	"github.com/knakul853/accessmesh/pkg/rebac"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRelationHandler(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	e := newTestEnforcer(t)
+	for _, tenant := range []string{"acme", "globex"} {
+		for _, action := range []string{RelationsReadAction, RelationsWriteAction} {
+			_, err := e.AddPolicy("editor", tenant, RelationsResource, action)
+			require.NoError(t, err)
+		}
+		_, err := e.AddPolicy("reader", tenant, RelationsResource, RelationsReadAction)
+		require.NoError(t, err)
+	}
+
+	var namespaces rebac.Namespaces
+	require.NoError(t, json.Unmarshal([]byte(`{
+		"user": {},
+		"group": {"relations": {"member": null}},
+		"document": {"relations": {
+			"owner": null,
+			"viewer": {"union": [{"this": true}, {"computed_userset": "owner"}]}}}
+	}`), &namespaces))
+	require.NoError(t, namespaces.Validate())
+	relations := NewRelationHandler(e, rebac.NewEngine(store.NewMemoryStore().Tuples(), namespaces))
+
+	router := gin.New()
+	router.Use(middleware.TenantScope(e))
+	router.POST("/relations/tuples", relations.Write)
+	router.GET("/relations/tuples", relations.List)
+	router.POST("/relations/check", relations.Check)
+	router.POST("/relations/expand", relations.Expand)
+	router.POST("/relations/list-objects", relations.ListObjects)
+
+	do := func(token, method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+	var response struct {
+		Allowed          bool     `json:"allowed"`
+		Tuples           []string `json:"tuples"`
+		ObjectIDs        []string `json:"object_ids"`
+		ConsistencyToken string   `json:"consistency_token"`
+	}
+	decode := func(w *httptest.ResponseRecorder) {
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		response.Allowed, response.Tuples, response.ObjectIDs = false, nil, nil
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	}
+
+	editor := testTenantToken(t, "editor", "acme")
+	reader := testTenantToken(t, "reader", "acme")
+
+	write := `{"writes": ["document:1#owner@user:alice", "document:2#viewer@group:eng#member", "group:eng#member@user:bob"]}`
+	assert.Equal(t, http.StatusForbidden, do(reader, "POST", "/relations/tuples", write).Code)
+	assert.Equal(t, http.StatusBadRequest, do(editor, "POST", "/relations/tuples", `{"writes": ["document:1#owner"]}`).Code)
+	assert.Equal(t, http.StatusBadRequest, do(editor, "POST", "/relations/tuples", `{"writes": ["document:1#reader@user:alice"]}`).Code)
+	assert.Equal(t, http.StatusBadRequest, do(editor, "POST", "/relations/tuples", `{}`).Code)
+	decode(do(editor, "POST", "/relations/tuples", write))
+	granted := response.ConsistencyToken
+	require.NotEmpty(t, granted)
+
+	decode(do(reader, "POST", "/relations/check", `{"object": "document:1", "relation": "viewer", "subject": "user:alice"}`))
+	assert.True(t, response.Allowed)
+	decode(do(reader, "POST", "/relations/check", `{"object": "document:2", "relation": "viewer", "subject": "user:bob"}`))
+	assert.True(t, response.Allowed)
+	assert.Equal(t, granted, response.ConsistencyToken)
+	assert.Equal(t, http.StatusBadRequest,
+		do(reader, "POST", "/relations/check", `{"object": "document:1", "relation": "reader", "subject": "user:alice"}`).Code)
+
+	decode(do(reader, "POST", "/relations/list-objects", `{"object_type": "document", "relation": "viewer", "subject": "user:bob"}`))
+	assert.Equal(t, []string{"2"}, response.ObjectIDs)
+
+	w := do(reader, "POST", "/relations/expand", `{"object": "document:1", "relation": "viewer"}`)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Contains(t, w.Body.String(), `"subjects":["user:alice"]`)
+
+	decode(do(reader, "GET", "/relations/tuples?subject=group:eng%23member", ""))
+	assert.Equal(t, []string{"document:2#viewer@group:eng#member"}, response.Tuples)
+
+	// Revoking, then reading at the snapshot of the grant and after it.
+	decode(do(editor, "POST", "/relations/tuples", `{"deletes": ["group:eng#member@user:bob"]}`))
+	check := `{"object": "document:2", "relation": "viewer", "subject": "user:bob", "consistency": {"%s": "` + granted + `"}}`
+	decode(do(reader, "POST", "/relations/check", fmt.Sprintf(check, "at_exact_snapshot")))
+	assert.True(t, response.Allowed)
+	decode(do(reader, "POST", "/relations/check", fmt.Sprintf(check, "at_least_as_fresh")))
+	assert.False(t, response.Allowed)
+	decode(do(reader, "GET", "/relations/tuples?relation=member&at_exact_snapshot="+granted, ""))
+	assert.Equal(t, []string{"group:eng#member@user:bob"}, response.Tuples)
+
+	// Tuples and tokens belong to a tenant.
+	globex := testTenantToken(t, "reader", "globex")
+	decode(do(globex, "POST", "/relations/check", `{"object": "document:1", "relation": "owner", "subject": "user:alice"}`))
+	assert.False(t, response.Allowed)
+	assert.Equal(t, http.StatusBadRequest, do(globex, "POST", "/relations/check", fmt.Sprintf(check, "at_least_as_fresh")).Code)
+}
@@ -1,129 +1,256 @@
 package handlers
 
 import (
+	"errors"
+	"log"
 	"net/http"
+	"strconv"
 
 	"github.com/gin-gonic/gin"
+	"github.com/knakul853/accessmesh/internal/models"
+	"github.com/knakul853/accessmesh/internal/services"
 	"github.com/knakul853/accessmesh/internal/store"
-	"go.mongodb.org/mongo-driver/bson/primitive"
+	"github.com/knakul853/accessmesh/pkg/enforcer"
 )
 
-type Role struct {
-	ID          primitive.ObjectID `json:"id" bson:"_id,omitempty"`
-	Name        string            `json:"name" bson:"name"`
-	Description string            `json:"description" bson:"description"`
-	Permissions []string          `json:"permissions" bson:"permissions"`
-}
-
+// RoleHandler manages roles. Deleting a role deals with the users, policies
+// and groups still referencing it as configured in integrity. Every change is
+// recorded in the role's history.
 type RoleHandler struct {
-	store *store.MongoStore
+	roles     store.RoleRepository
+	policies  store.PolicyRepository
+	enforcer  *enforcer.Enforcer
+	integrity *services.RoleIntegrity
+	history   *services.History
 }
 
-func NewRoleHandler(store *store.MongoStore) *RoleHandler {
-	return &RoleHandler{store: store}
+func NewRoleHandler(roles store.RoleRepository, policies store.PolicyRepository, enforcer *enforcer.Enforcer, integrity *services.RoleIntegrity, history *services.History) *RoleHandler {
+	return &RoleHandler{roles: roles, policies: policies, enforcer: enforcer, integrity: integrity, history: history}
 }
 
 // Create handles the creation of a new role
 func (h *RoleHandler) Create(c *gin.Context) {
-	var role Role
+	var role models.Role
 	if err := c.ShouldBindJSON(&role); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	// Insert role into database
-	result, err := h.store.Roles().InsertOne(c, role)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create role"})
+	role.TenantID = scopeOf(c).assign(role.TenantID)
+	if err := h.roles.Create(recording(c, models.RevisionCreate), &role); err != nil {
+		writeRoleError(c, err, "Failed to create role")
 		return
 	}
 
-	role.ID = result.InsertedID.(primitive.ObjectID)
+	setETag(c, role.Version)
 	c.JSON(http.StatusCreated, role)
 }
 
-// List returns all roles
+// List returns a page of roles
 func (h *RoleHandler) List(c *gin.Context) {
-	var roles []Role
-	cursor, err := h.store.Roles().Find(c, primitive.D{})
+	opts, err := listOptions(c)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch roles"})
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
-	defer cursor.Close(c)
 
-	if err = cursor.All(c, &roles); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to decode roles"})
+	page, err := h.roles.List(c.Request.Context(), store.RoleQuery{
+		ListOptions: opts,
+		TenantID:    scopeOf(c).listTenant(c),
+	})
+	if err != nil {
+		writeListError(c, err, "Failed to fetch roles")
 		return
 	}
 
-	c.JSON(http.StatusOK, roles)
+	writePage(c, page)
 }
 
 // Get returns a specific role by ID
 func (h *RoleHandler) Get(c *gin.Context) {
-	id, err := primitive.ObjectIDFromHex(c.Param("id"))
+	role, err := h.get(c)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid role ID"})
-		return
-	}
-
-	var role Role
-	if err := h.store.Roles().FindOne(c, primitive.M{"_id": id}).Decode(&role); err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Role not found"})
+		writeRoleError(c, err, "Failed to fetch role")
 		return
 	}
 
+	setETag(c, role.Version)
 	c.JSON(http.StatusOK, role)
 }
 
-// Update modifies an existing role
+// Update replaces the role's name, description and permissions
 func (h *RoleHandler) Update(c *gin.Context) {
-	id, err := primitive.ObjectIDFromHex(c.Param("id"))
+	h.save(c, models.RevisionUpdate, decodeReplacement[models.Role])
+}
+
+// Patch applies a JSON Merge Patch to a role
+func (h *RoleHandler) Patch(c *gin.Context) {
+	h.save(c, models.RevisionUpdate, decodeMergePatch[models.Role])
+}
+
+// History returns the revisions of the role, oldest first, each with the
+// fields it changed
+func (h *RoleHandler) History(c *gin.Context) {
+	revisions, err := h.history.Revisions(c.Request.Context(), models.RevisionKindRole, c.Param("id"))
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid role ID"})
+		log.Printf("Error getting role history: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch role history"})
+		return
+	}
+	if len(revisions) == 0 {
+		// A role from before history was kept has none.
+		if _, err := h.get(c); err != nil {
+			writeRoleError(c, err, "Failed to fetch role history")
+			return
+		}
+	} else if err := scopeOf(c).check(revisions[0].TenantID); err != nil {
+		writeRoleError(c, err, "Failed to fetch role history")
 		return
 	}
+	c.JSON(http.StatusOK, revisions)
+}
 
-	var role Role
-	if err := c.ShouldBindJSON(&role); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+// Revert sets the role's name, description and permissions back to those of
+// the revision that produced the version in the URL
+func (h *RoleHandler) Revert(c *gin.Context) {
+	version, err := strconv.ParseInt(c.Param("version"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid version"})
+		return
+	}
+	revision, err := h.history.Revision(c.Request.Context(), models.RevisionKindRole, c.Param("id"), version)
+	if errors.Is(err, services.ErrUnknownRevision) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		log.Printf("Error getting role revision: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revert role"})
 		return
 	}
 
-	role.ID = id
-	result, err := h.store.Roles().ReplaceOne(c, primitive.M{"_id": id}, role)
+	h.save(c, models.RevisionRevert, func(*gin.Context, *models.Role) (*models.Role, error) {
+		return revision.Role, nil
+	})
+}
+
+// save loads the role, checks If-Match, and writes the editable fields of the
+// decoded request back under the loaded version, recording the change as
+// action.
+func (h *RoleHandler) save(c *gin.Context, action string, decode func(*gin.Context, *models.Role) (*models.Role, error)) {
+	existing, err := h.get(c)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update role"})
+		writeRoleError(c, err, "Failed to update role")
+		return
+	}
+	if !checkIfMatch(c, existing.Version) {
 		return
 	}
 
-	if result.MatchedCount == 0 {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Role not found"})
+	role, err := decode(c, existing)
+	if err != nil {
+		writeDecodeError(c, err)
 		return
 	}
 
-	c.JSON(http.StatusOK, role)
+	existing.Name = role.Name
+	existing.Description = role.Description
+	existing.Permissions = role.Permissions
+	if err := h.roles.Update(recording(c, action), existing); err != nil {
+		writeRoleError(c, err, "Failed to update role")
+		return
+	}
+
+	setETag(c, existing.Version)
+	c.JSON(http.StatusOK, existing)
 }
 
-// Delete removes a role
+// Delete moves a role to the trash, first dealing with the users, policies
+// and groups that reference it according to the role delete mode
 func (h *RoleHandler) Delete(c *gin.Context) {
-	id, err := primitive.ObjectIDFromHex(c.Param("id"))
+	existing, err := h.get(c)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid role ID"})
+		writeRoleError(c, err, "Failed to delete role")
+		return
+	}
+	if !checkIfMatch(c, existing.Version) {
 		return
 	}
 
-	result, err := h.store.Roles().DeleteOne(c, primitive.M{"_id": id})
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete role"})
+	refs, err := h.integrity.DeleteRole(c.Request.Context(), existing, deletedBy(c))
+	switch {
+	case errors.Is(err, services.ErrRoleInUse), errors.Is(err, services.ErrUnknownRole):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "users": refs.Users, "policies": refs.Policies, "groups": refs.Groups})
+		return
+	case err != nil:
+		log.Printf("Error deleting role %s: %v", existing.Name, err)
+		writeRoleError(c, err, "Failed to delete role")
 		return
 	}
 
-	if result.DeletedCount == 0 {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Role not found"})
+	c.JSON(http.StatusOK, gin.H{"message": "Role deleted successfully", "users": refs.Users, "policies": refs.Policies, "groups": refs.Groups})
+}
+
+// Restore takes a role out of the trash and grants its policies again
+func (h *RoleHandler) Restore(c *gin.Context) {
+	if err := h.roles.Restore(recording(c, models.RevisionRestore), c.Param("id"), scopeOf(c).restoreTenant()); err != nil {
+		writeRoleError(c, err, "Failed to restore role")
+		return
+	}
+
+	role, err := h.roles.Get(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		writeRoleError(c, err, "Failed to restore role")
+		return
+	}
+	if err := h.enforcer.GrantRole(c.Request.Context(), h.policies, role.TenantID, role.Name); err != nil {
+		log.Printf("Error granting role %s: %v", role.Name, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to grant role"})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Role deleted successfully"})
+	setETag(c, role.Version)
+	c.JSON(http.StatusOK, role)
+}
+
+// get loads the role named in the URL if it belongs to the caller's tenant.
+func (h *RoleHandler) get(c *gin.Context) (*models.Role, error) {
+	role, err := h.roles.Get(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		return nil, err
+	}
+	if err := scopeOf(c).check(role.TenantID); err != nil {
+		return nil, err
+	}
+	return role, nil
+}
+
+// checkRole responds 400 unless role names a live role of the tenant.
+func checkRole(c *gin.Context, roles store.RoleRepository, tenant, role string) bool {
+	err := services.CheckRole(c.Request.Context(), roles, tenant, role)
+	switch {
+	case errors.Is(err, services.ErrUnknownRole):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return false
+	case err != nil:
+		log.Printf("Error checking role %s: %v", role, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to check role"})
+		return false
+	}
+	return true
+}
+
+func writeRoleError(c *gin.Context, err error, message string) {
+	switch {
+	case errors.Is(err, store.ErrInvalidID):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid role ID"})
+	case errors.Is(err, store.ErrNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Role not found"})
+	case errors.Is(err, store.ErrVersionConflict):
+		writeVersionConflict(c)
+	case errors.Is(err, store.ErrDuplicate):
+		c.JSON(http.StatusConflict, gin.H{"error": "a role with this name already exists"})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": message})
+	}
 }
@@ -0,0 +1,130 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/knakul853/accessmesh/internal/models"
+	"github.com/knakul853/accessmesh/internal/services"
+	"github.com/knakul853/accessmesh/internal/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRoleHandler_DeleteReferenced(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	ctx := context.Background()
+
+	setup := func(t *testing.T, mode string) (store.Store, *gin.Engine, *models.Role) {
+		testStore := store.NewMemoryStore()
+		e := newTestEnforcer(t)
+
+		support := &models.Role{Name: "support"}
+		require.NoError(t, testStore.Roles().Create(ctx, support))
+		require.NoError(t, testStore.Roles().Create(ctx, &models.Role{Name: "viewer"}))
+		require.NoError(t, testStore.Users().Create(ctx, &models.User{Username: "alice", Roles: models.AssignRoles("support")}))
+		policy := &models.Policy{Role: "support", Resource: "/api/v1/orders", Action: "read"}
+		require.NoError(t, testStore.Policies().Create(ctx, policy))
+		require.NoError(t, e.Grant(policy))
+
+		integrity, err := services.NewRoleIntegrity(testStore, e, mode, "viewer")
+		require.NoError(t, err)
+		handler := NewRoleHandler(testStore.Roles(), testStore.Policies(), e, integrity, services.NewHistory(testStore, e))
+
+		router := gin.New()
+		router.DELETE("/roles/:id", handler.Delete)
+		return testStore, router, support
+	}
+	remove := func(router *gin.Engine, role *models.Role) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("DELETE", "/roles/"+role.ID.Hex(), nil))
+		return w
+	}
+
+	t.Run("reject", func(t *testing.T) {
+		testStore, router, support := setup(t, services.RoleDeleteReject)
+
+		w := remove(router, support)
+		assert.Equal(t, http.StatusConflict, w.Code)
+		var body map[string]interface{}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+		assert.EqualValues(t, 1, body["users"])
+		assert.EqualValues(t, 1, body["policies"])
+
+		_, err := testStore.Roles().Get(ctx, support.ID.Hex())
+		assert.NoError(t, err)
+	})
+
+	t.Run("reassign", func(t *testing.T) {
+		testStore, router, support := setup(t, services.RoleDeleteReassign)
+		require.NoError(t, testStore.Users().Create(ctx, &models.User{Username: "bob", Roles: models.AssignRoles("viewer", "support")}))
+
+		assert.Equal(t, http.StatusOK, remove(router, support).Code)
+		user, err := testStore.Users().GetByUsername(ctx, "alice")
+		require.NoError(t, err)
+		assert.Equal(t, models.AssignRoles("viewer"), user.Roles)
+		// A user already holding the fallback is not given it twice.
+		user, err = testStore.Users().GetByUsername(ctx, "bob")
+		require.NoError(t, err)
+		assert.Equal(t, models.AssignRoles("viewer"), user.Roles)
+		policies, err := testStore.Policies().List(ctx, store.PolicyQuery{Role: "viewer"})
+		require.NoError(t, err)
+		assert.EqualValues(t, 1, policies.Total)
+	})
+
+	t.Run("cascade", func(t *testing.T) {
+		testStore, router, support := setup(t, services.RoleDeleteCascade)
+
+		assert.Equal(t, http.StatusOK, remove(router, support).Code)
+		user, err := testStore.Users().GetByUsername(ctx, "alice")
+		require.NoError(t, err)
+		assert.Empty(t, user.Roles)
+		policies, err := testStore.Policies().List(ctx, store.PolicyQuery{})
+		require.NoError(t, err)
+		assert.Zero(t, policies.Total)
+	})
+}
+
+func TestConsistencyHandler(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	ctx := context.Background()
+	testStore := store.NewMemoryStore()
+	e := newTestEnforcer(t)
+	_, err := e.AddPolicy("admin", "default", ConsistencyResource, ConsistencyAction)
+	require.NoError(t, err)
+
+	require.NoError(t, testStore.Roles().Create(ctx, &models.Role{Name: "admin"}))
+	ghost := &models.User{Username: "bob", Roles: models.AssignRoles("ghost")}
+	require.NoError(t, testStore.Users().Create(ctx, ghost))
+	require.NoError(t, testStore.Users().Create(ctx, &models.User{Username: "carol", Roles: models.AssignRoles("admin")}))
+	require.NoError(t, testStore.Policies().Create(ctx, &models.Policy{Role: "ghost", Resource: "/api/v1/orders", Action: "read"}))
+	_, err = e.AddPolicy("ghost", "default", "/api/v1/orders", "read")
+	require.NoError(t, err)
+
+	integrity, err := services.NewRoleIntegrity(testStore, e, services.RoleDeleteReject, "")
+	require.NoError(t, err)
+	router := gin.New()
+	router.GET("/admin/consistency", NewConsistencyHandler(integrity, e).Check)
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/admin/consistency", nil)
+	req.Header.Set("Authorization", "Bearer "+testToken(t, "admin"))
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var report services.OrphanReport
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &report))
+	assert.Equal(t, []services.Orphan{{ID: ghost.ID.Hex(), TenantID: "default", Role: "ghost"}}, report.Users)
+	assert.Len(t, report.Policies, 1)
+	assert.Equal(t, [][]string{{"ghost", "default", "/api/v1/orders", "read"}}, report.Rules)
+
+	w = httptest.NewRecorder()
+	req = httptest.NewRequest("GET", "/admin/consistency", nil)
+	req.Header.Set("Authorization", "Bearer "+testToken(t, "ghost"))
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+}
@@ -0,0 +1,107 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/knakul853/accessmesh/internal/authn"
+)
+
+const samlRequestCookie = "saml_request_id"
+
+type SAMLHandler struct {
+	providers map[string]*authn.SAMLServiceProvider
+}
+
+func NewSAMLHandler(providers map[string]*authn.SAMLServiceProvider) *SAMLHandler {
+	return &SAMLHandler{providers: providers}
+}
+
+func (h *SAMLHandler) provider(c *gin.Context) (*authn.SAMLServiceProvider, bool) {
+	provider, ok := h.providers[c.Param("idp")]
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "unknown identity provider"})
+	}
+	return provider, ok
+}
+
+// Metadata serves the SP metadata document for one identity provider.
+func (h *SAMLHandler) Metadata(c *gin.Context) {
+	provider, ok := h.provider(c)
+	if !ok {
+		return
+	}
+
+	metadata, err := provider.Metadata()
+	if err != nil {
+		log.Printf("Error building SAML metadata: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to build metadata"})
+		return
+	}
+	c.Data(http.StatusOK, "application/samlmetadata+xml", metadata)
+}
+
+// Login starts an SP-initiated login by redirecting to the IdP.
+func (h *SAMLHandler) Login(c *gin.Context) {
+	provider, ok := h.provider(c)
+	if !ok {
+		return
+	}
+
+	redirect, requestID, err := provider.AuthnRequestURL(c.Query("relay_state"))
+	if err != nil {
+		log.Printf("Error creating SAML request: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create login request"})
+		return
+	}
+
+	// The IdP posts back cross-site, so the cookie needs SameSite=None.
+	c.SetSameSite(http.SameSiteNoneMode)
+	c.SetCookie(samlRequestCookie, requestID, 300, samlCookiePath(provider), "", true, true)
+	c.Redirect(http.StatusFound, redirect.String())
+}
+
+// ACS validates the IdP's signed response and issues an AccessMesh token.
+func (h *SAMLHandler) ACS(c *gin.Context) {
+	provider, ok := h.provider(c)
+	if !ok {
+		return
+	}
+
+	var requestIDs []string
+	if requestID, err := c.Cookie(samlRequestCookie); err == nil && requestID != "" {
+		requestIDs = append(requestIDs, requestID)
+	}
+
+	user, err := provider.Authenticate(c.Request.Context(), c.Request, requestIDs)
+	if err != nil {
+		log.Printf("SAML login via %s failed: %v", provider.ID(), err)
+		if errors.Is(err, authn.ErrNoRole) || errors.Is(err, authn.ErrAccountConflict) {
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid SAML response"})
+		return
+	}
+
+	token, err := issueUserToken(user)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to generate token"})
+		return
+	}
+
+	c.SetSameSite(http.SameSiteNoneMode)
+	c.SetCookie(samlRequestCookie, "", -1, samlCookiePath(provider), "", true, true)
+
+	user.Password = ""
+	c.JSON(http.StatusOK, AuthResponse{
+		Token: token,
+		User:  *user,
+	})
+}
+
+func samlCookiePath(provider *authn.SAMLServiceProvider) string {
+	return "/api/v1/auth/saml/" + provider.ID()
+}
@@ -0,0 +1,113 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/knakul853/accessmesh/internal/services"
+	"github.com/knakul853/accessmesh/internal/store"
+)
+
+// SnapshotHandler takes snapshots of a tenant's policies and rolls the
+// tenant's policies back to them.
+type SnapshotHandler struct {
+	snapshots store.SnapshotRepository
+	history   *services.History
+}
+
+type CreateSnapshotRequest struct {
+	TenantID    string `json:"tenant_id"`
+	Description string `json:"description"`
+}
+
+func NewSnapshotHandler(snapshots store.SnapshotRepository, history *services.History) *SnapshotHandler {
+	return &SnapshotHandler{snapshots: snapshots, history: history}
+}
+
+// Create snapshots the live policies of the caller's tenant.
+func (h *SnapshotHandler) Create(c *gin.Context) {
+	var req CreateSnapshotRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	tenant := scopeOf(c).assign(req.TenantID)
+	snapshot, err := h.history.Snapshot(c.Request.Context(), tenant, req.Description, actorOf(c))
+	if err != nil {
+		log.Printf("Error creating policy snapshot: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create snapshot"})
+		return
+	}
+	c.JSON(http.StatusCreated, snapshot)
+}
+
+// List returns the snapshots of the caller's tenant, newest first.
+func (h *SnapshotHandler) List(c *gin.Context) {
+	tenant := scopeOf(c).assign(c.Query("tenant"))
+	snapshots, err := h.snapshots.List(c.Request.Context(), tenant)
+	if err != nil {
+		log.Printf("Error listing policy snapshots: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list snapshots"})
+		return
+	}
+	c.JSON(http.StatusOK, snapshots)
+}
+
+// Get returns a snapshot with the policies it holds.
+func (h *SnapshotHandler) Get(c *gin.Context) {
+	snapshot, err := h.snapshots.Get(c.Request.Context(), c.Param("id"))
+	if err == nil {
+		err = scopeOf(c).check(snapshot.TenantID)
+	}
+	if err != nil {
+		writeSnapshotError(c, err, "failed to get snapshot")
+		return
+	}
+	c.JSON(http.StatusOK, snapshot)
+}
+
+// Rollback makes the snapshot's policies the live policies of its tenant,
+// all at once, and returns the policies it changed as before and after
+// pairs. Policies created since are trashed and trashed ones restored.
+func (h *SnapshotHandler) Rollback(c *gin.Context) {
+	snapshot, err := h.snapshots.Get(c.Request.Context(), c.Param("id"))
+	if err == nil {
+		err = scopeOf(c).check(snapshot.TenantID)
+	}
+	if err != nil {
+		writeSnapshotError(c, err, "failed to roll back")
+		return
+	}
+
+	changes, err := h.history.Rollback(c.Request.Context(), snapshot, actorOf(c))
+	switch {
+	case errors.Is(err, services.ErrUnknownRole), errors.Is(err, services.ErrUnknownGroup):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	case err != nil:
+		log.Printf("Error rolling back to snapshot %s: %v", snapshot.ID.Hex(), err)
+		writeSnapshotError(c, err, "failed to roll back")
+		return
+	}
+
+	if changes == nil {
+		changes = []store.PolicyChange{}
+	}
+	c.JSON(http.StatusOK, gin.H{"changes": changes})
+}
+
+func writeSnapshotError(c *gin.Context, err error, message string) {
+	switch {
+	case errors.Is(err, store.ErrInvalidID):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid snapshot ID"})
+	case errors.Is(err, store.ErrNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "snapshot not found"})
+	case errors.Is(err, store.ErrVersionConflict):
+		c.JSON(http.StatusConflict, gin.H{"error": "policies changed during the rollback, try again"})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": message})
+	}
+}
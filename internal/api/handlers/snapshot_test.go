@@ -0,0 +1,126 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/knakul853/accessmesh/internal/models"
+	"github.com/knakul853/accessmesh/internal/services"
+	"github.com/knakul853/accessmesh/internal/store"
+	"github.com/knakul853/accessmesh/pkg/abac"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPolicyHistoryAndSnapshots(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	testStore := store.NewMemoryStore()
+	manager := &models.Role{Name: "manager"}
+	require.NoError(t, testStore.Roles().Create(context.Background(), manager))
+	require.NoError(t, testStore.Roles().Create(context.Background(), &models.Role{Name: "support"}))
+	e := newTestEnforcer(t)
+	history := services.NewHistory(testStore, e)
+
+	policies := NewPolicyHandler(testStore.Policies(), testStore.Roles(), testStore.Groups(), e, &abac.Schema{}, history)
+	snapshots := NewSnapshotHandler(testStore.Snapshots(), history)
+	router.POST("/policies", policies.Create)
+	router.PATCH("/policies/:id", policies.Patch)
+	router.DELETE("/policies/:id", policies.Delete)
+	router.GET("/policies/:id/history", policies.History)
+	router.POST("/policies/:id/history/:version/restore", policies.Revert)
+	router.POST("/policy-snapshots", snapshots.Create)
+	router.GET("/policy-snapshots", snapshots.List)
+	router.GET("/policy-snapshots/:id", snapshots.Get)
+	router.POST("/policy-snapshots/:id/rollback", snapshots.Rollback)
+
+	token := testToken(t, "admin")
+	do := func(token, method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/merge-patch+json")
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+	allowed := func(role, action string) bool {
+		ok, err := e.Enforce(role, "default", "/api/v1/orders", action)
+		require.NoError(t, err)
+		return ok
+	}
+
+	w := do(token, "POST", "/policies", `{"role": "manager", "resource": "/api/v1/orders", "action": "read"}`)
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	var policy models.Policy
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &policy))
+	path := "/policies/" + policy.ID.Hex()
+
+	w = do(token, "POST", "/policy-snapshots", `{"description": "before the change"}`)
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	var snapshot models.PolicySnapshot
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &snapshot))
+	assert.Len(t, snapshot.Policies, 1)
+
+	require.Equal(t, http.StatusOK, do(token, "PATCH", path, `{"action": "write"}`).Code)
+	w = do(token, "POST", "/policies", `{"role": "support", "resource": "/api/v1/orders", "action": "read"}`)
+	require.Equal(t, http.StatusCreated, w.Code)
+
+	w = do(token, "GET", path+"/history", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	var revisions []models.Revision
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &revisions))
+	require.Len(t, revisions, 2)
+	assert.Equal(t, models.RevisionCreate, revisions[0].Action)
+	assert.Equal(t, "admin-1", revisions[0].Actor)
+	assert.Equal(t, models.RevisionUpdate, revisions[1].Action)
+	assert.Equal(t, []models.FieldChange{{Field: "action", From: "read", To: "write"}}, revisions[1].Changes)
+
+	// Restoring a revision writes it back as a new version.
+	assert.Equal(t, http.StatusNotFound, do(token, "POST", path+"/history/9/restore", "").Code)
+	assert.Equal(t, http.StatusBadRequest, do(token, "POST", path+"/history/one/restore", "").Code)
+	w = do(token, "POST", path+"/history/1/restore", "")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, `"3"`, w.Header().Get("ETag"))
+	assert.True(t, allowed("manager", "read"))
+	assert.False(t, allowed("manager", "write"))
+
+	// Rolling back trashes the policy created since and undoes the edits.
+	require.Equal(t, http.StatusOK, do(token, "PATCH", path, `{"action": "delete"}`).Code)
+	w = do(token, "POST", "/policy-snapshots/"+snapshot.ID.Hex()+"/rollback", "")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var rollback struct {
+		Changes []store.PolicyChange `json:"changes"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &rollback))
+	assert.Len(t, rollback.Changes, 2)
+	assert.True(t, allowed("manager", "read"))
+	assert.False(t, allowed("manager", "delete"))
+	assert.False(t, allowed("support", "read"))
+
+	w = do(token, "GET", path+"/history", "")
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &revisions))
+	assert.Equal(t, models.RevisionRollback, revisions[len(revisions)-1].Action)
+
+	// History outlives the policy, but stays within its tenant.
+	require.Equal(t, http.StatusOK, do(token, "DELETE", path, "").Code)
+	w = do(token, "GET", path+"/history", "")
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &revisions))
+	assert.Equal(t, models.RevisionDelete, revisions[len(revisions)-1].Action)
+	globex := testTenantToken(t, "admin", "globex")
+	assert.Equal(t, http.StatusNotFound, do(globex, "GET", path+"/history", "").Code)
+	assert.Equal(t, http.StatusNotFound, do(globex, "GET", "/policy-snapshots/"+snapshot.ID.Hex(), "").Code)
+	assert.Equal(t, http.StatusNotFound, do(globex, "POST", "/policy-snapshots/"+snapshot.ID.Hex()+"/rollback", "").Code)
+
+	w = do(globex, "GET", "/policy-snapshots", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `[]`, w.Body.String())
+
+	// A snapshot naming a role deleted since cannot be rolled back to.
+	require.NoError(t, testStore.Roles().SoftDelete(context.Background(), manager.ID.Hex(), manager.Version, "admin-1"))
+	assert.Equal(t, http.StatusConflict, do(token, "POST", "/policy-snapshots/"+snapshot.ID.Hex()+"/rollback", "").Code)
+}
@@ -0,0 +1,169 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"regexp"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/knakul853/accessmesh/internal/api/middleware"
+	"github.com/knakul853/accessmesh/internal/models"
+	"github.com/knakul853/accessmesh/internal/store"
+	"github.com/knakul853/accessmesh/pkg/auth"
+)
+
+// tenantIDPattern is what a tenant ID, which doubles as a Casbin domain, may
+// look like.
+var tenantIDPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{0,62}$`)
+
+// tenantScope is the tenant a request works in. Super admins may work in
+// every tenant.
+type tenantScope struct {
+	tenant string
+	all    bool
+}
+
+// scopeOf returns the scope middleware.TenantScope recorded for the request.
+// Without it the caller is confined to the tenant in its token.
+func scopeOf(c *gin.Context) tenantScope {
+	if tenant := c.GetString(middleware.TenantKey); tenant != "" {
+		return tenantScope{tenant: tenant, all: c.GetBool(middleware.AllTenantsKey)}
+	}
+
+	claims, err := auth.ValidateToken(c.GetHeader("Authorization"))
+	if err != nil {
+		return tenantScope{tenant: models.DefaultTenant}
+	}
+	return tenantScope{tenant: claims.Domain()}
+}
+
+// listTenant returns the tenant to list documents of: the caller's own, or
+// for super admins the tenant query parameter, where empty means every
+// tenant.
+func (s tenantScope) listTenant(c *gin.Context) string {
+	if s.all {
+		return c.Query("tenant")
+	}
+	return s.tenant
+}
+
+// check hides documents of other tenants from the caller as ErrNotFound.
+func (s tenantScope) check(tenantID string) error {
+	if s.all || tenantID == s.tenant {
+		return nil
+	}
+	return store.ErrNotFound
+}
+
+// assign returns the tenant a new document goes in: the caller's own, or for
+// super admins the requested one if any.
+func (s tenantScope) assign(requested string) string {
+	if s.all && requested != "" {
+		return requested
+	}
+	return s.tenant
+}
+
+// restoreTenant returns the tenant the caller may restore documents of, with
+// empty meaning any.
+func (s tenantScope) restoreTenant() string {
+	if s.all {
+		return ""
+	}
+	return s.tenant
+}
+
+// TenantHandler manages tenants. Only super admins may create them or see
+// tenants other than their own.
+type TenantHandler struct {
+	tenants store.TenantRepository
+}
+
+func NewTenantHandler(tenants store.TenantRepository) *TenantHandler {
+	return &TenantHandler{tenants: tenants}
+}
+
+type CreateTenantRequest struct {
+	ID   string `json:"id" binding:"required"`
+	Name string `json:"name" binding:"required"`
+}
+
+// Create adds a tenant.
+func (h *TenantHandler) Create(c *gin.Context) {
+	if !scopeOf(c).all {
+		c.JSON(http.StatusForbidden, gin.H{"error": "access denied"})
+		return
+	}
+
+	var req CreateTenantRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !tenantIDPattern.MatchString(req.ID) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "tenant ID must be lowercase letters, digits and dashes"})
+		return
+	}
+
+	tenant := models.Tenant{ID: req.ID, Name: req.Name, CreatedAt: time.Now()}
+	if err := h.tenants.Create(c.Request.Context(), &tenant); err != nil {
+		if errors.Is(err, store.ErrDuplicate) {
+			c.JSON(http.StatusConflict, gin.H{"error": "tenant already exists"})
+			return
+		}
+		log.Printf("Error creating tenant %s: %v", req.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create tenant"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, tenant)
+}
+
+// List returns every tenant to super admins and the caller's own to anyone
+// else.
+func (h *TenantHandler) List(c *gin.Context) {
+	scope := scopeOf(c)
+	if !scope.all {
+		tenant, err := h.tenants.Get(c.Request.Context(), scope.tenant)
+		if err != nil {
+			writeTenantError(c, err, "failed to list tenants")
+			return
+		}
+		c.JSON(http.StatusOK, []models.Tenant{*tenant})
+		return
+	}
+
+	tenants, err := h.tenants.List(c.Request.Context())
+	if err != nil {
+		log.Printf("Error listing tenants: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list tenants"})
+		return
+	}
+	c.JSON(http.StatusOK, tenants)
+}
+
+// Get returns a tenant the caller may see.
+func (h *TenantHandler) Get(c *gin.Context) {
+	if err := scopeOf(c).check(c.Param("id")); err != nil {
+		writeTenantError(c, err, "failed to get tenant")
+		return
+	}
+
+	tenant, err := h.tenants.Get(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		writeTenantError(c, err, "failed to get tenant")
+		return
+	}
+	c.JSON(http.StatusOK, tenant)
+}
+
+func writeTenantError(c *gin.Context, err error, message string) {
+	if errors.Is(err, store.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "tenant not found"})
+		return
+	}
+	log.Printf("Error loading tenant: %v", err)
+	c.JSON(http.StatusInternalServerError, gin.H{"error": message})
+}
@@ -0,0 +1,112 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/knakul853/accessmesh/internal/api/middleware"
+	"github.com/knakul853/accessmesh/internal/models"
+	"github.com/knakul853/accessmesh/internal/services"
+	"github.com/knakul853/accessmesh/internal/store"
+	"github.com/knakul853/accessmesh/pkg/abac"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTenantIsolation(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	ctx := context.Background()
+	testStore := store.NewMemoryStore()
+	e := newTestEnforcer(t)
+	_, err := e.AddPolicy("root", models.DefaultTenant, middleware.TenantsResource, middleware.TenantsAction)
+	require.NoError(t, err)
+
+	require.NoError(t, testStore.Tenants().Create(ctx, &models.Tenant{ID: "acme", Name: "Acme", CreatedAt: time.Now()}))
+	require.NoError(t, testStore.Roles().Create(ctx, &models.Role{Name: "manager"}))
+	require.NoError(t, testStore.Roles().Create(ctx, &models.Role{TenantID: "acme", Name: "manager"}))
+	require.NoError(t, testStore.Roles().Create(ctx, &models.Role{TenantID: "acme", Name: "clerk"}))
+
+	policies := NewPolicyHandler(testStore.Policies(), testStore.Roles(), testStore.Groups(), e, &abac.Schema{}, services.NewHistory(testStore, e))
+	tenants := NewTenantHandler(testStore.Tenants())
+	router := gin.New()
+	router.Use(middleware.TenantScope(e))
+	router.POST("/policies", policies.Create)
+	router.GET("/policies", policies.List)
+	router.GET("/policies/:id", policies.Get)
+	router.PATCH("/policies/:id", policies.Patch)
+	router.POST("/tenants", tenants.Create)
+	router.GET("/tenants", tenants.List)
+
+	do := func(token, method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+	list := func(token, path string) []models.Policy {
+		w := do(token, "GET", path, "")
+		require.Equal(t, http.StatusOK, w.Code)
+		var items []models.Policy
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &items))
+		return items
+	}
+	acme := testTenantToken(t, "manager", "acme")
+	local := testToken(t, "manager")
+	root := testToken(t, "root")
+
+	// Documents go in the caller's tenant whatever the body says, and roles
+	// are looked up there.
+	w := do(acme, "POST", "/policies", `{"tenant_id": "default", "role": "clerk", "resource": "/api/v1/orders", "action": "read"}`)
+	require.Equal(t, http.StatusCreated, w.Code)
+	var policy models.Policy
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &policy))
+	assert.Equal(t, "acme", policy.TenantID)
+	assert.Equal(t, http.StatusBadRequest,
+		do(local, "POST", "/policies", `{"role": "clerk", "resource": "/api/v1/orders", "action": "read"}`).Code)
+
+	allowed, err := e.Enforce("clerk", "acme", "/api/v1/orders", "read")
+	require.NoError(t, err)
+	assert.True(t, allowed)
+	allowed, err = e.Enforce("clerk", models.DefaultTenant, "/api/v1/orders", "read")
+	require.NoError(t, err)
+	assert.False(t, allowed)
+
+	// Other tenants' documents are invisible.
+	assert.Len(t, list(acme, "/policies"), 1)
+	assert.Empty(t, list(local, "/policies"))
+	assert.Empty(t, list(local, "/policies?tenant=acme"))
+	path := "/policies/" + policy.ID.Hex()
+	assert.Equal(t, http.StatusOK, do(acme, "GET", path, "").Code)
+	assert.Equal(t, http.StatusNotFound, do(local, "GET", path, "").Code)
+	assert.Equal(t, http.StatusNotFound, do(local, "PATCH", path, `{"action": "write"}`).Code)
+
+	// Super admins see across tenants.
+	assert.Len(t, list(root, "/policies"), 1)
+	assert.Len(t, list(root, "/policies?tenant=acme"), 1)
+	assert.Empty(t, list(root, "/policies?tenant=default"))
+	assert.Equal(t, http.StatusOK, do(root, "GET", path, "").Code)
+	w = do(root, "POST", "/policies", `{"tenant_id": "acme", "role": "manager", "resource": "/api/v1/orders", "action": "write"}`)
+	require.Equal(t, http.StatusCreated, w.Code)
+	assert.Len(t, list(acme, "/policies"), 2)
+
+	// Only super admins manage tenants.
+	assert.Equal(t, http.StatusForbidden, do(acme, "POST", "/tenants", `{"id": "globex", "name": "Globex"}`).Code)
+	assert.Equal(t, http.StatusBadRequest, do(root, "POST", "/tenants", `{"id": "Globex!", "name": "Globex"}`).Code)
+	assert.Equal(t, http.StatusCreated, do(root, "POST", "/tenants", `{"id": "globex", "name": "Globex"}`).Code)
+	assert.Equal(t, http.StatusConflict, do(root, "POST", "/tenants", `{"id": "globex", "name": "Globex"}`).Code)
+
+	var visible []models.Tenant
+	require.NoError(t, json.Unmarshal(do(acme, "GET", "/tenants", "").Body.Bytes(), &visible))
+	require.Len(t, visible, 1)
+	assert.Equal(t, "acme", visible[0].ID)
+	require.NoError(t, json.Unmarshal(do(root, "GET", "/tenants", "").Body.Bytes(), &visible))
+	assert.Len(t, visible, 3)
+}
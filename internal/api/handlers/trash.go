@@ -0,0 +1,33 @@
+package handlers
+
+import (
+	"context"
+
+	"github.com/gin-gonic/gin"
+	"github.com/knakul853/accessmesh/internal/store"
+	"github.com/knakul853/accessmesh/pkg/auth"
+)
+
+// deletedBy identifies the caller moving a document to the trash.
+func deletedBy(c *gin.Context) string {
+	return actorOf(c)
+}
+
+// actorOf identifies the caller changing a document: the real actor of an
+// impersonated session, otherwise the token's subject.
+func actorOf(c *gin.Context) string {
+	claims, err := auth.ValidateToken(c.GetHeader("Authorization"))
+	if err != nil {
+		return ""
+	}
+	if claims.IsImpersonated() {
+		return claims.Act.Subject
+	}
+	return claims.Subject
+}
+
+// recording returns the request's context for a policy or role write that
+// the store records in the document's history as action by the caller.
+func recording(c *gin.Context, action string) context.Context {
+	return store.WithRevision(c.Request.Context(), action, actorOf(c))
+}
@@ -1,76 +1,232 @@
 package handlers
 
 import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"net/http"
-	"time"
+	"slices"
+	"strconv"
 
 	"github.com/gin-gonic/gin"
 	"github.com/knakul853/accessmesh/internal/models"
 	"github.com/knakul853/accessmesh/internal/store"
-	"go.mongodb.org/mongo-driver/bson/primitive"
+	"github.com/knakul853/accessmesh/pkg/abac"
 )
 
-// GetUsers handles the request to fetch all users
-func GetUsers(store *store.MongoStore) gin.HandlerFunc {
+var (
+	errLegacyRole   = errors.New(`"role" is no longer supported; send "roles" as a list of assignments`)
+	errMissingRoles = errors.New(`"roles" is required; send [] to remove every role`)
+)
+
+// GetUsers handles the request to fetch a page of the caller's tenant's
+// users. Results can be filtered by role and email_verified, and for super
+// admins by tenant.
+func GetUsers(users store.UserRepository) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		users, err := store.GetAllUsers()
+		opts, err := listOptions(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		query := store.UserQuery{
+			ListOptions: opts,
+			TenantID:    scopeOf(c).listTenant(c),
+			Role:        c.Query("role"),
+		}
+		if raw := c.Query("email_verified"); raw != "" {
+			verified, err := strconv.ParseBool(raw)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "email_verified must be true or false"})
+				return
+			}
+			query.EmailVerified = &verified
+		}
+
+		page, err := users.List(c.Request.Context(), query)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			writeListError(c, err, "Failed to fetch users")
 			return
 		}
-		c.JSON(http.StatusOK, users)
+		writePage(c, page)
 	}
 }
 
-// UpdateUser handles the request to update a user
-func UpdateUser(store *store.MongoStore) gin.HandlerFunc {
+// UpdateUser handles the request to replace a user's username, email, role
+// assignments and attributes. Newly assigned roles must exist, and
+// attributes must be declared in schema. The body must list the roles, as
+// leaving them out would remove every assignment.
+func UpdateUser(users store.UserRepository, roles store.RoleRepository, schema *abac.Schema) gin.HandlerFunc {
+	return saveUser(users, roles, schema, checkRoleFields(decodeReplacement[models.User], true))
+}
+
+// PatchUser handles the request to apply a JSON Merge Patch to a user
+func PatchUser(users store.UserRepository, roles store.RoleRepository, schema *abac.Schema) gin.HandlerFunc {
+	return saveUser(users, roles, schema, checkRoleFields(decodeMergePatch[models.User], false))
+}
+
+// checkRoleFields wraps decode to refuse bodies with the single "role" field
+// of older clients, which would otherwise be ignored, and, if required,
+// bodies without "roles".
+func checkRoleFields(decode func(*gin.Context, *models.User) (*models.User, error), required bool) func(*gin.Context, *models.User) (*models.User, error) {
+	return func(c *gin.Context, current *models.User) (*models.User, error) {
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			return nil, err
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		// Bodies that are not objects are left to decode to reject.
+		var fields map[string]json.RawMessage
+		if json.Unmarshal(body, &fields) == nil {
+			if _, ok := fields["role"]; ok {
+				return nil, errLegacyRole
+			}
+			if _, ok := fields["roles"]; required && !ok {
+				return nil, errMissingRoles
+			}
+		}
+		return decode(c, current)
+	}
+}
+
+// saveUser loads the user, checks If-Match, and writes the editable fields of
+// the decoded request back under the loaded version.
+func saveUser(users store.UserRepository, roles store.RoleRepository, schema *abac.Schema, decode func(*gin.Context, *models.User) (*models.User, error)) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		userID := c.Param("id")
-		objID, err := primitive.ObjectIDFromHex(userID)
+		user, err := getUser(c, users)
 		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+			writeUserError(c, err)
+			return
+		}
+		if !checkIfMatch(c, user.Version) {
 			return
 		}
 
-		var userData struct {
-			Username string `json:"username"`
-			Email    string `json:"email"`
-			Role     string `json:"role"`
+		userData, err := decode(c, user)
+		if err != nil {
+			writeDecodeError(c, err)
+			return
 		}
 
-		if err := c.ShouldBindJSON(&userData); err != nil {
+		if !checkAssignments(c, roles, user.TenantID, user.Roles, userData.Roles) {
+			return
+		}
+		attributes, err := schema.Check(abac.NamespaceSubject, userData.Attributes)
+		if err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
 
-		user := &models.User{
-			ID:        objID,
-			Username:  userData.Username,
-			Email:     userData.Email,
-			Role:      userData.Role,
-			UpdatedAt: time.Now(),
-		}
+		user.Username = userData.Username
+		user.Email = userData.Email
+		user.Roles = userData.Roles
+		user.Attributes = attributes
 
-		err = store.UpdateUser(userID, user)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		if err := users.Update(c.Request.Context(), user); err != nil {
+			writeUserError(c, err)
 			return
 		}
 
+		setETag(c, user.Version)
 		c.JSON(http.StatusOK, gin.H{"message": "User updated successfully"})
 	}
 }
 
-// DeleteUser handles the request to delete a user
-func DeleteUser(store *store.MongoStore) gin.HandlerFunc {
+// checkAssignments responds 400 unless every role is assigned once, every
+// time window ends after it starts, and every role not held before exists
+// in the tenant.
+func checkAssignments(c *gin.Context, roles store.RoleRepository, tenant string, held, assignments []models.RoleAssignment) bool {
+	seen := map[string]bool{}
+	for _, assignment := range assignments {
+		if seen[assignment.Role] {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("role %q is assigned more than once", assignment.Role)})
+			return false
+		}
+		seen[assignment.Role] = true
+
+		if assignment.StartsAt != nil && assignment.ExpiresAt != nil && !assignment.ExpiresAt.After(*assignment.StartsAt) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("role %q expires before it starts", assignment.Role)})
+			return false
+		}
+
+		wasHeld := slices.ContainsFunc(held, func(previous models.RoleAssignment) bool {
+			return previous.Role == assignment.Role
+		})
+		if !wasHeld && !checkRole(c, roles, tenant, assignment.Role) {
+			return false
+		}
+	}
+	return true
+}
+
+// DeleteUser handles the request to move a user to the trash
+func DeleteUser(users store.UserRepository) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		userID := c.Param("id")
-		err := store.DeleteUser(userID)
+		user, err := getUser(c, users)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			writeUserError(c, err)
+			return
+		}
+		if !checkIfMatch(c, user.Version) {
+			return
+		}
+
+		if err := users.SoftDelete(c.Request.Context(), c.Param("id"), user.Version, deletedBy(c)); err != nil {
+			writeUserError(c, err)
 			return
 		}
 
 		c.JSON(http.StatusOK, gin.H{"message": "User deleted successfully"})
 	}
 }
+
+// RestoreUser handles the request to take a user out of the trash
+func RestoreUser(users store.UserRepository) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if err := users.Restore(c.Request.Context(), c.Param("id"), scopeOf(c).restoreTenant()); err != nil {
+			writeUserError(c, err)
+			return
+		}
+
+		user, err := getUser(c, users)
+		if err != nil {
+			writeUserError(c, err)
+			return
+		}
+
+		setETag(c, user.Version)
+		c.JSON(http.StatusOK, gin.H{"message": "User restored successfully"})
+	}
+}
+
+// getUser loads the user named in the URL if it belongs to the caller's
+// tenant.
+func getUser(c *gin.Context, users store.UserRepository) (*models.User, error) {
+	user, err := users.Get(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		return nil, err
+	}
+	if err := scopeOf(c).check(user.TenantID); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+func writeUserError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, store.ErrInvalidID):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+	case errors.Is(err, store.ErrNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+	case errors.Is(err, store.ErrDuplicate):
+		c.JSON(http.StatusConflict, gin.H{"error": "username or email already exists"})
+	case errors.Is(err, store.ErrVersionConflict):
+		writeVersionConflict(c)
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
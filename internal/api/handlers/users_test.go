@@ -0,0 +1,67 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/knakul853/accessmesh/internal/api/middleware"
+	"github.com/knakul853/accessmesh/internal/models"
+	"github.com/knakul853/accessmesh/internal/store"
+	"github.com/knakul853/accessmesh/pkg/abac"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSaveUser_Roles(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	ctx := context.Background()
+	testStore := store.NewMemoryStore()
+	e := newTestEnforcer(t)
+
+	require.NoError(t, testStore.Roles().Create(ctx, &models.Role{Name: "support"}))
+	alice := &models.User{Username: "alice", Roles: models.AssignRoles("support")}
+	require.NoError(t, testStore.Users().Create(ctx, alice))
+
+	router := gin.New()
+	router.Use(middleware.TenantScope(e))
+	router.PUT("/users/:id", UpdateUser(testStore.Users(), testStore.Roles(), &abac.Schema{}))
+	router.PATCH("/users/:id", PatchUser(testStore.Users(), testStore.Roles(), &abac.Schema{}))
+
+	token := testToken(t, "admin")
+	do := func(method, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/users/"+alice.ID.Hex(), bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+	roles := func() []models.RoleAssignment {
+		user, err := testStore.Users().Get(ctx, alice.ID.Hex())
+		require.NoError(t, err)
+		return user.Roles
+	}
+
+	// Replacing a user without roles, or with the old single role, would
+	// drop every assignment.
+	w := do("PUT", `{"username": "alice", "email": "alice@example.org"}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), `\"roles\" is required`)
+	w = do("PUT", `{"username": "alice", "role": "support"}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), `\"role\" is no longer supported`)
+	assert.Equal(t, http.StatusBadRequest, do("PATCH", `{"role": "admin"}`).Code)
+	assert.Equal(t, models.AssignRoles("support"), roles())
+
+	// A patch leaves roles alone unless it names them.
+	require.Equal(t, http.StatusOK, do("PATCH", `{"email": "alice@example.org"}`).Code)
+	assert.Equal(t, models.AssignRoles("support"), roles())
+
+	// An empty list removes every role on purpose.
+	require.Equal(t, http.StatusOK, do("PUT", `{"username": "alice", "roles": []}`).Code)
+	assert.Empty(t, roles())
+}
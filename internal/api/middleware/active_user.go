@@ -0,0 +1,48 @@
+package middleware
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/knakul853/accessmesh/internal/store"
+	"github.com/knakul853/accessmesh/pkg/auth"
+)
+
+// ActiveUser rejects tokens issued to users that have since been moved to the
+// trash, and impersonation tokens whose real actor has been. Subjects that are
+// not user IDs pass through.
+func ActiveUser(users store.UserRepository) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claims, err := auth.ValidateToken(c.GetHeader("Authorization"))
+		if err != nil {
+			c.Next()
+			return
+		}
+
+		subjects := []string{claims.Subject}
+		if claims.IsImpersonated() {
+			subjects = append(subjects, claims.Act.Subject)
+		}
+
+		for _, id := range subjects {
+			if id == "" {
+				continue
+			}
+			_, err := users.Get(c.Request.Context(), id)
+			switch {
+			case err == nil, errors.Is(err, store.ErrInvalidID):
+			case errors.Is(err, store.ErrNotFound):
+				c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "user no longer exists"})
+				return
+			default:
+				log.Printf("Error checking user %s: %v", id, err)
+				c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
+				return
+			}
+		}
+
+		c.Next()
+	}
+}
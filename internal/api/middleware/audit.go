@@ -0,0 +1,48 @@
+package middleware
+
+import (
+	"context"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/knakul853/accessmesh/internal/models"
+	"github.com/knakul853/accessmesh/internal/store"
+	"github.com/knakul853/accessmesh/pkg/auth"
+)
+
+// ImpersonationAudit writes every request made with an impersonation token to
+// the audit log, recording both the impersonated user and the real actor.
+func ImpersonationAudit(audit store.AuditRepository) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claims, err := auth.ValidateToken(c.GetHeader("Authorization"))
+		if err != nil || !claims.IsImpersonated() {
+			c.Next()
+			return
+		}
+
+		c.Set("actor", claims.Act)
+		c.Next()
+
+		entry := &models.AuditEntry{
+			Event:       models.AuditEventImpersonatedRequest,
+			SubjectID:   claims.Subject,
+			SubjectRole: strings.Join(claims.RoleNames(), ","),
+			ActorID:     claims.Act.Subject,
+			ActorRole:   strings.Join(claims.Act.Roles, ","),
+			Method:      c.Request.Method,
+			Path:        c.Request.URL.Path,
+			Status:      c.Writer.Status(),
+			ClientIP:    c.ClientIP(),
+		}
+
+		// The request context may already be cancelled once the response is written.
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		if err := audit.Write(ctx, entry); err != nil {
+			log.Printf("Error writing impersonation audit entry: %v", err)
+		}
+	}
+}
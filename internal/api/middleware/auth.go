@@ -10,6 +10,10 @@ import (
 	"github.com/knakul853/accessmesh/pkg/enforcer"
 )
 
+// AccessControl allows the request if one of the caller's roles, or a group
+// the caller belongs to, may perform its method on its route. The route is
+// the pattern it was registered with, such as /api/v1/users/:id, or the path
+// for requests no route matched.
 func AccessControl(e *enforcer.Enforcer) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		token := c.GetHeader("Authorization")
@@ -21,14 +25,19 @@ func AccessControl(e *enforcer.Enforcer) gin.HandlerFunc {
 			return
 		}
 
-		allowed, err := e.Enforce(claims.Role, c.Request.URL.Path, c.Request.Method)
+		route := c.FullPath()
+		if route == "" {
+			route = c.Request.URL.Path
+		}
+
+		allowed, err := e.EnforceUser(claims.Subject, claims.RoleNames(), claims.Domain(), route, c.Request.Method)
 		if err != nil {
 			log.Printf("Error enforcing policy: %v", err)
 			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
 			return
 		}
 		if !allowed {
-			log.Printf("Access denied for user %s to resource %s with method %s", claims.Role, c.Request.URL.Path, c.Request.Method)
+			log.Printf("Access denied for user %s in tenant %s to resource %s with method %s", claims.Subject, claims.Domain(), route, c.Request.Method)
 			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "access denied"})
 			return
 		}
@@ -62,8 +71,8 @@ func AuthMiddleware() gin.HandlerFunc {
 			return
 		}
 
-		// Store user role in the context
-		c.Set("role", claims.Role)
+		// Store the user's roles in the context
+		c.Set("roles", claims.RoleNames())
 
 		c.Next()
 	}
@@ -0,0 +1,57 @@
+package middleware
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/knakul853/accessmesh/internal/models"
+	"github.com/knakul853/accessmesh/pkg/auth"
+	"github.com/knakul853/accessmesh/pkg/enforcer"
+)
+
+// Casbin object/action a role of the default tenant must be granted there to
+// act as a super admin across every tenant.
+const (
+	TenantsResource = "tenants"
+	TenantsAction   = "manage"
+)
+
+// Context keys set by TenantScope.
+const (
+	TenantKey     = "tenant"
+	AllTenantsKey = "all_tenants"
+)
+
+// TenantScope records the caller's tenant, taken from the token, under
+// TenantKey and whether the caller is a super admin under AllTenantsKey.
+func TenantScope(e *enforcer.Enforcer) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claims, err := auth.ValidateToken(c.GetHeader("Authorization"))
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid token"})
+			return
+		}
+
+		all, err := IsSuperAdmin(e, claims)
+		if err != nil {
+			log.Printf("Error enforcing tenant permission: %v", err)
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
+			return
+		}
+
+		c.Set(TenantKey, claims.Domain())
+		c.Set(AllTenantsKey, all)
+		c.Next()
+	}
+}
+
+// IsSuperAdmin reports whether the token belongs to a user of the default
+// tenant who is granted TenantsResource/TenantsAction there, through a role
+// or a group.
+func IsSuperAdmin(e *enforcer.Enforcer, claims *auth.Claims) (bool, error) {
+	if claims.Domain() != models.DefaultTenant {
+		return false, nil
+	}
+	return e.EnforceUser(claims.Subject, claims.RoleNames(), models.DefaultTenant, TenantsResource, TenantsAction)
+}
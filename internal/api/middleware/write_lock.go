@@ -0,0 +1,26 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// WriteLock refuses requests that change anything with 423 Locked while
+// locked returns true, giving reason as the error. locked is asked on every
+// request, so the lock can change while the server runs. Reads pass
+// through, as does everything when not locked.
+func WriteLock(locked func() bool, reason string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !locked() {
+			c.Next()
+			return
+		}
+		switch c.Request.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			c.Next()
+		default:
+			c.AbortWithStatusJSON(http.StatusLocked, gin.H{"error": reason})
+		}
+	}
+}
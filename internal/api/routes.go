@@ -8,22 +8,28 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/knakul853/accessmesh/internal/api/handlers"
 	"github.com/knakul853/accessmesh/internal/api/middleware"
+	"github.com/knakul853/accessmesh/internal/authn"
 	"github.com/knakul853/accessmesh/internal/services"
 	"github.com/knakul853/accessmesh/internal/store"
 	"github.com/knakul853/accessmesh/pkg/enforcer"
+	"github.com/knakul853/accessmesh/pkg/rebac"
 	"golang.org/x/time/rate"
 )
 
 // SetupRoutes sets up the API routes for the application.
-// It takes a Gin engine, a store, and an enforcer as parameters.
-func SetupRoutes(r *gin.Engine, store *store.MongoStore, enforcer *enforcer.Enforcer) {
+// It takes a Gin engine, a store, an enforcer, the role reference rules, the
+// role elevation workflow, the access checker, the relation tuple engine, the
+// login authenticator chain and the configured SAML and OIDC identity
+// providers as parameters.
+func SetupRoutes(r *gin.Engine, db store.Store, enforcer *enforcer.Enforcer, roleIntegrity *services.RoleIntegrity, elevations *services.Elevations, access *services.Access, relations *rebac.Engine, gitops *services.GitOps, authenticator authn.Authenticator, samlProviders map[string]*authn.SAMLServiceProvider, oidcProviders map[string]*authn.OIDCProvider) {
 	log.Println("Setting up API routes...")
 
 	// Configure CORS
 	config := cors.DefaultConfig()
 	config.AllowOrigins = []string{"http://localhost:3000"} // Next.js dev server
 	config.AllowCredentials = true
-	config.AllowHeaders = append(config.AllowHeaders, "Authorization")
+	config.AllowHeaders = append(config.AllowHeaders, "Authorization", "If-Match")
+	config.ExposeHeaders = []string{"X-Total-Count", "X-Next-Cursor", "Link", "ETag"}
 	r.Use(cors.New(config))
 
 	// Initialize rate limiter
@@ -52,9 +58,20 @@ func SetupRoutes(r *gin.Engine, store *store.MongoStore, enforcer *enforcer.Enfo
 		smtpFromEmail,
 	)
 
-	policyHandler := handlers.NewPolicyHandler(store)
-	authHandler := handlers.NewAuthHandler(store, emailService)
-	roleHandler := handlers.NewRoleHandler(store)
+	history := services.NewHistory(db, enforcer)
+	policyHandler := handlers.NewPolicyHandler(db.Policies(), db.Roles(), db.Groups(), enforcer, access.Schema(), history)
+	authHandler := handlers.NewAuthHandler(db, emailService, authenticator)
+	roleHandler := handlers.NewRoleHandler(db.Roles(), db.Policies(), enforcer, roleIntegrity, history)
+	snapshotHandler := handlers.NewSnapshotHandler(db.Snapshots(), history)
+	bundleHandler := handlers.NewBundleHandler(enforcer, services.NewBundles(db, enforcer, roleIntegrity, access.Schema()))
+	impersonationHandler := handlers.NewImpersonationHandler(db, enforcer)
+	groupHandler := handlers.NewGroupHandler(db, enforcer)
+	elevationHandler := handlers.NewElevationHandler(db, enforcer, elevations)
+	checkHandler := handlers.NewCheckHandler(db.Users(), enforcer, access)
+	relationHandler := handlers.NewRelationHandler(enforcer, relations)
+	tenantHandler := handlers.NewTenantHandler(db.Tenants())
+	samlHandler := handlers.NewSAMLHandler(samlProviders)
+	oidcHandler := handlers.NewOIDCHandler(oidcProviders)
 
 	// Public auth routes (no authentication required)
 	auth := r.Group("/api/v1/auth")
@@ -64,7 +81,16 @@ func SetupRoutes(r *gin.Engine, store *store.MongoStore, enforcer *enforcer.Enfo
 		auth.POST("/verify-email", authHandler.VerifyEmail)
 		auth.POST("/forgot-password", authHandler.ForgotPassword)
 		auth.POST("/reset-password", authHandler.ResetPassword)
+		auth.POST("/magic-link", authHandler.RequestMagicLink)
+		auth.POST("/magic-link/verify", authHandler.VerifyMagicLink)
 		auth.GET("/logout", authHandler.Logout)
+
+		auth.GET("/saml/:idp/metadata", samlHandler.Metadata)
+		auth.GET("/saml/:idp/login", samlHandler.Login)
+		auth.POST("/saml/:idp/acs", samlHandler.ACS)
+
+		auth.GET("/oidc/:provider/login", oidcHandler.Login)
+		auth.GET("/oidc/:provider/callback", oidcHandler.Callback)
 	}
 
 	// Protected routes (require authentication)
@@ -72,38 +98,148 @@ func SetupRoutes(r *gin.Engine, store *store.MongoStore, enforcer *enforcer.Enfo
 	api.Use(middleware.SessionAuth(middleware.SessionConfig{
 		JWTSecret: []byte(os.Getenv("JWT_SECRET")),
 	}))
+	api.Use(middleware.ActiveUser(db.Users()))
+	api.Use(middleware.TenantScope(enforcer))
+	api.Use(middleware.ImpersonationAudit(db.AuditLogs()))
+
+	// While GitOps manages roles, groups and policies it may lock API writes
+	// to them; group membership stays editable.
+	writeLock := middleware.WriteLock(func() bool { return gitops != nil && gitops.Locked() },
+		"roles, groups and policies are managed by GitOps; change the policy files instead")
+
+	// Routes whose handlers do not authorize the caller themselves are
+	// allowed by the caller's policies for the route.
+	accessControl := middleware.AccessControl(enforcer)
+
+	api.POST("/impersonate", impersonationHandler.Impersonate)
+
+	// Access checks, evaluating the conditions of attribute-based policies
+	api.POST("/check", checkHandler.Check)
+
+	// Online backups, for stores that support them
+	if backuper, ok := db.(store.Backuper); ok {
+		backupHandler := handlers.NewBackupHandler(backuper, enforcer)
+		api.GET("/admin/backup", backupHandler.Backup)
+	}
+
+	consistencyHandler := handlers.NewConsistencyHandler(roleIntegrity, enforcer)
+	api.GET("/admin/consistency", consistencyHandler.Check)
+
+	// Policy analysis compares resources with the routes registered by the
+	// time it runs, which is all of them.
+	analyzer := services.NewAnalyzer(db, func() []services.Route {
+		var routes []services.Route
+		for _, route := range r.Routes() {
+			routes = append(routes, services.Route{Method: route.Method, Path: route.Path})
+		}
+		return routes
+	}, handlers.Permissions())
+	analysisHandler := handlers.NewAnalysisHandler(analyzer, enforcer)
+	api.GET("/admin/policy-analysis", analysisHandler.Analyze)
+
+	// Tenants; creating them and seeing other tenants takes a super admin
+	tenants := api.Group("/tenants")
+	{
+		tenants.POST("", tenantHandler.Create)
+		tenants.GET("", tenantHandler.List)
+		tenants.GET("/:id", tenantHandler.Get)
+	}
 
-	// Place policy routes before access control middleware
 	policies := api.Group("/policies")
+	policies.Use(writeLock)
 	{
 		policies.POST("", policyHandler.Create)
 		policies.GET("", policyHandler.List)
 		policies.GET("/:id", policyHandler.Get)
 		policies.PUT("/:id", policyHandler.Update)
+		policies.PATCH("/:id", policyHandler.Patch)
 		policies.DELETE("/:id", policyHandler.Delete)
+		policies.POST("/:id/restore", policyHandler.Restore)
+		policies.GET("/:id/history", policyHandler.History)
+		policies.POST("/:id/history/:version/restore", policyHandler.Revert)
+	}
+
+	if gitops != nil {
+		gitopsHandler := handlers.NewGitOpsHandler(enforcer, gitops)
+		api.GET("/gitops", gitopsHandler.Status)
+		api.POST("/gitops/sync", gitopsHandler.Sync)
+	}
+
+	// Policy bundles: a tenant's roles, groups and policies as one file
+	api.GET("/bundle", bundleHandler.Export)
+	api.POST("/bundle", writeLock, bundleHandler.Import)
+
+	// Snapshots of a tenant's policies, which can be rolled back to at once
+	snapshots := api.Group("/policy-snapshots")
+	{
+		snapshots.POST("", snapshotHandler.Create)
+		snapshots.GET("", snapshotHandler.List)
+		snapshots.GET("/:id", snapshotHandler.Get)
+		snapshots.POST("/:id/rollback", writeLock, snapshotHandler.Rollback)
 	}
 
 	// User routes
 	users := api.Group("/users")
-	users.Use(middleware.AuthMiddleware())
+	users.Use(middleware.AuthMiddleware(), accessControl)
 	{
-		users.GET("", handlers.GetUsers(store))
-		users.PUT("/:id", handlers.UpdateUser(store))
-		users.DELETE("/:id", handlers.DeleteUser(store))
+		users.GET("", handlers.GetUsers(db.Users()))
+		users.PUT("/:id", handlers.UpdateUser(db.Users(), db.Roles(), access.Schema()))
+		users.PATCH("/:id", handlers.PatchUser(db.Users(), db.Roles(), access.Schema()))
+		users.DELETE("/:id", handlers.DeleteUser(db.Users()))
+		users.POST("/:id/restore", handlers.RestoreUser(db.Users()))
 	}
 
 	// Role management routes
 	roles := api.Group("/roles")
+	roles.Use(writeLock)
 	{
 		roles.POST("", roleHandler.Create)
 		roles.GET("", roleHandler.List)
 		roles.GET("/:id", roleHandler.Get)
 		roles.PUT("/:id", roleHandler.Update)
+		roles.PATCH("/:id", roleHandler.Patch)
 		roles.DELETE("/:id", roleHandler.Delete)
+		roles.POST("/:id/restore", roleHandler.Restore)
+		roles.GET("/:id/history", roleHandler.History)
+		roles.POST("/:id/history/:version/restore", roleHandler.Revert)
+	}
+
+	// Groups and their membership
+	groups := api.Group("/groups")
+	{
+		groups.POST("", writeLock, groupHandler.Create)
+		groups.GET("", groupHandler.List)
+		groups.GET("/:id", groupHandler.Get)
+		groups.PUT("/:id", writeLock, groupHandler.Update)
+		groups.PATCH("/:id", writeLock, groupHandler.Patch)
+		groups.DELETE("/:id", writeLock, groupHandler.Delete)
+		groups.POST("/:id/restore", writeLock, groupHandler.Restore)
+		groups.POST("/:id/members", groupHandler.AddMember)
+		groups.DELETE("/:id/members/:user_id", groupHandler.RemoveMember)
+		groups.POST("/:id/subgroups", writeLock, groupHandler.AddSubgroup)
+		groups.DELETE("/:id/subgroups/:group_id", writeLock, groupHandler.RemoveSubgroup)
+	}
+
+	// Just-in-time role elevation; deciding takes elevations/approve
+	elevationRoutes := api.Group("/elevations")
+	{
+		elevationRoutes.POST("", elevationHandler.Request)
+		elevationRoutes.GET("", elevationHandler.List)
+		elevationRoutes.GET("/:id", elevationHandler.Get)
+		elevationRoutes.POST("/:id/approve", elevationHandler.Approve)
+		elevationRoutes.POST("/:id/deny", elevationHandler.Deny)
+		elevationRoutes.POST("/:id/revoke", elevationHandler.Revoke)
 	}
 
-	// Apply access control after policy routes
-	api.Use(middleware.AccessControl(enforcer))
+	// Relation tuples and the relationship-based checks answered from them
+	relationRoutes := api.Group("/relations")
+	{
+		relationRoutes.POST("/tuples", relationHandler.Write)
+		relationRoutes.GET("/tuples", relationHandler.List)
+		relationRoutes.POST("/check", relationHandler.Check)
+		relationRoutes.POST("/expand", relationHandler.Expand)
+		relationRoutes.POST("/list-objects", relationHandler.ListObjects)
+	}
 
 	log.Println("API routes setup complete.")
 }
@@ -0,0 +1,123 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/casbin/casbin/v2"
+	"github.com/casbin/casbin/v2/model"
+	"github.com/gin-gonic/gin"
+	"github.com/knakul853/accessmesh/internal/api/handlers"
+	"github.com/knakul853/accessmesh/internal/models"
+	"github.com/knakul853/accessmesh/internal/services"
+	"github.com/knakul853/accessmesh/internal/store"
+	"github.com/knakul853/accessmesh/pkg/abac"
+	"github.com/knakul853/accessmesh/pkg/auth"
+	"github.com/knakul853/accessmesh/pkg/enforcer"
+	"github.com/knakul853/accessmesh/pkg/rebac"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestRouter returns the full API over a memory store.
+func newTestRouter(t *testing.T) (*gin.Engine, store.Store, *enforcer.Enforcer) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	t.Setenv("JWT_SECRET", "your-secret-key")
+
+	conf, err := os.ReadFile("../../model.conf")
+	require.NoError(t, err)
+	m, err := model.NewModelFromString(string(conf))
+	require.NoError(t, err)
+	synced, err := casbin.NewSyncedEnforcer(m, enforcer.NewMemoryAdapter())
+	require.NoError(t, err)
+	e := &enforcer.Enforcer{SyncedEnforcer: synced}
+
+	db := store.NewMemoryStore()
+	roleIntegrity, err := services.NewRoleIntegrity(db, e, services.RoleDeleteReject, "")
+	require.NoError(t, err)
+	elevations := services.NewElevations(db, e, 8*time.Hour)
+	access := services.NewAccess(db, e, &abac.Schema{})
+	relations := rebac.NewEngine(db.Tuples(), nil)
+
+	router := gin.New()
+	SetupRoutes(router, db, e, roleIntegrity, elevations, access, relations, nil, nil, nil, nil)
+	return router, db, e
+}
+
+func TestSetupRoutes_Impersonation(t *testing.T) {
+	router, db, e := newTestRouter(t)
+	ctx := context.Background()
+	for _, p := range [][]string{
+		{"admin", "default", "/api/v1/users", "GET"},
+		{"admin", "default", handlers.ImpersonationResource, handlers.ImpersonationAction},
+	} {
+		_, err := e.AddPolicy(p)
+		require.NoError(t, err)
+	}
+
+	alice := &models.User{Username: "alice", Roles: models.AssignRoles("admin")}
+	bob := &models.User{Username: "bob", Roles: models.AssignRoles("support")}
+	for _, user := range []*models.User{alice, bob} {
+		require.NoError(t, db.Users().Create(ctx, user))
+	}
+	token, err := auth.GenerateUserToken(alice.ID.Hex(), []string{"admin"}, "")
+	require.NoError(t, err)
+
+	do := func(token, method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	assert.Equal(t, http.StatusOK, do(token, "GET", "/api/v1/users", "").Code)
+
+	w := do(token, "POST", "/api/v1/impersonate", `{"user_id": "`+bob.ID.Hex()+`", "reason": "ticket 42"}`)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var resp handlers.AuthResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+
+	// The impersonated session has bob's permissions, not alice's.
+	w = do(resp.Token, "GET", "/api/v1/users", "")
+	assert.Equal(t, http.StatusForbidden, w.Code, w.Body.String())
+}
+
+func TestSetupRoutes_GroupGrant(t *testing.T) {
+	router, db, e := newTestRouter(t)
+	ctx := context.Background()
+
+	carol := &models.User{Username: "carol"}
+	dave := &models.User{Username: "dave"}
+	for _, user := range []*models.User{carol, dave} {
+		require.NoError(t, db.Users().Create(ctx, user))
+	}
+	readers := &models.Group{Name: "readers", Members: []string{carol.ID.Hex()}}
+	require.NoError(t, db.Groups().Create(ctx, readers))
+	require.NoError(t, e.SyncGroup(nil, readers))
+	_, err := e.AddPolicy(enforcer.GroupSubject(readers.ID.Hex()), "default", "/api/v1/users/:id", "PATCH")
+	require.NoError(t, err)
+
+	patch := func(user *models.User) int {
+		token, err := auth.GenerateUserToken(user.ID.Hex(), nil, "")
+		require.NoError(t, err)
+		req := httptest.NewRequest("PATCH", "/api/v1/users/"+dave.ID.Hex(), bytes.NewBufferString(`{"email": "dave@example.org"}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	// Only the group grants the route, and only to its members.
+	assert.Equal(t, http.StatusOK, patch(carol))
+	assert.Equal(t, http.StatusForbidden, patch(dave))
+}
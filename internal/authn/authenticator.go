@@ -0,0 +1,53 @@
+package authn
+
+import (
+	"context"
+	"errors"
+	"log"
+
+	"github.com/knakul853/accessmesh/internal/models"
+)
+
+var (
+	// ErrInvalidCredentials means the backend does not know the user or the
+	// password is wrong. The chain moves on to the next backend.
+	ErrInvalidCredentials = errors.New("invalid credentials")
+	// ErrNoRole means the user authenticated but no role could be assigned.
+	ErrNoRole = errors.New("no role mapped for user")
+	// ErrAccountConflict means the username already belongs to an account
+	// managed by a different backend, or in another tenant.
+	ErrAccountConflict = errors.New("account managed by another authentication source")
+	// ErrUnverifiedEmail means an external login could only be linked to an
+	// existing account by email, but the address is not verified on both sides.
+	ErrUnverifiedEmail = errors.New("email not verified")
+)
+
+// Authenticator verifies a username and password and returns the matching user.
+type Authenticator interface {
+	Name() string
+	Authenticate(ctx context.Context, username, password string) (*models.User, error)
+}
+
+// Chain tries each authenticator in order and returns the first success.
+type Chain []Authenticator
+
+func NewChain(authenticators ...Authenticator) Chain {
+	return Chain(authenticators)
+}
+
+func (c Chain) Name() string {
+	return "chain"
+}
+
+func (c Chain) Authenticate(ctx context.Context, username, password string) (*models.User, error) {
+	for _, a := range c {
+		user, err := a.Authenticate(ctx, username, password)
+		if err == nil {
+			return user, nil
+		}
+		if !errors.Is(err, ErrInvalidCredentials) {
+			log.Printf("Authenticator %s failed for user %s: %v", a.Name(), username, err)
+		}
+	}
+	return nil, ErrInvalidCredentials
+}
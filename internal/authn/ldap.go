@@ -0,0 +1,237 @@
+package authn
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/go-ldap/ldap/v3"
+	"github.com/knakul853/accessmesh/internal/models"
+)
+
+// GroupRole maps an LDAP group to an AccessMesh (Casbin) role.
+type GroupRole struct {
+	Group string `json:"group"`
+	Role  string `json:"role"`
+}
+
+type LDAPConfig struct {
+	URL      string
+	StartTLS bool
+	// TLSConfig is used for StartTLS and ldaps:// connections.
+	TLSConfig *tls.Config
+	Timeout   time.Duration
+
+	// Service account used to search for the user entry. Leave empty for
+	// directories that allow anonymous search.
+	BindDN       string
+	BindPassword string
+
+	BaseDN string
+	// UserFilter must contain a single %s for the escaped username,
+	// e.g. "(uid=%s)" or "(sAMAccountName=%s)".
+	UserFilter     string
+	EmailAttribute string
+	GroupAttribute string
+
+	// GroupRoles is checked in order; the first group the user belongs to wins.
+	GroupRoles  []GroupRole
+	DefaultRole string
+
+	// Tenant is the tenant the directory's users belong to, the default one
+	// if empty.
+	Tenant string
+}
+
+// LDAPAuthenticator authenticates with search-then-bind against an LDAP or
+// Active Directory server and provisions the user locally on success.
+type LDAPAuthenticator struct {
+	config      LDAPConfig
+	provisioner Provisioner
+}
+
+func NewLDAPAuthenticator(config LDAPConfig, provisioner Provisioner) *LDAPAuthenticator {
+	if config.UserFilter == "" {
+		config.UserFilter = "(uid=%s)"
+	}
+	if config.EmailAttribute == "" {
+		config.EmailAttribute = "mail"
+	}
+	if config.GroupAttribute == "" {
+		config.GroupAttribute = "memberOf"
+	}
+	if config.Timeout == 0 {
+		config.Timeout = 10 * time.Second
+	}
+
+	return &LDAPAuthenticator{
+		config:      config,
+		provisioner: provisioner,
+	}
+}
+
+func (a *LDAPAuthenticator) Name() string {
+	return models.AuthSourceLDAP
+}
+
+func (a *LDAPAuthenticator) Authenticate(ctx context.Context, username, password string) (*models.User, error) {
+	// An empty password would turn the user bind into an unauthenticated
+	// bind, which many servers accept.
+	if username == "" || password == "" {
+		return nil, ErrInvalidCredentials
+	}
+
+	conn, err := a.dial()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	if a.config.BindDN != "" {
+		if err := conn.Bind(a.config.BindDN, a.config.BindPassword); err != nil {
+			return nil, fmt.Errorf("service bind: %w", err)
+		}
+	}
+
+	search := ldap.NewSearchRequest(
+		a.config.BaseDN,
+		ldap.ScopeWholeSubtree,
+		ldap.NeverDerefAliases,
+		2, // more than one match is an error
+		int(a.config.Timeout.Seconds()),
+		false,
+		fmt.Sprintf(a.config.UserFilter, ldap.EscapeFilter(username)),
+		[]string{a.config.EmailAttribute, a.config.GroupAttribute},
+		nil,
+	)
+
+	result, err := conn.Search(search)
+	if err != nil {
+		if ldap.IsErrorWithCode(err, ldap.LDAPResultSizeLimitExceeded) {
+			return nil, ErrInvalidCredentials
+		}
+		return nil, fmt.Errorf("user search: %w", err)
+	}
+	if len(result.Entries) != 1 {
+		return nil, ErrInvalidCredentials
+	}
+	entry := result.Entries[0]
+
+	if err := conn.Bind(entry.DN, password); err != nil {
+		if ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials) {
+			return nil, ErrInvalidCredentials
+		}
+		return nil, fmt.Errorf("user bind: %w", err)
+	}
+
+	role := mapGroupRole(a.config.GroupRoles, entry.GetAttributeValues(a.config.GroupAttribute), a.config.DefaultRole)
+	if role == "" {
+		return nil, ErrNoRole
+	}
+
+	email := entry.GetAttributeValue(a.config.EmailAttribute)
+	user := &models.User{
+		TenantID:      a.config.Tenant,
+		Username:      username,
+		Email:         email,
+		Roles:         models.AssignRoles(role),
+		EmailVerified: email != "",
+		AuthSource:    models.AuthSourceLDAP,
+	}
+
+	return a.provisioner.Provision(ctx, user)
+}
+
+func (a *LDAPAuthenticator) dial() (*ldap.Conn, error) {
+	dialer := &net.Dialer{Timeout: a.config.Timeout}
+	opts := []ldap.DialOpt{ldap.DialWithDialer(dialer)}
+	if a.config.TLSConfig != nil {
+		opts = append(opts, ldap.DialWithTLSConfig(a.config.TLSConfig))
+	}
+
+	conn, err := ldap.DialURL(a.config.URL, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("dial %s: %w", a.config.URL, err)
+	}
+	conn.SetTimeout(a.config.Timeout)
+
+	if a.config.StartTLS {
+		tlsConfig := &tls.Config{}
+		if a.config.TLSConfig != nil {
+			tlsConfig = a.config.TLSConfig.Clone()
+		}
+		if tlsConfig.ServerName == "" {
+			tlsConfig.ServerName = hostOf(a.config.URL)
+		}
+		if err := conn.StartTLS(tlsConfig); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("start tls: %w", err)
+		}
+	}
+
+	return conn, nil
+}
+
+// mapGroupRole returns the role of the first mapping whose group the user is
+// a member of, or defaultRole. Groups match on the full DN or on the leading
+// CN value.
+func mapGroupRole(mappings []GroupRole, groups []string, defaultRole string) string {
+	for _, mapping := range mappings {
+		for _, group := range groups {
+			if strings.EqualFold(mapping.Group, group) || strings.EqualFold(mapping.Group, commonName(group)) {
+				return mapping.Role
+			}
+		}
+	}
+	return defaultRole
+}
+
+func commonName(dn string) string {
+	parsed, err := ldap.ParseDN(dn)
+	if err != nil || len(parsed.RDNs) == 0 {
+		return ""
+	}
+	for _, attr := range parsed.RDNs[0].Attributes {
+		if strings.EqualFold(attr.Type, "cn") {
+			return attr.Value
+		}
+	}
+	return ""
+}
+
+func hostOf(rawURL string) string {
+	rest := rawURL
+	if i := strings.Index(rest, "://"); i >= 0 {
+		rest = rest[i+3:]
+	}
+	host, _, err := net.SplitHostPort(rest)
+	if err != nil {
+		return rest
+	}
+	return host
+}
+
+// ParseGroupRoles parses "group:role;group:role" mappings. The role is taken
+// after the last colon so group DNs may be used as-is.
+func ParseGroupRoles(s string) ([]GroupRole, error) {
+	var mappings []GroupRole
+	for _, item := range strings.Split(s, ";") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		i := strings.LastIndex(item, ":")
+		if i <= 0 || i == len(item)-1 {
+			return nil, errors.New("invalid group role mapping: " + item)
+		}
+		mappings = append(mappings, GroupRole{
+			Group: strings.TrimSpace(item[:i]),
+			Role:  strings.TrimSpace(item[i+1:]),
+		})
+	}
+	return mappings, nil
+}
@@ -0,0 +1,183 @@
+package authn
+
+import (
+	"context"
+	"crypto/tls"
+	"testing"
+
+	"github.com/knakul853/accessmesh/internal/models"
+	"github.com/knakul853/accessmesh/internal/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type recordingProvisioner struct {
+	users []*models.User
+}
+
+func (p *recordingProvisioner) Provision(ctx context.Context, user *models.User) (*models.User, error) {
+	p.users = append(p.users, user)
+	return user, nil
+}
+
+type staticAuthenticator struct {
+	user *models.User
+	err  error
+}
+
+func (a staticAuthenticator) Name() string { return "static" }
+
+func (a staticAuthenticator) Authenticate(ctx context.Context, username, password string) (*models.User, error) {
+	return a.user, a.err
+}
+
+func newTestDirectory(t *testing.T) (*stubLDAPServer, LDAPConfig) {
+	server, pool := newStubLDAPServer(t, true,
+		stubEntry{
+			dn:       "cn=service,dc=example,dc=org",
+			password: "service-secret",
+		},
+		stubEntry{
+			dn:       "uid=alice,ou=people,dc=example,dc=org",
+			password: "alice-secret",
+			attrs: map[string][]string{
+				"uid":      {"alice"},
+				"mail":     {"alice@example.org"},
+				"memberOf": {"cn=staff,ou=groups,dc=example,dc=org", "cn=admins,ou=groups,dc=example,dc=org"},
+			},
+		},
+		stubEntry{
+			dn:       "uid=bob,ou=people,dc=example,dc=org",
+			password: "bob-secret",
+			attrs: map[string][]string{
+				"uid":      {"bob"},
+				"mail":     {"bob@example.org"},
+				"memberOf": {"cn=contractors,ou=groups,dc=example,dc=org"},
+			},
+		},
+	)
+
+	return server, LDAPConfig{
+		URL:          server.URL(),
+		StartTLS:     true,
+		TLSConfig:    &tls.Config{RootCAs: pool},
+		BindDN:       "cn=service,dc=example,dc=org",
+		BindPassword: "service-secret",
+		BaseDN:       "ou=people,dc=example,dc=org",
+		GroupRoles: []GroupRole{
+			{Group: "cn=admins,ou=groups,dc=example,dc=org", Role: "admin"},
+			{Group: "staff", Role: "support"},
+		},
+	}
+}
+
+func TestLDAPAuthenticator_Success(t *testing.T) {
+	server, config := newTestDirectory(t)
+	provisioner := &recordingProvisioner{}
+	a := NewLDAPAuthenticator(config, provisioner)
+
+	user, err := a.Authenticate(context.Background(), "alice", "alice-secret")
+	require.NoError(t, err)
+
+	assert.True(t, server.TLSStarted())
+	assert.Equal(t, "alice", user.Username)
+	assert.Equal(t, "alice@example.org", user.Email)
+	assert.Equal(t, models.AssignRoles("admin"), user.Roles)
+	assert.True(t, user.EmailVerified)
+	assert.Equal(t, models.AuthSourceLDAP, user.AuthSource)
+	assert.Len(t, provisioner.users, 1)
+}
+
+func TestLDAPAuthenticator_ProvisionsIntoTenant(t *testing.T) {
+	_, config := newTestDirectory(t)
+	config.Tenant = "acme"
+	users := store.NewMemoryStore().Users()
+	a := NewLDAPAuthenticator(config, NewUserProvisioner(users))
+
+	_, err := a.Authenticate(context.Background(), "alice", "alice-secret")
+	require.NoError(t, err)
+	stored, err := users.GetByUsername(context.Background(), "alice")
+	require.NoError(t, err)
+	assert.Equal(t, "acme", stored.TenantID)
+
+	// An account of the same name in another tenant is not taken over.
+	stored.TenantID = models.DefaultTenant
+	require.NoError(t, users.Update(context.Background(), stored))
+	_, err = a.Authenticate(context.Background(), "alice", "alice-secret")
+	assert.ErrorIs(t, err, ErrAccountConflict)
+}
+
+func TestLDAPAuthenticator_InvalidCredentials(t *testing.T) {
+	_, config := newTestDirectory(t)
+	provisioner := &recordingProvisioner{}
+	a := NewLDAPAuthenticator(config, provisioner)
+
+	cases := map[string][2]string{
+		"wrong password":   {"alice", "nope"},
+		"unknown user":     {"mallory", "secret"},
+		"empty password":   {"alice", ""},
+		"filter injection": {"*", "alice-secret"},
+	}
+	for name, creds := range cases {
+		t.Run(name, func(t *testing.T) {
+			_, err := a.Authenticate(context.Background(), creds[0], creds[1])
+			assert.ErrorIs(t, err, ErrInvalidCredentials)
+		})
+	}
+	assert.Empty(t, provisioner.users)
+}
+
+func TestLDAPAuthenticator_GroupRoleMapping(t *testing.T) {
+	_, config := newTestDirectory(t)
+
+	_, err := NewLDAPAuthenticator(config, &recordingProvisioner{}).
+		Authenticate(context.Background(), "bob", "bob-secret")
+	assert.ErrorIs(t, err, ErrNoRole)
+
+	config.DefaultRole = "viewer"
+	user, err := NewLDAPAuthenticator(config, &recordingProvisioner{}).
+		Authenticate(context.Background(), "bob", "bob-secret")
+	require.NoError(t, err)
+	assert.Equal(t, models.AssignRoles("viewer"), user.Roles)
+}
+
+func TestLDAPAuthenticator_RequiresTLS(t *testing.T) {
+	_, config := newTestDirectory(t)
+	config.StartTLS = false
+
+	_, err := NewLDAPAuthenticator(config, &recordingProvisioner{}).
+		Authenticate(context.Background(), "alice", "alice-secret")
+	assert.Error(t, err)
+	assert.NotErrorIs(t, err, ErrInvalidCredentials)
+}
+
+func TestChain(t *testing.T) {
+	_, config := newTestDirectory(t)
+	local := staticAuthenticator{err: ErrInvalidCredentials}
+	chain := NewChain(local, NewLDAPAuthenticator(config, &recordingProvisioner{}))
+
+	user, err := chain.Authenticate(context.Background(), "alice", "alice-secret")
+	require.NoError(t, err)
+	assert.Equal(t, models.AssignRoles("admin"), user.Roles)
+
+	_, err = chain.Authenticate(context.Background(), "alice", "wrong")
+	assert.ErrorIs(t, err, ErrInvalidCredentials)
+
+	first := staticAuthenticator{user: &models.User{Username: "alice", Roles: models.AssignRoles("local")}}
+	user, err = NewChain(first, NewLDAPAuthenticator(config, &recordingProvisioner{})).
+		Authenticate(context.Background(), "alice", "alice-secret")
+	require.NoError(t, err)
+	assert.Equal(t, models.AssignRoles("local"), user.Roles)
+}
+
+func TestParseGroupRoles(t *testing.T) {
+	mappings, err := ParseGroupRoles("cn=admins,ou=groups,dc=example,dc=org:admin; support : support ;")
+	require.NoError(t, err)
+	assert.Equal(t, []GroupRole{
+		{Group: "cn=admins,ou=groups,dc=example,dc=org", Role: "admin"},
+		{Group: "support", Role: "support"},
+	}, mappings)
+
+	_, err = ParseGroupRoles("admins")
+	assert.Error(t, err)
+}
@@ -0,0 +1,266 @@
+package authn
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	ber "github.com/go-asn1-ber/asn1-ber"
+	"github.com/go-ldap/ldap/v3"
+)
+
+const startTLSOID = "1.3.6.1.4.1.1466.20037"
+
+type stubEntry struct {
+	dn       string
+	password string
+	attrs    map[string][]string
+}
+
+// stubLDAPServer is a minimal in-process LDAP server supporting simple bind,
+// search with and/or/equality/present filters, and StartTLS.
+type stubLDAPServer struct {
+	listener   net.Listener
+	tlsConfig  *tls.Config
+	requireTLS bool
+	entries    []stubEntry
+
+	mu         sync.Mutex
+	tlsStarted bool
+}
+
+func newStubLDAPServer(t *testing.T, requireTLS bool, entries ...stubEntry) (*stubLDAPServer, *x509.CertPool) {
+	t.Helper()
+
+	cert, pool := selfSignedCert(t)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+
+	s := &stubLDAPServer{
+		listener:   listener,
+		tlsConfig:  &tls.Config{Certificates: []tls.Certificate{cert}},
+		requireTLS: requireTLS,
+		entries:    entries,
+	}
+	go s.serve()
+	t.Cleanup(func() { listener.Close() })
+
+	return s, pool
+}
+
+func (s *stubLDAPServer) URL() string {
+	return "ldap://" + s.listener.Addr().String()
+}
+
+func (s *stubLDAPServer) TLSStarted() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.tlsStarted
+}
+
+func (s *stubLDAPServer) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		go s.handle(conn)
+	}
+}
+
+func (s *stubLDAPServer) handle(conn net.Conn) {
+	defer func() { conn.Close() }()
+	secure := false
+
+	for {
+		packet, err := ber.ReadPacket(conn)
+		if err != nil || len(packet.Children) < 2 {
+			return
+		}
+		id := packet.Children[0].Value.(int64)
+		op := packet.Children[1]
+
+		switch op.Tag {
+		case ldap.ApplicationBindRequest:
+			name := op.Children[1].Data.String()
+			password := op.Children[2].Data.String()
+			code := ldap.LDAPResultInvalidCredentials
+			if s.requireTLS && !secure {
+				code = ldap.LDAPResultConfidentialityRequired
+			} else if entry := s.find(name); entry != nil && password != "" && entry.password == password {
+				code = ldap.LDAPResultSuccess
+			}
+			s.write(conn, id, result(ldap.ApplicationBindResponse, code))
+
+		case ldap.ApplicationUnbindRequest:
+			return
+
+		case ldap.ApplicationExtendedRequest:
+			if op.Children[0].Data.String() != startTLSOID || secure {
+				s.write(conn, id, result(ldap.ApplicationExtendedResponse, ldap.LDAPResultProtocolError))
+				continue
+			}
+			s.write(conn, id, result(ldap.ApplicationExtendedResponse, ldap.LDAPResultSuccess))
+			tlsConn := tls.Server(conn, s.tlsConfig)
+			if err := tlsConn.Handshake(); err != nil {
+				return
+			}
+			conn, secure = tlsConn, true
+			s.mu.Lock()
+			s.tlsStarted = true
+			s.mu.Unlock()
+
+		case ldap.ApplicationSearchRequest:
+			base := strings.ToLower(op.Children[0].Data.String())
+			sizeLimit := op.Children[3].Value.(int64)
+			filter := op.Children[6]
+
+			var matches []stubEntry
+			for _, entry := range s.entries {
+				if strings.HasSuffix(strings.ToLower(entry.dn), base) && matchFilter(filter, entry) {
+					matches = append(matches, entry)
+				}
+			}
+
+			code := ldap.LDAPResultSuccess
+			if sizeLimit > 0 && int64(len(matches)) > sizeLimit {
+				matches, code = matches[:sizeLimit], ldap.LDAPResultSizeLimitExceeded
+			}
+			for _, entry := range matches {
+				s.write(conn, id, searchEntry(entry))
+			}
+			s.write(conn, id, result(ldap.ApplicationSearchResultDone, code))
+
+		default:
+			return
+		}
+	}
+}
+
+func (s *stubLDAPServer) find(dn string) *stubEntry {
+	for i := range s.entries {
+		if strings.EqualFold(s.entries[i].dn, dn) {
+			return &s.entries[i]
+		}
+	}
+	return nil
+}
+
+func (s *stubLDAPServer) write(conn net.Conn, id int64, op *ber.Packet) {
+	packet := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "LDAP Response")
+	packet.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, id, "MessageID"))
+	packet.AppendChild(op)
+	conn.Write(packet.Bytes())
+}
+
+func result(tag ber.Tag, code int) *ber.Packet {
+	op := ber.Encode(ber.ClassApplication, ber.TypeConstructed, tag, nil, "Result")
+	op.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagEnumerated, int64(code), "resultCode"))
+	op.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "matchedDN"))
+	op.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "diagnosticMessage"))
+	return op
+}
+
+func searchEntry(entry stubEntry) *ber.Packet {
+	op := ber.Encode(ber.ClassApplication, ber.TypeConstructed, ldap.ApplicationSearchResultEntry, nil, "Entry")
+	op.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, entry.dn, "objectName"))
+	attrs := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "attributes")
+	for name, values := range entry.attrs {
+		attr := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "attribute")
+		attr.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, name, "type"))
+		vals := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSet, nil, "vals")
+		for _, v := range values {
+			vals.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, v, "value"))
+		}
+		attr.AppendChild(vals)
+		attrs.AppendChild(attr)
+	}
+	op.AppendChild(attrs)
+	return op
+}
+
+func matchFilter(f *ber.Packet, entry stubEntry) bool {
+	switch f.Tag {
+	case ldap.FilterAnd:
+		for _, child := range f.Children {
+			if !matchFilter(child, entry) {
+				return false
+			}
+		}
+		return true
+	case ldap.FilterOr:
+		for _, child := range f.Children {
+			if matchFilter(child, entry) {
+				return true
+			}
+		}
+		return false
+	case ldap.FilterNot:
+		return !matchFilter(f.Children[0], entry)
+	case ldap.FilterEqualityMatch:
+		name, value := f.Children[0].Data.String(), f.Children[1].Data.String()
+		for _, v := range attrValues(entry, name) {
+			if strings.EqualFold(v, value) {
+				return true
+			}
+		}
+		return false
+	case ldap.FilterPresent:
+		return len(attrValues(entry, f.Data.String())) > 0
+	default:
+		return false
+	}
+}
+
+func attrValues(entry stubEntry, name string) []string {
+	for k, v := range entry.attrs {
+		if strings.EqualFold(k, name) {
+			return v
+		}
+	}
+	return nil
+}
+
+func selfSignedCert(t *testing.T) (tls.Certificate, *x509.CertPool) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "ldap-stub"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("create certificate: %v", err)
+	}
+	parsed, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("parse certificate: %v", err)
+	}
+
+	pool := x509.NewCertPool()
+	pool.AddCert(parsed)
+
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, pool
+}
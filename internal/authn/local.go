@@ -0,0 +1,38 @@
+package authn
+
+import (
+	"context"
+
+	"github.com/knakul853/accessmesh/internal/models"
+	"github.com/knakul853/accessmesh/internal/store"
+)
+
+// LocalAuthenticator checks passwords stored with the user record.
+type LocalAuthenticator struct {
+	users store.UserRepository
+}
+
+func NewLocalAuthenticator(users store.UserRepository) *LocalAuthenticator {
+	return &LocalAuthenticator{users: users}
+}
+
+func (a *LocalAuthenticator) Name() string {
+	return models.AuthSourceLocal
+}
+
+func (a *LocalAuthenticator) Authenticate(ctx context.Context, username, password string) (*models.User, error) {
+	user, err := a.users.GetByUsername(ctx, username)
+	if err != nil {
+		return nil, ErrInvalidCredentials
+	}
+
+	if !user.IsLocal() {
+		return nil, ErrInvalidCredentials
+	}
+
+	if err := user.ComparePassword(password); err != nil {
+		return nil, ErrInvalidCredentials
+	}
+
+	return user, nil
+}
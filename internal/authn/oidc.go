@@ -0,0 +1,201 @@
+package authn
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"path"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"github.com/knakul853/accessmesh/internal/models"
+	"golang.org/x/oauth2"
+)
+
+// OIDCRoleRule assigns Role when the ID token claim equals Value, or contains
+// it when the claim is a list.
+type OIDCRoleRule struct {
+	Claim string `json:"claim"`
+	Value string `json:"value"`
+	Role  string `json:"role"`
+}
+
+// OIDCProviderConfig configures one upstream OpenID Connect issuer.
+type OIDCProviderConfig struct {
+	ID           string   `json:"id"`
+	Issuer       string   `json:"issuer"`
+	ClientID     string   `json:"client_id"`
+	ClientSecret string   `json:"client_secret"`
+	Scopes       []string `json:"scopes"`
+	// UsernameClaim defaults to preferred_username, falling back to email and sub.
+	UsernameClaim string         `json:"username_claim"`
+	RoleRules     []OIDCRoleRule `json:"role_rules"`
+	DefaultRole   string         `json:"default_role"`
+	// LinkByEmail attaches the login to an existing account with the same
+	// email when the issuer reports the email as verified.
+	LinkByEmail bool `json:"link_by_email"`
+	// Tenant is the tenant the issuer's users belong to, the default one if
+	// empty.
+	Tenant string `json:"tenant"`
+}
+
+// OIDCIdentity is the verified result of an OIDC login.
+type OIDCIdentity struct {
+	Provider      string
+	Subject       string
+	Username      string
+	Email         string
+	EmailVerified bool
+	Role          string
+	AuthSource    string
+	LinkByEmail   bool
+	Tenant        string
+}
+
+// Linker resolves an external identity to a local account, linking or
+// provisioning one as needed.
+type Linker interface {
+	Link(ctx context.Context, identity OIDCIdentity) (*models.User, error)
+}
+
+// OIDCProvider runs the authorization code + PKCE flow against one issuer.
+type OIDCProvider struct {
+	config   OIDCProviderConfig
+	oauth    oauth2.Config
+	verifier *oidc.IDTokenVerifier
+	linker   Linker
+}
+
+// NewOIDCProvider discovers the issuer's endpoints and keys. The callback is
+// served at {rootURL}/api/v1/auth/oidc/{config.ID}/callback.
+func NewOIDCProvider(ctx context.Context, rootURL url.URL, config OIDCProviderConfig, linker Linker) (*OIDCProvider, error) {
+	provider, err := oidc.NewProvider(ctx, config.Issuer)
+	if err != nil {
+		return nil, fmt.Errorf("discover %s: %w", config.Issuer, err)
+	}
+
+	redirectURL := rootURL
+	redirectURL.Path = path.Join(rootURL.Path, "/api/v1/auth/oidc", config.ID, "callback")
+
+	scopes := config.Scopes
+	if len(scopes) == 0 {
+		scopes = []string{"profile", "email"}
+	}
+
+	return &OIDCProvider{
+		config: config,
+		oauth: oauth2.Config{
+			ClientID:     config.ClientID,
+			ClientSecret: config.ClientSecret,
+			Endpoint:     provider.Endpoint(),
+			RedirectURL:  redirectURL.String(),
+			Scopes:       append([]string{oidc.ScopeOpenID}, scopes...),
+		},
+		verifier: provider.Verifier(&oidc.Config{ClientID: config.ClientID}),
+		linker:   linker,
+	}, nil
+}
+
+func (p *OIDCProvider) ID() string {
+	return p.config.ID
+}
+
+// AuthSource identifies users provisioned through this issuer.
+func (p *OIDCProvider) AuthSource() string {
+	return models.AuthSourceOIDC + ":" + p.config.ID
+}
+
+// AuthCodeURL returns the issuer's authorization URL for a new login.
+func (p *OIDCProvider) AuthCodeURL(state, nonce, verifier string) string {
+	return p.oauth.AuthCodeURL(state, oidc.Nonce(nonce), oauth2.S256ChallengeOption(verifier))
+}
+
+// Exchange redeems the authorization code, verifies the ID token against the
+// issuer's JWKS and resolves the local account.
+func (p *OIDCProvider) Exchange(ctx context.Context, code, verifier, nonce string) (*models.User, error) {
+	token, err := p.oauth.Exchange(ctx, code, oauth2.VerifierOption(verifier))
+	if err != nil {
+		return nil, fmt.Errorf("%w: code exchange: %v", ErrInvalidCredentials, err)
+	}
+
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok {
+		return nil, fmt.Errorf("%w: token response has no id_token", ErrInvalidCredentials)
+	}
+
+	idToken, err := p.verifier.Verify(ctx, rawIDToken)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidCredentials, err)
+	}
+	if idToken.Nonce != nonce {
+		return nil, fmt.Errorf("%w: nonce mismatch", ErrInvalidCredentials)
+	}
+
+	var claims map[string]interface{}
+	if err := idToken.Claims(&claims); err != nil {
+		return nil, err
+	}
+
+	identity, err := p.identityFromClaims(idToken.Subject, claims)
+	if err != nil {
+		return nil, err
+	}
+	return p.linker.Link(ctx, identity)
+}
+
+func (p *OIDCProvider) identityFromClaims(subject string, claims map[string]interface{}) (OIDCIdentity, error) {
+	email, _ := claims["email"].(string)
+	emailVerified, _ := claims["email_verified"].(bool)
+
+	usernameClaim := p.config.UsernameClaim
+	if usernameClaim == "" {
+		usernameClaim = "preferred_username"
+	}
+	username, _ := claims[usernameClaim].(string)
+	if username == "" {
+		username = email
+	}
+	if username == "" {
+		username = subject
+	}
+
+	role := p.config.DefaultRole
+	for _, rule := range p.config.RoleRules {
+		if claimMatches(claims[rule.Claim], rule.Value) {
+			role = rule.Role
+			break
+		}
+	}
+	if role == "" {
+		return OIDCIdentity{}, ErrNoRole
+	}
+
+	return OIDCIdentity{
+		Provider:      p.config.ID,
+		Subject:       subject,
+		Username:      username,
+		Email:         email,
+		EmailVerified: emailVerified,
+		Role:          role,
+		AuthSource:    p.AuthSource(),
+		LinkByEmail:   p.config.LinkByEmail,
+		Tenant:        p.config.Tenant,
+	}, nil
+}
+
+func claimMatches(claim interface{}, value string) bool {
+	switch v := claim.(type) {
+	case string:
+		return v == value
+	case bool:
+		return fmt.Sprint(v) == value
+	case float64:
+		return fmt.Sprint(v) == value
+	case []interface{}:
+		for _, item := range v {
+			if claimMatches(item, value) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,298 @@
+package authn
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-jose/go-jose/v4"
+	"github.com/knakul853/accessmesh/internal/models"
+	"github.com/knakul853/accessmesh/internal/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/oauth2"
+)
+
+type pendingCode struct {
+	challenge string
+	claims    map[string]interface{}
+}
+
+// mockIssuer is a minimal OIDC issuer serving discovery, JWKS and a token
+// endpoint that enforces PKCE.
+type mockIssuer struct {
+	*httptest.Server
+	key     *rsa.PrivateKey
+	signKey *rsa.PrivateKey
+
+	mu    sync.Mutex
+	codes map[string]pendingCode
+}
+
+func newMockIssuer(t *testing.T) *mockIssuer {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	m := &mockIssuer{key: key, signKey: key, codes: map[string]pendingCode{}}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"issuer":                                m.URL,
+			"authorization_endpoint":                m.URL + "/authorize",
+			"token_endpoint":                        m.URL + "/token",
+			"jwks_uri":                              m.URL + "/jwks",
+			"id_token_signing_alg_values_supported": []string{"RS256"},
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(jose.JSONWebKeySet{Keys: []jose.JSONWebKey{{
+			Key: &m.key.PublicKey, KeyID: "test", Algorithm: "RS256", Use: "sig",
+		}}})
+	})
+	mux.HandleFunc("/token", m.token)
+	m.Server = httptest.NewServer(mux)
+	t.Cleanup(m.Close)
+
+	return m
+}
+
+// authorize simulates the user approving the login at the issuer.
+func (m *mockIssuer) authorize(t *testing.T, authURL string, claims map[string]interface{}) string {
+	t.Helper()
+
+	u, err := url.Parse(authURL)
+	require.NoError(t, err)
+	q := u.Query()
+	require.Equal(t, "S256", q.Get("code_challenge_method"))
+
+	claims["nonce"] = q.Get("nonce")
+	claims["aud"] = q.Get("client_id")
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.codes["code-1"] = pendingCode{challenge: q.Get("code_challenge"), claims: claims}
+	return "code-1"
+}
+
+func (m *mockIssuer) token(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+
+	m.mu.Lock()
+	pending, ok := m.codes[r.PostForm.Get("code")]
+	delete(m.codes, r.PostForm.Get("code"))
+	m.mu.Unlock()
+
+	sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+	if !ok || base64.RawURLEncoding.EncodeToString(sum[:]) != pending.challenge {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"error":"invalid_grant"}`))
+		return
+	}
+
+	claims := map[string]interface{}{
+		"iss": m.URL,
+		"iat": time.Now().Unix(),
+		"exp": time.Now().Add(time.Hour).Unix(),
+	}
+	for k, v := range pending.claims {
+		claims[k] = v
+	}
+
+	signer, _ := jose.NewSigner(jose.SigningKey{Algorithm: jose.RS256, Key: jose.JSONWebKey{Key: m.signKey, KeyID: "test"}}, nil)
+	payload, _ := json.Marshal(claims)
+	jws, _ := signer.Sign(payload)
+	idToken, _ := jws.CompactSerialize()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"access_token": "access",
+		"token_type":   "Bearer",
+		"id_token":     idToken,
+	})
+}
+
+type recordingLinker struct {
+	identities []OIDCIdentity
+}
+
+func (l *recordingLinker) Link(ctx context.Context, identity OIDCIdentity) (*models.User, error) {
+	l.identities = append(l.identities, identity)
+	return &models.User{
+		Username:      identity.Username,
+		Email:         identity.Email,
+		EmailVerified: identity.EmailVerified,
+		Roles:         models.AssignRoles(identity.Role),
+		AuthSource:    identity.AuthSource,
+	}, nil
+}
+
+func newTestOIDCProvider(t *testing.T, issuer *mockIssuer, linker Linker) *OIDCProvider {
+	t.Helper()
+
+	p, err := NewOIDCProvider(context.Background(), url.URL{Scheme: "https", Host: "accessmesh.example.org"}, OIDCProviderConfig{
+		ID:       "corp",
+		Issuer:   issuer.URL,
+		ClientID: "accessmesh",
+		RoleRules: []OIDCRoleRule{
+			{Claim: "groups", Value: "platform", Role: "admin"},
+			{Claim: "department", Value: "support", Role: "support"},
+		},
+		LinkByEmail: true,
+	}, linker)
+	require.NoError(t, err)
+	return p
+}
+
+func userClaims(groups ...string) map[string]interface{} {
+	return map[string]interface{}{
+		"sub":                "user-42",
+		"preferred_username": "alice",
+		"email":              "alice@corp.example",
+		"email_verified":     true,
+		"groups":             groups,
+	}
+}
+
+func TestOIDCProvider_AuthCodeURL(t *testing.T) {
+	issuer := newMockIssuer(t)
+	p := newTestOIDCProvider(t, issuer, &recordingLinker{})
+
+	u, err := url.Parse(p.AuthCodeURL("state-1", "nonce-1", oauth2.GenerateVerifier()))
+	require.NoError(t, err)
+	q := u.Query()
+
+	assert.Equal(t, issuer.URL+"/authorize", u.Scheme+"://"+u.Host+u.Path)
+	assert.Equal(t, "state-1", q.Get("state"))
+	assert.Equal(t, "nonce-1", q.Get("nonce"))
+	assert.Equal(t, "S256", q.Get("code_challenge_method"))
+	assert.Equal(t, "https://accessmesh.example.org/api/v1/auth/oidc/corp/callback", q.Get("redirect_uri"))
+	assert.Contains(t, q.Get("scope"), "openid")
+}
+
+func TestOIDCProvider_Exchange(t *testing.T) {
+	issuer := newMockIssuer(t)
+	linker := &recordingLinker{}
+	p := newTestOIDCProvider(t, issuer, linker)
+
+	verifier := oauth2.GenerateVerifier()
+	code := issuer.authorize(t, p.AuthCodeURL("state", "nonce-1", verifier), userClaims("staff", "platform"))
+
+	user, err := p.Exchange(context.Background(), code, verifier, "nonce-1")
+	require.NoError(t, err)
+
+	assert.Equal(t, "alice", user.Username)
+	assert.Equal(t, []string{"admin"}, user.ActiveRoles(time.Now()))
+	require.Len(t, linker.identities, 1)
+	assert.Equal(t, OIDCIdentity{
+		Provider:      "corp",
+		Subject:       "user-42",
+		Username:      "alice",
+		Email:         "alice@corp.example",
+		EmailVerified: true,
+		Role:          "admin",
+		AuthSource:    models.AuthSourceOIDC + ":corp",
+		LinkByEmail:   true,
+	}, linker.identities[0])
+}
+
+func TestOIDCProvider_ExchangeRejects(t *testing.T) {
+	t.Run("wrong PKCE verifier", func(t *testing.T) {
+		issuer := newMockIssuer(t)
+		p := newTestOIDCProvider(t, issuer, &recordingLinker{})
+		code := issuer.authorize(t, p.AuthCodeURL("state", "nonce", oauth2.GenerateVerifier()), userClaims("platform"))
+
+		_, err := p.Exchange(context.Background(), code, oauth2.GenerateVerifier(), "nonce")
+		assert.ErrorIs(t, err, ErrInvalidCredentials)
+	})
+
+	t.Run("nonce mismatch", func(t *testing.T) {
+		issuer := newMockIssuer(t)
+		p := newTestOIDCProvider(t, issuer, &recordingLinker{})
+		verifier := oauth2.GenerateVerifier()
+		code := issuer.authorize(t, p.AuthCodeURL("state", "nonce", verifier), userClaims("platform"))
+
+		_, err := p.Exchange(context.Background(), code, verifier, "other-nonce")
+		assert.ErrorIs(t, err, ErrInvalidCredentials)
+	})
+
+	t.Run("signed with unknown key", func(t *testing.T) {
+		issuer := newMockIssuer(t)
+		rogue, err := rsa.GenerateKey(rand.Reader, 2048)
+		require.NoError(t, err)
+		issuer.signKey = rogue
+
+		p := newTestOIDCProvider(t, issuer, &recordingLinker{})
+		verifier := oauth2.GenerateVerifier()
+		code := issuer.authorize(t, p.AuthCodeURL("state", "nonce", verifier), userClaims("platform"))
+
+		_, err = p.Exchange(context.Background(), code, verifier, "nonce")
+		assert.ErrorIs(t, err, ErrInvalidCredentials)
+	})
+
+	t.Run("no matching role rule", func(t *testing.T) {
+		issuer := newMockIssuer(t)
+		linker := &recordingLinker{}
+		p := newTestOIDCProvider(t, issuer, linker)
+		verifier := oauth2.GenerateVerifier()
+		code := issuer.authorize(t, p.AuthCodeURL("state", "nonce", verifier), userClaims("sales"))
+
+		_, err := p.Exchange(context.Background(), code, verifier, "nonce")
+		assert.ErrorIs(t, err, ErrNoRole)
+		assert.Empty(t, linker.identities)
+	})
+}
+
+func TestUserLinker_Tenants(t *testing.T) {
+	ctx := context.Background()
+	users := store.NewMemoryStore().Users()
+	linker := NewUserLinker(users)
+	identity := OIDCIdentity{
+		Provider: "corp", Subject: "user-42", Username: "alice", Email: "alice@corp.example", EmailVerified: true,
+		Role: "admin", AuthSource: models.AuthSourceOIDC + ":corp", LinkByEmail: true, Tenant: "acme",
+	}
+
+	// New accounts are created in the issuer's tenant.
+	user, err := linker.Link(ctx, identity)
+	require.NoError(t, err)
+	assert.Equal(t, "acme", user.TenantID)
+	again, err := linker.Link(ctx, identity)
+	require.NoError(t, err)
+	assert.Equal(t, user.ID, again.ID)
+
+	// An account with the same email in another tenant is not linked.
+	bob := &models.User{Username: "bob", Email: "bob@corp.example", EmailVerified: true, AuthSource: models.AuthSourceLocal}
+	require.NoError(t, users.Create(ctx, bob))
+	other := identity
+	other.Subject, other.Username, other.Email = "user-43", "bob-corp", "bob@corp.example"
+	_, err = linker.Link(ctx, other)
+	assert.ErrorIs(t, err, ErrAccountConflict)
+	stored, err := users.Get(ctx, bob.ID.Hex())
+	require.NoError(t, err)
+	assert.Empty(t, stored.Identities)
+
+	// Nor is an identity whose account has since moved to another tenant.
+	again.TenantID = "globex"
+	require.NoError(t, users.Update(ctx, again))
+	_, err = linker.Link(ctx, identity)
+	assert.ErrorIs(t, err, ErrAccountConflict)
+}
+
+func TestClaimMatches(t *testing.T) {
+	assert.True(t, claimMatches("support", "support"))
+	assert.True(t, claimMatches([]interface{}{"a", "support"}, "support"))
+	assert.True(t, claimMatches(true, "true"))
+	assert.False(t, claimMatches(nil, "support"))
+	assert.False(t, claimMatches([]interface{}{"a"}, "support"))
+}
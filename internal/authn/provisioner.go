@@ -0,0 +1,153 @@
+package authn
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/knakul853/accessmesh/internal/models"
+	"github.com/knakul853/accessmesh/internal/store"
+)
+
+// Provisioner creates or refreshes the local record of an externally
+// authenticated user.
+type Provisioner interface {
+	Provision(ctx context.Context, user *models.User) (*models.User, error)
+}
+
+// UserProvisioner stores externally authenticated users in the user
+// repository, in the user's tenant or the default one. Usernames are unique
+// across tenants, so a user whose account lives in another tenant is
+// refused rather than moved.
+type UserProvisioner struct {
+	users store.UserRepository
+}
+
+func NewUserProvisioner(users store.UserRepository) *UserProvisioner {
+	return &UserProvisioner{users: users}
+}
+
+func (p *UserProvisioner) Provision(ctx context.Context, user *models.User) (*models.User, error) {
+	existing, err := p.users.GetByUsername(ctx, user.Username)
+	if errors.Is(err, store.ErrNotFound) {
+		now := time.Now()
+		provisioned := *user
+		provisioned.Password = ""
+		provisioned.CreatedAt = now
+		provisioned.UpdatedAt = now
+		if err := p.users.Create(ctx, &provisioned); err != nil {
+			return nil, err
+		}
+		return &provisioned, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if existing.AuthSource != user.AuthSource || tenantOf(existing.TenantID) != tenantOf(user.TenantID) {
+		return nil, ErrAccountConflict
+	}
+
+	existing.Email = user.Email
+	existing.Roles = user.Roles
+	existing.EmailVerified = user.EmailVerified
+	if err := p.users.Update(ctx, existing); err != nil {
+		return nil, err
+	}
+	return existing, nil
+}
+
+func tenantOf(tenantID string) string {
+	if tenantID == "" {
+		return models.DefaultTenant
+	}
+	return tenantID
+}
+
+// UserLinker resolves OIDC identities against the user repository, within
+// the identity's tenant. Like UserProvisioner, it refuses accounts of another
+// tenant rather than linking or moving them.
+type UserLinker struct {
+	users store.UserRepository
+}
+
+func NewUserLinker(users store.UserRepository) *UserLinker {
+	return &UserLinker{users: users}
+}
+
+// Link returns the account already linked to the identity, otherwise links
+// the identity to an account with the same verified email (when allowed),
+// otherwise provisions a new account.
+func (l *UserLinker) Link(ctx context.Context, identity OIDCIdentity) (*models.User, error) {
+	now := time.Now()
+	tenant := tenantOf(identity.Tenant)
+
+	user, err := l.users.GetByIdentity(ctx, identity.Provider, identity.Subject)
+	if err == nil {
+		if tenantOf(user.TenantID) != tenant {
+			return nil, ErrAccountConflict
+		}
+		// Only accounts created by this provider follow its claims; linked
+		// local accounts keep their own role.
+		if user.AuthSource == identity.AuthSource {
+			user.Email = identity.Email
+			user.EmailVerified = identity.EmailVerified
+			user.Roles = models.AssignRoles(identity.Role)
+			if err := l.users.Update(ctx, user); err != nil {
+				return nil, err
+			}
+		}
+		return user, nil
+	}
+	if !errors.Is(err, store.ErrNotFound) {
+		return nil, err
+	}
+
+	link := models.ExternalIdentity{
+		Provider: identity.Provider,
+		Subject:  identity.Subject,
+		LinkedAt: now,
+	}
+
+	if identity.LinkByEmail && identity.Email != "" {
+		user, err = l.users.GetByEmail(ctx, identity.Email)
+		if err == nil {
+			if tenantOf(user.TenantID) != tenant {
+				return nil, ErrAccountConflict
+			}
+			if !identity.EmailVerified || !user.EmailVerified {
+				return nil, ErrUnverifiedEmail
+			}
+			user.Identities = append(user.Identities, link)
+			if err := l.users.Update(ctx, user); err != nil {
+				return nil, err
+			}
+			return user, nil
+		}
+		if !errors.Is(err, store.ErrNotFound) {
+			return nil, err
+		}
+	}
+
+	if _, err := l.users.GetByUsername(ctx, identity.Username); err == nil {
+		return nil, ErrAccountConflict
+	} else if !errors.Is(err, store.ErrNotFound) {
+		return nil, err
+	}
+
+	user = &models.User{
+		TenantID:      tenant,
+		Username:      identity.Username,
+		Email:         identity.Email,
+		EmailVerified: identity.EmailVerified,
+		Roles:         models.AssignRoles(identity.Role),
+		AuthSource:    identity.AuthSource,
+		Identities:    []models.ExternalIdentity{link},
+		CreatedAt:     now,
+		UpdatedAt:     now,
+	}
+	if err := l.users.Create(ctx, user); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
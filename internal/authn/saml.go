@@ -0,0 +1,177 @@
+package authn
+
+import (
+	"context"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+
+	"github.com/crewjam/saml"
+	"github.com/knakul853/accessmesh/internal/models"
+)
+
+// SAMLAttributeMapping names the assertion attributes holding user fields.
+// Names match either the attribute Name or its FriendlyName.
+type SAMLAttributeMapping struct {
+	// Username defaults to the assertion's NameID when empty.
+	Username string `json:"username"`
+	Email    string `json:"email"`
+	Groups   string `json:"groups"`
+}
+
+// SAMLIdentityProvider configures one upstream IdP. Several may be registered
+// for the same tenant.
+type SAMLIdentityProvider struct {
+	ID     string `json:"id"`
+	Tenant string `json:"tenant"`
+	// Either MetadataURL or MetadataXML must be set.
+	MetadataURL       string               `json:"metadata_url"`
+	MetadataXML       string               `json:"metadata_xml"`
+	Attributes        SAMLAttributeMapping `json:"attributes"`
+	GroupRoles        []GroupRole          `json:"group_roles"`
+	DefaultRole       string               `json:"default_role"`
+	AllowIDPInitiated bool                 `json:"allow_idp_initiated"`
+}
+
+// SAMLServiceProvider is the AccessMesh side of the SAML trust with one IdP.
+type SAMLServiceProvider struct {
+	idp         SAMLIdentityProvider
+	sp          *saml.ServiceProvider
+	provisioner Provisioner
+}
+
+// NewSAMLServiceProvider builds the service provider for idp. Its endpoints
+// live under {rootURL}/api/v1/auth/saml/{idp.ID}/.
+func NewSAMLServiceProvider(rootURL url.URL, key *rsa.PrivateKey, cert *x509.Certificate, idp SAMLIdentityProvider, metadata *saml.EntityDescriptor, provisioner Provisioner) *SAMLServiceProvider {
+	base := rootURL
+	base.Path = path.Join(rootURL.Path, "/api/v1/auth/saml", idp.ID)
+
+	metadataURL := base
+	metadataURL.Path = path.Join(base.Path, "metadata")
+	acsURL := base
+	acsURL.Path = path.Join(base.Path, "acs")
+
+	return &SAMLServiceProvider{
+		idp: idp,
+		sp: &saml.ServiceProvider{
+			EntityID:          metadataURL.String(),
+			Key:               key,
+			Certificate:       cert,
+			MetadataURL:       metadataURL,
+			AcsURL:            acsURL,
+			IDPMetadata:       metadata,
+			AllowIDPInitiated: idp.AllowIDPInitiated,
+		},
+		provisioner: provisioner,
+	}
+}
+
+func (p *SAMLServiceProvider) ID() string {
+	return p.idp.ID
+}
+
+func (p *SAMLServiceProvider) Tenant() string {
+	return p.idp.Tenant
+}
+
+// AuthSource identifies users provisioned through this IdP.
+func (p *SAMLServiceProvider) AuthSource() string {
+	return models.AuthSourceSAML + ":" + p.idp.ID
+}
+
+// Metadata returns the SP metadata document to register with the IdP.
+func (p *SAMLServiceProvider) Metadata() ([]byte, error) {
+	return xml.MarshalIndent(p.sp.Metadata(), "", "  ")
+}
+
+// AuthnRequestURL returns the IdP redirect URL for a new login together with
+// the request ID that the response must answer.
+func (p *SAMLServiceProvider) AuthnRequestURL(relayState string) (*url.URL, string, error) {
+	req, err := p.sp.MakeAuthenticationRequest(
+		p.sp.GetSSOBindingLocation(saml.HTTPRedirectBinding),
+		saml.HTTPRedirectBinding,
+		saml.HTTPPostBinding,
+	)
+	if err != nil {
+		return nil, "", err
+	}
+
+	redirect, err := req.Redirect(relayState, p.sp)
+	if err != nil {
+		return nil, "", err
+	}
+	return redirect, req.ID, nil
+}
+
+// Authenticate validates the signed SAML response posted to the ACS endpoint,
+// maps it to a user and provisions that user locally, in the IdP's tenant.
+func (p *SAMLServiceProvider) Authenticate(ctx context.Context, r *http.Request, requestIDs []string) (*models.User, error) {
+	if err := r.ParseForm(); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidCredentials, err)
+	}
+
+	assertion, err := p.sp.ParseResponse(r, requestIDs)
+	if err != nil {
+		var invalid *saml.InvalidResponseError
+		if errors.As(err, &invalid) {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidCredentials, invalid.PrivateErr)
+		}
+		return nil, err
+	}
+
+	username := firstAttributeValue(assertion, p.idp.Attributes.Username)
+	if username == "" && assertion.Subject != nil && assertion.Subject.NameID != nil {
+		username = assertion.Subject.NameID.Value
+	}
+	if username == "" {
+		return nil, fmt.Errorf("%w: assertion has no username", ErrInvalidCredentials)
+	}
+
+	role := mapGroupRole(p.idp.GroupRoles, attributeValues(assertion, p.idp.Attributes.Groups), p.idp.DefaultRole)
+	if role == "" {
+		return nil, ErrNoRole
+	}
+
+	email := firstAttributeValue(assertion, p.idp.Attributes.Email)
+	user := &models.User{
+		TenantID:      p.Tenant(),
+		Username:      username,
+		Email:         email,
+		Roles:         models.AssignRoles(role),
+		EmailVerified: email != "",
+		AuthSource:    p.AuthSource(),
+	}
+
+	return p.provisioner.Provision(ctx, user)
+}
+
+func attributeValues(assertion *saml.Assertion, name string) []string {
+	if name == "" {
+		return nil
+	}
+
+	var values []string
+	for _, statement := range assertion.AttributeStatements {
+		for _, attr := range statement.Attributes {
+			if attr.Name != name && attr.FriendlyName != name {
+				continue
+			}
+			for _, v := range attr.Values {
+				values = append(values, v.Value)
+			}
+		}
+	}
+	return values
+}
+
+func firstAttributeValue(assertion *saml.Assertion, name string) string {
+	if values := attributeValues(assertion, name); len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
@@ -0,0 +1,207 @@
+package authn
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/beevik/etree"
+	"github.com/crewjam/saml"
+	"github.com/knakul853/accessmesh/internal/models"
+	"github.com/knakul853/accessmesh/internal/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func rsaKeyPair(t *testing.T, name string) (*rsa.PrivateKey, *x509.Certificate) {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	return key, cert
+}
+
+func newTestIDP(t *testing.T) *saml.IdentityProvider {
+	key, cert := rsaKeyPair(t, "idp")
+	return &saml.IdentityProvider{
+		Key:         key,
+		Certificate: cert,
+		MetadataURL: url.URL{Scheme: "https", Host: "idp.example.org", Path: "/metadata"},
+		SSOURL:      url.URL{Scheme: "https", Host: "idp.example.org", Path: "/sso"},
+	}
+}
+
+func newTestSAMLProvider(t *testing.T, idp *saml.IdentityProvider, provisioner Provisioner) *SAMLServiceProvider {
+	key, cert := rsaKeyPair(t, "sp")
+	rootURL := url.URL{Scheme: "https", Host: "accessmesh.example.org"}
+
+	return NewSAMLServiceProvider(rootURL, key, cert, SAMLIdentityProvider{
+		ID:         "okta",
+		Tenant:     "acme",
+		Attributes: SAMLAttributeMapping{Username: "uid", Email: "email", Groups: "groups"},
+		GroupRoles: []GroupRole{{Group: "engineering", Role: "developer"}},
+	}, idp.Metadata(), provisioner)
+}
+
+// postResponse has idp answer requestID with a signed assertion for session
+// and returns the resulting ACS request.
+func postResponse(t *testing.T, idp *saml.IdentityProvider, p *SAMLServiceProvider, requestID string, session *saml.Session) *http.Request {
+	t.Helper()
+
+	spMetadata := p.sp.Metadata()
+	req := &saml.IdpAuthnRequest{
+		IDP:                     idp,
+		HTTPRequest:             httptest.NewRequest(http.MethodGet, "/sso", nil),
+		Request:                 saml.AuthnRequest{ID: requestID, IssueInstant: saml.TimeNow()},
+		ServiceProviderMetadata: spMetadata,
+		SPSSODescriptor:         &spMetadata.SPSSODescriptors[0],
+		ACSEndpoint:             &spMetadata.SPSSODescriptors[0].AssertionConsumerServices[0],
+		Now:                     saml.TimeNow(),
+	}
+	require.NoError(t, saml.DefaultAssertionMaker{}.MakeAssertion(req, session))
+	require.NoError(t, req.MakeAssertionEl())
+	require.NoError(t, req.MakeResponse())
+
+	doc := etree.NewDocument()
+	doc.SetRoot(req.ResponseEl)
+	body, err := doc.WriteToBytes()
+	require.NoError(t, err)
+
+	form := url.Values{"SAMLResponse": {base64.StdEncoding.EncodeToString(body)}}
+	r := httptest.NewRequest(http.MethodPost, p.sp.AcsURL.String(), strings.NewReader(form.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return r
+}
+
+func testSession(groups ...string) *saml.Session {
+	return &saml.Session{
+		ID:         "session-1",
+		CreateTime: saml.TimeNow(),
+		ExpireTime: saml.TimeNow().Add(time.Hour),
+		NameID:     "alice@acme.example",
+		UserName:   "alice",
+		CustomAttributes: []saml.Attribute{
+			{Name: "email", Values: []saml.AttributeValue{{Type: "xs:string", Value: "alice@acme.example"}}},
+			{Name: "groups", Values: func() []saml.AttributeValue {
+				var values []saml.AttributeValue
+				for _, g := range groups {
+					values = append(values, saml.AttributeValue{Type: "xs:string", Value: g})
+				}
+				return values
+			}()},
+		},
+	}
+}
+
+func TestSAMLServiceProvider_Metadata(t *testing.T) {
+	p := newTestSAMLProvider(t, newTestIDP(t), &recordingProvisioner{})
+
+	metadata, err := p.Metadata()
+	require.NoError(t, err)
+	assert.Contains(t, string(metadata), `entityID="https://accessmesh.example.org/api/v1/auth/saml/okta/metadata"`)
+	assert.Contains(t, string(metadata), `Location="https://accessmesh.example.org/api/v1/auth/saml/okta/acs"`)
+}
+
+func TestSAMLServiceProvider_AuthnRequest(t *testing.T) {
+	p := newTestSAMLProvider(t, newTestIDP(t), &recordingProvisioner{})
+
+	redirect, requestID, err := p.AuthnRequestURL("")
+	require.NoError(t, err)
+	assert.Equal(t, "idp.example.org", redirect.Host)
+	assert.NotEmpty(t, redirect.Query().Get("SAMLRequest"))
+	assert.NotEmpty(t, requestID)
+}
+
+func TestSAMLServiceProvider_Authenticate(t *testing.T) {
+	idp := newTestIDP(t)
+	provisioner := &recordingProvisioner{}
+	p := newTestSAMLProvider(t, idp, provisioner)
+
+	user, err := p.Authenticate(context.Background(),
+		postResponse(t, idp, p, "id-123", testSession("engineering")), []string{"id-123"})
+	require.NoError(t, err)
+
+	assert.Equal(t, "alice", user.Username)
+	assert.Equal(t, "acme", user.TenantID)
+	assert.Equal(t, "alice@acme.example", user.Email)
+	assert.Equal(t, models.AssignRoles("developer"), user.Roles)
+	assert.True(t, user.EmailVerified)
+	assert.Equal(t, models.AuthSourceSAML+":okta", user.AuthSource)
+	assert.Len(t, provisioner.users, 1)
+}
+
+func TestSAMLServiceProvider_ProvisionsIntoTenant(t *testing.T) {
+	idp := newTestIDP(t)
+	users := store.NewMemoryStore().Users()
+	p := newTestSAMLProvider(t, idp, NewUserProvisioner(users))
+	login := func() (*models.User, error) {
+		return p.Authenticate(context.Background(),
+			postResponse(t, idp, p, "id-123", testSession("engineering")), []string{"id-123"})
+	}
+
+	user, err := login()
+	require.NoError(t, err)
+	stored, err := users.GetByUsername(context.Background(), "alice")
+	require.NoError(t, err)
+	assert.Equal(t, "acme", stored.TenantID)
+
+	// The next login updates the same account.
+	again, err := login()
+	require.NoError(t, err)
+	assert.Equal(t, user.ID, again.ID)
+
+	// An account of the same name in another tenant is not taken over.
+	stored, err = users.GetByUsername(context.Background(), "alice")
+	require.NoError(t, err)
+	stored.TenantID = models.DefaultTenant
+	require.NoError(t, users.Update(context.Background(), stored))
+	_, err = login()
+	assert.ErrorIs(t, err, ErrAccountConflict)
+}
+
+func TestSAMLServiceProvider_Rejects(t *testing.T) {
+	idp := newTestIDP(t)
+	p := newTestSAMLProvider(t, idp, &recordingProvisioner{})
+
+	t.Run("unexpected request id", func(t *testing.T) {
+		_, err := p.Authenticate(context.Background(),
+			postResponse(t, idp, p, "id-123", testSession("engineering")), []string{"id-other"})
+		assert.ErrorIs(t, err, ErrInvalidCredentials)
+	})
+
+	t.Run("untrusted signing key", func(t *testing.T) {
+		rogue := newTestIDP(t)
+		_, err := p.Authenticate(context.Background(),
+			postResponse(t, rogue, p, "id-123", testSession("engineering")), []string{"id-123"})
+		assert.ErrorIs(t, err, ErrInvalidCredentials)
+	})
+
+	t.Run("no mapped group", func(t *testing.T) {
+		_, err := p.Authenticate(context.Background(),
+			postResponse(t, idp, p, "id-123", testSession("sales")), []string{"id-123"})
+		assert.ErrorIs(t, err, ErrNoRole)
+	})
+}
@@ -0,0 +1,202 @@
+package authn
+
+import (
+	"context"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/crewjam/saml"
+	"github.com/knakul853/accessmesh/internal/config"
+	"github.com/knakul853/accessmesh/internal/models"
+	"github.com/knakul853/accessmesh/internal/store"
+)
+
+// NewChainFromConfig builds the login chain from the configured backend names.
+func NewChainFromConfig(cfg *config.Config, users store.UserRepository) (Chain, error) {
+	var chain Chain
+	for _, name := range cfg.AuthBackends {
+		switch name {
+		case models.AuthSourceLocal:
+			chain = append(chain, NewLocalAuthenticator(users))
+		case models.AuthSourceLDAP:
+			ldapConfig, err := ldapConfigFrom(cfg.LDAP)
+			if err != nil {
+				return nil, err
+			}
+			chain = append(chain, NewLDAPAuthenticator(ldapConfig, NewUserProvisioner(users)))
+		default:
+			return nil, fmt.Errorf("unknown auth backend %q", name)
+		}
+	}
+
+	if len(chain) == 0 {
+		return nil, fmt.Errorf("no auth backends configured")
+	}
+	return chain, nil
+}
+
+func ldapConfigFrom(cfg config.LDAPConfig) (LDAPConfig, error) {
+	if cfg.URL == "" || cfg.BaseDN == "" {
+		return LDAPConfig{}, fmt.Errorf("ldap backend requires LDAP_URL and LDAP_BASE_DN")
+	}
+
+	groupRoles, err := ParseGroupRoles(cfg.GroupRoles)
+	if err != nil {
+		return LDAPConfig{}, err
+	}
+
+	var tlsConfig *tls.Config
+	if cfg.InsecureSkipVerify {
+		tlsConfig = &tls.Config{InsecureSkipVerify: true}
+	}
+
+	return LDAPConfig{
+		URL:            cfg.URL,
+		StartTLS:       cfg.StartTLS,
+		TLSConfig:      tlsConfig,
+		BindDN:         cfg.BindDN,
+		BindPassword:   cfg.BindPassword,
+		BaseDN:         cfg.BaseDN,
+		UserFilter:     cfg.UserFilter,
+		EmailAttribute: cfg.EmailAttribute,
+		GroupAttribute: cfg.GroupAttribute,
+		GroupRoles:     groupRoles,
+		DefaultRole:    cfg.DefaultRole,
+		Tenant:         cfg.Tenant,
+	}, nil
+}
+
+// LoadSAMLProviders reads the SP keypair and the IdP list configured in cfg.
+// It returns no providers when SAML is not configured.
+func LoadSAMLProviders(publicURL string, cfg config.SAMLConfig, users store.UserRepository) (map[string]*SAMLServiceProvider, error) {
+	providers := map[string]*SAMLServiceProvider{}
+	if cfg.ProvidersFile == "" {
+		return providers, nil
+	}
+
+	rootURL, err := url.Parse(publicURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid PUBLIC_URL: %w", err)
+	}
+
+	keyPair, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("load SAML keypair: %w", err)
+	}
+	key, ok := keyPair.PrivateKey.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("SAML key must be an RSA key")
+	}
+	cert, err := x509.ParseCertificate(keyPair.Certificate[0])
+	if err != nil {
+		return nil, fmt.Errorf("parse SAML certificate: %w", err)
+	}
+
+	data, err := os.ReadFile(cfg.ProvidersFile)
+	if err != nil {
+		return nil, err
+	}
+	var idps []SAMLIdentityProvider
+	if err := json.Unmarshal(data, &idps); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", cfg.ProvidersFile, err)
+	}
+
+	provisioner := NewUserProvisioner(users)
+	for _, idp := range idps {
+		if idp.ID == "" {
+			return nil, fmt.Errorf("SAML identity provider without id")
+		}
+		if _, exists := providers[idp.ID]; exists {
+			return nil, fmt.Errorf("duplicate SAML identity provider %q", idp.ID)
+		}
+
+		metadata, err := loadIDPMetadata(idp)
+		if err != nil {
+			return nil, fmt.Errorf("SAML identity provider %q: %w", idp.ID, err)
+		}
+		providers[idp.ID] = NewSAMLServiceProvider(*rootURL, key, cert, idp, metadata, provisioner)
+		log.Printf("Registered SAML identity provider %s for tenant %s", idp.ID, idp.Tenant)
+	}
+
+	return providers, nil
+}
+
+func loadIDPMetadata(idp SAMLIdentityProvider) (*saml.EntityDescriptor, error) {
+	data := []byte(idp.MetadataXML)
+	if len(data) == 0 {
+		if idp.MetadataURL == "" {
+			return nil, fmt.Errorf("metadata_url or metadata_xml is required")
+		}
+
+		client := &http.Client{Timeout: 10 * time.Second}
+		resp, err := client.Get(idp.MetadataURL)
+		if err != nil {
+			return nil, fmt.Errorf("fetch metadata: %w", err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("fetch metadata: unexpected status %d", resp.StatusCode)
+		}
+		if data, err = io.ReadAll(io.LimitReader(resp.Body, 1<<20)); err != nil {
+			return nil, fmt.Errorf("fetch metadata: %w", err)
+		}
+	}
+
+	metadata := &saml.EntityDescriptor{}
+	if err := xml.Unmarshal(data, metadata); err != nil {
+		return nil, fmt.Errorf("parse metadata: %w", err)
+	}
+	return metadata, nil
+}
+
+// LoadOIDCProviders runs discovery for every issuer configured in cfg. It
+// returns no providers when OIDC is not configured.
+func LoadOIDCProviders(ctx context.Context, publicURL string, cfg config.OIDCConfig, users store.UserRepository) (map[string]*OIDCProvider, error) {
+	providers := map[string]*OIDCProvider{}
+	if cfg.ProvidersFile == "" {
+		return providers, nil
+	}
+
+	rootURL, err := url.Parse(publicURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid PUBLIC_URL: %w", err)
+	}
+
+	data, err := os.ReadFile(cfg.ProvidersFile)
+	if err != nil {
+		return nil, err
+	}
+	var configs []OIDCProviderConfig
+	if err := json.Unmarshal(data, &configs); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", cfg.ProvidersFile, err)
+	}
+
+	linker := NewUserLinker(users)
+	for _, c := range configs {
+		if c.ID == "" || c.Issuer == "" || c.ClientID == "" {
+			return nil, fmt.Errorf("OIDC provider requires id, issuer and client_id")
+		}
+		if _, exists := providers[c.ID]; exists {
+			return nil, fmt.Errorf("duplicate OIDC provider %q", c.ID)
+		}
+
+		provider, err := NewOIDCProvider(ctx, *rootURL, c, linker)
+		if err != nil {
+			return nil, fmt.Errorf("OIDC provider %q: %w", c.ID, err)
+		}
+		providers[c.ID] = provider
+		log.Printf("Registered OIDC provider %s (%s) for tenant %s", c.ID, c.Issuer, tenantOf(c.Tenant))
+	}
+
+	return providers, nil
+}
@@ -1,18 +1,166 @@
 package config
 
-import "os"
+import (
+	"log"
+	"os"
+	"strings"
+	"time"
+)
+
+// Storage backends selectable with STORE.
+const (
+	StoreMongo    = "mongo"
+	StorePostgres = "postgres"
+	StoreSQLite   = "sqlite"
+	StoreMemory   = "memory"
+)
 
 type Config struct {
-	MongoURI    string
+	// Store selects the storage backend: "mongo" (default), "postgres",
+	// "sqlite" or "memory".
+	Store    string
+	MongoURI string
+	// MongoAutoMigrate applies pending MongoDB migrations at startup. When
+	// disabled, run `server migrate` before starting new versions. The SQL
+	// backends always migrate when opened.
+	MongoAutoMigrate bool
+	// EnforcerWatch keeps each replica's Casbin rules in step with the ones
+	// other replicas write to MongoDB.
+	EnforcerWatch bool
+	// EnforcerPollInterval is how often rules are polled when MongoDB offers
+	// no change streams, and the delay before a lost stream is reopened.
+	EnforcerPollInterval time.Duration
+	// ReplicaID names this instance's saved change stream position. It
+	// defaults to the host name.
+	ReplicaID string
+	// PostgresURL is a libpq-style connection string, used when Store is
+	// "postgres".
+	PostgresURL string
+	// SQLitePath is the database file used when Store is "sqlite".
+	SQLitePath  string
 	JWTSecret   string
 	Environment string
+	// PublicURL is the externally reachable base URL of this server, used to
+	// build SSO callback URLs.
+	PublicURL string
+	// SoftDeleteRetention is how long deleted users, roles and policies stay
+	// in the trash before they are purged for good. Zero keeps them forever.
+	SoftDeleteRetention time.Duration
+	// PurgeInterval is how often the trash is checked for expired documents.
+	PurgeInterval time.Duration
+	// RoleDeleteMode decides what deleting a role still referenced by users
+	// or policies does: "reject" (default), "cascade" or "reassign".
+	RoleDeleteMode string
+	// RoleDeleteFallback is the role users and policies move to in
+	// "reassign" mode.
+	RoleDeleteFallback string
+	// ElevationMaxDuration caps how long a role elevation may be requested
+	// for.
+	ElevationMaxDuration time.Duration
+	// ElevationExpiryInterval is how often approved elevations are checked
+	// for expiry.
+	ElevationExpiryInterval time.Duration
+	// AttributeSchemaFile is a JSON file declaring the subject and resource
+	// attributes policy conditions may use.
+	AttributeSchemaFile string
+	// AttributeProvidersFile is a JSON file listing the services that supply
+	// resource attributes, by resource prefix.
+	AttributeProvidersFile string
+	// RelationNamespacesFile is a JSON file declaring the object types and
+	// relations of relation tuples, and their userset rewrites.
+	RelationNamespacesFile string
+	// GitOpsDir is a directory of policy bundle files, such as a git
+	// checkout, that tenants' roles, groups and policies are kept in step
+	// with. Empty disables GitOps.
+	GitOpsDir string
+	// GitOpsInterval is how often the directory is synced.
+	GitOpsInterval time.Duration
+	// GitOpsLock refuses API writes to roles, groups and policies while
+	// GitOps is enabled.
+	GitOpsLock bool
+	// AuthBackends lists the login backends tried in order, e.g. "local,ldap".
+	AuthBackends []string
+	LDAP         LDAPConfig
+	SAML         SAMLConfig
+	OIDC         OIDCConfig
+}
+
+type LDAPConfig struct {
+	URL                string
+	StartTLS           bool
+	InsecureSkipVerify bool
+	BindDN             string
+	BindPassword       string
+	BaseDN             string
+	UserFilter         string
+	EmailAttribute     string
+	GroupAttribute     string
+	// GroupRoles is a "group:role;group:role" list.
+	GroupRoles  string
+	DefaultRole string
+	Tenant      string
+}
+
+type SAMLConfig struct {
+	CertFile string
+	KeyFile  string
+	// ProvidersFile is a JSON list of identity provider configurations.
+	ProvidersFile string
+}
+
+type OIDCConfig struct {
+	// ProvidersFile is a JSON list of upstream OIDC issuer configurations.
+	ProvidersFile string
 }
 
 func Load() *Config {
 	return &Config{
-		MongoURI:    getEnvOrDefault("MONGO_URI", "mongodb://localhost:27017"),
-		JWTSecret:   getEnvOrDefault("JWT_SECRET", "your-secret-key"),
-		Environment: getEnvOrDefault("ENV", "development"),
+		Store:                   getEnvOrDefault("STORE", StoreMongo),
+		MongoURI:                getEnvOrDefault("MONGO_URI", "mongodb://localhost:27017"),
+		MongoAutoMigrate:        os.Getenv("MONGO_AUTO_MIGRATE") != "false",
+		EnforcerWatch:           os.Getenv("ENFORCER_WATCH") != "false",
+		EnforcerPollInterval:    getDurationOrDefault("ENFORCER_POLL_INTERVAL", 10*time.Second),
+		ReplicaID:               getEnvOrDefault("REPLICA_ID", hostname()),
+		PostgresURL:             getEnvOrDefault("POSTGRES_URL", "postgres://localhost:5432/accessmesh"),
+		SQLitePath:              getEnvOrDefault("SQLITE_PATH", "accessmesh.db"),
+		JWTSecret:               getEnvOrDefault("JWT_SECRET", "your-secret-key"),
+		Environment:             getEnvOrDefault("ENV", "development"),
+		PublicURL:               getEnvOrDefault("PUBLIC_URL", "http://localhost:8080"),
+		SoftDeleteRetention:     getDurationOrDefault("SOFT_DELETE_RETENTION", 30*24*time.Hour),
+		PurgeInterval:           getDurationOrDefault("PURGE_INTERVAL", time.Hour),
+		RoleDeleteMode:          getEnvOrDefault("ROLE_DELETE_MODE", "reject"),
+		RoleDeleteFallback:      os.Getenv("ROLE_DELETE_FALLBACK"),
+		ElevationMaxDuration:    getDurationOrDefault("ELEVATION_MAX_DURATION", 8*time.Hour),
+		ElevationExpiryInterval: getDurationOrDefault("ELEVATION_EXPIRY_INTERVAL", time.Minute),
+		AttributeSchemaFile:     os.Getenv("ATTRIBUTE_SCHEMA_FILE"),
+		AttributeProvidersFile:  os.Getenv("ATTRIBUTE_PROVIDERS_FILE"),
+		RelationNamespacesFile:  os.Getenv("RELATION_NAMESPACES_FILE"),
+		GitOpsDir:               os.Getenv("GITOPS_DIR"),
+		GitOpsInterval:          getDurationOrDefault("GITOPS_INTERVAL", 30*time.Second),
+		GitOpsLock:              os.Getenv("GITOPS_LOCK") == "true",
+		AuthBackends:            splitList(getEnvOrDefault("AUTH_BACKENDS", "local")),
+		LDAP: LDAPConfig{
+			URL:                os.Getenv("LDAP_URL"),
+			StartTLS:           os.Getenv("LDAP_START_TLS") == "true",
+			InsecureSkipVerify: os.Getenv("LDAP_INSECURE_SKIP_VERIFY") == "true",
+			BindDN:             os.Getenv("LDAP_BIND_DN"),
+			BindPassword:       os.Getenv("LDAP_BIND_PASSWORD"),
+			BaseDN:             os.Getenv("LDAP_BASE_DN"),
+			UserFilter:         getEnvOrDefault("LDAP_USER_FILTER", "(uid=%s)"),
+			EmailAttribute:     getEnvOrDefault("LDAP_EMAIL_ATTRIBUTE", "mail"),
+			GroupAttribute:     getEnvOrDefault("LDAP_GROUP_ATTRIBUTE", "memberOf"),
+			GroupRoles:         os.Getenv("LDAP_GROUP_ROLES"),
+			DefaultRole:        os.Getenv("LDAP_DEFAULT_ROLE"),
+			Tenant:             os.Getenv("LDAP_TENANT"),
+		},
+		SAML: SAMLConfig{
+			CertFile:      os.Getenv("SAML_CERT_FILE"),
+			KeyFile:       os.Getenv("SAML_KEY_FILE"),
+			ProvidersFile: os.Getenv("SAML_PROVIDERS_FILE"),
+		},
+		OIDC: OIDCConfig{
+			ProvidersFile: os.Getenv("OIDC_PROVIDERS_FILE"),
+		},
 	}
 }
 
@@ -22,3 +170,36 @@ func getEnvOrDefault(key, defaultValue string) string {
 	}
 	return defaultValue
 }
+
+// getDurationOrDefault parses key as a time.Duration such as "720h", falling
+// back to defaultValue when it is unset or invalid.
+func getDurationOrDefault(key string, defaultValue time.Duration) time.Duration {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d < 0 {
+		log.Printf("Invalid %s %q, using %s", key, value, defaultValue)
+		return defaultValue
+	}
+	return d
+}
+
+func hostname() string {
+	name, err := os.Hostname()
+	if err != nil {
+		return "accessmesh"
+	}
+	return name
+}
+
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -0,0 +1,38 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	AuditEventImpersonationStart  = "impersonation.start"
+	AuditEventImpersonatedRequest = "impersonation.request"
+
+	AuditEventElevationRequest = "elevation.request"
+	AuditEventElevationApprove = "elevation.approve"
+	AuditEventElevationDeny    = "elevation.deny"
+	AuditEventElevationRevoke  = "elevation.revoke"
+	AuditEventElevationExpire  = "elevation.expire"
+)
+
+// AuditEntry records an action performed in the system together with the
+// identities involved. For impersonation, ActorID/ActorRole are only set
+// when the subject was being impersonated. For elevations, SubjectRole is
+// the elevated role, ActorID the user who decided on or revoked it, and
+// Reason the justification or the decider's note.
+type AuditEntry struct {
+	ID          primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
+	Event       string             `bson:"event" json:"event"`
+	SubjectID   string             `bson:"subject_id" json:"subject_id"`
+	SubjectRole string             `bson:"subject_role" json:"subject_role"`
+	ActorID     string             `bson:"actor_id,omitempty" json:"actor_id,omitempty"`
+	ActorRole   string             `bson:"actor_role,omitempty" json:"actor_role,omitempty"`
+	Method      string             `bson:"method,omitempty" json:"method,omitempty"`
+	Path        string             `bson:"path,omitempty" json:"path,omitempty"`
+	Status      int                `bson:"status,omitempty" json:"status,omitempty"`
+	ClientIP    string             `bson:"client_ip,omitempty" json:"client_ip,omitempty"`
+	Reason      string             `bson:"reason,omitempty" json:"reason,omitempty"`
+	CreatedAt   time.Time          `bson:"created_at" json:"created_at"`
+}
@@ -0,0 +1,47 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Elevation states. A request starts pending and is approved or denied; an
+// approved elevation ends by expiring or being revoked.
+const (
+	ElevationPending  = "pending"
+	ElevationApproved = "approved"
+	ElevationDenied   = "denied"
+	ElevationExpired  = "expired"
+	ElevationRevoked  = "revoked"
+)
+
+// Elevation is a user's request to hold a role for a limited time. While
+// approved, the user holds the role in the tenant until ExpiresAt.
+type Elevation struct {
+	ID       primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	TenantID string             `json:"tenant_id" bson:"tenant_id"`
+	UserID   string             `json:"user_id" bson:"user_id"`
+	Role     string             `json:"role" bson:"role"`
+	// Hours is how long the role is held once approved.
+	Hours         int    `json:"hours" bson:"hours"`
+	Justification string `json:"justification" bson:"justification"`
+	Status        string `json:"status" bson:"status"`
+	// DecidedBy is the user who approved or denied the request, and Note
+	// the reason they gave.
+	DecidedBy string     `json:"decided_by,omitempty" bson:"decided_by,omitempty"`
+	DecidedAt *time.Time `json:"decided_at,omitempty" bson:"decided_at,omitempty"`
+	Note      string     `json:"note,omitempty" bson:"note,omitempty"`
+	// ExpiresAt is set on approval.
+	ExpiresAt *time.Time `json:"expires_at,omitempty" bson:"expires_at,omitempty"`
+	// EndedAt is when an approved elevation expired or was revoked.
+	EndedAt   *time.Time `json:"ended_at,omitempty" bson:"ended_at,omitempty"`
+	Version   int64      `json:"version" bson:"version"`
+	CreatedAt time.Time  `json:"created_at" bson:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at" bson:"updated_at"`
+}
+
+// Open reports whether the elevation is pending or approved.
+func (e *Elevation) Open() bool {
+	return e.Status == ElevationPending || e.Status == ElevationApproved
+}
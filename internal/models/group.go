@@ -0,0 +1,27 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Group collects users so they can be granted roles and policies together.
+// Members of a subgroup are members of the group as well.
+type Group struct {
+	ID          primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	TenantID    string             `json:"tenant_id" bson:"tenant_id"`
+	Name        string             `json:"name" bson:"name"`
+	Description string             `json:"description" bson:"description"`
+	// Roles are the names of the roles every member holds.
+	Roles []string `json:"roles" bson:"roles"`
+	// Members are the IDs of the users in the group.
+	Members []string `json:"members" bson:"members"`
+	// Subgroups are the IDs of the groups nested in this one.
+	Subgroups []string   `json:"subgroups" bson:"subgroups"`
+	Version   int64      `json:"version" bson:"version"`
+	CreatedAt time.Time  `json:"created_at" bson:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at" bson:"updated_at"`
+	DeletedAt *time.Time `json:"deleted_at,omitempty" bson:"deleted_at,omitempty"`
+	DeletedBy string     `json:"deleted_by,omitempty" bson:"deleted_by,omitempty"`
+}
@@ -7,16 +7,34 @@ import (
 )
 
 type Policy struct {
-	ID         primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
-	Role       string             `bson:"role" json:"role"`
-	Resource   string             `bson:"resource" json:"resource"`
-	Action     string             `bson:"action" json:"action"`
-	Conditions PolicyConditions   `bson:"conditions" json:"conditions"`
-	CreatedAt  time.Time          `bson:"created_at" json:"created_at"`
-	UpdatedAt  time.Time          `bson:"updated_at" json:"updated_at"`
+	ID       primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
+	TenantID string             `bson:"tenant_id" json:"tenant_id"`
+	Role     string             `bson:"role" json:"role"`
+	// Group is the ID of the group the policy applies to instead of a role.
+	// A policy names either a role or a group.
+	Group      string           `bson:"group_id" json:"group_id,omitempty"`
+	Resource   string           `bson:"resource" json:"resource"`
+	Action     string           `bson:"action" json:"action"`
+	Conditions PolicyConditions `bson:"conditions" json:"conditions"`
+	Version    int64            `bson:"version" json:"version"`
+	CreatedAt  time.Time        `bson:"created_at" json:"created_at"`
+	UpdatedAt  time.Time        `bson:"updated_at" json:"updated_at"`
+	DeletedAt  *time.Time       `bson:"deleted_at,omitempty" json:"deleted_at,omitempty"`
+	DeletedBy  string           `bson:"deleted_by,omitempty" json:"deleted_by,omitempty"`
 }
 
 type PolicyConditions struct {
 	IPRange   []string `bson:"ip_range" json:"ip_range"`
 	TimeRange []string `bson:"time_range" json:"time_range"`
+	// Expression is an attribute condition over subject.*, resource.* and
+	// env.*, such as `subject.department == resource.department`. A policy
+	// with one only grants access through the check API, which has the
+	// attributes to evaluate it.
+	Expression string `bson:"expression,omitempty" json:"expression,omitempty"`
+}
+
+// Conditional reports whether the policy grants access only when its
+// expression holds.
+func (p *Policy) Conditional() bool {
+	return p.Conditions.Expression != ""
 }
@@ -0,0 +1,66 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Kinds of documents with a revision history.
+const (
+	RevisionKindPolicy = "policy"
+	RevisionKindRole   = "role"
+)
+
+// What a revision did to its document.
+const (
+	RevisionCreate  = "create"
+	RevisionUpdate  = "update"
+	RevisionDelete  = "delete"
+	RevisionRestore = "restore"
+	// RevisionRevert sets a document back to an earlier revision.
+	RevisionRevert = "revert"
+	// RevisionRollback is a change made by rolling back to a snapshot.
+	RevisionRollback = "rollback"
+	// RevisionImport is a change made by importing a policy bundle.
+	RevisionImport = "import"
+)
+
+// Revision records a policy or role as it was after a change: who made it,
+// when, and which Version of the document it produced. Revisions are only
+// ever appended. Policy or Role holds the document, depending on Kind.
+type Revision struct {
+	ID         primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	TenantID   string             `bson:"tenant_id" json:"tenant_id"`
+	Kind       string             `bson:"kind" json:"kind"`
+	DocumentID string             `bson:"document_id" json:"document_id"`
+	Version    int64              `bson:"version" json:"version"`
+	Action     string             `bson:"action" json:"action"`
+	Actor      string             `bson:"actor,omitempty" json:"actor,omitempty"`
+	Policy     *Policy            `bson:"policy,omitempty" json:"policy,omitempty"`
+	Role       *Role              `bson:"role,omitempty" json:"role,omitempty"`
+	CreatedAt  time.Time          `bson:"created_at" json:"created_at"`
+	// Changes are the fields that differ from the previous revision. They
+	// are worked out when the history is read, not stored.
+	Changes []FieldChange `bson:"-" json:"changes,omitempty"`
+}
+
+// FieldChange is a field of a document that a revision changed, named by
+// its JSON path, such as "conditions.ip_range". From is nil for a field the
+// revision added.
+type FieldChange struct {
+	Field string      `json:"field"`
+	From  interface{} `json:"from"`
+	To    interface{} `json:"to"`
+}
+
+// PolicySnapshot is a copy of every live policy of a tenant, which the
+// tenant's policies can be rolled back to.
+type PolicySnapshot struct {
+	ID          primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	TenantID    string             `bson:"tenant_id" json:"tenant_id"`
+	Description string             `bson:"description" json:"description"`
+	Policies    []Policy           `bson:"policies" json:"policies"`
+	CreatedBy   string             `bson:"created_by,omitempty" json:"created_by,omitempty"`
+	CreatedAt   time.Time          `bson:"created_at" json:"created_at"`
+}
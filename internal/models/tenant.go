@@ -0,0 +1,16 @@
+package models
+
+import "time"
+
+// DefaultTenant owns the users, roles and policies created before tenants
+// existed and anything created without one. It is also the platform tenant:
+// only its users can be granted access across tenants.
+const DefaultTenant = "default"
+
+// Tenant is a customer organization. Its ID is a short slug such as "acme"
+// that doubles as the Casbin domain of its roles and policies.
+type Tenant struct {
+	ID        string    `bson:"_id" json:"id"`
+	Name      string    `bson:"name" json:"name"`
+	CreatedAt time.Time `bson:"created_at" json:"created_at"`
+}
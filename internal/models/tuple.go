@@ -0,0 +1,119 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+)
+
+// RelationTuple states that a subject has a relation to an object, written
+// "<object type>:<object id>#<relation>@<subject>". The subject is either an
+// object, such as "user:alice", or the set of subjects having a relation to
+// an object, such as "group:eng#member":
+//
+//	document:42#owner@user:alice
+//	document:42#parent@folder:7
+//	folder:7#viewer@group:eng#member
+//
+// Tuples are never updated. Deleting one records the revision it was
+// deleted at, so that reads at older revisions still see it.
+type RelationTuple struct {
+	TenantID        string `json:"-" bson:"tenant_id"`
+	ObjectType      string `json:"object_type" bson:"object_type"`
+	ObjectID        string `json:"object_id" bson:"object_id"`
+	Relation        string `json:"relation" bson:"relation"`
+	SubjectType     string `json:"subject_type" bson:"subject_type"`
+	SubjectID       string `json:"subject_id" bson:"subject_id"`
+	SubjectRelation string `json:"subject_relation,omitempty" bson:"subject_relation"`
+	// CreatedRevision and DeletedRevision bound the revisions of the
+	// tenant's tuples at which the tuple exists. DeletedRevision is 0 while
+	// it is live.
+	CreatedRevision int64 `json:"-" bson:"created_rev"`
+	DeletedRevision int64 `json:"-" bson:"deleted_rev"`
+}
+
+// ObjectRef names an object as "<type>:<id>".
+type ObjectRef struct {
+	Type string
+	ID   string
+}
+
+func (o ObjectRef) String() string {
+	return o.Type + ":" + o.ID
+}
+
+// SubjectRef is an object, or the subjects with Relation to it if Relation
+// is set: "<type>:<id>" or "<type>:<id>#<relation>".
+type SubjectRef struct {
+	ObjectRef
+	Relation string
+}
+
+func (s SubjectRef) String() string {
+	if s.Relation == "" {
+		return s.ObjectRef.String()
+	}
+	return s.ObjectRef.String() + "#" + s.Relation
+}
+
+// Object returns the tuple's object.
+func (t *RelationTuple) Object() ObjectRef {
+	return ObjectRef{Type: t.ObjectType, ID: t.ObjectID}
+}
+
+// Subject returns the tuple's subject.
+func (t *RelationTuple) Subject() SubjectRef {
+	return SubjectRef{ObjectRef: ObjectRef{Type: t.SubjectType, ID: t.SubjectID}, Relation: t.SubjectRelation}
+}
+
+// String returns the tuple as written, without its tenant and revisions.
+func (t *RelationTuple) String() string {
+	return t.Object().String() + "#" + t.Relation + "@" + t.Subject().String()
+}
+
+// ParseObject parses "<type>:<id>".
+func ParseObject(s string) (ObjectRef, error) {
+	objectType, id, ok := strings.Cut(s, ":")
+	if !ok || objectType == "" || id == "" || strings.ContainsAny(objectType, "#@") || strings.ContainsAny(id, "#@") {
+		return ObjectRef{}, fmt.Errorf("invalid object %q, want <type>:<id>", s)
+	}
+	return ObjectRef{Type: objectType, ID: id}, nil
+}
+
+// ParseSubject parses "<type>:<id>" or "<type>:<id>#<relation>".
+func ParseSubject(s string) (SubjectRef, error) {
+	object, relation, hasRelation := strings.Cut(s, "#")
+	ref, err := ParseObject(object)
+	if err != nil || (hasRelation && !validRelation(relation)) {
+		return SubjectRef{}, fmt.Errorf("invalid subject %q, want <type>:<id> or <type>:<id>#<relation>", s)
+	}
+	return SubjectRef{ObjectRef: ref, Relation: relation}, nil
+}
+
+// ParseTuple parses "<type>:<id>#<relation>@<subject>".
+func ParseTuple(s string) (RelationTuple, error) {
+	objectRelation, subject, ok := strings.Cut(s, "@")
+	object, relation, hasRelation := strings.Cut(objectRelation, "#")
+	if !ok || !hasRelation || !validRelation(relation) {
+		return RelationTuple{}, fmt.Errorf("invalid tuple %q, want <type>:<id>#<relation>@<subject>", s)
+	}
+	objectRef, err := ParseObject(object)
+	if err != nil {
+		return RelationTuple{}, err
+	}
+	subjectRef, err := ParseSubject(subject)
+	if err != nil {
+		return RelationTuple{}, err
+	}
+	return RelationTuple{
+		ObjectType:      objectRef.Type,
+		ObjectID:        objectRef.ID,
+		Relation:        relation,
+		SubjectType:     subjectRef.Type,
+		SubjectID:       subjectRef.ID,
+		SubjectRelation: subjectRef.Relation,
+	}, nil
+}
+
+func validRelation(relation string) bool {
+	return relation != "" && !strings.ContainsAny(relation, ":#@")
+}
@@ -7,18 +7,120 @@ import (
 	"golang.org/x/crypto/bcrypt"
 )
 
+// Authentication sources a user account can be managed by.
+const (
+	AuthSourceLocal = "local"
+	AuthSourceLDAP  = "ldap"
+	// SAML users are stored as "saml:<idp id>" so accounts from different
+	// IdPs never collide.
+	AuthSourceSAML = "saml"
+	// OIDC users are stored as "oidc:<provider id>".
+	AuthSourceOIDC = "oidc"
+)
+
+// ExternalIdentity links an account to a subject at an external identity provider.
+type ExternalIdentity struct {
+	Provider string    `bson:"provider" json:"provider"`
+	Subject  string    `bson:"subject" json:"subject"`
+	LinkedAt time.Time `bson:"linked_at" json:"linked_at"`
+}
+
+// RoleAssignment gives a user a role, optionally only from StartsAt and
+// until ExpiresAt.
+type RoleAssignment struct {
+	Role      string     `bson:"role" json:"role"`
+	StartsAt  *time.Time `bson:"starts_at,omitempty" json:"starts_at,omitempty"`
+	ExpiresAt *time.Time `bson:"expires_at,omitempty" json:"expires_at,omitempty"`
+}
+
+// ActiveAt reports whether the assignment applies at t.
+func (a RoleAssignment) ActiveAt(t time.Time) bool {
+	return (a.StartsAt == nil || !t.Before(*a.StartsAt)) && (a.ExpiresAt == nil || t.Before(*a.ExpiresAt))
+}
+
+// AssignRoles returns unbounded assignments of the named roles, skipping
+// empty names.
+func AssignRoles(names ...string) []RoleAssignment {
+	assignments := []RoleAssignment{}
+	for _, name := range names {
+		if name != "" {
+			assignments = append(assignments, RoleAssignment{Role: name})
+		}
+	}
+	return assignments
+}
+
 type User struct {
 	ID                primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
+	TenantID          string             `bson:"tenant_id" json:"tenant_id"`
 	Username          string             `bson:"username" json:"username"`
 	Password          string             `bson:"password" json:"-"`
-	Role              string             `bson:"role" json:"role"`
+	Roles             []RoleAssignment   `bson:"roles" json:"roles"`
 	Email             string             `bson:"email" json:"email"`
 	EmailVerified     bool               `bson:"email_verified" json:"email_verified"`
 	VerificationToken string             `bson:"verification_token,omitempty" json:"-"`
 	ResetToken        string             `bson:"reset_token,omitempty" json:"-"`
 	ResetTokenExpiry  time.Time          `bson:"reset_token_expiry,omitempty" json:"-"`
+	AuthSource        string             `bson:"auth_source,omitempty" json:"auth_source,omitempty"`
+	Identities        []ExternalIdentity `bson:"identities,omitempty" json:"identities,omitempty"`
+	Version           int64              `bson:"version" json:"version"`
 	CreatedAt         time.Time          `bson:"created_at" json:"created_at"`
 	UpdatedAt         time.Time          `bson:"updated_at" json:"updated_at"`
+	DeletedAt         *time.Time         `bson:"deleted_at,omitempty" json:"deleted_at,omitempty"`
+	DeletedBy         string             `bson:"deleted_by,omitempty" json:"deleted_by,omitempty"`
+	// Attributes are the user's subject.* attributes, such as department or
+	// clearance, as declared in the attribute schema.
+	Attributes map[string]interface{} `bson:"attributes,omitempty" json:"attributes,omitempty"`
+}
+
+// HasRole reports whether the user is assigned the role, at any time.
+func (u *User) HasRole(name string) bool {
+	for _, a := range u.Roles {
+		if a.Role == name {
+			return true
+		}
+	}
+	return false
+}
+
+// ActiveRoles returns the names of the roles assigned to the user at t.
+func (u *User) ActiveRoles(t time.Time) []string {
+	names := []string{}
+	for _, a := range u.Roles {
+		if a.ActiveAt(t) {
+			names = append(names, a.Role)
+		}
+	}
+	return names
+}
+
+// RolesChangeAt returns the first time after t at which one of the user's
+// role assignments starts or expires, or nil if none ever does.
+func (u *User) RolesChangeAt(t time.Time) *time.Time {
+	var next *time.Time
+	for _, a := range u.Roles {
+		for _, bound := range []*time.Time{a.StartsAt, a.ExpiresAt} {
+			if bound != nil && bound.After(t) && (next == nil || bound.Before(*next)) {
+				next = bound
+			}
+		}
+	}
+	return next
+}
+
+// TokenExpiry returns when a token issued to the user at now should expire:
+// after ttl, or when the user's roles next change if that is sooner.
+func (u *User) TokenExpiry(now time.Time, ttl time.Duration) time.Time {
+	expiresAt := now.Add(ttl)
+	if change := u.RolesChangeAt(now); change != nil && change.Before(expiresAt) {
+		return *change
+	}
+	return expiresAt
+}
+
+// IsLocal reports whether the account's password is managed by AccessMesh.
+func (u *User) IsLocal() bool {
+	return u.AuthSource == "" || u.AuthSource == AuthSourceLocal
 }
 
 func (u *User) HashPassword() error {
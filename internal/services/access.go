@@ -0,0 +1,170 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"maps"
+	"slices"
+	"time"
+
+	"github.com/knakul853/accessmesh/internal/models"
+	"github.com/knakul853/accessmesh/internal/store"
+	"github.com/knakul853/accessmesh/pkg/abac"
+	"github.com/knakul853/accessmesh/pkg/enforcer"
+)
+
+// AccessRequest asks whether a user may perform Action on Resource in a
+// tenant. Attributes are the resource.* attributes the caller knows; those
+// of a registered provider take precedence.
+type AccessRequest struct {
+	UserID     string
+	Roles      []string
+	TenantID   string
+	Resource   string
+	Action     string
+	Attributes map[string]interface{}
+	IP         string
+	Time       time.Time
+}
+
+// Decision is the answer to an AccessRequest. PolicyID names the
+// conditional policy that allowed it, if any.
+type Decision struct {
+	Allowed  bool   `json:"allowed"`
+	PolicyID string `json:"policy_id,omitempty"`
+}
+
+// Access decides access requests from both kinds of policy: unconditional
+// ones through their Casbin rules, and conditional ones by evaluating their
+// expression against the attributes of the user, the resource and the
+// request.
+type Access struct {
+	store     store.Store
+	enforcer  *enforcer.Enforcer
+	schema    *abac.Schema
+	providers abac.Providers
+}
+
+// NewAccess returns an Access that type-checks conditions against schema.
+func NewAccess(store store.Store, enforcer *enforcer.Enforcer, schema *abac.Schema) *Access {
+	return &Access{store: store, enforcer: enforcer, schema: schema}
+}
+
+// Schema returns the attribute schema conditions are checked against.
+func (a *Access) Schema() *abac.Schema {
+	return a.schema
+}
+
+// RegisterProvider makes provider supply the attributes of the resources
+// starting with prefix. Its answers must match the schema like those of
+// callers do.
+func (a *Access) RegisterProvider(prefix string, provider abac.Provider) {
+	a.providers.Register(prefix, provider)
+}
+
+// Check decides req. Resource attributes that the schema does not declare
+// or that have the wrong type fail with abac.ErrInvalidAttributes.
+func (a *Access) Check(ctx context.Context, req AccessRequest) (*Decision, error) {
+	callerAttributes, err := a.schema.Check(abac.NamespaceResource, req.Attributes)
+	if err != nil {
+		return nil, err
+	}
+
+	allowed, err := a.enforcer.EnforceUser(req.UserID, req.Roles, req.TenantID, req.Resource, req.Action)
+	if err != nil || allowed {
+		return &Decision{Allowed: allowed}, err
+	}
+
+	candidates, err := a.conditionalPolicies(ctx, req)
+	if err != nil || len(candidates) == 0 {
+		return &Decision{}, err
+	}
+
+	attrs, err := a.attributes(ctx, req, callerAttributes)
+	if err != nil {
+		return nil, err
+	}
+	for i := range candidates {
+		policy := &candidates[i]
+		condition, err := abac.Compile(policy.Conditions.Expression, a.schema)
+		if err != nil {
+			// The schema changed since the policy was written.
+			log.Printf("Skipping policy %s: %v", policy.ID.Hex(), err)
+			continue
+		}
+		holds, err := condition.Eval(attrs)
+		if err != nil && !errors.Is(err, abac.ErrMissingAttribute) {
+			return nil, err
+		}
+		if holds {
+			return &Decision{Allowed: true, PolicyID: policy.ID.Hex()}, nil
+		}
+	}
+	return &Decision{}, nil
+}
+
+// conditionalPolicies returns the live conditional policies of the tenant
+// for the resource and action that apply to one of the user's subjects.
+func (a *Access) conditionalPolicies(ctx context.Context, req AccessRequest) ([]models.Policy, error) {
+	page, err := a.store.Policies().List(ctx, store.PolicyQuery{
+		TenantID: req.TenantID,
+		Resource: req.Resource,
+		Action:   req.Action,
+	})
+	if err != nil {
+		return nil, err
+	}
+	subjects, err := a.enforcer.Subjects(req.UserID, req.Roles, req.TenantID)
+	if err != nil {
+		return nil, err
+	}
+
+	var policies []models.Policy
+	for _, policy := range page.Items {
+		if policy.Conditional() && slices.Contains(subjects, enforcer.PolicySubject(&policy)) {
+			policies = append(policies, policy)
+		}
+	}
+	return policies, nil
+}
+
+// attributes gathers what conditions are evaluated against: the stored
+// attributes of the user, the resource attributes of the caller overlaid
+// with those of the resource's provider, and the request's environment.
+func (a *Access) attributes(ctx context.Context, req AccessRequest, callerAttributes map[string]interface{}) (abac.Attributes, error) {
+	subject := map[string]interface{}{}
+	if req.UserID != "" {
+		user, err := a.store.Users().Get(ctx, req.UserID)
+		switch {
+		case errors.Is(err, store.ErrNotFound), errors.Is(err, store.ErrInvalidID):
+		case err != nil:
+			return abac.Attributes{}, err
+		default:
+			maps.Copy(subject, user.Attributes)
+			subject["username"] = user.Username
+		}
+	}
+	subject["id"] = req.UserID
+	subject["roles"] = req.Roles
+
+	resource := callerAttributes
+	provided, err := a.providers.ResourceAttributes(ctx, req.TenantID, req.Resource)
+	if err != nil {
+		return abac.Attributes{}, fmt.Errorf("look up attributes of %s: %w", req.Resource, err)
+	}
+	// A provider answering outside the schema is the server's fault, not the
+	// caller's, so this does not wrap abac.ErrInvalidAttributes.
+	provided, err = a.schema.Check(abac.NamespaceResource, provided)
+	if err != nil {
+		return abac.Attributes{}, fmt.Errorf("provider attributes of %s: %v", req.Resource, err)
+	}
+	maps.Copy(resource, provided)
+
+	return abac.Attributes{
+		Subject:  subject,
+		Resource: resource,
+		Env:      abac.Env(req.IP, req.Time),
+	}, nil
+}
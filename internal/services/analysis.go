@@ -0,0 +1,371 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/knakul853/accessmesh/internal/models"
+	"github.com/knakul853/accessmesh/internal/store"
+	"github.com/knakul853/accessmesh/pkg/bundle"
+	"github.com/knakul853/accessmesh/pkg/enforcer"
+)
+
+// Kinds of problems policy analysis finds.
+const (
+	// FindingDuplicate is a policy granting exactly what an older one of
+	// the same role or group grants, under the same conditions.
+	FindingDuplicate = "duplicate"
+	// FindingShadowed is a policy that never decides anything, as a policy
+	// of the same subject or of one it inherits from grants the same
+	// without conditions, or under the same ones.
+	FindingShadowed = "shadowed"
+	// FindingConflict is a policy granting what a policy of the same
+	// subject, or of one inheriting from or inherited by it, grants under
+	// different conditions. Policies only allow, so access is allowed when
+	// any of the conditions holds, which is rarely what both authors meant.
+	// The Casbin model and the policy schema have no deny effect, so one
+	// policy allowing what another denies cannot happen and is never
+	// reported.
+	FindingConflict = "conflict"
+	// FindingUnknownRole is a policy of a role that does not exist.
+	FindingUnknownRole = "unknown_role"
+	// FindingUnknownGroup is a policy of a group that does not exist.
+	FindingUnknownGroup = "unknown_group"
+	// FindingUnreachable is a policy whose resource and action no route of
+	// the API and no permission check ever asks about. It can still grant
+	// access through the check API.
+	FindingUnreachable = "unreachable"
+)
+
+// Route is an API route as access control sees it: the request method is
+// the action and the path the resource. Path segments starting with ":"
+// match any one segment, and one starting with "*" the rest of the path.
+type Route struct {
+	Method string `json:"method"`
+	Path   string `json:"path"`
+}
+
+// Permission is an object and action a handler checks explicitly, such as
+// "bundles" and "export".
+type Permission struct {
+	Resource string `json:"resource"`
+	Action   string `json:"action"`
+}
+
+// Finding is a policy that policy analysis flags. Related are the IDs of
+// the policies it duplicates, is shadowed by or conflicts with. Subject is
+// the role name, or the group as "group:<name>".
+type Finding struct {
+	Kind     string   `json:"kind"`
+	TenantID string   `json:"tenant_id"`
+	Policy   string   `json:"policy"`
+	Related  []string `json:"related,omitempty"`
+	Subject  string   `json:"subject"`
+	Resource string   `json:"resource"`
+	Action   string   `json:"action"`
+	Message  string   `json:"message"`
+}
+
+// AnalysisReport is the result of analysing the live policies of one or
+// every tenant.
+type AnalysisReport struct {
+	Policies int       `json:"policies"`
+	Findings []Finding `json:"findings"`
+}
+
+// Analyzer looks for policies that are redundant, contradict each other or
+// refer to roles, groups or resources that do not exist.
+type Analyzer struct {
+	store       store.Store
+	routes      func() []Route
+	permissions []Permission
+}
+
+// NewAnalyzer returns an Analyzer comparing resources with the routes routes
+// returns when asked, as they are only known once all are registered, and
+// with the permissions handlers check.
+func NewAnalyzer(store store.Store, routes func() []Route, permissions []Permission) *Analyzer {
+	return &Analyzer{store: store, routes: routes, permissions: permissions}
+}
+
+// Analyze analyses the live policies of the tenant, or of every tenant if
+// tenant is empty. Each policy is reported at most once per kind; a
+// duplicate is only reported as such.
+func (a *Analyzer) Analyze(ctx context.Context, tenant string) (*AnalysisReport, error) {
+	roles, err := a.store.Roles().List(ctx, store.RoleQuery{TenantID: tenant})
+	if err != nil {
+		return nil, err
+	}
+	groups, err := a.store.Groups().List(ctx, store.GroupQuery{TenantID: tenant})
+	if err != nil {
+		return nil, err
+	}
+	policies, err := a.store.Policies().List(ctx, store.PolicyQuery{TenantID: tenant})
+	if err != nil {
+		return nil, err
+	}
+
+	tenants := map[string]*policySet{}
+	set := func(tenant string) *policySet {
+		if tenants[tenant] == nil {
+			tenants[tenant] = &policySet{tenant: tenant, roles: map[string]bool{}, groups: map[string]*models.Group{}}
+		}
+		return tenants[tenant]
+	}
+	for _, role := range roles.Items {
+		set(role.TenantID).roles[role.Name] = true
+	}
+	for i := range groups.Items {
+		group := &groups.Items[i]
+		set(group.TenantID).groups[group.ID.Hex()] = group
+	}
+	for _, policy := range policies.Items {
+		s := set(policy.TenantID)
+		s.policies = append(s.policies, policy)
+	}
+
+	names := make([]string, 0, len(tenants))
+	for name := range tenants {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	routes := a.routes()
+	report := &AnalysisReport{Policies: len(policies.Items), Findings: []Finding{}}
+	for _, name := range names {
+		report.Findings = append(report.Findings, tenants[name].analyze(routes, a.permissions)...)
+	}
+	return report, nil
+}
+
+// policySet is the live roles, groups and policies of one tenant.
+type policySet struct {
+	tenant   string
+	roles    map[string]bool
+	groups   map[string]*models.Group
+	policies []models.Policy
+}
+
+func (s *policySet) analyze(routes []Route, permissions []Permission) []Finding {
+	var findings []Finding
+	finding := func(kind string, policy *models.Policy, related []*models.Policy, message string, args ...interface{}) {
+		f := Finding{
+			Kind:     kind,
+			TenantID: s.tenant,
+			Policy:   policy.ID.Hex(),
+			Subject:  s.subjectName(policy),
+			Resource: policy.Resource,
+			Action:   policy.Action,
+			Message:  fmt.Sprintf(message, args...),
+		}
+		for _, other := range related {
+			f.Related = append(f.Related, other.ID.Hex())
+		}
+		findings = append(findings, f)
+	}
+
+	inherited := map[string]map[string]bool{}
+	inheritedBy := func(subject string) map[string]bool {
+		if inherited[subject] == nil {
+			inherited[subject] = s.inherited(subject)
+		}
+		return inherited[subject]
+	}
+
+	// Policies are compared with those granting the same resource and
+	// action.
+	grants := map[[2]string][]*models.Policy{}
+	for i := range s.policies {
+		policy := &s.policies[i]
+		key := [2]string{policy.Resource, policy.Action}
+		grants[key] = append(grants[key], policy)
+	}
+
+	for i := range s.policies {
+		policy := &s.policies[i]
+		subject := enforcer.PolicySubject(policy)
+		if policy.Group == "" && !s.roles[policy.Role] {
+			finding(FindingUnknownRole, policy, nil, "role %q does not exist", policy.Role)
+		}
+		if policy.Group != "" && s.groups[policy.Group] == nil {
+			finding(FindingUnknownGroup, policy, nil, "group %s does not exist", policy.Group)
+		}
+		if message := reachable(policy.Resource, policy.Action, routes, permissions); message != "" {
+			finding(FindingUnreachable, policy, nil, "%s", message)
+		}
+
+		var duplicates, shadowing, conflicting []*models.Policy
+		for _, other := range grants[[2]string{policy.Resource, policy.Action}] {
+			if other == policy {
+				continue
+			}
+			otherSubject := enforcer.PolicySubject(other)
+			same := otherSubject == subject
+			broader := inheritedBy(subject)[otherSubject]
+			narrower := inheritedBy(otherSubject)[subject]
+			if !same && !broader && !narrower {
+				continue
+			}
+
+			equal := sameConditions(policy.Conditions, other.Conditions)
+			switch {
+			case same && equal:
+				if older(other, policy) {
+					duplicates = append(duplicates, other)
+				}
+			case (same || broader) && (equal || unconditional(other.Conditions)):
+				shadowing = append(shadowing, other)
+			case !unconditional(policy.Conditions) && !unconditional(other.Conditions) && !equal:
+				// Only reported on the newer of the two.
+				if older(other, policy) {
+					conflicting = append(conflicting, other)
+				}
+			}
+		}
+
+		switch {
+		case len(duplicates) > 0:
+			finding(FindingDuplicate, policy, duplicates, "duplicates an older policy of %s", s.subjectName(duplicates[0]))
+		case len(shadowing) > 0:
+			finding(FindingShadowed, policy, shadowing, "already granted by %s", s.subjectNames(shadowing))
+		}
+		if len(duplicates) == 0 && len(conflicting) > 0 {
+			finding(FindingConflict, policy, conflicting,
+				"granted by %s under different conditions; access is allowed when any of them holds", s.subjectNames(conflicting))
+		}
+	}
+	return findings
+}
+
+// inherited returns the subjects whose policies apply to subject as well:
+// for a group, the groups it is nested in and the roles of all of them.
+// Roles inherit nothing.
+func (s *policySet) inherited(subject string) map[string]bool {
+	inherited := map[string]bool{}
+	var visit func(groupID string)
+	visit = func(groupID string) {
+		group := s.groups[groupID]
+		if group == nil {
+			return
+		}
+		for _, role := range group.Roles {
+			inherited[role] = true
+		}
+		for _, parent := range s.groups {
+			parentSubject := enforcer.GroupSubject(parent.ID.Hex())
+			if slices.Contains(parent.Subgroups, groupID) && !inherited[parentSubject] {
+				inherited[parentSubject] = true
+				visit(parent.ID.Hex())
+			}
+		}
+	}
+	if groupID, ok := strings.CutPrefix(subject, enforcer.GroupSubject("")); ok {
+		visit(groupID)
+	}
+	return inherited
+}
+
+// subjectName names the role or group of a policy for people.
+func (s *policySet) subjectName(policy *models.Policy) string {
+	if policy.Group == "" {
+		return policy.Role
+	}
+	if group := s.groups[policy.Group]; group != nil {
+		return "group:" + group.Name
+	}
+	return enforcer.GroupSubject(policy.Group)
+}
+
+func (s *policySet) subjectNames(policies []*models.Policy) string {
+	var names []string
+	for _, policy := range policies {
+		if name := s.subjectName(policy); !slices.Contains(names, name) {
+			names = append(names, name)
+		}
+	}
+	return strings.Join(names, ", ")
+}
+
+func older(a, b *models.Policy) bool {
+	if !a.CreatedAt.Equal(b.CreatedAt) {
+		return a.CreatedAt.Before(b.CreatedAt)
+	}
+	return a.ID.Hex() < b.ID.Hex()
+}
+
+func unconditional(conditions models.PolicyConditions) bool {
+	return bundle.ConditionsOf(conditions).IsZero()
+}
+
+// sameConditions compares conditions, ignoring the order of the ranges.
+func sameConditions(a, b models.PolicyConditions) bool {
+	sameSet := func(a, b []string) bool {
+		a, b = slices.Clone(a), slices.Clone(b)
+		slices.Sort(a)
+		slices.Sort(b)
+		return slices.Equal(slices.Compact(a), slices.Compact(b))
+	}
+	return a.Expression == b.Expression && sameSet(a.IPRange, b.IPRange) && sameSet(a.TimeRange, b.TimeRange)
+}
+
+// reachable returns why nothing asks about action on resource, or "" if a
+// permission check or a route does.
+func reachable(resource, action string, routes []Route, permissions []Permission) string {
+	var actions []string
+	for _, permission := range permissions {
+		if permission.Resource != resource {
+			continue
+		}
+		if permission.Action == action {
+			return ""
+		}
+		actions = append(actions, permission.Action)
+	}
+	if len(actions) > 0 {
+		return fmt.Sprintf("%s is only checked for %s", resource, strings.Join(actions, ", "))
+	}
+
+	var methods []string
+	for _, route := range routes {
+		if !matchRoute(route.Path, resource) {
+			continue
+		}
+		if route.Method == action {
+			return ""
+		}
+		if !slices.Contains(methods, route.Method) {
+			methods = append(methods, route.Method)
+		}
+	}
+	if len(methods) > 0 {
+		return fmt.Sprintf("routes matching %s take %s, not %s", resource, strings.Join(methods, ", "), action)
+	}
+	return fmt.Sprintf("no route or permission check matches %s", resource)
+}
+
+// matchRoute reports whether path matches the route pattern.
+func matchRoute(pattern, path string) bool {
+	patternSegments := strings.Split(strings.Trim(pattern, "/"), "/")
+	pathSegments := strings.Split(strings.Trim(path, "/"), "/")
+	for i, segment := range patternSegments {
+		if strings.HasPrefix(segment, "*") {
+			return true
+		}
+		if i >= len(pathSegments) {
+			return false
+		}
+		if strings.HasPrefix(segment, ":") {
+			if pathSegments[i] == "" {
+				return false
+			}
+			continue
+		}
+		if segment != pathSegments[i] {
+			return false
+		}
+	}
+	return len(patternSegments) == len(pathSegments)
+}
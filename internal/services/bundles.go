@@ -0,0 +1,558 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/knakul853/accessmesh/internal/models"
+	"github.com/knakul853/accessmesh/internal/store"
+	"github.com/knakul853/accessmesh/pkg/abac"
+	"github.com/knakul853/accessmesh/pkg/bundle"
+	"github.com/knakul853/accessmesh/pkg/enforcer"
+)
+
+// How an imported bundle combines with the tenant's roles, groups and
+// policies.
+const (
+	// ImportMerge creates and updates what the bundle holds and leaves
+	// everything else alone.
+	ImportMerge = "merge"
+	// ImportReplace also deletes what the bundle does not hold, so that the
+	// tenant ends up with exactly the bundle.
+	ImportReplace = "replace"
+)
+
+// Kinds of documents a bundle import changes.
+const (
+	BundleKindRole   = "role"
+	BundleKindGroup  = "group"
+	BundleKindPolicy = "policy"
+)
+
+// BundleChange is a role, group or policy that importing a bundle creates,
+// updates or deletes. Name is the role or group name, or the policy's
+// bundle.Policy.Key. Changes lists the fields that differ, named as in the
+// bundle.
+type BundleChange struct {
+	Kind    string               `json:"kind"`
+	Name    string               `json:"name"`
+	Op      string               `json:"op"`
+	Changes []models.FieldChange `json:"changes,omitempty"`
+}
+
+// ImportResult is what an import changed, or with DryRun would change.
+type ImportResult struct {
+	Mode    string         `json:"mode"`
+	DryRun  bool           `json:"dry_run"`
+	Changes []BundleChange `json:"changes"`
+}
+
+// Bundles exports a tenant's roles, groups and policies as a bundle and
+// imports bundles into a tenant.
+type Bundles struct {
+	store     store.Store
+	enforcer  *enforcer.Enforcer
+	history   *History
+	integrity *RoleIntegrity
+	schema    *abac.Schema
+}
+
+func NewBundles(store store.Store, enforcer *enforcer.Enforcer, integrity *RoleIntegrity, schema *abac.Schema) *Bundles {
+	return &Bundles{store: store, enforcer: enforcer, history: NewHistory(store, enforcer), integrity: integrity, schema: schema}
+}
+
+// tenantState is the live roles, groups and policies of a tenant.
+type tenantState struct {
+	roles      []models.Role
+	roleByName map[string]*models.Role
+	groups     []models.Group
+	// groupByName holds the first group of each name, and groupNames the
+	// name of each group ID.
+	groupByName map[string]*models.Group
+	groupNames  map[string]string
+	policies    []models.Policy
+}
+
+func (b *Bundles) load(ctx context.Context, tenant string) (*tenantState, error) {
+	roles, err := b.store.Roles().List(ctx, store.RoleQuery{TenantID: tenant})
+	if err != nil {
+		return nil, err
+	}
+	groups, err := b.store.Groups().List(ctx, store.GroupQuery{TenantID: tenant})
+	if err != nil {
+		return nil, err
+	}
+	policies, err := b.store.Policies().List(ctx, store.PolicyQuery{TenantID: tenant})
+	if err != nil {
+		return nil, err
+	}
+
+	state := &tenantState{
+		roles:       roles.Items,
+		roleByName:  map[string]*models.Role{},
+		groups:      groups.Items,
+		groupByName: map[string]*models.Group{},
+		groupNames:  map[string]string{},
+		policies:    policies.Items,
+	}
+	for i := range state.roles {
+		if state.roleByName[state.roles[i].Name] == nil {
+			state.roleByName[state.roles[i].Name] = &state.roles[i]
+		}
+	}
+	for i := range state.groups {
+		group := &state.groups[i]
+		if state.groupByName[group.Name] == nil {
+			state.groupByName[group.Name] = group
+		}
+		state.groupNames[group.ID.Hex()] = group.Name
+	}
+	return state, nil
+}
+
+// bundleRole, bundleGroup and bundlePolicy convert stored documents, naming
+// groups instead of giving their IDs. References to groups that are gone
+// are left out; a policy of such a group is reported as not ok.
+func bundleRole(role *models.Role) bundle.Role {
+	return bundle.Role{Name: role.Name, Description: role.Description, Permissions: slices.Clone(role.Permissions)}
+}
+
+func (s *tenantState) bundleGroup(group *models.Group) bundle.Group {
+	converted := bundle.Group{Name: group.Name, Description: group.Description, Roles: slices.Clone(group.Roles)}
+	for _, id := range group.Subgroups {
+		if name, ok := s.groupNames[id]; ok {
+			converted.Subgroups = append(converted.Subgroups, name)
+		}
+	}
+	return converted
+}
+
+func (s *tenantState) bundlePolicy(policy *models.Policy) (bundle.Policy, bool) {
+	converted := bundle.Policy{
+		Role:       policy.Role,
+		Resource:   policy.Resource,
+		Action:     policy.Action,
+		Conditions: bundle.ConditionsOf(policy.Conditions),
+	}
+	if policy.Group != "" {
+		name, ok := s.groupNames[policy.Group]
+		if !ok {
+			return converted, false
+		}
+		converted.Group = name
+	}
+	return converted, true
+}
+
+// Export returns the live roles, groups and policies of the tenant, sorted
+// so that exports of the same state are identical.
+func (b *Bundles) Export(ctx context.Context, tenant string) (*bundle.Bundle, error) {
+	state, err := b.load(ctx, tenant)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	exported := &bundle.Bundle{
+		Version:    bundle.Version,
+		Tenant:     tenant,
+		ExportedAt: &now,
+		Roles:      []bundle.Role{},
+		Groups:     []bundle.Group{},
+		Policies:   []bundle.Policy{},
+	}
+	for i := range state.roles {
+		exported.Roles = append(exported.Roles, bundleRole(&state.roles[i]))
+	}
+	for i := range state.groups {
+		exported.Groups = append(exported.Groups, state.bundleGroup(&state.groups[i]))
+	}
+	for i := range state.policies {
+		if policy, ok := state.bundlePolicy(&state.policies[i]); ok {
+			exported.Policies = append(exported.Policies, policy)
+		}
+	}
+
+	sort.SliceStable(exported.Roles, func(i, j int) bool { return exported.Roles[i].Name < exported.Roles[j].Name })
+	sort.SliceStable(exported.Groups, func(i, j int) bool { return exported.Groups[i].Name < exported.Groups[j].Name })
+	sort.SliceStable(exported.Policies, func(i, j int) bool {
+		return exported.Policies[i].Key() < exported.Policies[j].Key()
+	})
+	return exported, nil
+}
+
+// importPlan is the writes of an import, worked out before any is made.
+type importPlan struct {
+	createRoles  []models.Role
+	updateRoles  []models.Role
+	deleteRoles  []models.Role
+	createGroups []bundle.Group
+	updateGroups []bundle.Group
+	deleteGroups []models.Group
+	// policies are the live policies of the tenant after the import, with
+	// groups named in groupNames by index until the groups exist.
+	policies   []models.Policy
+	groupNames map[int]string
+	changes    []BundleChange
+}
+
+// Import makes the bundle's roles, groups and policies those of the tenant
+// as mode says, and returns what it changed. The whole bundle is checked
+// first: every role and group it refers to must be in the bundle or, when
+// merging, already exist, and expressions must type-check. If anything is
+// wrong nothing is written and an error wrapping bundle.ErrInvalid is
+// returned. With dryRun the changes are worked out but not made.
+//
+// Policies are written in a single store transaction. Roles go before them
+// and groups in between, so a failing write can leave the roles and groups
+// written so far in place.
+func (b *Bundles) Import(ctx context.Context, tenant string, imported *bundle.Bundle, mode string, dryRun bool, actor string) (*ImportResult, error) {
+	if mode != ImportMerge && mode != ImportReplace {
+		return nil, fmt.Errorf("%w: unknown import mode %q", bundle.ErrInvalid, mode)
+	}
+	if err := imported.Validate(); err != nil {
+		return nil, err
+	}
+
+	state, err := b.load(ctx, tenant)
+	if err != nil {
+		return nil, err
+	}
+	plan, err := b.plan(ctx, tenant, state, imported, mode)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &ImportResult{Mode: mode, DryRun: dryRun, Changes: plan.changes}
+	if dryRun {
+		return result, nil
+	}
+	return result, b.apply(ctx, tenant, state, plan, actor)
+}
+
+func (b *Bundles) plan(ctx context.Context, tenant string, state *tenantState, imported *bundle.Bundle, mode string) (*importPlan, error) {
+	plan := &importPlan{groupNames: map[int]string{}}
+	var problems []string
+	change := func(kind, name, op string, before, after interface{}) error {
+		changes, err := diff(before, after)
+		if err != nil {
+			return err
+		}
+		if op != models.RevisionUpdate || len(changes) > 0 {
+			plan.changes = append(plan.changes, BundleChange{Kind: kind, Name: name, Op: op, Changes: changes})
+		}
+		return nil
+	}
+
+	// Roles, by name.
+	roles := map[string]bool{}
+	for i := range imported.Roles {
+		role := &imported.Roles[i]
+		roles[role.Name] = true
+		existing := state.roleByName[role.Name]
+		if existing == nil {
+			plan.createRoles = append(plan.createRoles, models.Role{
+				TenantID:    tenant,
+				Name:        role.Name,
+				Description: role.Description,
+				Permissions: slices.Clone(role.Permissions),
+			})
+			if err := change(BundleKindRole, role.Name, models.RevisionCreate, nil, role); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		before := bundleRole(existing)
+		if before.Description != role.Description || !slices.Equal(before.Permissions, role.Permissions) {
+			updated := *existing
+			updated.Description = role.Description
+			updated.Permissions = slices.Clone(role.Permissions)
+			plan.updateRoles = append(plan.updateRoles, updated)
+			if err := change(BundleKindRole, role.Name, models.RevisionUpdate, &before, role); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if mode == ImportReplace {
+		for i := range state.roles {
+			role := &state.roles[i]
+			if roles[role.Name] {
+				continue
+			}
+			if b.integrity.mode == RoleDeleteReject {
+				// The role's policies and groups go with the import, but
+				// its users stay.
+				users, err := b.store.Users().List(ctx, store.UserQuery{
+					ListOptions: store.ListOptions{Limit: 1},
+					TenantID:    tenant,
+					Role:        role.Name,
+				})
+				if err != nil {
+					return nil, err
+				}
+				if users.Total > 0 {
+					problems = append(problems, fmt.Sprintf("role %q is not in the bundle but %d users hold it", role.Name, users.Total))
+				}
+			}
+			plan.deleteRoles = append(plan.deleteRoles, *role)
+			before := bundleRole(role)
+			if err := change(BundleKindRole, role.Name, models.RevisionDelete, &before, nil); err != nil {
+				return nil, err
+			}
+		}
+	} else {
+		for name := range state.roleByName {
+			roles[name] = true
+		}
+	}
+
+	// Groups, by name. The groups of the tenant after the import must not
+	// contain themselves either.
+	groups := map[string]bool{}
+	after := map[string]bundle.Group{}
+	if mode == ImportMerge {
+		for i := range state.groups {
+			group := &state.groups[i]
+			groups[group.Name] = true
+			if _, ok := after[group.Name]; !ok {
+				after[group.Name] = state.bundleGroup(group)
+			}
+		}
+	}
+	for _, group := range imported.Groups {
+		groups[group.Name] = true
+		after[group.Name] = group
+	}
+	for i := range imported.Groups {
+		group := &imported.Groups[i]
+		for _, role := range group.Roles {
+			if !roles[role] {
+				problems = append(problems, fmt.Sprintf("group %q: unknown role %q", group.Name, role))
+			}
+		}
+		for _, subgroup := range group.Subgroups {
+			if !groups[subgroup] {
+				problems = append(problems, fmt.Sprintf("group %q: unknown subgroup %q", group.Name, subgroup))
+			}
+		}
+
+		existing := state.groupByName[group.Name]
+		if existing == nil {
+			plan.createGroups = append(plan.createGroups, *group)
+			if err := change(BundleKindGroup, group.Name, models.RevisionCreate, nil, group); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		before := state.bundleGroup(existing)
+		if before.Description != group.Description || !slices.Equal(before.Roles, group.Roles) ||
+			!slices.Equal(before.Subgroups, group.Subgroups) {
+			plan.updateGroups = append(plan.updateGroups, *group)
+			if err := change(BundleKindGroup, group.Name, models.RevisionUpdate, &before, group); err != nil {
+				return nil, err
+			}
+		}
+	}
+	merged := &bundle.Bundle{Version: bundle.Version}
+	for _, group := range after {
+		merged.Groups = append(merged.Groups, group)
+	}
+	sort.Slice(merged.Groups, func(i, j int) bool { return merged.Groups[i].Name < merged.Groups[j].Name })
+	if err := merged.Validate(); err != nil {
+		problems = append(problems, strings.TrimPrefix(err.Error(), bundle.ErrInvalid.Error()+": "))
+	}
+	if mode == ImportReplace {
+		for i := range state.groups {
+			group := &state.groups[i]
+			if _, ok := after[group.Name]; ok && state.groupByName[group.Name] == group {
+				continue
+			}
+			plan.deleteGroups = append(plan.deleteGroups, *group)
+			before := state.bundleGroup(group)
+			if err := change(BundleKindGroup, group.Name, models.RevisionDelete, &before, nil); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	// Policies, by what they grant. A bundle policy granting what a live
+	// policy grants updates that policy's conditions.
+	existing := map[string]*models.Policy{}
+	for i := range state.policies {
+		if policy, ok := state.bundlePolicy(&state.policies[i]); ok {
+			if _, seen := existing[policy.Key()]; !seen {
+				existing[policy.Key()] = &state.policies[i]
+			}
+		}
+	}
+	kept := map[*models.Policy]bool{}
+	for i := range imported.Policies {
+		policy := &imported.Policies[i]
+		switch {
+		case policy.Role != "" && !roles[policy.Role]:
+			problems = append(problems, fmt.Sprintf("policy %s: unknown role %q", policy.Key(), policy.Role))
+		case policy.Group != "" && !groups[policy.Group]:
+			problems = append(problems, fmt.Sprintf("policy %s: unknown group %q", policy.Key(), policy.Group))
+		}
+		if policy.Conditions.Expression != "" {
+			if _, err := abac.Compile(policy.Conditions.Expression, b.schema); err != nil {
+				problems = append(problems, fmt.Sprintf("policy %s: %v", policy.Key(), err))
+			}
+		}
+
+		match := existing[policy.Key()]
+		if match == nil {
+			if policy.Group != "" {
+				plan.groupNames[len(plan.policies)] = policy.Group
+			}
+			plan.policies = append(plan.policies, models.Policy{
+				TenantID:   tenant,
+				Role:       policy.Role,
+				Resource:   policy.Resource,
+				Action:     policy.Action,
+				Conditions: policy.Conditions.Model(),
+			})
+			if err := change(BundleKindPolicy, policy.Key(), models.RevisionCreate, nil, policy); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		kept[match] = true
+		updated := *match
+		updated.Conditions = policy.Conditions.Model()
+		plan.policies = append(plan.policies, updated)
+		before, _ := state.bundlePolicy(match)
+		if err := change(BundleKindPolicy, policy.Key(), models.RevisionUpdate, &before, policy); err != nil {
+			return nil, err
+		}
+	}
+	for i := range state.policies {
+		policy := &state.policies[i]
+		if kept[policy] {
+			continue
+		}
+		if mode == ImportMerge {
+			plan.policies = append(plan.policies, *policy)
+			continue
+		}
+		before, ok := state.bundlePolicy(policy)
+		name := before.Key()
+		if !ok {
+			name = "group:" + policy.Group + " " + policy.Resource + " " + policy.Action
+		}
+		if err := change(BundleKindPolicy, name, models.RevisionDelete, &before, nil); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(problems) > 0 {
+		return nil, fmt.Errorf("%w: %s", bundle.ErrInvalid, strings.Join(problems, "; "))
+	}
+	if plan.changes == nil {
+		plan.changes = []BundleChange{}
+	}
+	return plan, nil
+}
+
+func (b *Bundles) apply(ctx context.Context, tenant string, state *tenantState, plan *importPlan, actor string) error {
+	for i := range plan.createRoles {
+		role := &plan.createRoles[i]
+		if err := b.store.Roles().Create(store.WithRevision(ctx, models.RevisionImport, actor), role); err != nil {
+			return err
+		}
+	}
+	for i := range plan.updateRoles {
+		role := &plan.updateRoles[i]
+		if err := b.store.Roles().Update(store.WithRevision(ctx, models.RevisionImport, actor), role); err != nil {
+			return err
+		}
+	}
+
+	// New groups are created first so that subgroups can be given by ID.
+	groupIDs := map[string]string{}
+	for name, group := range state.groupByName {
+		groupIDs[name] = group.ID.Hex()
+	}
+	created := map[string]*models.Group{}
+	for _, group := range plan.createGroups {
+		now := time.Now()
+		stored := &models.Group{
+			TenantID:    tenant,
+			Name:        group.Name,
+			Description: group.Description,
+			Roles:       slices.Clone(group.Roles),
+			Members:     []string{},
+			Subgroups:   []string{},
+			CreatedAt:   now,
+			UpdatedAt:   now,
+		}
+		if err := b.store.Groups().Create(ctx, stored); err != nil {
+			return err
+		}
+		groupIDs[group.Name] = stored.ID.Hex()
+		created[group.Name] = stored
+	}
+	subgroupIDs := func(group bundle.Group) []string {
+		ids := []string{}
+		for _, name := range group.Subgroups {
+			ids = append(ids, groupIDs[name])
+		}
+		return ids
+	}
+	for _, group := range plan.createGroups {
+		stored := created[group.Name]
+		if len(group.Subgroups) > 0 {
+			stored.Subgroups = subgroupIDs(group)
+			if err := b.store.Groups().Update(ctx, stored); err != nil {
+				return err
+			}
+		}
+		if err := b.enforcer.SyncGroup(nil, stored); err != nil {
+			return err
+		}
+	}
+	for _, group := range plan.updateGroups {
+		stored := state.groupByName[group.Name]
+		previous := *stored
+		previous.Members = slices.Clone(stored.Members)
+		previous.Roles = slices.Clone(stored.Roles)
+		previous.Subgroups = slices.Clone(stored.Subgroups)
+		stored.Description = group.Description
+		stored.Roles = slices.Clone(group.Roles)
+		stored.Subgroups = subgroupIDs(group)
+		if err := b.store.Groups().Update(ctx, stored); err != nil {
+			return err
+		}
+		if err := b.enforcer.SyncGroup(&previous, stored); err != nil {
+			return err
+		}
+	}
+
+	for i, name := range plan.groupNames {
+		plan.policies[i].Group = groupIDs[name]
+	}
+	if _, err := b.history.replacePolicies(ctx, tenant, plan.policies, actor, models.RevisionImport); err != nil {
+		return err
+	}
+
+	for i := range plan.deleteGroups {
+		group := &plan.deleteGroups[i]
+		if err := b.store.Groups().SoftDelete(ctx, group.ID.Hex(), group.Version, actor); err != nil {
+			return err
+		}
+		if err := b.enforcer.SyncGroup(group, nil); err != nil {
+			return err
+		}
+	}
+	for i := range plan.deleteRoles {
+		if _, err := b.integrity.DeleteRole(ctx, &plan.deleteRoles[i], actor); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,253 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/knakul853/accessmesh/internal/models"
+	"github.com/knakul853/accessmesh/internal/store"
+	"github.com/knakul853/accessmesh/pkg/enforcer"
+)
+
+var (
+	// ErrElevationHours is returned when an elevation asks for less than an
+	// hour or for longer than the configured maximum.
+	ErrElevationHours = errors.New("invalid elevation duration")
+	// ErrElevationOpen is returned when the user already has a pending or
+	// approved elevation to the same role.
+	ErrElevationOpen = errors.New("an elevation to this role is already pending or active")
+	// ErrElevationState is returned when an elevation is decided on that is
+	// no longer pending, or revoked while not approved.
+	ErrElevationState = errors.New("elevation cannot change from its current status")
+	// ErrSelfDecision is returned when users approve or deny their own
+	// elevation.
+	ErrSelfDecision = errors.New("cannot decide on your own elevation")
+	// ErrElevationNotCovered is returned when approvers grant a role with
+	// privileges they do not hold themselves.
+	ErrElevationNotCovered = errors.New("cannot approve a role with privileges you do not hold")
+)
+
+// Elevations runs the just-in-time role elevation workflow: users request a
+// role for a number of hours, an approver accepts or denies, and approved
+// elevations end when they expire or are revoked. Every step is written to
+// the audit log.
+type Elevations struct {
+	store    store.Store
+	enforcer *enforcer.Enforcer
+	maxHours int
+}
+
+// NewElevations returns the workflow, allowing elevations of up to
+// maxDuration rounded down to whole hours.
+func NewElevations(store store.Store, enforcer *enforcer.Enforcer, maxDuration time.Duration) *Elevations {
+	return &Elevations{store: store, enforcer: enforcer, maxHours: int(maxDuration / time.Hour)}
+}
+
+// Request records a pending elevation of the elevation's user to its role.
+// The role must exist in the tenant, and the user may not already have a
+// pending or approved elevation to it.
+func (s *Elevations) Request(ctx context.Context, elevation *models.Elevation) error {
+	if elevation.Hours < 1 || elevation.Hours > s.maxHours {
+		return fmt.Errorf("%w: hours must be between 1 and %d", ErrElevationHours, s.maxHours)
+	}
+	if err := CheckRole(ctx, s.store.Roles(), elevation.TenantID, elevation.Role); err != nil {
+		return err
+	}
+	for _, status := range []string{models.ElevationPending, models.ElevationApproved} {
+		page, err := s.store.Elevations().List(ctx, store.ElevationQuery{
+			ListOptions: store.ListOptions{Limit: 1},
+			TenantID:    elevation.TenantID,
+			UserID:      elevation.UserID,
+			Role:        elevation.Role,
+			Status:      status,
+		})
+		if err != nil {
+			return err
+		}
+		if page.Total > 0 {
+			return ErrElevationOpen
+		}
+	}
+
+	elevation.Status = models.ElevationPending
+	elevation.CreatedAt = time.Now()
+	elevation.UpdatedAt = elevation.CreatedAt
+	if err := s.store.Elevations().Create(ctx, elevation); err != nil {
+		return err
+	}
+	return s.audit(ctx, models.AuditEventElevationRequest, elevation, "", elevation.Justification)
+}
+
+// Approve grants the pending elevation for its hours from now. approverRoles
+// are the approver's roles in the elevation's tenant, which together with
+// the approver's groups must hold every privilege of the elevated role.
+//
+// The approval is recorded before the role is granted, so that of two
+// racing approvers only the one whose update wins touches the enforcer. If
+// the grant then fails the elevation is put back to pending.
+func (s *Elevations) Approve(ctx context.Context, elevation *models.Elevation, approver string, approverRoles []string, note string) error {
+	if err := checkDecision(elevation, approver); err != nil {
+		return err
+	}
+	if err := s.checkCovers(elevation, approver, approverRoles); err != nil {
+		return err
+	}
+
+	pending := *elevation
+	if err := s.decide(ctx, elevation, models.ElevationApproved, approver, note); err != nil {
+		return err
+	}
+	if err := s.enforcer.GrantElevation(elevation); err != nil {
+		pending.Version = elevation.Version
+		if undoErr := s.store.Elevations().Update(ctx, &pending); undoErr != nil {
+			log.Printf("Error reopening elevation %s whose role could not be granted: %v", elevation.ID.Hex(), undoErr)
+			return err
+		}
+		*elevation = pending
+		return err
+	}
+	return s.audit(ctx, models.AuditEventElevationApprove, elevation, approver, note)
+}
+
+// checkCovers returns ErrElevationNotCovered unless the approver holds every
+// privilege of the elevation's role in its tenant.
+func (s *Elevations) checkCovers(elevation *models.Elevation, approver string, approverRoles []string) error {
+	actors, err := s.enforcer.Subjects(approver, approverRoles, elevation.TenantID)
+	if err != nil {
+		return err
+	}
+	targets, err := s.enforcer.Subjects("", []string{elevation.Role}, elevation.TenantID)
+	if err != nil {
+		return err
+	}
+	covered, err := s.enforcer.Covers(actors, targets, elevation.TenantID)
+	if err != nil {
+		return err
+	}
+	if !covered {
+		return ErrElevationNotCovered
+	}
+	return nil
+}
+
+// Deny turns the pending elevation down.
+func (s *Elevations) Deny(ctx context.Context, elevation *models.Elevation, approver, note string) error {
+	if err := s.decide(ctx, elevation, models.ElevationDenied, approver, note); err != nil {
+		return err
+	}
+	return s.audit(ctx, models.AuditEventElevationDeny, elevation, approver, note)
+}
+
+// decide moves a pending elevation to status on behalf of approver.
+func (s *Elevations) decide(ctx context.Context, elevation *models.Elevation, status, approver, note string) error {
+	if err := checkDecision(elevation, approver); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	elevation.Status = status
+	elevation.DecidedBy = approver
+	elevation.DecidedAt = &now
+	elevation.Note = note
+	if status == models.ElevationApproved {
+		expiresAt := now.Add(time.Duration(elevation.Hours) * time.Hour)
+		elevation.ExpiresAt = &expiresAt
+	}
+	return s.store.Elevations().Update(ctx, elevation)
+}
+
+// checkDecision reports whether approver may decide on the elevation now.
+func checkDecision(elevation *models.Elevation, approver string) error {
+	if elevation.Status != models.ElevationPending {
+		return ErrElevationState
+	}
+	if approver == elevation.UserID {
+		return ErrSelfDecision
+	}
+	return nil
+}
+
+// Revoke ends an approved elevation before it expires.
+func (s *Elevations) Revoke(ctx context.Context, elevation *models.Elevation, revokedBy, note string) error {
+	if elevation.Status != models.ElevationApproved {
+		return ErrElevationState
+	}
+	if err := s.end(ctx, elevation, models.ElevationRevoked); err != nil {
+		return err
+	}
+	return s.audit(ctx, models.AuditEventElevationRevoke, elevation, revokedBy, note)
+}
+
+// end takes the role away and then records the elevation as ended, so that
+// a failed write never leaves the role in place.
+func (s *Elevations) end(ctx context.Context, elevation *models.Elevation, status string) error {
+	if err := s.enforcer.RevokeElevation(elevation); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	elevation.Status = status
+	elevation.EndedAt = &now
+	return s.store.Elevations().Update(ctx, elevation)
+}
+
+// Run expires elevations once at start and then every interval until ctx is
+// cancelled.
+func (s *Elevations) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := s.ExpireOnce(ctx); err != nil && ctx.Err() == nil {
+			log.Printf("Error expiring elevations: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// ExpireOnce ends every approved elevation past its expiry and returns how
+// many it ended. Elevations another replica ended first are skipped.
+func (s *Elevations) ExpireOnce(ctx context.Context) (int, error) {
+	expired, err := s.store.Elevations().Expired(ctx, time.Now())
+	if err != nil {
+		return 0, err
+	}
+
+	ended := 0
+	for i := range expired {
+		elevation := &expired[i]
+		err := s.end(ctx, elevation, models.ElevationExpired)
+		if errors.Is(err, store.ErrVersionConflict) {
+			continue
+		}
+		if err != nil {
+			return ended, err
+		}
+		ended++
+		if err := s.audit(ctx, models.AuditEventElevationExpire, elevation, "", ""); err != nil {
+			log.Printf("Error auditing expiry of elevation %s: %v", elevation.ID.Hex(), err)
+		}
+	}
+	if ended > 0 {
+		log.Printf("Expired %d role elevations", ended)
+	}
+	return ended, nil
+}
+
+func (s *Elevations) audit(ctx context.Context, event string, elevation *models.Elevation, actor, reason string) error {
+	return s.store.AuditLogs().Write(ctx, &models.AuditEntry{
+		Event:       event,
+		SubjectID:   elevation.UserID,
+		SubjectRole: elevation.Role,
+		ActorID:     actor,
+		Reason:      reason,
+	})
+}
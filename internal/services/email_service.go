@@ -2,6 +2,7 @@ package services
 
 import (
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/hex"
 	"fmt"
 	"log"
@@ -45,6 +46,15 @@ func (s *EmailService) SendPasswordResetEmail(to, token string) error {
 	return s.sendEmail(to, subject, body)
 }
 
+func (s *EmailService) SendMagicLinkEmail(to, token string, expiresIn time.Duration) error {
+	subject := "Your Login Link"
+	loginURL := fmt.Sprintf("%s/magic-link?token=%s", os.Getenv("FRONTEND_URL"), token)
+	body := fmt.Sprintf("Sign in by clicking this link: %s\r\n\r\nThe link can be used once and expires in %d minutes. "+
+		"Open it in the same browser you requested it from.", loginURL, int(expiresIn.Minutes()))
+
+	return s.sendEmail(to, subject, body)
+}
+
 func (s *EmailService) sendEmail(to, subject, body string) error {
 	log.Printf("SMTP Configuration - Host: %s, Port: %d, Username: %s, From: %s", 
 		s.smtpHost, s.smtpPort, s.smtpUsername, s.fromEmail)
@@ -78,6 +88,13 @@ func GenerateToken() (string, error) {
 	return hex.EncodeToString(b), nil
 }
 
+// HashToken returns the hex-encoded SHA-256 of a token so it can be stored
+// and looked up without keeping the secret itself.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
 type Token struct {
 	Token     string
 	ExpiresAt time.Time
@@ -0,0 +1,353 @@
+package services
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/knakul853/accessmesh/internal/models"
+	"github.com/knakul853/accessmesh/pkg/bundle"
+)
+
+// GitOpsActor is recorded as the actor of the changes GitOps makes.
+const GitOpsActor = "gitops"
+
+// GitOpsStatus reports the last sync of the policy directory.
+type GitOpsStatus struct {
+	Dir    string `json:"dir"`
+	Locked bool   `json:"locked"`
+	// Revision is a digest of the policy files last applied, and Commit the
+	// commit checked out in the directory's git repository, if any.
+	Revision    string     `json:"revision,omitempty"`
+	Commit      string     `json:"commit,omitempty"`
+	LastCheckAt *time.Time `json:"last_check_at,omitempty"`
+	LastSyncAt  *time.Time `json:"last_sync_at,omitempty"`
+	// LastError is why the last check failed. Nothing is changed while the
+	// files are invalid.
+	LastError string                   `json:"last_error,omitempty"`
+	Tenants   map[string]*GitOpsTenant `json:"tenants"`
+}
+
+// GitOpsTenant reports the sync of one tenant's policy files.
+type GitOpsTenant struct {
+	Files []string `json:"files"`
+	// Drift is the changes made outside GitOps that the last sync found and
+	// reverted, as the changes reverting them.
+	Drift           []BundleChange `json:"drift"`
+	DriftDetectedAt *time.Time     `json:"drift_detected_at,omitempty"`
+	// Applied is the changes the last sync of new files made.
+	Applied  []BundleChange `json:"applied"`
+	SyncedAt *time.Time     `json:"synced_at,omitempty"`
+}
+
+// GitOps keeps the roles, groups and policies of tenants in step with the
+// bundle files in a directory, typically a git checkout kept up to date by
+// a separate pull. Each file holds a bundle for the tenant it names, or the
+// default tenant; a tenant's files are combined. Each sync imports the
+// files in ImportReplace mode, so edits made through the API are reverted
+// and reported as drift.
+type GitOps struct {
+	bundles  *Bundles
+	dir      string
+	interval time.Duration
+	lock     bool
+
+	mu     sync.Mutex
+	status GitOpsStatus
+}
+
+// NewGitOps returns a GitOps syncing dir every interval. With lock, API
+// writes to what GitOps manages should be refused; see Locked.
+func NewGitOps(bundles *Bundles, dir string, interval time.Duration, lock bool) *GitOps {
+	return &GitOps{
+		bundles:  bundles,
+		dir:      dir,
+		interval: interval,
+		lock:     lock,
+		status:   GitOpsStatus{Dir: dir, Locked: lock, Tenants: map[string]*GitOpsTenant{}},
+	}
+}
+
+// Locked reports whether API writes to roles, groups and policies are
+// locked while GitOps manages them.
+func (g *GitOps) Locked() bool {
+	return g.lock
+}
+
+// Run syncs once at start and then every interval until ctx is cancelled.
+func (g *GitOps) Run(ctx context.Context) {
+	ticker := time.NewTicker(g.interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := g.Sync(ctx); err != nil && ctx.Err() == nil {
+			log.Printf("Error syncing policy directory %s: %v", g.dir, err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Status returns a copy of the status of the last sync.
+func (g *GitOps) Status() *GitOpsStatus {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.copyStatus()
+}
+
+func (g *GitOps) copyStatus() *GitOpsStatus {
+	status := g.status
+	status.Tenants = make(map[string]*GitOpsTenant, len(g.status.Tenants))
+	for tenant, t := range g.status.Tenants {
+		copied := *t
+		status.Tenants[tenant] = &copied
+	}
+	return &status
+}
+
+// Sync reads the policy files and imports each tenant's, returning the new
+// status. Tenants whose files are removed are no longer synced, but keep
+// their roles, groups and policies.
+func (g *GitOps) Sync(ctx context.Context) (*GitOpsStatus, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	now := time.Now().UTC()
+	g.status.LastCheckAt = &now
+	if err := g.sync(ctx, now); err != nil {
+		g.status.LastError = err.Error()
+		return g.copyStatus(), err
+	}
+	g.status.LastError = ""
+	return g.copyStatus(), nil
+}
+
+func (g *GitOps) sync(ctx context.Context, now time.Time) error {
+	files, err := readPolicyDir(g.dir)
+	if err != nil {
+		return err
+	}
+	changed := files.revision != g.status.Revision
+
+	// Every tenant is checked before any is changed.
+	plans := map[string]*ImportResult{}
+	for _, tenant := range files.tenants() {
+		result, err := g.bundles.Import(ctx, tenant, files.bundles[tenant], ImportReplace, true, GitOpsActor)
+		if err != nil {
+			return fmt.Errorf("tenant %s: %w", tenant, err)
+		}
+		plans[tenant] = result
+	}
+
+	for _, tenant := range files.tenants() {
+		t := g.status.Tenants[tenant]
+		if t == nil {
+			t = &GitOpsTenant{Drift: []BundleChange{}, Applied: []BundleChange{}}
+			g.status.Tenants[tenant] = t
+		}
+		t.Files = files.files[tenant]
+
+		pending := plans[tenant].Changes
+		if len(pending) > 0 {
+			result, err := g.bundles.Import(ctx, tenant, files.bundles[tenant], ImportReplace, false, GitOpsActor)
+			if err != nil {
+				return fmt.Errorf("tenant %s: %w", tenant, err)
+			}
+			// Changes while the files stayed the same were made elsewhere.
+			if !changed && t.SyncedAt != nil {
+				log.Printf("GitOps reverted %d changes made outside %s in tenant %s", len(result.Changes), g.dir, tenant)
+				t.Drift = result.Changes
+				t.DriftDetectedAt = &now
+			} else {
+				t.Applied = result.Changes
+			}
+		} else if changed {
+			t.Applied = []BundleChange{}
+		}
+		t.SyncedAt = &now
+	}
+	for tenant := range g.status.Tenants {
+		if _, ok := files.bundles[tenant]; !ok {
+			delete(g.status.Tenants, tenant)
+		}
+	}
+
+	if changed {
+		log.Printf("GitOps applied policy revision %s from %s", files.revision, g.dir)
+	}
+	g.status.Revision = files.revision
+	g.status.Commit = gitCommit(g.dir)
+	g.status.LastSyncAt = &now
+	return nil
+}
+
+// policyFiles is the bundles of a policy directory, combined per tenant.
+type policyFiles struct {
+	bundles  map[string]*bundle.Bundle
+	files    map[string][]string
+	revision string
+}
+
+func (f *policyFiles) tenants() []string {
+	tenants := make([]string, 0, len(f.bundles))
+	for tenant := range f.bundles {
+		tenants = append(tenants, tenant)
+	}
+	sort.Strings(tenants)
+	return tenants
+}
+
+// readPolicyDir reads and checks the .yaml, .yml, .json and .csv files in
+// dir and below, skipping hidden files and directories such as .git.
+func readPolicyDir(dir string) (*policyFiles, error) {
+	files := &policyFiles{bundles: map[string]*bundle.Bundle{}, files: map[string][]string{}}
+	digest := sha256.New()
+
+	err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if strings.HasPrefix(entry.Name(), ".") && path != dir {
+			if entry.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if entry.IsDir() {
+			return nil
+		}
+		format, err := bundle.ParseFormat(strings.TrimPrefix(filepath.Ext(path), "."))
+		if err != nil {
+			return nil
+		}
+
+		name, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(digest, "%s\x00%d\x00", name, len(data))
+		digest.Write(data)
+
+		b, err := bundle.Decode(bytes.NewReader(data), format)
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		if b.Version != bundle.Version {
+			return fmt.Errorf("%s: %w: unsupported version %d, want %d", name, bundle.ErrInvalid, b.Version, bundle.Version)
+		}
+		tenant := b.Tenant
+		if tenant == "" {
+			tenant = models.DefaultTenant
+		}
+		combined := files.bundles[tenant]
+		if combined == nil {
+			combined = &bundle.Bundle{Version: bundle.Version, Tenant: tenant}
+			files.bundles[tenant] = combined
+		}
+		combined.Roles = combineRoles(combined.Roles, b.Roles)
+		combined.Groups = append(combined.Groups, b.Groups...)
+		combined.Policies = append(combined.Policies, b.Policies...)
+		files.files[tenant] = append(files.files[tenant], name)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, tenant := range files.tenants() {
+		if err := files.bundles[tenant].Validate(); err != nil {
+			return nil, fmt.Errorf("tenant %s (%s): %w", tenant, strings.Join(files.files[tenant], ", "), err)
+		}
+	}
+	files.revision = hex.EncodeToString(digest.Sum(nil))[:12]
+	return files, nil
+}
+
+// combineRoles adds roles to combined. A role may be named in several files
+// as long as only one describes it, as CSV files only name roles.
+func combineRoles(combined, roles []bundle.Role) []bundle.Role {
+	bare := func(role bundle.Role) bool { return role.Description == "" && len(role.Permissions) == 0 }
+	for _, role := range roles {
+		i := slices.IndexFunc(combined, func(other bundle.Role) bool { return other.Name == role.Name })
+		switch {
+		case i < 0:
+			combined = append(combined, role)
+		case bare(role):
+		case bare(combined[i]):
+			combined[i] = role
+		default:
+			// Left for Validate to report.
+			combined = append(combined, role)
+		}
+	}
+	return combined
+}
+
+// gitCommit returns the commit checked out in the git repository holding
+// dir, or "" if there is none or it cannot be read.
+func gitCommit(dir string) string {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return ""
+	}
+	for {
+		gitDir := filepath.Join(abs, ".git")
+		if info, err := os.Stat(gitDir); err == nil && info.IsDir() {
+			return resolveHead(gitDir)
+		}
+		parent := filepath.Dir(abs)
+		if parent == abs {
+			return ""
+		}
+		abs = parent
+	}
+}
+
+// resolveHead reads HEAD, following a branch to its commit through the
+// loose or packed refs.
+func resolveHead(gitDir string) string {
+	head, err := os.ReadFile(filepath.Join(gitDir, "HEAD"))
+	if err != nil {
+		return ""
+	}
+	ref, ok := strings.CutPrefix(strings.TrimSpace(string(head)), "ref: ")
+	if !ok {
+		return strings.TrimSpace(string(head))
+	}
+	if commit, err := os.ReadFile(filepath.Join(gitDir, filepath.FromSlash(ref))); err == nil {
+		return strings.TrimSpace(string(commit))
+	}
+
+	packed, err := os.Open(filepath.Join(gitDir, "packed-refs"))
+	if err != nil {
+		return ""
+	}
+	defer packed.Close()
+	scanner := bufio.NewScanner(packed)
+	for scanner.Scan() {
+		if commit, name, ok := strings.Cut(scanner.Text(), " "); ok && name == ref {
+			return commit
+		}
+	}
+	return ""
+}
@@ -0,0 +1,112 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/knakul853/accessmesh/internal/models"
+	"github.com/knakul853/accessmesh/internal/store"
+)
+
+var (
+	// ErrUnknownUser is returned when a group lists a member that is not a
+	// live user of the group's tenant.
+	ErrUnknownUser = errors.New("unknown user")
+	// ErrUnknownGroup is returned when a group or policy names a group that
+	// is not a live group of its tenant.
+	ErrUnknownGroup = errors.New("unknown group")
+	// ErrGroupCycle is returned when nesting a group would make it a
+	// subgroup of itself.
+	ErrGroupCycle = errors.New("group cycle")
+)
+
+// CheckGroup checks the members, subgroups and roles that group adds to
+// previous, which is nil for a new group: members must be live users and
+// subgroups live groups of the group's tenant, roles must exist there, and
+// no subgroup may contain the group. References the group already had are
+// not checked again, so a trashed member does not block other edits.
+func CheckGroup(ctx context.Context, s store.Store, previous, group *models.Group) error {
+	var had models.Group
+	if previous != nil {
+		had = *previous
+	}
+
+	for _, id := range group.Members {
+		if slices.Contains(had.Members, id) {
+			continue
+		}
+		user, err := s.Users().Get(ctx, id)
+		if errors.Is(err, store.ErrNotFound) || errors.Is(err, store.ErrInvalidID) ||
+			(err == nil && user.TenantID != group.TenantID) {
+			return fmt.Errorf("%w %q", ErrUnknownUser, id)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, id := range group.Subgroups {
+		if slices.Contains(had.Subgroups, id) {
+			continue
+		}
+		if err := CheckGroupRef(ctx, s.Groups(), group.TenantID, id); err != nil {
+			return err
+		}
+		if !group.ID.IsZero() {
+			if err := checkNesting(ctx, s.Groups(), group.ID.Hex(), id); err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, name := range group.Roles {
+		if slices.Contains(had.Roles, name) {
+			continue
+		}
+		if err := CheckRole(ctx, s.Roles(), group.TenantID, name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CheckGroupRef returns ErrUnknownGroup unless id names a live group of the
+// tenant.
+func CheckGroupRef(ctx context.Context, groups store.GroupRepository, tenant, id string) error {
+	group, err := groups.Get(ctx, id)
+	if errors.Is(err, store.ErrNotFound) || errors.Is(err, store.ErrInvalidID) ||
+		(err == nil && group.TenantID != tenant) {
+		return fmt.Errorf("%w %q", ErrUnknownGroup, id)
+	}
+	return err
+}
+
+// checkNesting returns ErrGroupCycle if parent is subgroup or nested
+// anywhere below it.
+func checkNesting(ctx context.Context, groups store.GroupRepository, parent, subgroup string) error {
+	seen := map[string]bool{}
+	queue := []string{subgroup}
+	for len(queue) > 0 {
+		id := queue[0]
+		queue = queue[1:]
+		if id == parent {
+			return fmt.Errorf("%w: group %s would contain itself", ErrGroupCycle, parent)
+		}
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+
+		group, err := groups.Get(ctx, id)
+		if errors.Is(err, store.ErrNotFound) || errors.Is(err, store.ErrInvalidID) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		queue = append(queue, group.Subgroups...)
+	}
+	return nil
+}
@@ -0,0 +1,221 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"time"
+
+	"github.com/knakul853/accessmesh/internal/models"
+	"github.com/knakul853/accessmesh/internal/store"
+	"github.com/knakul853/accessmesh/pkg/enforcer"
+)
+
+// ErrUnknownRevision is returned when restoring a revision a document does
+// not have.
+var ErrUnknownRevision = errors.New("unknown revision")
+
+// Fields left out of revision diffs: they change with every write, or are
+// covered by the revision's action.
+var unversionedFields = map[string]bool{
+	"id":         true,
+	"tenant_id":  true,
+	"version":    true,
+	"created_at": true,
+	"updated_at": true,
+	"deleted_at": true,
+	"deleted_by": true,
+}
+
+// History keeps the revision log of policies and roles, and takes and rolls
+// back to snapshots of a tenant's policies.
+type History struct {
+	store    store.Store
+	enforcer *enforcer.Enforcer
+}
+
+func NewHistory(store store.Store, enforcer *enforcer.Enforcer) *History {
+	return &History{store: store, enforcer: enforcer}
+}
+
+// Revisions returns the history of a policy or role, oldest first, with the
+// changes each revision made to the one before it. Documents changed before
+// history was kept start with the first change after.
+func (h *History) Revisions(ctx context.Context, kind, id string) ([]models.Revision, error) {
+	revisions, err := h.store.Revisions().List(ctx, kind, id)
+	if err != nil {
+		return nil, err
+	}
+
+	var previous interface{}
+	for i := range revisions {
+		var current interface{} = revisions[i].Policy
+		if kind == models.RevisionKindRole {
+			current = revisions[i].Role
+		}
+		if revisions[i].Changes, err = diff(previous, current); err != nil {
+			return nil, err
+		}
+		previous = current
+	}
+	return revisions, nil
+}
+
+// Revision returns the revision of a policy or role that produced version.
+func (h *History) Revision(ctx context.Context, kind, id string, version int64) (*models.Revision, error) {
+	revisions, err := h.store.Revisions().List(ctx, kind, id)
+	if err != nil {
+		return nil, err
+	}
+	for i := range revisions {
+		if revisions[i].Version == version {
+			return &revisions[i], nil
+		}
+	}
+	return nil, fmt.Errorf("%w: %s %s has no version %d", ErrUnknownRevision, kind, id, version)
+}
+
+// diff lists the fields that differ between two policies or two roles,
+// descending one level into objects such as a policy's conditions.
+func diff(previous, current interface{}) ([]models.FieldChange, error) {
+	before, err := fields(previous)
+	if err != nil {
+		return nil, err
+	}
+	after, err := fields(current)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := []models.FieldChange{}
+	for name, to := range after {
+		if from, ok := before[name]; !ok || !reflect.DeepEqual(from, to) {
+			changes = append(changes, models.FieldChange{Field: name, From: from, To: to})
+		}
+	}
+	for name, from := range before {
+		if _, ok := after[name]; !ok {
+			changes = append(changes, models.FieldChange{Field: name, From: from})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Field < changes[j].Field })
+	return changes, nil
+}
+
+// fields flattens the JSON form of a document into its versioned fields.
+// Empty lists and absent fields are alike.
+func fields(document interface{}) (map[string]interface{}, error) {
+	flat := map[string]interface{}{}
+	if document == nil || reflect.ValueOf(document).IsNil() {
+		return flat, nil
+	}
+
+	data, err := json.Marshal(document)
+	if err != nil {
+		return nil, err
+	}
+	var top map[string]interface{}
+	if err := json.Unmarshal(data, &top); err != nil {
+		return nil, err
+	}
+	for name, value := range top {
+		if unversionedFields[name] {
+			continue
+		}
+		if object, ok := value.(map[string]interface{}); ok {
+			for inner, innerValue := range object {
+				if !empty(innerValue) {
+					flat[name+"."+inner] = innerValue
+				}
+			}
+			continue
+		}
+		if !empty(value) {
+			flat[name] = value
+		}
+	}
+	return flat, nil
+}
+
+func empty(value interface{}) bool {
+	switch v := value.(type) {
+	case nil:
+		return true
+	case string:
+		return v == ""
+	case []interface{}:
+		return len(v) == 0
+	}
+	return false
+}
+
+// Snapshot copies the live policies of a tenant.
+func (h *History) Snapshot(ctx context.Context, tenantID, description, actor string) (*models.PolicySnapshot, error) {
+	page, err := h.store.Policies().List(ctx, store.PolicyQuery{TenantID: tenantID})
+	if err != nil {
+		return nil, err
+	}
+
+	snapshot := &models.PolicySnapshot{
+		TenantID:    tenantID,
+		Description: description,
+		Policies:    page.Items,
+		CreatedBy:   actor,
+		CreatedAt:   time.Now(),
+	}
+	if err := h.store.Snapshots().Create(ctx, snapshot); err != nil {
+		return nil, err
+	}
+	return snapshot, nil
+}
+
+// Rollback makes the snapshot's policies the live policies of its tenant in
+// a single store transaction, then brings the enforcer's rules and the
+// revision log in line. It returns the policies it changed. Every policy
+// must still name a live role or group of the tenant; otherwise nothing is
+// changed and ErrUnknownRole or ErrUnknownGroup is returned.
+func (h *History) Rollback(ctx context.Context, snapshot *models.PolicySnapshot, actor string) ([]store.PolicyChange, error) {
+	for _, policy := range snapshot.Policies {
+		var err error
+		if policy.Group != "" {
+			err = CheckGroupRef(ctx, h.store.Groups(), snapshot.TenantID, policy.Group)
+		} else {
+			err = CheckRole(ctx, h.store.Roles(), snapshot.TenantID, policy.Role)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return h.replacePolicies(ctx, snapshot.TenantID, snapshot.Policies, actor, models.RevisionRollback)
+}
+
+// replacePolicies makes policies the live policies of the tenant, recording
+// each change as action, in a single store transaction, then updates the
+// enforcer's rules.
+func (h *History) replacePolicies(ctx context.Context, tenantID string, policies []models.Policy, actor, action string) ([]store.PolicyChange, error) {
+	changes, err := h.store.Policies().ReplaceAll(store.WithRevision(ctx, action, actor), tenantID, policies, actor)
+	if err != nil {
+		return nil, err
+	}
+
+	// Revoking checks the store for other policies granting the same rule,
+	// so all revokes go first and see the replaced policies.
+	for _, change := range changes {
+		if change.Before != nil && change.Before.DeletedAt == nil {
+			if err := h.enforcer.Revoke(ctx, h.store.Policies(), change.Before); err != nil {
+				return changes, err
+			}
+		}
+	}
+	for _, change := range changes {
+		if change.After.DeletedAt == nil {
+			if err := h.enforcer.Grant(change.After); err != nil {
+				return changes, err
+			}
+		}
+	}
+	return changes, nil
+}
@@ -0,0 +1,64 @@
+package services
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/knakul853/accessmesh/internal/store"
+)
+
+// Purger permanently removes users, roles, policies and groups that have been in the
+// trash for longer than the retention period.
+type Purger struct {
+	store     store.Store
+	retention time.Duration
+	interval  time.Duration
+}
+
+func NewPurger(store store.Store, retention, interval time.Duration) *Purger {
+	return &Purger{store: store, retention: retention, interval: interval}
+}
+
+// Run purges once at start and then every interval until ctx is cancelled.
+func (p *Purger) Run(ctx context.Context) {
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := p.PurgeOnce(ctx); err != nil && ctx.Err() == nil {
+			log.Printf("Error purging trash: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// PurgeOnce removes everything trashed before the retention cutoff and
+// returns how many documents went.
+func (p *Purger) PurgeOnce(ctx context.Context) (int64, error) {
+	before := time.Now().Add(-p.retention)
+	purges := []func(context.Context, time.Time) (int64, error){
+		p.store.Users().Purge,
+		p.store.Roles().Purge,
+		p.store.Policies().Purge,
+		p.store.Groups().Purge,
+	}
+
+	var total int64
+	for _, purge := range purges {
+		n, err := purge(ctx, before)
+		total += n
+		if err != nil {
+			return total, err
+		}
+	}
+	if total > 0 {
+		log.Printf("Purged %d documents trashed before %s", total, before.Format(time.RFC3339))
+	}
+	return total, nil
+}
@@ -0,0 +1,273 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/knakul853/accessmesh/internal/models"
+	"github.com/knakul853/accessmesh/internal/store"
+	"github.com/knakul853/accessmesh/pkg/enforcer"
+)
+
+// What happens to the users, policies and groups still referencing a role
+// that is deleted, selected with ROLE_DELETE_MODE.
+const (
+	// RoleDeleteReject refuses to delete a role that is still referenced.
+	RoleDeleteReject = "reject"
+	// RoleDeleteCascade trashes the role's policies and takes the role from
+	// its users and groups.
+	RoleDeleteCascade = "cascade"
+	// RoleDeleteReassign moves the role's users, policies and groups to the
+	// fallback role.
+	RoleDeleteReassign = "reassign"
+)
+
+var (
+	// ErrUnknownRole is returned when a user or policy names a role that
+	// does not exist or is in the trash.
+	ErrUnknownRole = errors.New("unknown role")
+	// ErrRoleInUse is returned when deleting a role that users, policies or
+	// groups still reference and the delete mode is RoleDeleteReject.
+	ErrRoleInUse = errors.New("role in use")
+)
+
+// CheckRole returns ErrUnknownRole unless the tenant has a live role called
+// name.
+func CheckRole(ctx context.Context, roles store.RoleRepository, tenant, name string) error {
+	if name == "" {
+		return ErrUnknownRole
+	}
+
+	page, err := roles.List(ctx, store.RoleQuery{
+		ListOptions: store.ListOptions{Limit: 1},
+		TenantID:    tenant,
+		Name:        name,
+	})
+	if err != nil {
+		return err
+	}
+	if page.Total == 0 {
+		return fmt.Errorf("%w %q", ErrUnknownRole, name)
+	}
+	return nil
+}
+
+// RoleReferences counts the live users, policies and groups naming a role.
+type RoleReferences struct {
+	Users    int64 `json:"users"`
+	Policies int64 `json:"policies"`
+	Groups   int64 `json:"groups"`
+}
+
+// Orphan is a user or policy whose role does not exist in its tenant.
+type Orphan struct {
+	ID       string `json:"id"`
+	TenantID string `json:"tenant_id"`
+	Role     string `json:"role"`
+}
+
+// OrphanReport lists everything referring to a role that does not exist.
+type OrphanReport struct {
+	Users    []Orphan `json:"users"`
+	Policies []Orphan `json:"policies"`
+	// Rules are enforcer rules whose subject is not a live role of the
+	// rule's domain.
+	Rules [][]string `json:"rules"`
+}
+
+// RoleIntegrity keeps users, policies and groups pointing at live roles.
+type RoleIntegrity struct {
+	store    store.Store
+	enforcer *enforcer.Enforcer
+	mode     string
+	fallback string
+}
+
+// NewRoleIntegrity checks mode and returns a RoleIntegrity applying it. The
+// fallback role is required for RoleDeleteReassign.
+func NewRoleIntegrity(store store.Store, enforcer *enforcer.Enforcer, mode, fallback string) (*RoleIntegrity, error) {
+	switch mode {
+	case RoleDeleteReject, RoleDeleteCascade:
+	case RoleDeleteReassign:
+		if fallback == "" {
+			return nil, errors.New("ROLE_DELETE_FALLBACK is required when ROLE_DELETE_MODE is reassign")
+		}
+	default:
+		return nil, fmt.Errorf("unknown ROLE_DELETE_MODE %q", mode)
+	}
+
+	return &RoleIntegrity{store: store, enforcer: enforcer, mode: mode, fallback: fallback}, nil
+}
+
+// DeleteRole moves the role to the trash after dealing with the users,
+// policies and groups of its tenant referencing it according to the delete mode, and
+// returns how many there were. References are left alone while another live
+// role of the tenant shares the name. In reject mode a referenced role is
+// kept and ErrRoleInUse returned.
+func (i *RoleIntegrity) DeleteRole(ctx context.Context, role *models.Role, deletedBy string) (*RoleReferences, error) {
+	refs := &RoleReferences{}
+
+	namesakes, err := i.store.Roles().List(ctx, store.RoleQuery{
+		ListOptions: store.ListOptions{Limit: 1},
+		TenantID:    role.TenantID,
+		Name:        role.Name,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if namesakes.Total <= 1 {
+		users, err := i.store.Users().List(ctx, store.UserQuery{TenantID: role.TenantID, Role: role.Name})
+		if err != nil {
+			return nil, err
+		}
+		policies, err := i.store.Policies().List(ctx, store.PolicyQuery{TenantID: role.TenantID, Role: role.Name})
+		if err != nil {
+			return nil, err
+		}
+		groups, err := i.store.Groups().List(ctx, store.GroupQuery{TenantID: role.TenantID, Role: role.Name})
+		if err != nil {
+			return nil, err
+		}
+		refs.Users, refs.Policies, refs.Groups = users.Total, policies.Total, groups.Total
+
+		if refs.Users > 0 || refs.Policies > 0 || refs.Groups > 0 {
+			if err := i.release(ctx, role, users.Items, policies.Items, groups.Items, deletedBy); err != nil {
+				return refs, err
+			}
+		}
+	}
+
+	recording := store.WithRevision(ctx, models.RevisionDelete, deletedBy)
+	return refs, i.store.Roles().SoftDelete(recording, role.ID.Hex(), role.Version, deletedBy)
+}
+
+// release points users, policies and groups away from the role.
+func (i *RoleIntegrity) release(ctx context.Context, role *models.Role, users []models.User, policies []models.Policy, groups []models.Group, deletedBy string) error {
+	target := ""
+	switch i.mode {
+	case RoleDeleteReject:
+		return ErrRoleInUse
+	case RoleDeleteReassign:
+		if i.fallback == role.Name {
+			return fmt.Errorf("%w: cannot delete the fallback role", ErrRoleInUse)
+		}
+		if err := CheckRole(ctx, i.store.Roles(), role.TenantID, i.fallback); err != nil {
+			return fmt.Errorf("fallback role: %w", err)
+		}
+		target = i.fallback
+	}
+
+	for j := range users {
+		user := &users[j]
+		// A user already holding the fallback role just loses this one.
+		rename := target != "" && !user.HasRole(target)
+		user.Roles = slices.DeleteFunc(user.Roles, func(assignment models.RoleAssignment) bool {
+			return assignment.Role == role.Name && !rename
+		})
+		for k := range user.Roles {
+			if user.Roles[k].Role == role.Name {
+				user.Roles[k].Role = target
+			}
+		}
+		if err := i.store.Users().Update(ctx, user); err != nil {
+			return err
+		}
+	}
+
+	for j := range policies {
+		policy := &policies[j]
+		previous := *policy
+		if target == "" {
+			recording := store.WithRevision(ctx, models.RevisionDelete, deletedBy)
+			if err := i.store.Policies().SoftDelete(recording, policy.ID.Hex(), policy.Version, deletedBy); err != nil {
+				return err
+			}
+		} else {
+			policy.Role = target
+			recording := store.WithRevision(ctx, models.RevisionUpdate, deletedBy)
+			if err := i.store.Policies().Update(recording, policy); err != nil {
+				return err
+			}
+			if err := i.enforcer.Grant(policy); err != nil {
+				return err
+			}
+		}
+		if err := i.enforcer.Revoke(ctx, i.store.Policies(), &previous); err != nil {
+			return err
+		}
+	}
+
+	for j := range groups {
+		group := &groups[j]
+		previous := *group
+		previous.Roles = slices.Clone(group.Roles)
+		group.Roles = slices.DeleteFunc(group.Roles, func(name string) bool { return name == role.Name })
+		if target != "" && !slices.Contains(group.Roles, target) {
+			group.Roles = append(group.Roles, target)
+		}
+		if err := i.store.Groups().Update(ctx, group); err != nil {
+			return err
+		}
+		if err := i.enforcer.SyncGroup(&previous, group); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Orphans reports the live users and policies, and the enforcer rules, of
+// the tenant, or of every tenant if tenant is empty, with a role that does
+// not exist in their tenant. A user is reported once per such role.
+// Policies and rules applying to a group are not orphans.
+func (i *RoleIntegrity) Orphans(ctx context.Context, tenant string) (*OrphanReport, error) {
+	roles, err := i.store.Roles().List(ctx, store.RoleQuery{TenantID: tenant})
+	if err != nil {
+		return nil, err
+	}
+	type tenantRole struct{ tenant, name string }
+	known := make(map[tenantRole]bool, len(roles.Items))
+	for _, role := range roles.Items {
+		known[tenantRole{role.TenantID, role.Name}] = true
+	}
+
+	report := &OrphanReport{Users: []Orphan{}, Policies: []Orphan{}, Rules: [][]string{}}
+
+	users, err := i.store.Users().List(ctx, store.UserQuery{TenantID: tenant})
+	if err != nil {
+		return nil, err
+	}
+	for _, user := range users.Items {
+		for _, assignment := range user.Roles {
+			if !known[tenantRole{user.TenantID, assignment.Role}] {
+				report.Users = append(report.Users, Orphan{ID: user.ID.Hex(), TenantID: user.TenantID, Role: assignment.Role})
+			}
+		}
+	}
+
+	policies, err := i.store.Policies().List(ctx, store.PolicyQuery{TenantID: tenant})
+	if err != nil {
+		return nil, err
+	}
+	for _, policy := range policies.Items {
+		if policy.Group == "" && !known[tenantRole{policy.TenantID, policy.Role}] {
+			report.Policies = append(report.Policies, Orphan{ID: policy.ID.Hex(), TenantID: policy.TenantID, Role: policy.Role})
+		}
+	}
+
+	rules, err := i.enforcer.GetPolicy()
+	if err != nil {
+		return nil, err
+	}
+	for _, rule := range rules {
+		if len(rule) < 2 || (tenant != "" && rule[1] != tenant) || strings.HasPrefix(rule[0], enforcer.GroupSubject("")) {
+			continue
+		}
+		if !known[tenantRole{rule[1], rule[0]}] {
+			report.Rules = append(report.Rules, rule)
+		}
+	}
+	return report, nil
+}
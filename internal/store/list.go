@@ -0,0 +1,187 @@
+package store
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/knakul853/accessmesh/internal/models"
+)
+
+// ListOptions pages, orders and searches a List call. The zero value returns
+// every match in creation order.
+type ListOptions struct {
+	// Limit caps the page size; 0 means no limit.
+	Limit int
+	// After is the NextCursor of the previous page.
+	After string
+	// Sort names the field to order by, prefixed with "-" for descending.
+	// Empty or "created_at" sorts by creation order.
+	Sort string
+	// Search matches a case-insensitive substring of the resource's text
+	// fields.
+	Search string
+	// Deleted lists the trash, i.e. only soft-deleted documents, instead of
+	// the live ones.
+	Deleted bool
+}
+
+type UserQuery struct {
+	ListOptions
+	TenantID      string
+	Role          string
+	EmailVerified *bool
+}
+
+type RoleQuery struct {
+	ListOptions
+	TenantID string
+	Name     string
+}
+
+type PolicyQuery struct {
+	ListOptions
+	TenantID string
+	Role     string
+	Group    string
+	Resource string
+	Action   string
+}
+
+// GroupQuery filters groups. Member, Subgroup and Role select the groups
+// whose Members, Subgroups or Roles contain the given value.
+type GroupQuery struct {
+	ListOptions
+	TenantID string
+	Name     string
+	Member   string
+	Subgroup string
+	Role     string
+}
+
+// ElevationQuery filters elevations. Search matches the justification.
+type ElevationQuery struct {
+	ListOptions
+	TenantID string
+	UserID   string
+	Role     string
+	Status   string
+}
+
+// Page is one page of a List result.
+type Page[T any] struct {
+	Items []T
+	// Total counts every match, ignoring Limit and After.
+	Total int64
+	// NextCursor is passed as After to fetch the following page. It is empty
+	// on the last page.
+	NextCursor string
+}
+
+// Sortable fields per resource, mapped to their stored field names. An empty
+// field name orders by ID, which follows creation order.
+var (
+	userSortFields      = map[string]string{"created_at": "", "username": "username", "email": "email"}
+	roleSortFields      = map[string]string{"created_at": "", "name": "name"}
+	policySortFields    = map[string]string{"created_at": "", "role": "role", "resource": "resource", "action": "action"}
+	groupSortFields     = map[string]string{"created_at": "", "name": "name"}
+	elevationSortFields = map[string]string{"created_at": ""}
+)
+
+// Sort keys return the value a row sorts by for a stored field name, and the
+// row's ID as the tie-breaker.
+
+func userSortKey(u models.User, field string) (string, string) {
+	switch field {
+	case "username":
+		return u.Username, u.ID.Hex()
+	case "email":
+		return u.Email, u.ID.Hex()
+	}
+	return "", u.ID.Hex()
+}
+
+func roleSortKey(r models.Role, field string) (string, string) {
+	if field == "name" {
+		return r.Name, r.ID.Hex()
+	}
+	return "", r.ID.Hex()
+}
+
+func policySortKey(p models.Policy, field string) (string, string) {
+	switch field {
+	case "role":
+		return p.Role, p.ID.Hex()
+	case "resource":
+		return p.Resource, p.ID.Hex()
+	case "action":
+		return p.Action, p.ID.Hex()
+	}
+	return "", p.ID.Hex()
+}
+
+func groupSortKey(g models.Group, field string) (string, string) {
+	if field == "name" {
+		return g.Name, g.ID.Hex()
+	}
+	return "", g.ID.Hex()
+}
+
+func elevationSortKey(e models.Elevation, field string) (string, string) {
+	return "", e.ID.Hex()
+}
+
+type sortSpec struct {
+	// Field is the stored field name, empty for ID order.
+	Field string
+	Desc  bool
+}
+
+func parseSort(sort string, fields map[string]string) (sortSpec, error) {
+	var spec sortSpec
+	if strings.HasPrefix(sort, "-") {
+		spec.Desc = true
+		sort = sort[1:]
+	}
+	if sort == "" {
+		return spec, nil
+	}
+
+	field, ok := fields[sort]
+	if !ok {
+		return spec, fmt.Errorf("%w: cannot sort by %q", ErrInvalidQuery, sort)
+	}
+	spec.Field = field
+	return spec, nil
+}
+
+// listCursor is the keyset position of the last item on a page.
+type listCursor struct {
+	Value string `json:"v,omitempty"`
+	ID    string `json:"id"`
+}
+
+func encodeCursor(value, id string) string {
+	data, _ := json.Marshal(listCursor{Value: value, ID: id})
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeCursor(after string) (*listCursor, error) {
+	if after == "" {
+		return nil, nil
+	}
+
+	data, err := base64.RawURLEncoding.DecodeString(after)
+	if err != nil {
+		return nil, fmt.Errorf("%w: malformed cursor", ErrInvalidQuery)
+	}
+	var c listCursor
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, fmt.Errorf("%w: malformed cursor", ErrInvalidQuery)
+	}
+	if _, err := parseObjectID(c.ID); err != nil {
+		return nil, fmt.Errorf("%w: malformed cursor", ErrInvalidQuery)
+	}
+	return &c, nil
+}
@@ -0,0 +1,326 @@
+package store
+
+import (
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/knakul853/accessmesh/internal/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// MemoryStore keeps all data in process memory. It is safe for concurrent
+// use and mirrors the lookup, uniqueness and expiry behaviour of MongoStore,
+// which makes it suitable for tests and single-node demos. Nothing survives
+// a restart.
+type MemoryStore struct {
+	mu         sync.RWMutex
+	tenants    map[string]models.Tenant
+	users      table[models.User]
+	roles      table[models.Role]
+	policies   table[models.Policy]
+	groups     table[models.Group]
+	elevations table[models.Elevation]
+	magicLinks table[models.MagicLink]
+	// magicLinkRequests counts the links requested per email and window.
+	magicLinkRequests map[magicLinkWindow]int64
+	revisions         table[models.Revision]
+	snapshots         table[models.PolicySnapshot]
+	auditLog          []models.AuditEntry
+	// tuples holds every relation tuple ever written, deleted ones
+	// included, and tupleRevisions the latest revision of each tenant.
+	tuples         []models.RelationTuple
+	tupleRevisions map[string]int64
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		tenants: map[string]models.Tenant{
+			models.DefaultTenant: {ID: models.DefaultTenant, Name: "Default", CreatedAt: time.Now()},
+		},
+		users:      newTable[models.User](),
+		roles:      newTable[models.Role](),
+		policies:   newTable[models.Policy](),
+		groups:     newTable[models.Group](),
+		elevations: newTable[models.Elevation](),
+		magicLinks: newTable[models.MagicLink](),
+		revisions:  newTable[models.Revision](),
+		snapshots:  newTable[models.PolicySnapshot](),
+
+		magicLinkRequests: map[magicLinkWindow]int64{},
+		tupleRevisions:    map[string]int64{},
+	}
+}
+
+func (s *MemoryStore) Tenants() TenantRepository {
+	return &memoryTenantRepository{s}
+}
+
+func (s *MemoryStore) Users() UserRepository {
+	return &memoryUserRepository{s}
+}
+
+func (s *MemoryStore) Roles() RoleRepository {
+	return &memoryRoleRepository{s}
+}
+
+func (s *MemoryStore) Policies() PolicyRepository {
+	return &memoryPolicyRepository{s}
+}
+
+func (s *MemoryStore) Groups() GroupRepository {
+	return &memoryGroupRepository{s}
+}
+
+func (s *MemoryStore) Elevations() ElevationRepository {
+	return &memoryElevationRepository{s}
+}
+
+func (s *MemoryStore) Tuples() TupleRepository {
+	return &memoryTupleRepository{s}
+}
+
+func (s *MemoryStore) Revisions() RevisionRepository {
+	return &memoryRevisionRepository{s}
+}
+
+func (s *MemoryStore) Snapshots() SnapshotRepository {
+	return &memorySnapshotRepository{s}
+}
+
+func (s *MemoryStore) MagicLinks() MagicLinkRepository {
+	return &memoryMagicLinkRepository{s}
+}
+
+func (s *MemoryStore) AuditLogs() AuditRepository {
+	return &memoryAuditRepository{s}
+}
+
+// table holds documents by ID and remembers insertion order so List returns
+// them the way Mongo's natural order would.
+type table[T any] struct {
+	rows  map[primitive.ObjectID]T
+	order []primitive.ObjectID
+}
+
+func newTable[T any]() table[T] {
+	return table[T]{rows: map[primitive.ObjectID]T{}}
+}
+
+func (t *table[T]) insert(id primitive.ObjectID, row T) {
+	t.rows[id] = row
+	t.order = append(t.order, id)
+}
+
+func (t *table[T]) get(id string) (T, primitive.ObjectID, error) {
+	var zero T
+	objID, err := objectID(id)
+	if err != nil {
+		return zero, objID, err
+	}
+	row, ok := t.rows[objID]
+	if !ok {
+		return zero, objID, ErrNotFound
+	}
+	return row, objID, nil
+}
+
+// find returns the first row, in insertion order, that matches.
+func (t *table[T]) find(match func(T) bool) (T, bool) {
+	for _, id := range t.order {
+		if row := t.rows[id]; match(row) {
+			return row, true
+		}
+	}
+	var zero T
+	return zero, false
+}
+
+func (t *table[T]) all() []T {
+	rows := make([]T, 0, len(t.order))
+	for _, id := range t.order {
+		rows = append(rows, t.rows[id])
+	}
+	return rows
+}
+
+func (t *table[T]) replace(id primitive.ObjectID, row T) error {
+	if _, ok := t.rows[id]; !ok {
+		return ErrNotFound
+	}
+	t.rows[id] = row
+	return nil
+}
+
+// checkVersion compares the stored version with the one a delete expects,
+// where 0 expects any version.
+func checkVersion(stored, expected int64) error {
+	if expected != 0 && stored != expected {
+		return ErrVersionConflict
+	}
+	return nil
+}
+
+func (t *table[T]) delete(id string) error {
+	objID, err := objectID(id)
+	if err != nil {
+		return err
+	}
+	if _, ok := t.rows[objID]; !ok {
+		return ErrNotFound
+	}
+
+	delete(t.rows, objID)
+	for i, existing := range t.order {
+		if existing == objID {
+			t.order = append(t.order[:i], t.order[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
+
+// rowMeta points at the tenant, version and deletion fields of a row.
+type rowMeta struct {
+	tenantID  *string
+	version   *int64
+	deletedAt **time.Time
+	deletedBy *string
+}
+
+// getLive is get for soft-deletable rows; trashed rows are not found.
+func (t *table[T]) getLive(id string, meta func(*T) rowMeta) (T, error) {
+	row, _, err := t.get(id)
+	if err == nil && *meta(&row).deletedAt != nil {
+		var zero T
+		return zero, ErrNotFound
+	}
+	return row, err
+}
+
+func (t *table[T]) softDelete(id string, version int64, deletedBy string, meta func(*T) rowMeta) error {
+	row, objID, err := t.get(id)
+	if err != nil {
+		return err
+	}
+	m := meta(&row)
+	if *m.deletedAt != nil {
+		return ErrNotFound
+	}
+	if err := checkVersion(*m.version, version); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	*m.deletedAt = &now
+	*m.deletedBy = deletedBy
+	*m.version++
+	t.rows[objID] = row
+	return nil
+}
+
+func (t *table[T]) restore(id, tenantID string, meta func(*T) rowMeta) error {
+	row, objID, err := t.get(id)
+	if err != nil {
+		return err
+	}
+	m := meta(&row)
+	if *m.deletedAt == nil || (tenantID != "" && *m.tenantID != tenantID) {
+		return ErrNotFound
+	}
+
+	*m.deletedAt = nil
+	*m.deletedBy = ""
+	*m.version++
+	t.rows[objID] = row
+	return nil
+}
+
+func (t *table[T]) purge(before time.Time, meta func(*T) rowMeta) int64 {
+	var purged int64
+	for _, id := range slices.Clone(t.order) {
+		row := t.rows[id]
+		if deletedAt := *meta(&row).deletedAt; deletedAt != nil && deletedAt.Before(before) {
+			t.delete(id.Hex())
+			purged++
+		}
+	}
+	return purged
+}
+
+// live selects rows in or out of the trash as opts asks.
+func live(opts ListOptions, deletedAt *time.Time) bool {
+	return (deletedAt != nil) == opts.Deleted
+}
+
+// listPage filters, orders and pages rows the same way the database backends
+// do.
+func listPage[T any](rows []T, opts ListOptions, fields map[string]string,
+	sortKey func(row T, field string) (string, string), match func(T) bool,
+) (*Page[T], error) {
+	spec, err := parseSort(opts.Sort, fields)
+	if err != nil {
+		return nil, err
+	}
+	after, err := decodeCursor(opts.After)
+	if err != nil {
+		return nil, err
+	}
+
+	compare := func(v1, id1, v2, id2 string) int {
+		c := strings.Compare(v1, v2)
+		if c == 0 {
+			c = strings.Compare(id1, id2)
+		}
+		if spec.Desc {
+			c = -c
+		}
+		return c
+	}
+	key := func(row T) (string, string) {
+		return sortKey(row, spec.Field)
+	}
+
+	var matches []T
+	for _, row := range rows {
+		if match(row) {
+			matches = append(matches, row)
+		}
+	}
+	sort.SliceStable(matches, func(i, j int) bool {
+		vi, idi := key(matches[i])
+		vj, idj := key(matches[j])
+		return compare(vi, idi, vj, idj) < 0
+	})
+
+	page := &Page[T]{Items: []T{}, Total: int64(len(matches))}
+	for _, row := range matches {
+		v, rowID := key(row)
+		if after != nil && compare(v, rowID, after.Value, after.ID) <= 0 {
+			continue
+		}
+		if opts.Limit > 0 && len(page.Items) == opts.Limit {
+			last := page.Items[len(page.Items)-1]
+			page.NextCursor = encodeCursor(key(last))
+			break
+		}
+		page.Items = append(page.Items, row)
+	}
+	return page, nil
+}
+
+// containsFold reports whether any of values contains search, ignoring case.
+func containsFold(search string, values ...string) bool {
+	if search == "" {
+		return true
+	}
+	search = strings.ToLower(search)
+	for _, v := range values {
+		if strings.Contains(strings.ToLower(v), search) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,106 @@
+package store
+
+import (
+	"context"
+	"slices"
+	"time"
+
+	"github.com/knakul853/accessmesh/internal/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type memoryMagicLinkRepository struct {
+	s *MemoryStore
+}
+
+func (r *memoryMagicLinkRepository) Create(ctx context.Context, link *models.MagicLink) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	// Links are dropped magicLinkRetention after they expire, as the TTL
+	// index of MongoStore does.
+	cutoff := time.Now().Add(-magicLinkRetention)
+	for _, id := range slices.Clone(r.s.magicLinks.order) {
+		if r.s.magicLinks.rows[id].ExpiresAt.Before(cutoff) {
+			r.s.magicLinks.delete(id.Hex())
+		}
+	}
+
+	link.ID = primitive.NewObjectID()
+	r.s.magicLinks.insert(link.ID, *link)
+	return nil
+}
+
+// magicLinkWindow identifies the requests of one email in one rate limit
+// window.
+type magicLinkWindow struct {
+	email string
+	start int64
+}
+
+func (r *memoryMagicLinkRepository) RecordRequest(ctx context.Context, email string, window time.Time, limit int64) (bool, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	// Windows are dropped magicLinkRetention after they start, as the TTL
+	// index of MongoStore does.
+	cutoff := time.Now().Add(-magicLinkRetention).UnixNano()
+	for key := range r.s.magicLinkRequests {
+		if key.start < cutoff {
+			delete(r.s.magicLinkRequests, key)
+		}
+	}
+
+	key := magicLinkWindow{email: email, start: window.UnixNano()}
+	if r.s.magicLinkRequests[key] >= limit {
+		return false, nil
+	}
+	r.s.magicLinkRequests[key]++
+	return true, nil
+}
+
+func (r *memoryMagicLinkRepository) GetActive(ctx context.Context, tokenHash string) (*models.MagicLink, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	now := time.Now()
+	link, ok := r.s.magicLinks.find(func(l models.MagicLink) bool {
+		return l.TokenHash == tokenHash && !l.Used && l.ExpiresAt.After(now)
+	})
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &link, nil
+}
+
+func (r *memoryMagicLinkRepository) Claim(ctx context.Context, id string) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	link, objID, err := r.s.magicLinks.get(id)
+	if err != nil {
+		return err
+	}
+	if link.Used {
+		return ErrNotFound
+	}
+
+	link.Used = true
+	return r.s.magicLinks.replace(objID, link)
+}
+
+type memoryAuditRepository struct {
+	s *MemoryStore
+}
+
+func (r *memoryAuditRepository) Write(ctx context.Context, entry *models.AuditEntry) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	if entry.CreatedAt.IsZero() {
+		entry.CreatedAt = time.Now()
+	}
+	entry.ID = primitive.NewObjectID()
+	r.s.auditLog = append(r.s.auditLog, *entry)
+	return nil
+}
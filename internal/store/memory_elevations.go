@@ -0,0 +1,81 @@
+package store
+
+import (
+	"context"
+	"time"
+
+	"github.com/knakul853/accessmesh/internal/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type memoryElevationRepository struct {
+	s *MemoryStore
+}
+
+func (r *memoryElevationRepository) Create(ctx context.Context, elevation *models.Elevation) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	elevation.ID = primitive.NewObjectID()
+	elevation.TenantID = tenantOf(elevation.TenantID)
+	elevation.Version = 1
+	r.s.elevations.insert(elevation.ID, *elevation)
+	return nil
+}
+
+func (r *memoryElevationRepository) Get(ctx context.Context, id string) (*models.Elevation, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	elevation, _, err := r.s.elevations.get(id)
+	if err != nil {
+		return nil, err
+	}
+	return &elevation, nil
+}
+
+func (r *memoryElevationRepository) List(ctx context.Context, query ElevationQuery) (*Page[models.Elevation], error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	return listPage(r.s.elevations.all(), query.ListOptions, elevationSortFields, elevationSortKey,
+		func(e models.Elevation) bool {
+			return !query.Deleted &&
+				(query.TenantID == "" || e.TenantID == query.TenantID) &&
+				(query.UserID == "" || e.UserID == query.UserID) &&
+				(query.Role == "" || e.Role == query.Role) &&
+				(query.Status == "" || e.Status == query.Status) &&
+				containsFold(query.Search, e.Justification)
+		},
+	)
+}
+
+func (r *memoryElevationRepository) Update(ctx context.Context, elevation *models.Elevation) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	stored, ok := r.s.elevations.rows[elevation.ID]
+	if !ok {
+		return ErrNotFound
+	}
+	if stored.Version != elevation.Version {
+		return ErrVersionConflict
+	}
+
+	elevation.Version++
+	elevation.UpdatedAt = time.Now()
+	return r.s.elevations.replace(elevation.ID, *elevation)
+}
+
+func (r *memoryElevationRepository) Expired(ctx context.Context, now time.Time) ([]models.Elevation, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	var expired []models.Elevation
+	for _, elevation := range r.s.elevations.all() {
+		if elevation.Status == models.ElevationApproved && elevation.ExpiresAt != nil && !elevation.ExpiresAt.After(now) {
+			expired = append(expired, elevation)
+		}
+	}
+	return expired, nil
+}
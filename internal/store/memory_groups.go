@@ -0,0 +1,125 @@
+package store
+
+import (
+	"context"
+	"slices"
+	"time"
+
+	"github.com/knakul853/accessmesh/internal/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type memoryGroupRepository struct {
+	s *MemoryStore
+}
+
+func (r *memoryGroupRepository) Create(ctx context.Context, group *models.Group) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	group.ID = primitive.NewObjectID()
+	group.TenantID = tenantOf(group.TenantID)
+	group.Version = 1
+	r.s.groups.insert(group.ID, cloneGroup(*group))
+	return nil
+}
+
+func (r *memoryGroupRepository) Get(ctx context.Context, id string) (*models.Group, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	group, err := r.s.groups.getLive(id, groupMeta)
+	if err != nil {
+		return nil, err
+	}
+	group = cloneGroup(group)
+	return &group, nil
+}
+
+func (r *memoryGroupRepository) List(ctx context.Context, query GroupQuery) (*Page[models.Group], error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	page, err := listPage(r.s.groups.all(), query.ListOptions, groupSortFields, groupSortKey,
+		func(g models.Group) bool {
+			return live(query.ListOptions, g.DeletedAt) &&
+				(query.TenantID == "" || g.TenantID == query.TenantID) &&
+				(query.Name == "" || g.Name == query.Name) &&
+				(query.Member == "" || slices.Contains(g.Members, query.Member)) &&
+				(query.Subgroup == "" || slices.Contains(g.Subgroups, query.Subgroup)) &&
+				(query.Role == "" || slices.Contains(g.Roles, query.Role)) &&
+				containsFold(query.Search, g.Name, g.Description)
+		},
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range page.Items {
+		page.Items[i] = cloneGroup(page.Items[i])
+	}
+	return page, nil
+}
+
+func (r *memoryGroupRepository) Update(ctx context.Context, group *models.Group) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	stored, ok := r.s.groups.rows[group.ID]
+	if !ok || stored.DeletedAt != nil {
+		return ErrNotFound
+	}
+	if stored.Version != group.Version {
+		return ErrVersionConflict
+	}
+
+	group.Version++
+	group.UpdatedAt = time.Now()
+	return r.s.groups.replace(group.ID, cloneGroup(*group))
+}
+
+func (r *memoryGroupRepository) SoftDelete(ctx context.Context, id string, version int64, deletedBy string) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	return r.s.groups.softDelete(id, version, deletedBy, groupMeta)
+}
+
+func (r *memoryGroupRepository) Restore(ctx context.Context, id, tenantID string) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	return r.s.groups.restore(id, tenantID, groupMeta)
+}
+
+func (r *memoryGroupRepository) Purge(ctx context.Context, before time.Time) (int64, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	return r.s.groups.purge(before, groupMeta), nil
+}
+
+func (r *memoryGroupRepository) Delete(ctx context.Context, id string, version int64) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	stored, _, err := r.s.groups.get(id)
+	if err != nil {
+		return err
+	}
+	if err := checkVersion(stored.Version, version); err != nil {
+		return err
+	}
+	return r.s.groups.delete(id)
+}
+
+func cloneGroup(group models.Group) models.Group {
+	group.Roles = slices.Clone(group.Roles)
+	group.Members = slices.Clone(group.Members)
+	group.Subgroups = slices.Clone(group.Subgroups)
+	return group
+}
+
+func groupMeta(g *models.Group) rowMeta {
+	return rowMeta{&g.TenantID, &g.Version, &g.DeletedAt, &g.DeletedBy}
+}
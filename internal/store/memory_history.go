@@ -0,0 +1,143 @@
+package store
+
+import (
+	"cmp"
+	"context"
+	"slices"
+
+	"github.com/knakul853/accessmesh/internal/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type memoryRevisionRepository struct {
+	s *MemoryStore
+}
+
+func (r *memoryRevisionRepository) Append(ctx context.Context, revision *models.Revision) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	return r.s.appendRevision(revision)
+}
+
+// appendRevision inserts the revision while s.mu is held.
+func (s *MemoryStore) appendRevision(revision *models.Revision) error {
+	if _, taken := s.revisions.find(func(stored models.Revision) bool {
+		return stored.Kind == revision.Kind && stored.DocumentID == revision.DocumentID && stored.Version == revision.Version
+	}); taken {
+		return ErrDuplicate
+	}
+
+	revision.ID = primitive.NewObjectID()
+	revision.TenantID = tenantOf(revision.TenantID)
+	s.revisions.insert(revision.ID, cloneRevision(*revision))
+	return nil
+}
+
+// recordRow runs write on the row of t with the given ID and records the
+// revision ctx asks for of the row as write left it, putting the row back if
+// that fails.
+func recordRow[T any](ctx context.Context, s *MemoryStore, t *table[T], id string,
+	revision func(context.Context, T) *models.Revision, write func() error,
+) error {
+	previous, objID, err := t.get(id)
+	if err != nil {
+		return err
+	}
+	if err := write(); err != nil {
+		return err
+	}
+	return s.record(revision(ctx, t.rows[objID]), func() { t.rows[objID] = previous })
+}
+
+// record appends revision, which is nil unless the write's context asks for
+// one, while s.mu is held. If that fails, undo takes the write back.
+func (s *MemoryStore) record(revision *models.Revision, undo func()) error {
+	if revision == nil {
+		return nil
+	}
+	if err := s.appendRevision(revision); err != nil {
+		undo()
+		return err
+	}
+	return nil
+}
+
+func (r *memoryRevisionRepository) List(ctx context.Context, kind, documentID string) ([]models.Revision, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	revisions := []models.Revision{}
+	for _, revision := range r.s.revisions.all() {
+		if revision.Kind == kind && revision.DocumentID == documentID {
+			revisions = append(revisions, cloneRevision(revision))
+		}
+	}
+	slices.SortStableFunc(revisions, func(a, b models.Revision) int {
+		return cmp.Compare(a.Version, b.Version)
+	})
+	return revisions, nil
+}
+
+func cloneRevision(revision models.Revision) models.Revision {
+	if revision.Policy != nil {
+		policy := clonePolicy(*revision.Policy)
+		revision.Policy = &policy
+	}
+	if revision.Role != nil {
+		role := *revision.Role
+		role.Permissions = slices.Clone(role.Permissions)
+		revision.Role = &role
+	}
+	revision.Changes = nil
+	return revision
+}
+
+type memorySnapshotRepository struct {
+	s *MemoryStore
+}
+
+func (r *memorySnapshotRepository) Create(ctx context.Context, snapshot *models.PolicySnapshot) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	snapshot.ID = primitive.NewObjectID()
+	snapshot.TenantID = tenantOf(snapshot.TenantID)
+	r.s.snapshots.insert(snapshot.ID, cloneSnapshot(*snapshot))
+	return nil
+}
+
+func (r *memorySnapshotRepository) Get(ctx context.Context, id string) (*models.PolicySnapshot, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	snapshot, _, err := r.s.snapshots.get(id)
+	if err != nil {
+		return nil, err
+	}
+	snapshot = cloneSnapshot(snapshot)
+	return &snapshot, nil
+}
+
+func (r *memorySnapshotRepository) List(ctx context.Context, tenantID string) ([]models.PolicySnapshot, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	snapshots := []models.PolicySnapshot{}
+	for _, snapshot := range r.s.snapshots.all() {
+		if snapshot.TenantID == tenantOf(tenantID) {
+			snapshots = append(snapshots, cloneSnapshot(snapshot))
+		}
+	}
+	slices.Reverse(snapshots)
+	return snapshots, nil
+}
+
+func cloneSnapshot(snapshot models.PolicySnapshot) models.PolicySnapshot {
+	policies := make([]models.Policy, len(snapshot.Policies))
+	for i, policy := range snapshot.Policies {
+		policies[i] = clonePolicy(policy)
+	}
+	snapshot.Policies = policies
+	return snapshot
+}
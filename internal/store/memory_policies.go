@@ -0,0 +1,178 @@
+package store
+
+import (
+	"context"
+	"slices"
+	"time"
+
+	"github.com/knakul853/accessmesh/internal/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type memoryPolicyRepository struct {
+	s *MemoryStore
+}
+
+func (r *memoryPolicyRepository) Create(ctx context.Context, policy *models.Policy) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	policy.ID = primitive.NewObjectID()
+	policy.TenantID = tenantOf(policy.TenantID)
+	policy.Version = 1
+	r.s.policies.insert(policy.ID, clonePolicy(*policy))
+	return r.s.record(policyRevision(ctx, *policy), func() { r.s.policies.delete(policy.ID.Hex()) })
+}
+
+func (r *memoryPolicyRepository) Get(ctx context.Context, id string) (*models.Policy, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	policy, err := r.s.policies.getLive(id, policyMeta)
+	if err != nil {
+		return nil, err
+	}
+	policy = clonePolicy(policy)
+	return &policy, nil
+}
+
+func (r *memoryPolicyRepository) List(ctx context.Context, query PolicyQuery) (*Page[models.Policy], error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	page, err := listPage(r.s.policies.all(), query.ListOptions, policySortFields, policySortKey,
+		func(p models.Policy) bool {
+			return live(query.ListOptions, p.DeletedAt) &&
+				(query.TenantID == "" || p.TenantID == query.TenantID) &&
+				(query.Role == "" || p.Role == query.Role) &&
+				(query.Group == "" || p.Group == query.Group) &&
+				(query.Resource == "" || p.Resource == query.Resource) &&
+				(query.Action == "" || p.Action == query.Action) &&
+				containsFold(query.Search, p.Role, p.Resource)
+		},
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range page.Items {
+		page.Items[i] = clonePolicy(page.Items[i])
+	}
+	return page, nil
+}
+
+func (r *memoryPolicyRepository) Update(ctx context.Context, policy *models.Policy) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	stored, ok := r.s.policies.rows[policy.ID]
+	if !ok || stored.DeletedAt != nil {
+		return ErrNotFound
+	}
+	if stored.Version != policy.Version {
+		return ErrVersionConflict
+	}
+
+	policy.Version++
+	policy.UpdatedAt = time.Now()
+	if err := r.s.policies.replace(policy.ID, clonePolicy(*policy)); err != nil {
+		return err
+	}
+	return r.s.record(policyRevision(ctx, *policy), func() {
+		r.s.policies.rows[policy.ID] = stored
+		policy.Version--
+	})
+}
+
+func (r *memoryPolicyRepository) SoftDelete(ctx context.Context, id string, version int64, deletedBy string) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	return recordRow(ctx, r.s, &r.s.policies, id, policyRevision, func() error {
+		return r.s.policies.softDelete(id, version, deletedBy, policyMeta)
+	})
+}
+
+func (r *memoryPolicyRepository) Restore(ctx context.Context, id, tenantID string) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	return recordRow(ctx, r.s, &r.s.policies, id, policyRevision, func() error {
+		return r.s.policies.restore(id, tenantID, policyMeta)
+	})
+}
+
+func (r *memoryPolicyRepository) Purge(ctx context.Context, before time.Time) (int64, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	return r.s.policies.purge(before, policyMeta), nil
+}
+
+func (r *memoryPolicyRepository) Delete(ctx context.Context, id string, version int64) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	stored, _, err := r.s.policies.get(id)
+	if err != nil {
+		return err
+	}
+	if err := checkVersion(stored.Version, version); err != nil {
+		return err
+	}
+	return r.s.policies.delete(id)
+}
+
+func (r *memoryPolicyRepository) ReplaceAll(ctx context.Context, tenantID string, policies []models.Policy, deletedBy string) ([]PolicyChange, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	tenantID = tenantOf(tenantID)
+	var stored []models.Policy
+	for _, policy := range r.s.policies.all() {
+		if policy.TenantID == tenantID {
+			stored = append(stored, clonePolicy(policy))
+		}
+	}
+
+	changes := planReplaceAll(tenantID, stored, policies, deletedBy, time.Now())
+	for _, change := range changes {
+		if _, taken := r.s.policies.rows[change.After.ID]; taken && change.Before == nil {
+			return nil, ErrDuplicate
+		}
+	}
+	if recording(ctx) {
+		for _, change := range changes {
+			if _, taken := r.s.revisions.find(func(stored models.Revision) bool {
+				return stored.Kind == models.RevisionKindPolicy && stored.DocumentID == change.After.ID.Hex() &&
+					stored.Version == change.After.Version
+			}); taken {
+				return nil, ErrDuplicate
+			}
+		}
+	}
+	for _, change := range changes {
+		if change.Before == nil {
+			r.s.policies.insert(change.After.ID, clonePolicy(*change.After))
+		} else {
+			r.s.policies.rows[change.After.ID] = clonePolicy(*change.After)
+		}
+		// Checked above, so this cannot fail half way.
+		if revision := policyRevision(ctx, *change.After); revision != nil {
+			if err := r.s.appendRevision(revision); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return changes, nil
+}
+
+func clonePolicy(policy models.Policy) models.Policy {
+	policy.Conditions.IPRange = slices.Clone(policy.Conditions.IPRange)
+	policy.Conditions.TimeRange = slices.Clone(policy.Conditions.TimeRange)
+	return policy
+}
+
+func policyMeta(p *models.Policy) rowMeta {
+	return rowMeta{&p.TenantID, &p.Version, &p.DeletedAt, &p.DeletedBy}
+}
@@ -0,0 +1,148 @@
+package store
+
+import (
+	"context"
+	"slices"
+	"time"
+
+	"github.com/knakul853/accessmesh/internal/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type memoryRoleRepository struct {
+	s *MemoryStore
+}
+
+func (r *memoryRoleRepository) Create(ctx context.Context, role *models.Role) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	role.TenantID = tenantOf(role.TenantID)
+	if r.nameTaken(role) {
+		return ErrDuplicate
+	}
+	role.ID = primitive.NewObjectID()
+	role.Version = 1
+	r.s.roles.insert(role.ID, cloneRole(*role))
+	return r.s.record(roleRevision(ctx, *role), func() { r.s.roles.delete(role.ID.Hex()) })
+}
+
+func (r *memoryRoleRepository) Get(ctx context.Context, id string) (*models.Role, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	role, err := r.s.roles.getLive(id, roleMeta)
+	if err != nil {
+		return nil, err
+	}
+	role = cloneRole(role)
+	return &role, nil
+}
+
+func (r *memoryRoleRepository) List(ctx context.Context, query RoleQuery) (*Page[models.Role], error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	page, err := listPage(r.s.roles.all(), query.ListOptions, roleSortFields, roleSortKey,
+		func(role models.Role) bool {
+			return live(query.ListOptions, role.DeletedAt) &&
+				(query.TenantID == "" || role.TenantID == query.TenantID) &&
+				(query.Name == "" || role.Name == query.Name) &&
+				containsFold(query.Search, role.Name, role.Description)
+		},
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range page.Items {
+		page.Items[i] = cloneRole(page.Items[i])
+	}
+	return page, nil
+}
+
+func (r *memoryRoleRepository) Update(ctx context.Context, role *models.Role) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	stored, ok := r.s.roles.rows[role.ID]
+	if !ok || stored.DeletedAt != nil {
+		return ErrNotFound
+	}
+	if stored.Version != role.Version {
+		return ErrVersionConflict
+	}
+	if r.nameTaken(role) {
+		return ErrDuplicate
+	}
+
+	role.Version++
+	if err := r.s.roles.replace(role.ID, cloneRole(*role)); err != nil {
+		return err
+	}
+	return r.s.record(roleRevision(ctx, *role), func() {
+		r.s.roles.rows[role.ID] = stored
+		role.Version--
+	})
+}
+
+func (r *memoryRoleRepository) SoftDelete(ctx context.Context, id string, version int64, deletedBy string) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	return recordRow(ctx, r.s, &r.s.roles, id, roleRevision, func() error {
+		return r.s.roles.softDelete(id, version, deletedBy, roleMeta)
+	})
+}
+
+func (r *memoryRoleRepository) Restore(ctx context.Context, id, tenantID string) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	if stored, _, err := r.s.roles.get(id); err == nil && stored.DeletedAt != nil && r.nameTaken(&stored) {
+		return ErrDuplicate
+	}
+	return recordRow(ctx, r.s, &r.s.roles, id, roleRevision, func() error {
+		return r.s.roles.restore(id, tenantID, roleMeta)
+	})
+}
+
+func (r *memoryRoleRepository) Purge(ctx context.Context, before time.Time) (int64, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	return r.s.roles.purge(before, roleMeta), nil
+}
+
+func (r *memoryRoleRepository) Delete(ctx context.Context, id string, version int64) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	stored, _, err := r.s.roles.get(id)
+	if err != nil {
+		return err
+	}
+	if err := checkVersion(stored.Version, version); err != nil {
+		return err
+	}
+	return r.s.roles.delete(id)
+}
+
+// nameTaken reports whether another live role of the tenant has the role's
+// name, which the unique index of the database backends forbids.
+func (r *memoryRoleRepository) nameTaken(role *models.Role) bool {
+	_, taken := r.s.roles.find(func(other models.Role) bool {
+		return other.ID != role.ID && other.DeletedAt == nil &&
+			other.TenantID == tenantOf(role.TenantID) && other.Name == role.Name
+	})
+	return taken
+}
+
+func cloneRole(role models.Role) models.Role {
+	role.Permissions = slices.Clone(role.Permissions)
+	return role
+}
+
+func roleMeta(r *models.Role) rowMeta {
+	return rowMeta{&r.TenantID, &r.Version, &r.DeletedAt, &r.DeletedBy}
+}
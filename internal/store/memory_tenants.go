@@ -0,0 +1,46 @@
+package store
+
+import (
+	"context"
+	"sort"
+
+	"github.com/knakul853/accessmesh/internal/models"
+)
+
+type memoryTenantRepository struct {
+	s *MemoryStore
+}
+
+func (r *memoryTenantRepository) Create(ctx context.Context, tenant *models.Tenant) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	if _, ok := r.s.tenants[tenant.ID]; ok {
+		return ErrDuplicate
+	}
+	r.s.tenants[tenant.ID] = *tenant
+	return nil
+}
+
+func (r *memoryTenantRepository) Get(ctx context.Context, id string) (*models.Tenant, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	tenant, ok := r.s.tenants[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &tenant, nil
+}
+
+func (r *memoryTenantRepository) List(ctx context.Context) ([]models.Tenant, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	tenants := make([]models.Tenant, 0, len(r.s.tenants))
+	for _, tenant := range r.s.tenants {
+		tenants = append(tenants, tenant)
+	}
+	sort.Slice(tenants, func(i, j int) bool { return tenants[i].ID < tenants[j].ID })
+	return tenants, nil
+}
@@ -0,0 +1,89 @@
+package store
+
+import (
+	"cmp"
+	"context"
+	"slices"
+
+	"github.com/knakul853/accessmesh/internal/models"
+)
+
+type memoryTupleRepository struct {
+	s *MemoryStore
+}
+
+func (r *memoryTupleRepository) Write(ctx context.Context, tenantID string, inserts, deletes []models.RelationTuple) (int64, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	tenantID = tenantOf(tenantID)
+	revision := r.s.tupleRevisions[tenantID] + 1
+	r.s.tupleRevisions[tenantID] = revision
+
+	for _, tuple := range deletes {
+		if i := r.live(tenantID, tuple); i >= 0 {
+			r.s.tuples[i].DeletedRevision = revision
+		}
+	}
+	for _, tuple := range inserts {
+		if r.live(tenantID, tuple) >= 0 {
+			continue
+		}
+		tuple.TenantID = tenantID
+		tuple.CreatedRevision = revision
+		tuple.DeletedRevision = 0
+		r.s.tuples = append(r.s.tuples, tuple)
+	}
+	return revision, nil
+}
+
+// live returns the index of the tenant's live copy of tuple, or -1.
+func (r *memoryTupleRepository) live(tenantID string, tuple models.RelationTuple) int {
+	return slices.IndexFunc(r.s.tuples, func(t models.RelationTuple) bool {
+		return t.TenantID == tenantID && t.DeletedRevision == 0 && t.String() == tuple.String()
+	})
+}
+
+func (r *memoryTupleRepository) Read(ctx context.Context, filter TupleFilter, revision int64) ([]models.RelationTuple, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	tenantID := tenantOf(filter.TenantID)
+	var tuples []models.RelationTuple
+	for _, t := range r.s.tuples {
+		if t.TenantID == tenantID && liveAt(t, revision) && filter.matches(t) {
+			tuples = append(tuples, t)
+		}
+	}
+	slices.SortFunc(tuples, func(a, b models.RelationTuple) int {
+		return cmp.Or(
+			cmp.Compare(a.ObjectType, b.ObjectType),
+			cmp.Compare(a.ObjectID, b.ObjectID),
+			cmp.Compare(a.Relation, b.Relation),
+			cmp.Compare(a.SubjectType, b.SubjectType),
+			cmp.Compare(a.SubjectID, b.SubjectID),
+			cmp.Compare(a.SubjectRelation, b.SubjectRelation),
+		)
+	})
+	return tuples, nil
+}
+
+func (r *memoryTupleRepository) Revision(ctx context.Context, tenantID string) (int64, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	return r.s.tupleRevisions[tenantOf(tenantID)], nil
+}
+
+// liveAt reports whether the tuple existed at revision.
+func liveAt(t models.RelationTuple, revision int64) bool {
+	return t.CreatedRevision <= revision && (t.DeletedRevision == 0 || t.DeletedRevision > revision)
+}
+
+func (f TupleFilter) matches(t models.RelationTuple) bool {
+	return (f.ObjectType == "" || t.ObjectType == f.ObjectType) &&
+		(f.ObjectID == "" || t.ObjectID == f.ObjectID) &&
+		(f.Relation == "" || t.Relation == f.Relation) &&
+		(f.SubjectType == "" || (t.SubjectType == f.SubjectType && t.SubjectID == f.SubjectID &&
+			t.SubjectRelation == f.SubjectRelation))
+}
@@ -0,0 +1,201 @@
+package store
+
+import (
+	"context"
+	"maps"
+	"slices"
+	"time"
+
+	"github.com/knakul853/accessmesh/internal/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type memoryUserRepository struct {
+	s *MemoryStore
+}
+
+func (r *memoryUserRepository) Create(ctx context.Context, user *models.User) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	if r.conflicts(primitive.NilObjectID, user) {
+		return ErrDuplicate
+	}
+
+	user.ID = primitive.NewObjectID()
+	user.TenantID = tenantOf(user.TenantID)
+	user.Version = 1
+	r.s.users.insert(user.ID, cloneUser(*user))
+	return nil
+}
+
+func (r *memoryUserRepository) Get(ctx context.Context, id string) (*models.User, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	user, err := r.s.users.getLive(id, userMeta)
+	if err != nil {
+		return nil, err
+	}
+	return r.result(user), nil
+}
+
+func (r *memoryUserRepository) GetByUsername(ctx context.Context, username string) (*models.User, error) {
+	return r.findOne(func(u models.User) bool { return u.Username == username })
+}
+
+func (r *memoryUserRepository) GetByEmail(ctx context.Context, email string) (*models.User, error) {
+	return r.findOne(func(u models.User) bool { return u.Email == email })
+}
+
+func (r *memoryUserRepository) GetByIdentity(ctx context.Context, provider, subject string) (*models.User, error) {
+	return r.findOne(func(u models.User) bool {
+		return slices.ContainsFunc(u.Identities, func(i models.ExternalIdentity) bool {
+			return i.Provider == provider && i.Subject == subject
+		})
+	})
+}
+
+func (r *memoryUserRepository) GetByResetToken(ctx context.Context, token string) (*models.User, error) {
+	now := time.Now()
+	return r.findOne(func(u models.User) bool {
+		return u.ResetToken == token && u.ResetTokenExpiry.After(now)
+	})
+}
+
+func (r *memoryUserRepository) List(ctx context.Context, query UserQuery) (*Page[models.User], error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	page, err := listPage(r.s.users.all(), query.ListOptions, userSortFields, userSortKey,
+		func(u models.User) bool {
+			return live(query.ListOptions, u.DeletedAt) &&
+				(query.TenantID == "" || u.TenantID == query.TenantID) &&
+				(query.Role == "" || u.HasRole(query.Role)) &&
+				(query.EmailVerified == nil || u.EmailVerified == *query.EmailVerified) &&
+				containsFold(query.Search, u.Username, u.Email)
+		},
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range page.Items {
+		page.Items[i] = cloneUser(page.Items[i])
+	}
+	return page, nil
+}
+
+func (r *memoryUserRepository) Update(ctx context.Context, user *models.User) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	stored, ok := r.s.users.rows[user.ID]
+	if !ok || stored.DeletedAt != nil {
+		return ErrNotFound
+	}
+	if stored.Version != user.Version {
+		return ErrVersionConflict
+	}
+	if r.conflicts(user.ID, user) {
+		return ErrDuplicate
+	}
+
+	user.Version++
+	user.UpdatedAt = time.Now()
+	return r.s.users.replace(user.ID, cloneUser(*user))
+}
+
+func (r *memoryUserRepository) VerifyEmail(ctx context.Context, token string) error {
+	if token == "" {
+		return ErrNotFound
+	}
+
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	user, ok := r.s.users.find(func(u models.User) bool { return u.VerificationToken == token && u.DeletedAt == nil })
+	if !ok {
+		return ErrNotFound
+	}
+
+	user.EmailVerified = true
+	user.VerificationToken = ""
+	user.Version++
+	user.UpdatedAt = time.Now()
+	return r.s.users.replace(user.ID, user)
+}
+
+func (r *memoryUserRepository) SoftDelete(ctx context.Context, id string, version int64, deletedBy string) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	return r.s.users.softDelete(id, version, deletedBy, userMeta)
+}
+
+func (r *memoryUserRepository) Restore(ctx context.Context, id, tenantID string) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	return r.s.users.restore(id, tenantID, userMeta)
+}
+
+func (r *memoryUserRepository) Purge(ctx context.Context, before time.Time) (int64, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	return r.s.users.purge(before, userMeta), nil
+}
+
+func (r *memoryUserRepository) Delete(ctx context.Context, id string, version int64) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	stored, _, err := r.s.users.get(id)
+	if err != nil {
+		return err
+	}
+	if err := checkVersion(stored.Version, version); err != nil {
+		return err
+	}
+	return r.s.users.delete(id)
+}
+
+func (r *memoryUserRepository) findOne(match func(models.User) bool) (*models.User, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	user, ok := r.s.users.find(func(u models.User) bool { return u.DeletedAt == nil && match(u) })
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return r.result(user), nil
+}
+
+func (r *memoryUserRepository) result(user models.User) *models.User {
+	user = cloneUser(user)
+	return &user
+}
+
+// conflicts reports whether another user already holds the username or a
+// non-empty email of user.
+func (r *memoryUserRepository) conflicts(self primitive.ObjectID, user *models.User) bool {
+	_, taken := r.s.users.find(func(u models.User) bool {
+		if u.ID == self {
+			return false
+		}
+		return u.Username == user.Username || (user.Email != "" && u.Email == user.Email)
+	})
+	return taken
+}
+
+func cloneUser(user models.User) models.User {
+	user.Roles = slices.Clone(user.Roles)
+	user.Identities = slices.Clone(user.Identities)
+	user.Attributes = maps.Clone(user.Attributes)
+	return user
+}
+
+func userMeta(u *models.User) rowMeta {
+	return rowMeta{&u.TenantID, &u.Version, &u.DeletedAt, &u.DeletedBy}
+}
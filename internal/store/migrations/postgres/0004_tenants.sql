@@ -0,0 +1,15 @@
+CREATE TABLE tenants (
+    id         TEXT PRIMARY KEY,
+    name       TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL
+);
+
+INSERT INTO tenants (id, name, created_at) VALUES ('default', 'Default', NOW());
+
+ALTER TABLE users ADD COLUMN tenant_id TEXT NOT NULL DEFAULT 'default';
+ALTER TABLE roles ADD COLUMN tenant_id TEXT NOT NULL DEFAULT 'default';
+ALTER TABLE policies ADD COLUMN tenant_id TEXT NOT NULL DEFAULT 'default';
+
+CREATE INDEX users_tenant_id_idx ON users (tenant_id);
+CREATE INDEX roles_tenant_id_idx ON roles (tenant_id);
+CREATE INDEX policies_tenant_id_idx ON policies (tenant_id);
@@ -0,0 +1,24 @@
+CREATE TABLE elevations (
+    id            TEXT PRIMARY KEY,
+    tenant_id     TEXT NOT NULL DEFAULT 'default',
+    user_id       TEXT NOT NULL,
+    role          TEXT NOT NULL,
+    hours         INTEGER NOT NULL,
+    justification TEXT NOT NULL DEFAULT '',
+    status        TEXT NOT NULL,
+    decided_by    TEXT NOT NULL DEFAULT '',
+    decided_at    TIMESTAMPTZ,
+    note          TEXT NOT NULL DEFAULT '',
+    expires_at    TIMESTAMPTZ,
+    ended_at      TIMESTAMPTZ,
+    version       BIGINT NOT NULL DEFAULT 1,
+    created_at    TIMESTAMPTZ NOT NULL,
+    updated_at    TIMESTAMPTZ NOT NULL,
+    -- Elevations are kept on record and never trashed; the column lets them
+    -- be listed and versioned like everything else.
+    deleted_at    TIMESTAMPTZ
+);
+
+CREATE INDEX elevations_tenant_id_idx ON elevations (tenant_id);
+CREATE INDEX elevations_user_id_role_idx ON elevations (user_id, role);
+CREATE INDEX elevations_expires_at_idx ON elevations (expires_at) WHERE status = 'approved';
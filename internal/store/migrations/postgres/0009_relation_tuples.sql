@@ -0,0 +1,26 @@
+-- Relation tuples with the revisions of their tenant at which they were
+-- written and deleted, so that reads can see any revision. deleted_rev is 0
+-- while a tuple is live.
+CREATE TABLE relation_tuples (
+    tenant_id        TEXT NOT NULL,
+    object_type      TEXT NOT NULL,
+    object_id        TEXT NOT NULL,
+    relation         TEXT NOT NULL,
+    subject_type     TEXT NOT NULL,
+    subject_id       TEXT NOT NULL,
+    subject_relation TEXT NOT NULL DEFAULT '',
+    created_rev      BIGINT NOT NULL,
+    deleted_rev      BIGINT NOT NULL DEFAULT 0
+);
+
+CREATE UNIQUE INDEX relation_tuples_live_idx ON relation_tuples
+    (tenant_id, object_type, object_id, relation, subject_type, subject_id, subject_relation)
+    WHERE deleted_rev = 0;
+CREATE INDEX relation_tuples_object_idx ON relation_tuples (tenant_id, object_type, object_id, relation);
+CREATE INDEX relation_tuples_subject_idx ON relation_tuples (tenant_id, subject_type, subject_id, subject_relation);
+
+-- The latest revision of each tenant's tuples.
+CREATE TABLE tuple_revisions (
+    tenant_id TEXT PRIMARY KEY,
+    revision  BIGINT NOT NULL
+);
@@ -0,0 +1,9 @@
+-- Magic link requests, counted per email for rate limiting whether or not
+-- the email belongs to an account.
+CREATE TABLE magic_link_requests (
+    id         TEXT PRIMARY KEY,
+    email      TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX magic_link_requests_email_created_at_idx ON magic_link_requests (email, created_at);
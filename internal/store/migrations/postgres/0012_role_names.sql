@@ -0,0 +1,10 @@
+-- Live role names are unique per tenant. Of roles sharing a name, all but the
+-- oldest are moved to the trash first.
+UPDATE roles SET deleted_at = CURRENT_TIMESTAMP, deleted_by = 'migration', version = version + 1
+WHERE deleted_at IS NULL AND EXISTS (
+    SELECT 1 FROM roles AS older
+    WHERE older.tenant_id = roles.tenant_id AND older.name = roles.name
+        AND older.deleted_at IS NULL AND older.id < roles.id
+);
+
+CREATE UNIQUE INDEX roles_tenant_id_name_idx ON roles (tenant_id, name) WHERE deleted_at IS NULL;
@@ -0,0 +1,76 @@
+CREATE TABLE users (
+    id                 TEXT PRIMARY KEY,
+    username           TEXT NOT NULL UNIQUE,
+    password           TEXT NOT NULL DEFAULT '',
+    role               TEXT NOT NULL DEFAULT '',
+    email              TEXT NOT NULL DEFAULT '',
+    email_verified     BOOLEAN NOT NULL DEFAULT FALSE,
+    verification_token TEXT NOT NULL DEFAULT '',
+    reset_token        TEXT NOT NULL DEFAULT '',
+    reset_token_expiry DATETIME,
+    auth_source        TEXT NOT NULL DEFAULT '',
+    created_at         DATETIME NOT NULL,
+    updated_at         DATETIME NOT NULL
+);
+
+CREATE UNIQUE INDEX users_email_key ON users (email) WHERE email <> '';
+CREATE INDEX users_verification_token_idx ON users (verification_token) WHERE verification_token <> '';
+CREATE INDEX users_reset_token_idx ON users (reset_token) WHERE reset_token <> '';
+
+CREATE TABLE user_identities (
+    provider  TEXT NOT NULL,
+    subject   TEXT NOT NULL,
+    user_id   TEXT NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    linked_at DATETIME NOT NULL,
+    PRIMARY KEY (provider, subject)
+);
+
+CREATE INDEX user_identities_user_id_idx ON user_identities (user_id);
+
+CREATE TABLE roles (
+    id          TEXT PRIMARY KEY,
+    name        TEXT NOT NULL,
+    description TEXT NOT NULL DEFAULT '',
+    permissions TEXT NOT NULL DEFAULT '[]'
+);
+
+CREATE TABLE policies (
+    id         TEXT PRIMARY KEY,
+    role       TEXT NOT NULL,
+    resource   TEXT NOT NULL,
+    action     TEXT NOT NULL,
+    conditions TEXT NOT NULL DEFAULT '{}',
+    created_at DATETIME NOT NULL,
+    updated_at DATETIME NOT NULL
+);
+
+CREATE TABLE magic_links (
+    id         TEXT PRIMARY KEY,
+    user_id    TEXT NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    email      TEXT NOT NULL,
+    token_hash TEXT NOT NULL,
+    nonce_hash TEXT NOT NULL,
+    used       BOOLEAN NOT NULL DEFAULT FALSE,
+    expires_at DATETIME NOT NULL,
+    created_at DATETIME NOT NULL
+);
+
+CREATE INDEX magic_links_token_hash_idx ON magic_links (token_hash);
+CREATE INDEX magic_links_email_created_at_idx ON magic_links (email, created_at);
+
+CREATE TABLE audit_log (
+    id           TEXT PRIMARY KEY,
+    event        TEXT NOT NULL,
+    subject_id   TEXT NOT NULL DEFAULT '',
+    subject_role TEXT NOT NULL DEFAULT '',
+    actor_id     TEXT NOT NULL DEFAULT '',
+    actor_role   TEXT NOT NULL DEFAULT '',
+    method       TEXT NOT NULL DEFAULT '',
+    path         TEXT NOT NULL DEFAULT '',
+    status       INTEGER NOT NULL DEFAULT 0,
+    client_ip    TEXT NOT NULL DEFAULT '',
+    reason       TEXT NOT NULL DEFAULT '',
+    created_at   DATETIME NOT NULL
+);
+
+CREATE INDEX audit_log_created_at_idx ON audit_log (created_at);
@@ -0,0 +1,10 @@
+ALTER TABLE users ADD COLUMN deleted_at DATETIME;
+ALTER TABLE users ADD COLUMN deleted_by TEXT NOT NULL DEFAULT '';
+ALTER TABLE roles ADD COLUMN deleted_at DATETIME;
+ALTER TABLE roles ADD COLUMN deleted_by TEXT NOT NULL DEFAULT '';
+ALTER TABLE policies ADD COLUMN deleted_at DATETIME;
+ALTER TABLE policies ADD COLUMN deleted_by TEXT NOT NULL DEFAULT '';
+
+CREATE INDEX users_deleted_at_idx ON users (deleted_at) WHERE deleted_at IS NOT NULL;
+CREATE INDEX roles_deleted_at_idx ON roles (deleted_at) WHERE deleted_at IS NOT NULL;
+CREATE INDEX policies_deleted_at_idx ON policies (deleted_at) WHERE deleted_at IS NOT NULL;
@@ -0,0 +1,30 @@
+CREATE TABLE groups (
+    id          TEXT PRIMARY KEY,
+    tenant_id   TEXT NOT NULL DEFAULT 'default',
+    name        TEXT NOT NULL,
+    description TEXT NOT NULL DEFAULT '',
+    version     INTEGER NOT NULL DEFAULT 1,
+    created_at  DATETIME NOT NULL,
+    updated_at  DATETIME NOT NULL,
+    deleted_at  DATETIME,
+    deleted_by  TEXT NOT NULL DEFAULT ''
+);
+
+CREATE INDEX groups_tenant_id_idx ON groups (tenant_id);
+CREATE INDEX groups_deleted_at_idx ON groups (deleted_at) WHERE deleted_at IS NOT NULL;
+
+-- The members, subgroups and roles of a group, in the order they were given.
+CREATE TABLE group_links (
+    group_id TEXT NOT NULL REFERENCES groups (id) ON DELETE CASCADE,
+    kind     TEXT NOT NULL,
+    value    TEXT NOT NULL,
+    position INTEGER NOT NULL,
+    PRIMARY KEY (group_id, kind, value)
+);
+
+CREATE INDEX group_links_kind_value_idx ON group_links (kind, value);
+
+-- Policies name either a role or a group.
+ALTER TABLE policies ADD COLUMN group_id TEXT NOT NULL DEFAULT '';
+
+CREATE INDEX policies_group_id_idx ON policies (group_id);
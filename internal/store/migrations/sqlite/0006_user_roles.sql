@@ -0,0 +1,17 @@
+-- A user holds any number of roles, each optionally bounded in time, in the
+-- order they were given.
+CREATE TABLE user_roles (
+    user_id    TEXT NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    role       TEXT NOT NULL,
+    starts_at  DATETIME,
+    expires_at DATETIME,
+    position   INTEGER NOT NULL,
+    PRIMARY KEY (user_id, role)
+);
+
+CREATE INDEX user_roles_role_idx ON user_roles (role);
+
+INSERT INTO user_roles (user_id, role, starts_at, expires_at, position)
+SELECT id, role, NULL, NULL, 0 FROM users WHERE role <> '';
+
+ALTER TABLE users DROP COLUMN role;
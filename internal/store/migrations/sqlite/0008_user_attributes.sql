@@ -0,0 +1,3 @@
+-- The subject attributes attribute-based policy conditions are evaluated
+-- against, as a JSON object.
+ALTER TABLE users ADD COLUMN attributes TEXT NOT NULL DEFAULT '{}';
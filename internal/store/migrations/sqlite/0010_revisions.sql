@@ -0,0 +1,26 @@
+-- Revisions are appended and never updated or deleted; document holds the
+-- policy or role as JSON.
+CREATE TABLE revisions (
+    id          TEXT PRIMARY KEY,
+    tenant_id   TEXT NOT NULL DEFAULT 'default',
+    kind        TEXT NOT NULL,
+    document_id TEXT NOT NULL,
+    version     INTEGER NOT NULL,
+    action      TEXT NOT NULL,
+    actor       TEXT NOT NULL DEFAULT '',
+    document    TEXT NOT NULL,
+    created_at  DATETIME NOT NULL
+);
+
+CREATE UNIQUE INDEX revisions_document_idx ON revisions (kind, document_id, version);
+
+CREATE TABLE policy_snapshots (
+    id          TEXT PRIMARY KEY,
+    tenant_id   TEXT NOT NULL DEFAULT 'default',
+    description TEXT NOT NULL DEFAULT '',
+    policies    TEXT NOT NULL,
+    created_by  TEXT NOT NULL DEFAULT '',
+    created_at  DATETIME NOT NULL
+);
+
+CREATE INDEX policy_snapshots_tenant_id_idx ON policy_snapshots (tenant_id, created_at);
@@ -0,0 +1,12 @@
+-- Magic link requests are counted per email and rate limit window, so that
+-- checking and counting a request is a single atomic upsert.
+DROP TABLE magic_link_requests;
+
+CREATE TABLE magic_link_limits (
+    email        TEXT NOT NULL,
+    window_start DATETIME NOT NULL,
+    requests     INTEGER NOT NULL,
+    PRIMARY KEY (email, window_start)
+);
+
+CREATE INDEX magic_link_limits_window_start_idx ON magic_link_limits (window_start);
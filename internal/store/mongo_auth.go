@@ -0,0 +1,96 @@
+package store
+
+import (
+	"context"
+	"time"
+
+	"github.com/knakul853/accessmesh/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type mongoMagicLinkRepository struct {
+	collection *mongo.Collection
+	limits     *mongo.Collection
+}
+
+func (r *mongoMagicLinkRepository) Create(ctx context.Context, link *models.MagicLink) error {
+	result, err := r.collection.InsertOne(ctx, link)
+	if err != nil {
+		return err
+	}
+	link.ID = result.InsertedID.(primitive.ObjectID)
+	return nil
+}
+
+func (r *mongoMagicLinkRepository) RecordRequest(ctx context.Context, email string, window time.Time, limit int64) (bool, error) {
+	// Only a count below the limit matches, so concurrent requests cannot
+	// both take the last one. Once the window is full the upsert inserts a
+	// second document for it, which the unique index refuses.
+	filter := bson.M{"email": email, "window_start": window, "requests": bson.M{"$lt": limit}}
+	update := bson.M{"$inc": bson.M{"requests": 1}}
+	_, err := r.limits.UpdateOne(ctx, filter, update, options.Update().SetUpsert(true))
+	if !mongo.IsDuplicateKeyError(err) {
+		return err == nil, err
+	}
+
+	// A concurrent request may have created the window first; count this
+	// one in it unless that filled it.
+	result, err := r.limits.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return false, err
+	}
+	return result.MatchedCount > 0, nil
+}
+
+func (r *mongoMagicLinkRepository) GetActive(ctx context.Context, tokenHash string) (*models.MagicLink, error) {
+	var link models.MagicLink
+	err := findOne(ctx, r.collection, bson.M{
+		"token_hash": tokenHash,
+		"used":       false,
+		"expires_at": bson.M{"$gt": time.Now()},
+	}, &link)
+	if err != nil {
+		return nil, err
+	}
+	return &link, nil
+}
+
+func (r *mongoMagicLinkRepository) Claim(ctx context.Context, id string) error {
+	objID, err := objectID(id)
+	if err != nil {
+		return err
+	}
+
+	// Matching on used=false makes the claim atomic.
+	result, err := r.collection.UpdateOne(ctx,
+		bson.M{"_id": objID, "used": false},
+		bson.M{"$set": bson.M{"used": true}},
+	)
+	if err != nil {
+		return err
+	}
+	if result.ModifiedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+type mongoAuditRepository struct {
+	collection *mongo.Collection
+}
+
+func (r *mongoAuditRepository) Write(ctx context.Context, entry *models.AuditEntry) error {
+	if entry.CreatedAt.IsZero() {
+		entry.CreatedAt = time.Now()
+	}
+
+	result, err := r.collection.InsertOne(ctx, entry)
+	if err != nil {
+		return err
+	}
+	entry.ID = result.InsertedID.(primitive.ObjectID)
+	return nil
+}
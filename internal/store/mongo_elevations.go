@@ -0,0 +1,82 @@
+package store
+
+import (
+	"context"
+	"time"
+
+	"github.com/knakul853/accessmesh/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type mongoElevationRepository struct {
+	collection *mongo.Collection
+}
+
+func (r *mongoElevationRepository) Create(ctx context.Context, elevation *models.Elevation) error {
+	elevation.TenantID = tenantOf(elevation.TenantID)
+	elevation.Version = 1
+	result, err := r.collection.InsertOne(ctx, elevation)
+	if err != nil {
+		return err
+	}
+	elevation.ID = result.InsertedID.(primitive.ObjectID)
+	return nil
+}
+
+func (r *mongoElevationRepository) Get(ctx context.Context, id string) (*models.Elevation, error) {
+	objID, err := objectID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	var elevation models.Elevation
+	if err := findOne(ctx, r.collection, bson.M{"_id": objID}, &elevation); err != nil {
+		return nil, err
+	}
+	return &elevation, nil
+}
+
+func (r *mongoElevationRepository) List(ctx context.Context, query ElevationQuery) (*Page[models.Elevation], error) {
+	filter := bson.M{}
+	if query.Search != "" {
+		filter = searchFilter(query.Search, "justification")
+	}
+	if query.TenantID != "" {
+		filter["tenant_id"] = query.TenantID
+	}
+	if query.UserID != "" {
+		filter["user_id"] = query.UserID
+	}
+	if query.Role != "" {
+		filter["role"] = query.Role
+	}
+	if query.Status != "" {
+		filter["status"] = query.Status
+	}
+
+	// Elevations have no deleted_at, so they are live to findPage.
+	return findPage(ctx, r.collection, filter, query.ListOptions, elevationSortFields, elevationSortKey)
+}
+
+func (r *mongoElevationRepository) Update(ctx context.Context, elevation *models.Elevation) error {
+	elevation.UpdatedAt = time.Now()
+	return replaceVersioned(ctx, r.collection, elevation.ID, &elevation.Version, elevation)
+}
+
+func (r *mongoElevationRepository) Expired(ctx context.Context, now time.Time) ([]models.Elevation, error) {
+	cursor, err := r.collection.Find(ctx, bson.M{
+		"status":     models.ElevationApproved,
+		"expires_at": bson.M{"$lte": now},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var expired []models.Elevation
+	if err := cursor.All(ctx, &expired); err != nil {
+		return nil, err
+	}
+	return expired, nil
+}
@@ -0,0 +1,86 @@
+package store
+
+import (
+	"context"
+	"time"
+
+	"github.com/knakul853/accessmesh/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type mongoGroupRepository struct {
+	collection *mongo.Collection
+}
+
+func (r *mongoGroupRepository) Create(ctx context.Context, group *models.Group) error {
+	group.TenantID = tenantOf(group.TenantID)
+	group.Version = 1
+	result, err := r.collection.InsertOne(ctx, group)
+	if err != nil {
+		return err
+	}
+	group.ID = result.InsertedID.(primitive.ObjectID)
+	return nil
+}
+
+func (r *mongoGroupRepository) Get(ctx context.Context, id string) (*models.Group, error) {
+	objID, err := objectID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	var group models.Group
+	if err := findOne(ctx, r.collection, bson.M{"_id": objID, "deleted_at": nil}, &group); err != nil {
+		return nil, err
+	}
+	return &group, nil
+}
+
+func (r *mongoGroupRepository) List(ctx context.Context, query GroupQuery) (*Page[models.Group], error) {
+	filter := bson.M{}
+	if query.Search != "" {
+		filter = searchFilter(query.Search, "name", "description")
+	}
+	if query.TenantID != "" {
+		filter["tenant_id"] = query.TenantID
+	}
+	if query.Name != "" {
+		filter["name"] = query.Name
+	}
+	// Equality on an array field matches documents whose array contains the
+	// value.
+	if query.Member != "" {
+		filter["members"] = query.Member
+	}
+	if query.Subgroup != "" {
+		filter["subgroups"] = query.Subgroup
+	}
+	if query.Role != "" {
+		filter["roles"] = query.Role
+	}
+
+	return findPage(ctx, r.collection, filter, query.ListOptions, groupSortFields, groupSortKey)
+}
+
+func (r *mongoGroupRepository) Update(ctx context.Context, group *models.Group) error {
+	group.UpdatedAt = time.Now()
+	return replaceVersioned(ctx, r.collection, group.ID, &group.Version, group)
+}
+
+func (r *mongoGroupRepository) SoftDelete(ctx context.Context, id string, version int64, deletedBy string) error {
+	return softDelete(ctx, r.collection, id, version, deletedBy)
+}
+
+func (r *mongoGroupRepository) Restore(ctx context.Context, id, tenantID string) error {
+	return restore(ctx, r.collection, id, tenantID)
+}
+
+func (r *mongoGroupRepository) Purge(ctx context.Context, before time.Time) (int64, error) {
+	return purge(ctx, r.collection, before)
+}
+
+func (r *mongoGroupRepository) Delete(ctx context.Context, id string, version int64) error {
+	return deleteByID(ctx, r.collection, id, version)
+}
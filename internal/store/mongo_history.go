@@ -0,0 +1,121 @@
+package store
+
+import (
+	"context"
+
+	"github.com/knakul853/accessmesh/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type mongoRevisionRepository struct {
+	collection *mongo.Collection
+}
+
+func (r *mongoRevisionRepository) Append(ctx context.Context, revision *models.Revision) error {
+	return appendRevision(ctx, r.collection, revision)
+}
+
+func appendRevision(ctx context.Context, collection *mongo.Collection, revision *models.Revision) error {
+	revision.TenantID = tenantOf(revision.TenantID)
+	result, err := collection.InsertOne(ctx, revision)
+	if err != nil {
+		return writeError(err)
+	}
+	revision.ID = result.InsertedID.(primitive.ObjectID)
+	return nil
+}
+
+// revisionsOf returns the revisions collection of the database holding
+// collection.
+func revisionsOf(collection *mongo.Collection) *mongo.Collection {
+	return collection.Database().Collection("revisions")
+}
+
+// recorded runs write, which returns the ID of the document it wrote, and
+// if ctx asks for a revision appends the one revision makes of the document
+// as write left it. Both then run in a multi-document transaction, which
+// needs MongoDB to run as a replica set.
+func recorded[T any](ctx context.Context, collection *mongo.Collection,
+	write func(ctx context.Context) (primitive.ObjectID, error),
+	revision func(context.Context, T) *models.Revision,
+) error {
+	if !recording(ctx) {
+		_, err := write(ctx)
+		return err
+	}
+
+	session, err := collection.Database().Client().StartSession()
+	if err != nil {
+		return err
+	}
+	defer session.EndSession(ctx)
+
+	_, err = session.WithTransaction(ctx, func(ctx mongo.SessionContext) (interface{}, error) {
+		id, err := write(ctx)
+		if err != nil {
+			return nil, err
+		}
+		var document T
+		if err := findOne(ctx, collection, bson.M{"_id": id}, &document); err != nil {
+			return nil, err
+		}
+		return nil, appendRevision(ctx, revisionsOf(collection), revision(ctx, document))
+	})
+	return err
+}
+
+func (r *mongoRevisionRepository) List(ctx context.Context, kind, documentID string) ([]models.Revision, error) {
+	cursor, err := r.collection.Find(ctx, bson.M{"kind": kind, "document_id": documentID},
+		options.Find().SetSort(bson.D{{Key: "version", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	revisions := []models.Revision{}
+	if err := cursor.All(ctx, &revisions); err != nil {
+		return nil, err
+	}
+	return revisions, nil
+}
+
+type mongoSnapshotRepository struct {
+	collection *mongo.Collection
+}
+
+func (r *mongoSnapshotRepository) Create(ctx context.Context, snapshot *models.PolicySnapshot) error {
+	snapshot.TenantID = tenantOf(snapshot.TenantID)
+	result, err := r.collection.InsertOne(ctx, snapshot)
+	if err != nil {
+		return err
+	}
+	snapshot.ID = result.InsertedID.(primitive.ObjectID)
+	return nil
+}
+
+func (r *mongoSnapshotRepository) Get(ctx context.Context, id string) (*models.PolicySnapshot, error) {
+	objID, err := objectID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	var snapshot models.PolicySnapshot
+	if err := findOne(ctx, r.collection, bson.M{"_id": objID}, &snapshot); err != nil {
+		return nil, err
+	}
+	return &snapshot, nil
+}
+
+func (r *mongoSnapshotRepository) List(ctx context.Context, tenantID string) ([]models.PolicySnapshot, error) {
+	cursor, err := r.collection.Find(ctx, bson.M{"tenant_id": tenantOf(tenantID)},
+		options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}, {Key: "_id", Value: -1}}))
+	if err != nil {
+		return nil, err
+	}
+	snapshots := []models.PolicySnapshot{}
+	if err := cursor.All(ctx, &snapshots); err != nil {
+		return nil, err
+	}
+	return snapshots, nil
+}
@@ -0,0 +1,423 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/knakul853/accessmesh/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// mongoMigration is one versioned schema change. Up must be safe to re-run if
+// it fails part way, since the version is only recorded after it succeeds.
+type mongoMigration struct {
+	Version     string
+	Description string
+	Up          func(ctx context.Context, db *mongo.Database) error
+}
+
+// magicLinkRetention is how long expired magic links, and magic link rate
+// limit windows, are kept before the TTL indexes remove them. It must exceed
+// the length of a rate limit window.
+const magicLinkRetention = 24 * time.Hour
+
+var mongoMigrations = []mongoMigration{
+	{
+		Version:     "0001_indexes",
+		Description: "unique user keys, token lookups and magic link expiry",
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			nonEmpty := func(field string) bson.M {
+				return bson.M{field: bson.M{"$gt": ""}}
+			}
+
+			indexes := map[string][]mongo.IndexModel{
+				"users": {
+					{
+						Keys:    bson.D{{Key: "username", Value: 1}},
+						Options: options.Index().SetName("username_unique").SetUnique(true),
+					},
+					{
+						Keys: bson.D{{Key: "email", Value: 1}},
+						Options: options.Index().SetName("email_unique").SetUnique(true).
+							SetPartialFilterExpression(nonEmpty("email")),
+					},
+					{
+						Keys: bson.D{{Key: "verification_token", Value: 1}},
+						Options: options.Index().SetName("verification_token").
+							SetPartialFilterExpression(nonEmpty("verification_token")),
+					},
+					{
+						Keys: bson.D{{Key: "reset_token", Value: 1}},
+						Options: options.Index().SetName("reset_token").
+							SetPartialFilterExpression(nonEmpty("reset_token")),
+					},
+					{
+						Keys: bson.D{{Key: "identities.provider", Value: 1}, {Key: "identities.subject", Value: 1}},
+						Options: options.Index().SetName("identities_unique").SetUnique(true).
+							SetPartialFilterExpression(bson.M{"identities": bson.M{"$exists": true}}),
+					},
+				},
+				"magic_links": {
+					{
+						Keys:    bson.D{{Key: "token_hash", Value: 1}},
+						Options: options.Index().SetName("token_hash"),
+					},
+					{
+						Keys:    bson.D{{Key: "email", Value: 1}, {Key: "created_at", Value: 1}},
+						Options: options.Index().SetName("email_created_at"),
+					},
+					{
+						Keys: bson.D{{Key: "expires_at", Value: 1}},
+						Options: options.Index().SetName("expires_at_ttl").
+							SetExpireAfterSeconds(int32(magicLinkRetention.Seconds())),
+					},
+				},
+				"audit_log": {
+					{
+						Keys:    bson.D{{Key: "created_at", Value: 1}},
+						Options: options.Index().SetName("created_at"),
+					},
+				},
+			}
+
+			for collection, models := range indexes {
+				if _, err := db.Collection(collection).Indexes().CreateMany(ctx, models); err != nil {
+					return fmt.Errorf("%s indexes: %w", collection, err)
+				}
+			}
+			return nil
+		},
+	},
+	{
+		Version:     "0002_backfill_user_fields",
+		Description: "default auth_source and email_verified on older user documents",
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			users := db.Collection("users")
+			if _, err := users.UpdateMany(ctx,
+				bson.M{"auth_source": bson.M{"$in": bson.A{nil, ""}}},
+				bson.M{"$set": bson.M{"auth_source": "local"}},
+			); err != nil {
+				return err
+			}
+			_, err := users.UpdateMany(ctx,
+				bson.M{"email_verified": bson.M{"$exists": false}},
+				bson.M{"$set": bson.M{"email_verified": false}},
+			)
+			return err
+		},
+	},
+	{
+		Version:     "0003_document_versions",
+		Description: "start versioning users, roles and policies for optimistic concurrency",
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			for _, name := range []string{"users", "roles", "policies"} {
+				if _, err := db.Collection(name).UpdateMany(ctx,
+					bson.M{"version": bson.M{"$exists": false}},
+					bson.M{"$set": bson.M{"version": 1}},
+				); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	},
+	{
+		Version:     "0004_soft_delete",
+		Description: "index trashed users, roles and policies for listing and purging",
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			index := mongo.IndexModel{
+				Keys: bson.D{{Key: "deleted_at", Value: 1}},
+				Options: options.Index().SetName("deleted_at").
+					SetPartialFilterExpression(bson.M{"deleted_at": bson.M{"$exists": true}}),
+			}
+			for _, name := range []string{"users", "roles", "policies"} {
+				if _, err := db.Collection(name).Indexes().CreateOne(ctx, index); err != nil {
+					return fmt.Errorf("%s indexes: %w", name, err)
+				}
+			}
+			return nil
+		},
+	},
+	{
+		Version:     "0005_tenants",
+		Description: "put existing users, roles and policies in the default tenant",
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			if _, err := db.Collection("tenants").UpdateOne(ctx,
+				bson.M{"_id": models.DefaultTenant},
+				bson.M{"$setOnInsert": bson.M{"name": "Default", "created_at": time.Now()}},
+				options.Update().SetUpsert(true),
+			); err != nil {
+				return err
+			}
+
+			index := mongo.IndexModel{
+				Keys:    bson.D{{Key: "tenant_id", Value: 1}},
+				Options: options.Index().SetName("tenant_id"),
+			}
+			for _, name := range []string{"users", "roles", "policies"} {
+				collection := db.Collection(name)
+				if _, err := collection.UpdateMany(ctx,
+					bson.M{"tenant_id": bson.M{"$in": bson.A{nil, ""}}},
+					bson.M{"$set": bson.M{"tenant_id": models.DefaultTenant}},
+				); err != nil {
+					return err
+				}
+				if _, err := collection.Indexes().CreateOne(ctx, index); err != nil {
+					return fmt.Errorf("%s indexes: %w", name, err)
+				}
+			}
+			return nil
+		},
+	},
+	{
+		Version:     "0006_groups",
+		Description: "index groups by tenant, member and subgroup",
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			if _, err := db.Collection("groups").Indexes().CreateMany(ctx, []mongo.IndexModel{
+				{
+					Keys:    bson.D{{Key: "tenant_id", Value: 1}},
+					Options: options.Index().SetName("tenant_id"),
+				},
+				{
+					Keys:    bson.D{{Key: "members", Value: 1}},
+					Options: options.Index().SetName("members"),
+				},
+				{
+					Keys:    bson.D{{Key: "subgroups", Value: 1}},
+					Options: options.Index().SetName("subgroups"),
+				},
+				{
+					Keys: bson.D{{Key: "deleted_at", Value: 1}},
+					Options: options.Index().SetName("deleted_at").
+						SetPartialFilterExpression(bson.M{"deleted_at": bson.M{"$exists": true}}),
+				},
+			}); err != nil {
+				return fmt.Errorf("groups indexes: %w", err)
+			}
+			return nil
+		},
+	},
+	{
+		Version:     "0007_user_roles",
+		Description: "turn each user's single role into a list of role assignments",
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			users := db.Collection("users")
+			if _, err := users.UpdateMany(ctx,
+				bson.M{"roles": bson.M{"$exists": false}},
+				mongo.Pipeline{
+					{{Key: "$set", Value: bson.M{"roles": bson.M{"$cond": bson.A{
+						bson.M{"$gt": bson.A{bson.M{"$ifNull": bson.A{"$role", ""}}, ""}},
+						bson.A{bson.M{"role": "$role"}},
+						bson.A{},
+					}}}}},
+					{{Key: "$unset", Value: "role"}},
+				},
+			); err != nil {
+				return err
+			}
+			if _, err := users.Indexes().CreateOne(ctx, mongo.IndexModel{
+				Keys:    bson.D{{Key: "roles.role", Value: 1}},
+				Options: options.Index().SetName("roles_role"),
+			}); err != nil {
+				return fmt.Errorf("users indexes: %w", err)
+			}
+			return nil
+		},
+	},
+	{
+		Version:     "0008_elevations",
+		Description: "index elevations by tenant, user and expiry",
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			if _, err := db.Collection("elevations").Indexes().CreateMany(ctx, []mongo.IndexModel{
+				{
+					Keys:    bson.D{{Key: "tenant_id", Value: 1}},
+					Options: options.Index().SetName("tenant_id"),
+				},
+				{
+					Keys:    bson.D{{Key: "user_id", Value: 1}, {Key: "role", Value: 1}},
+					Options: options.Index().SetName("user_id_role"),
+				},
+				{
+					Keys:    bson.D{{Key: "status", Value: 1}, {Key: "expires_at", Value: 1}},
+					Options: options.Index().SetName("status_expires_at"),
+				},
+			}); err != nil {
+				return fmt.Errorf("elevations indexes: %w", err)
+			}
+			return nil
+		},
+	},
+	{
+		Version:     "0009_relation_tuples",
+		Description: "index relation tuples by object and subject, one live copy each",
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			if _, err := db.Collection("relation_tuples").Indexes().CreateMany(ctx, []mongo.IndexModel{
+				{
+					Keys: bson.D{
+						{Key: "tenant_id", Value: 1}, {Key: "object_type", Value: 1}, {Key: "object_id", Value: 1},
+						{Key: "relation", Value: 1}, {Key: "subject_type", Value: 1}, {Key: "subject_id", Value: 1},
+						{Key: "subject_relation", Value: 1},
+					},
+					Options: options.Index().SetName("tuple_live").SetUnique(true).
+						SetPartialFilterExpression(bson.M{"deleted_rev": 0}),
+				},
+				{
+					Keys: bson.D{
+						{Key: "tenant_id", Value: 1}, {Key: "subject_type", Value: 1}, {Key: "subject_id", Value: 1},
+						{Key: "subject_relation", Value: 1},
+					},
+					Options: options.Index().SetName("tuple_subject"),
+				},
+			}); err != nil {
+				return fmt.Errorf("relation_tuples indexes: %w", err)
+			}
+			return nil
+		},
+	},
+	{
+		Version:     "0010_revisions",
+		Description: "index revisions by document and version, and snapshots by tenant",
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			if _, err := db.Collection("revisions").Indexes().CreateOne(ctx, mongo.IndexModel{
+				Keys:    bson.D{{Key: "kind", Value: 1}, {Key: "document_id", Value: 1}, {Key: "version", Value: 1}},
+				Options: options.Index().SetName("kind_document_id_version").SetUnique(true),
+			}); err != nil {
+				return fmt.Errorf("revisions indexes: %w", err)
+			}
+			if _, err := db.Collection("policy_snapshots").Indexes().CreateOne(ctx, mongo.IndexModel{
+				Keys:    bson.D{{Key: "tenant_id", Value: 1}, {Key: "created_at", Value: -1}},
+				Options: options.Index().SetName("tenant_id_created_at"),
+			}); err != nil {
+				return fmt.Errorf("policy_snapshots indexes: %w", err)
+			}
+			return nil
+		},
+	},
+	{
+		Version:     "0011_magic_link_requests",
+		Description: "count magic link requests by email and expire them",
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			if _, err := db.Collection("magic_link_requests").Indexes().CreateMany(ctx, []mongo.IndexModel{
+				{
+					Keys:    bson.D{{Key: "email", Value: 1}, {Key: "created_at", Value: 1}},
+					Options: options.Index().SetName("email_created_at"),
+				},
+				{
+					Keys: bson.D{{Key: "created_at", Value: 1}},
+					Options: options.Index().SetName("created_at_ttl").
+						SetExpireAfterSeconds(int32(magicLinkRetention.Seconds())),
+				},
+			}); err != nil {
+				return fmt.Errorf("magic_link_requests indexes: %w", err)
+			}
+			return nil
+		},
+	},
+	{
+		Version:     "0012_role_names",
+		Description: "trash all but the oldest live role of each name and make live role names unique per tenant",
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			roles := db.Collection("roles")
+			cursor, err := roles.Aggregate(ctx, mongo.Pipeline{
+				{{Key: "$match", Value: bson.M{"deleted_at": nil}}},
+				{{Key: "$sort", Value: bson.M{"_id": 1}}},
+				{{Key: "$group", Value: bson.M{
+					"_id": bson.M{"tenant_id": "$tenant_id", "name": "$name"},
+					"ids": bson.M{"$push": "$_id"},
+				}}},
+				{{Key: "$match", Value: bson.M{"ids.1": bson.M{"$exists": true}}}},
+			})
+			if err != nil {
+				return err
+			}
+			var namesakes []struct {
+				IDs []primitive.ObjectID `bson:"ids"`
+			}
+			if err := cursor.All(ctx, &namesakes); err != nil {
+				return err
+			}
+			for _, group := range namesakes {
+				if _, err := roles.UpdateMany(ctx,
+					bson.M{"_id": bson.M{"$in": group.IDs[1:]}},
+					bson.M{
+						"$set": bson.M{"deleted_at": time.Now(), "deleted_by": "migration"},
+						"$inc": bson.M{"version": 1},
+					},
+				); err != nil {
+					return err
+				}
+			}
+
+			// Partial indexes cannot select documents without deleted_at, so
+			// the index includes it: live roles all have it missing, which
+			// indexes as null.
+			if _, err := roles.Indexes().CreateOne(ctx, mongo.IndexModel{
+				Keys:    bson.D{{Key: "tenant_id", Value: 1}, {Key: "name", Value: 1}, {Key: "deleted_at", Value: 1}},
+				Options: options.Index().SetName("tenant_id_name_unique").SetUnique(true),
+			}); err != nil {
+				return fmt.Errorf("roles indexes: %w", err)
+			}
+			return nil
+		},
+	},
+	{
+		Version:     "0013_magic_link_limits",
+		Description: "count magic link requests per email and window instead of one by one",
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			if err := db.Collection("magic_link_requests").Drop(ctx); err != nil {
+				return err
+			}
+			if _, err := db.Collection("magic_link_limits").Indexes().CreateMany(ctx, []mongo.IndexModel{
+				{
+					Keys:    bson.D{{Key: "email", Value: 1}, {Key: "window_start", Value: 1}},
+					Options: options.Index().SetName("email_window_start_unique").SetUnique(true),
+				},
+				{
+					Keys: bson.D{{Key: "window_start", Value: 1}},
+					Options: options.Index().SetName("window_start_ttl").
+						SetExpireAfterSeconds(int32(magicLinkRetention.Seconds())),
+				},
+			}); err != nil {
+				return fmt.Errorf("magic_link_limits indexes: %w", err)
+			}
+			return nil
+		},
+	},
+}
+
+// Migrate applies the migrations not yet recorded in schema_migrations, in
+// order.
+func (s *MongoStore) Migrate(ctx context.Context) error {
+	applied := s.DB.Collection("schema_migrations")
+
+	for _, m := range mongoMigrations {
+		count, err := applied.CountDocuments(ctx, bson.M{"_id": m.Version})
+		if err != nil {
+			return err
+		}
+		if count > 0 {
+			continue
+		}
+
+		log.Printf("Applying migration %s: %s...", m.Version, m.Description)
+		if err := m.Up(ctx, s.DB); err != nil {
+			return fmt.Errorf("migration %s: %w", m.Version, err)
+		}
+
+		// A duplicate key means another instance finished the same
+		// migration concurrently.
+		if _, err := applied.InsertOne(ctx, bson.M{
+			"_id":         m.Version,
+			"description": m.Description,
+			"applied_at":  time.Now(),
+		}); err != nil && !mongo.IsDuplicateKeyError(err) {
+			return err
+		}
+	}
+	return nil
+}
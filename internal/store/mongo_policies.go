@@ -0,0 +1,160 @@
+package store
+
+import (
+	"context"
+	"time"
+
+	"github.com/knakul853/accessmesh/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type mongoPolicyRepository struct {
+	collection *mongo.Collection
+}
+
+func (r *mongoPolicyRepository) Create(ctx context.Context, policy *models.Policy) error {
+	policy.TenantID = tenantOf(policy.TenantID)
+	policy.Version = 1
+	return recorded(ctx, r.collection, func(ctx context.Context) (primitive.ObjectID, error) {
+		result, err := r.collection.InsertOne(ctx, policy)
+		if err != nil {
+			return primitive.NilObjectID, err
+		}
+		policy.ID = result.InsertedID.(primitive.ObjectID)
+		return policy.ID, nil
+	}, policyRevision)
+}
+
+func (r *mongoPolicyRepository) Get(ctx context.Context, id string) (*models.Policy, error) {
+	objID, err := objectID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	var policy models.Policy
+	if err := findOne(ctx, r.collection, bson.M{"_id": objID, "deleted_at": nil}, &policy); err != nil {
+		return nil, err
+	}
+	return &policy, nil
+}
+
+func (r *mongoPolicyRepository) List(ctx context.Context, query PolicyQuery) (*Page[models.Policy], error) {
+	filter := bson.M{}
+	if query.Search != "" {
+		filter = searchFilter(query.Search, "role", "resource")
+	}
+	if query.TenantID != "" {
+		filter["tenant_id"] = query.TenantID
+	}
+	if query.Role != "" {
+		filter["role"] = query.Role
+	}
+	if query.Group != "" {
+		filter["group_id"] = query.Group
+	}
+	if query.Resource != "" {
+		filter["resource"] = query.Resource
+	}
+	if query.Action != "" {
+		filter["action"] = query.Action
+	}
+
+	return findPage(ctx, r.collection, filter, query.ListOptions, policySortFields, policySortKey)
+}
+
+func (r *mongoPolicyRepository) Update(ctx context.Context, policy *models.Policy) error {
+	policy.UpdatedAt = time.Now()
+	version := policy.Version
+	err := recorded(ctx, r.collection, func(ctx context.Context) (primitive.ObjectID, error) {
+		policy.Version = version
+		return policy.ID, replaceVersioned(ctx, r.collection, policy.ID, &policy.Version, policy)
+	}, policyRevision)
+	if err != nil {
+		policy.Version = version
+	}
+	return err
+}
+
+func (r *mongoPolicyRepository) SoftDelete(ctx context.Context, id string, version int64, deletedBy string) error {
+	objID, err := objectID(id)
+	if err != nil {
+		return err
+	}
+	return recorded(ctx, r.collection, func(ctx context.Context) (primitive.ObjectID, error) {
+		return objID, softDelete(ctx, r.collection, id, version, deletedBy)
+	}, policyRevision)
+}
+
+func (r *mongoPolicyRepository) Restore(ctx context.Context, id, tenantID string) error {
+	objID, err := objectID(id)
+	if err != nil {
+		return err
+	}
+	return recorded(ctx, r.collection, func(ctx context.Context) (primitive.ObjectID, error) {
+		return objID, restore(ctx, r.collection, id, tenantID)
+	}, policyRevision)
+}
+
+func (r *mongoPolicyRepository) Purge(ctx context.Context, before time.Time) (int64, error) {
+	return purge(ctx, r.collection, before)
+}
+
+func (r *mongoPolicyRepository) Delete(ctx context.Context, id string, version int64) error {
+	return deleteByID(ctx, r.collection, id, version)
+}
+
+// ReplaceAll runs in a multi-document transaction, which needs MongoDB to
+// run as a replica set.
+func (r *mongoPolicyRepository) ReplaceAll(ctx context.Context, tenantID string, policies []models.Policy, deletedBy string) ([]PolicyChange, error) {
+	tenantID = tenantOf(tenantID)
+
+	session, err := r.collection.Database().Client().StartSession()
+	if err != nil {
+		return nil, err
+	}
+	defer session.EndSession(ctx)
+
+	var changes []PolicyChange
+	_, err = session.WithTransaction(ctx, func(ctx mongo.SessionContext) (interface{}, error) {
+		cursor, err := r.collection.Find(ctx, bson.M{"tenant_id": tenantID})
+		if err != nil {
+			return nil, err
+		}
+		var stored []models.Policy
+		if err := cursor.All(ctx, &stored); err != nil {
+			return nil, err
+		}
+
+		changes = planReplaceAll(tenantID, stored, policies, deletedBy, time.Now())
+		for _, change := range changes {
+			if change.Before == nil {
+				if _, err := r.collection.InsertOne(ctx, change.After); err != nil {
+					return nil, writeError(err)
+				}
+				continue
+			}
+			result, err := r.collection.ReplaceOne(ctx,
+				bson.M{"_id": change.After.ID, "version": change.Before.Version}, change.After)
+			if err != nil {
+				return nil, writeError(err)
+			}
+			if result.MatchedCount == 0 {
+				return nil, ErrVersionConflict
+			}
+		}
+		for _, change := range changes {
+			if revision := policyRevision(ctx, *change.After); revision != nil {
+				if err := appendRevision(ctx, revisionsOf(r.collection), revision); err != nil {
+					return nil, err
+				}
+			}
+		}
+		return nil, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return changes, nil
+}
@@ -0,0 +1,96 @@
+package store
+
+import (
+	"context"
+	"time"
+
+	"github.com/knakul853/accessmesh/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type mongoRoleRepository struct {
+	collection *mongo.Collection
+}
+
+func (r *mongoRoleRepository) Create(ctx context.Context, role *models.Role) error {
+	role.TenantID = tenantOf(role.TenantID)
+	role.Version = 1
+	return recorded(ctx, r.collection, func(ctx context.Context) (primitive.ObjectID, error) {
+		result, err := r.collection.InsertOne(ctx, role)
+		if err != nil {
+			return primitive.NilObjectID, writeError(err)
+		}
+		role.ID = result.InsertedID.(primitive.ObjectID)
+		return role.ID, nil
+	}, roleRevision)
+}
+
+func (r *mongoRoleRepository) Get(ctx context.Context, id string) (*models.Role, error) {
+	objID, err := objectID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	var role models.Role
+	if err := findOne(ctx, r.collection, bson.M{"_id": objID, "deleted_at": nil}, &role); err != nil {
+		return nil, err
+	}
+	return &role, nil
+}
+
+func (r *mongoRoleRepository) List(ctx context.Context, query RoleQuery) (*Page[models.Role], error) {
+	filter := bson.M{}
+	if query.Search != "" {
+		filter = searchFilter(query.Search, "name", "description")
+	}
+	if query.TenantID != "" {
+		filter["tenant_id"] = query.TenantID
+	}
+	if query.Name != "" {
+		filter["name"] = query.Name
+	}
+
+	return findPage(ctx, r.collection, filter, query.ListOptions, roleSortFields, roleSortKey)
+}
+
+func (r *mongoRoleRepository) Update(ctx context.Context, role *models.Role) error {
+	version := role.Version
+	err := recorded(ctx, r.collection, func(ctx context.Context) (primitive.ObjectID, error) {
+		role.Version = version
+		return role.ID, replaceVersioned(ctx, r.collection, role.ID, &role.Version, role)
+	}, roleRevision)
+	if err != nil {
+		role.Version = version
+	}
+	return err
+}
+
+func (r *mongoRoleRepository) SoftDelete(ctx context.Context, id string, version int64, deletedBy string) error {
+	objID, err := objectID(id)
+	if err != nil {
+		return err
+	}
+	return recorded(ctx, r.collection, func(ctx context.Context) (primitive.ObjectID, error) {
+		return objID, softDelete(ctx, r.collection, id, version, deletedBy)
+	}, roleRevision)
+}
+
+func (r *mongoRoleRepository) Restore(ctx context.Context, id, tenantID string) error {
+	objID, err := objectID(id)
+	if err != nil {
+		return err
+	}
+	return recorded(ctx, r.collection, func(ctx context.Context) (primitive.ObjectID, error) {
+		return objID, restore(ctx, r.collection, id, tenantID)
+	}, roleRevision)
+}
+
+func (r *mongoRoleRepository) Purge(ctx context.Context, before time.Time) (int64, error) {
+	return purge(ctx, r.collection, before)
+}
+
+func (r *mongoRoleRepository) Delete(ctx context.Context, id string, version int64) error {
+	return deleteByID(ctx, r.collection, id, version)
+}
@@ -0,0 +1,41 @@
+package store
+
+import (
+	"context"
+
+	"github.com/knakul853/accessmesh/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type mongoTenantRepository struct {
+	collection *mongo.Collection
+}
+
+func (r *mongoTenantRepository) Create(ctx context.Context, tenant *models.Tenant) error {
+	_, err := r.collection.InsertOne(ctx, tenant)
+	return writeError(err)
+}
+
+func (r *mongoTenantRepository) Get(ctx context.Context, id string) (*models.Tenant, error) {
+	var tenant models.Tenant
+	if err := findOne(ctx, r.collection, bson.M{"_id": id}, &tenant); err != nil {
+		return nil, err
+	}
+	return &tenant, nil
+}
+
+func (r *mongoTenantRepository) List(ctx context.Context) ([]models.Tenant, error) {
+	cursor, err := r.collection.Find(ctx, bson.M{}, options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	tenants := []models.Tenant{}
+	if err := cursor.All(ctx, &tenants); err != nil {
+		return nil, err
+	}
+	return tenants, nil
+}
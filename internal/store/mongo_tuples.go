@@ -0,0 +1,115 @@
+package store
+
+import (
+	"context"
+	"errors"
+
+	"github.com/knakul853/accessmesh/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type mongoTupleRepository struct {
+	collection *mongo.Collection
+	revisions  *mongo.Collection
+}
+
+// Write is not transactional: a reader at the new revision may see part of a
+// write that is still in progress, and a failed write leaves the revision
+// bumped with some of its tuples applied. Retrying the write repairs it,
+// since inserting a live tuple or deleting a missing one is a no-op.
+func (r *mongoTupleRepository) Write(ctx context.Context, tenantID string, inserts, deletes []models.RelationTuple) (int64, error) {
+	tenantID = tenantOf(tenantID)
+
+	var counter struct {
+		Revision int64 `bson:"revision"`
+	}
+	if err := r.revisions.FindOneAndUpdate(ctx,
+		bson.M{"_id": tenantID},
+		bson.M{"$inc": bson.M{"revision": 1}},
+		options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After),
+	).Decode(&counter); err != nil {
+		return 0, err
+	}
+	revision := counter.Revision
+
+	for _, t := range deletes {
+		filter := tupleKey(tenantID, t)
+		filter["deleted_rev"] = 0
+		if _, err := r.collection.UpdateOne(ctx, filter, bson.M{"$set": bson.M{"deleted_rev": revision}}); err != nil {
+			return 0, err
+		}
+	}
+	for _, t := range inserts {
+		filter := tupleKey(tenantID, t)
+		filter["deleted_rev"] = 0
+		if _, err := r.collection.UpdateOne(ctx, filter,
+			bson.M{"$setOnInsert": bson.M{"created_rev": revision}},
+			options.Update().SetUpsert(true),
+		); err != nil && !mongo.IsDuplicateKeyError(err) {
+			return 0, err
+		}
+	}
+	return revision, nil
+}
+
+func tupleKey(tenantID string, t models.RelationTuple) bson.M {
+	return bson.M{
+		"tenant_id":        tenantID,
+		"object_type":      t.ObjectType,
+		"object_id":        t.ObjectID,
+		"relation":         t.Relation,
+		"subject_type":     t.SubjectType,
+		"subject_id":       t.SubjectID,
+		"subject_relation": t.SubjectRelation,
+	}
+}
+
+func (r *mongoTupleRepository) Read(ctx context.Context, filter TupleFilter, revision int64) ([]models.RelationTuple, error) {
+	query := bson.M{
+		"tenant_id":   tenantOf(filter.TenantID),
+		"created_rev": bson.M{"$lte": revision},
+		"$or":         bson.A{bson.M{"deleted_rev": 0}, bson.M{"deleted_rev": bson.M{"$gt": revision}}},
+	}
+	for field, value := range map[string]string{
+		"object_type": filter.ObjectType,
+		"object_id":   filter.ObjectID,
+		"relation":    filter.Relation,
+	} {
+		if value != "" {
+			query[field] = value
+		}
+	}
+	if filter.SubjectType != "" {
+		query["subject_type"] = filter.SubjectType
+		query["subject_id"] = filter.SubjectID
+		query["subject_relation"] = filter.SubjectRelation
+	}
+
+	cursor, err := r.collection.Find(ctx, query, options.Find().
+		SetProjection(bson.M{"_id": 0}).
+		SetSort(bson.D{
+			{Key: "object_type", Value: 1}, {Key: "object_id", Value: 1}, {Key: "relation", Value: 1},
+			{Key: "subject_type", Value: 1}, {Key: "subject_id", Value: 1}, {Key: "subject_relation", Value: 1},
+		}))
+	if err != nil {
+		return nil, err
+	}
+	var tuples []models.RelationTuple
+	if err := cursor.All(ctx, &tuples); err != nil {
+		return nil, err
+	}
+	return tuples, nil
+}
+
+func (r *mongoTupleRepository) Revision(ctx context.Context, tenantID string) (int64, error) {
+	var counter struct {
+		Revision int64 `bson:"revision"`
+	}
+	err := r.revisions.FindOne(ctx, bson.M{"_id": tenantOf(tenantID)}).Decode(&counter)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return 0, nil
+	}
+	return counter.Revision, err
+}
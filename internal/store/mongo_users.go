@@ -0,0 +1,130 @@
+package store
+
+import (
+	"context"
+	"time"
+
+	"github.com/knakul853/accessmesh/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type mongoUserRepository struct {
+	collection *mongo.Collection
+}
+
+func (r *mongoUserRepository) Create(ctx context.Context, user *models.User) error {
+	user.TenantID = tenantOf(user.TenantID)
+	user.Version = 1
+	result, err := r.collection.InsertOne(ctx, user)
+	if err != nil {
+		return writeError(err)
+	}
+	user.ID = result.InsertedID.(primitive.ObjectID)
+	return nil
+}
+
+func (r *mongoUserRepository) Get(ctx context.Context, id string) (*models.User, error) {
+	objID, err := objectID(id)
+	if err != nil {
+		return nil, err
+	}
+	return r.findOne(ctx, bson.M{"_id": objID})
+}
+
+func (r *mongoUserRepository) GetByUsername(ctx context.Context, username string) (*models.User, error) {
+	return r.findOne(ctx, bson.M{"username": username})
+}
+
+func (r *mongoUserRepository) GetByEmail(ctx context.Context, email string) (*models.User, error) {
+	return r.findOne(ctx, bson.M{"email": email})
+}
+
+func (r *mongoUserRepository) GetByIdentity(ctx context.Context, provider, subject string) (*models.User, error) {
+	return r.findOne(ctx, bson.M{
+		"identities": bson.M{"$elemMatch": bson.M{"provider": provider, "subject": subject}},
+	})
+}
+
+func (r *mongoUserRepository) GetByResetToken(ctx context.Context, token string) (*models.User, error) {
+	return r.findOne(ctx, bson.M{
+		"reset_token":        token,
+		"reset_token_expiry": bson.M{"$gt": time.Now()},
+	})
+}
+
+func (r *mongoUserRepository) List(ctx context.Context, query UserQuery) (*Page[models.User], error) {
+	filter := bson.M{}
+	if query.Search != "" {
+		filter = searchFilter(query.Search, "username", "email")
+	}
+	if query.TenantID != "" {
+		filter["tenant_id"] = query.TenantID
+	}
+	if query.Role != "" {
+		filter["roles.role"] = query.Role
+	}
+	if query.EmailVerified != nil {
+		filter["email_verified"] = *query.EmailVerified
+	}
+
+	return findPage(ctx, r.collection, filter, query.ListOptions, userSortFields, userSortKey)
+}
+
+func (r *mongoUserRepository) Update(ctx context.Context, user *models.User) error {
+	user.UpdatedAt = time.Now()
+	return replaceVersioned(ctx, r.collection, user.ID, &user.Version, user)
+}
+
+func (r *mongoUserRepository) VerifyEmail(ctx context.Context, token string) error {
+	if token == "" {
+		return ErrNotFound
+	}
+
+	result, err := r.collection.UpdateOne(ctx,
+		bson.M{"verification_token": token, "deleted_at": nil},
+		bson.M{
+			"$set": bson.M{
+				"email_verified":     true,
+				"verification_token": "",
+				"updated_at":         time.Now(),
+			},
+			"$inc": bson.M{"version": 1},
+		},
+	)
+	if err != nil {
+		return err
+	}
+	if result.ModifiedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *mongoUserRepository) SoftDelete(ctx context.Context, id string, version int64, deletedBy string) error {
+	return softDelete(ctx, r.collection, id, version, deletedBy)
+}
+
+func (r *mongoUserRepository) Restore(ctx context.Context, id, tenantID string) error {
+	return restore(ctx, r.collection, id, tenantID)
+}
+
+func (r *mongoUserRepository) Purge(ctx context.Context, before time.Time) (int64, error) {
+	return purge(ctx, r.collection, before)
+}
+
+func (r *mongoUserRepository) Delete(ctx context.Context, id string, version int64) error {
+	return deleteByID(ctx, r.collection, id, version)
+}
+
+// findOne finds a live user matching filter.
+func (r *mongoUserRepository) findOne(ctx context.Context, filter bson.M) (*models.User, error) {
+	filter["deleted_at"] = nil
+
+	var user models.User
+	if err := findOne(ctx, r.collection, filter, &user); err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
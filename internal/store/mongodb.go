@@ -2,9 +2,9 @@ package store
 
 import (
 	"context"
+	"regexp"
 	"time"
 
-	"github.com/knakul853/accessmesh/internal/models"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
@@ -33,16 +33,54 @@ func NewMongoStore(uri string) (*MongoStore, error) {
 	}, nil
 }
 
-func (s *MongoStore) Policies() *mongo.Collection {
-	return s.DB.Collection("policies")
+func (s *MongoStore) Tenants() TenantRepository {
+	return &mongoTenantRepository{collection: s.DB.Collection("tenants")}
 }
 
-func (s *MongoStore) Roles() *mongo.Collection {
-	return s.DB.Collection("roles")
+func (s *MongoStore) Policies() PolicyRepository {
+	return &mongoPolicyRepository{collection: s.DB.Collection("policies")}
 }
 
-func (s *MongoStore) Users() *mongo.Collection {
-	return s.DB.Collection("users")
+func (s *MongoStore) Roles() RoleRepository {
+	return &mongoRoleRepository{collection: s.DB.Collection("roles")}
+}
+
+func (s *MongoStore) Groups() GroupRepository {
+	return &mongoGroupRepository{collection: s.DB.Collection("groups")}
+}
+
+func (s *MongoStore) Elevations() ElevationRepository {
+	return &mongoElevationRepository{collection: s.DB.Collection("elevations")}
+}
+
+func (s *MongoStore) Tuples() TupleRepository {
+	return &mongoTupleRepository{
+		collection: s.DB.Collection("relation_tuples"),
+		revisions:  s.DB.Collection("tuple_revisions"),
+	}
+}
+
+func (s *MongoStore) Revisions() RevisionRepository {
+	return &mongoRevisionRepository{collection: s.DB.Collection("revisions")}
+}
+
+func (s *MongoStore) Snapshots() SnapshotRepository {
+	return &mongoSnapshotRepository{collection: s.DB.Collection("policy_snapshots")}
+}
+
+func (s *MongoStore) Users() UserRepository {
+	return &mongoUserRepository{collection: s.DB.Collection("users")}
+}
+
+func (s *MongoStore) MagicLinks() MagicLinkRepository {
+	return &mongoMagicLinkRepository{
+		collection: s.DB.Collection("magic_links"),
+		limits:     s.DB.Collection("magic_link_limits"),
+	}
+}
+
+func (s *MongoStore) AuditLogs() AuditRepository {
+	return &mongoAuditRepository{collection: s.DB.Collection("audit_log")}
 }
 
 func (s *MongoStore) GetClient() *mongo.Client {
@@ -53,58 +91,221 @@ func (s *MongoStore) GetURI() string {
 	return s.Uri
 }
 
-// GetAllUsers retrieves all users from the database
-func (s *MongoStore) GetAllUsers() ([]models.User, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
+func objectID(id string) (primitive.ObjectID, error) {
+	objID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return primitive.NilObjectID, ErrInvalidID
+	}
+	return objID, nil
+}
+
+// findOne decodes the first match into out, mapping a missing document to ErrNotFound.
+func findOne(ctx context.Context, collection *mongo.Collection, filter interface{}, out interface{}) error {
+	err := collection.FindOne(ctx, filter).Decode(out)
+	if err == mongo.ErrNoDocuments {
+		return ErrNotFound
+	}
+	return err
+}
+
+// writeError maps driver write errors to the store's sentinel errors.
+func writeError(err error) error {
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrDuplicate
+	}
+	return err
+}
+
+// findPage runs a sorted, paged query over live or, with opts.Deleted,
+// trashed documents. filter selects the matches counted in Page.Total; the
+// cursor condition is added on top of it.
+func findPage[T any](ctx context.Context, collection *mongo.Collection, filter bson.M, opts ListOptions,
+	fields map[string]string, sortKey func(row T, field string) (string, string),
+) (*Page[T], error) {
+	spec, err := parseSort(opts.Sort, fields)
+	if err != nil {
+		return nil, err
+	}
+	after, err := decodeCursor(opts.After)
+	if err != nil {
+		return nil, err
+	}
+
+	filter["deleted_at"] = nil
+	if opts.Deleted {
+		filter["deleted_at"] = bson.M{"$ne": nil}
+	}
+
+	total, err := collection.CountDocuments(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	dir, cmp := 1, "$gt"
+	if spec.Desc {
+		dir, cmp = -1, "$lt"
+	}
+	sort := bson.D{{Key: "_id", Value: dir}}
+	if spec.Field != "" {
+		sort = append(bson.D{{Key: spec.Field, Value: dir}}, sort...)
+	}
+
+	query := filter
+	if after != nil {
+		afterID, _ := primitive.ObjectIDFromHex(after.ID)
+		position := bson.M{"_id": bson.M{cmp: afterID}}
+		if spec.Field != "" {
+			position = bson.M{"$or": bson.A{
+				bson.M{spec.Field: bson.M{cmp: after.Value}},
+				bson.M{spec.Field: after.Value, "_id": bson.M{cmp: afterID}},
+			}}
+		}
+		query = bson.M{"$and": bson.A{filter, position}}
+	}
+
+	findOpts := options.Find().SetSort(sort)
+	if opts.Limit > 0 {
+		// Fetch one extra item to learn whether another page follows.
+		findOpts.SetLimit(int64(opts.Limit) + 1)
+	}
 
-	var users []models.User
-	cursor, err := s.Users().Find(ctx, bson.M{})
+	cursor, err := collection.Find(ctx, query, findOpts)
 	if err != nil {
 		return nil, err
 	}
 	defer cursor.Close(ctx)
 
-	if err = cursor.All(ctx, &users); err != nil {
+	page := &Page[T]{Items: []T{}, Total: total}
+	if err := cursor.All(ctx, &page.Items); err != nil {
 		return nil, err
 	}
 
-	return users, nil
+	if opts.Limit > 0 && len(page.Items) > opts.Limit {
+		page.Items = page.Items[:opts.Limit]
+		page.NextCursor = encodeCursor(sortKey(page.Items[opts.Limit-1], spec.Field))
+	}
+	return page, nil
 }
 
-// UpdateUser updates a user in the database
-func (s *MongoStore) UpdateUser(id string, user *models.User) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
+// searchFilter matches a case-insensitive substring of any of fields.
+func searchFilter(search string, fields ...string) bson.M {
+	pattern := primitive.Regex{Pattern: regexp.QuoteMeta(search), Options: "i"}
+	or := bson.A{}
+	for _, field := range fields {
+		or = append(or, bson.M{field: pattern})
+	}
+	return bson.M{"$or": or}
+}
 
-	objID, err := primitive.ObjectIDFromHex(id)
+// deleteByID deletes the document if its version matches; version 0 matches
+// any.
+func deleteByID(ctx context.Context, collection *mongo.Collection, id string, version int64) error {
+	objID, err := objectID(id)
 	if err != nil {
 		return err
 	}
 
-	update := bson.M{
-		"$set": bson.M{
-			"username":   user.Username,
-			"email":     user.Email,
-			"role":      user.Role,
-			"updatedAt": time.Now(),
-		},
+	filter := bson.M{"_id": objID}
+	if version != 0 {
+		filter["version"] = version
+	}
+	result, err := collection.DeleteOne(ctx, filter)
+	if err != nil {
+		return err
 	}
+	if result.DeletedCount == 0 {
+		return versionMismatch(ctx, collection, bson.M{"_id": objID})
+	}
+	return nil
+}
 
-	_, err = s.Users().UpdateOne(ctx, bson.M{"_id": objID}, update)
-	return err
+// replaceVersioned replaces the live document if its stored version is
+// still *version, and bumps *version on success.
+func replaceVersioned(ctx context.Context, collection *mongo.Collection, id primitive.ObjectID, version *int64, doc interface{}) error {
+	expected := *version
+	*version = expected + 1
+
+	result, err := collection.ReplaceOne(ctx, bson.M{"_id": id, "version": expected, "deleted_at": nil}, doc)
+	if err == nil && result.MatchedCount == 0 {
+		err = versionMismatch(ctx, collection, bson.M{"_id": id, "deleted_at": nil})
+	}
+	if err != nil {
+		*version = expected
+		return writeError(err)
+	}
+	return nil
 }
 
-// DeleteUser deletes a user from the database
-func (s *MongoStore) DeleteUser(id string) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
+// versionMismatch explains why a versioned write matched nothing: either no
+// document matches filter any more or it has moved on to another version.
+func versionMismatch(ctx context.Context, collection *mongo.Collection, filter bson.M) error {
+	count, err := collection.CountDocuments(ctx, filter)
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return ErrNotFound
+	}
+	return ErrVersionConflict
+}
 
-	objID, err := primitive.ObjectIDFromHex(id)
+// softDelete moves a live document to the trash if its version matches;
+// version 0 matches any.
+func softDelete(ctx context.Context, collection *mongo.Collection, id string, version int64, deletedBy string) error {
+	objID, err := objectID(id)
 	if err != nil {
 		return err
 	}
 
-	_, err = s.Users().DeleteOne(ctx, bson.M{"_id": objID})
-	return err
+	filter := bson.M{"_id": objID, "deleted_at": nil}
+	if version != 0 {
+		filter["version"] = version
+	}
+	result, err := collection.UpdateOne(ctx, filter, bson.M{
+		"$set": bson.M{"deleted_at": time.Now(), "deleted_by": deletedBy},
+		"$inc": bson.M{"version": 1},
+	})
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return versionMismatch(ctx, collection, bson.M{"_id": objID, "deleted_at": nil})
+	}
+	return nil
+}
+
+// restore takes a document of the tenant, or of any tenant if tenantID is
+// empty, out of the trash.
+func restore(ctx context.Context, collection *mongo.Collection, id, tenantID string) error {
+	objID, err := objectID(id)
+	if err != nil {
+		return err
+	}
+
+	filter := bson.M{"_id": objID, "deleted_at": bson.M{"$ne": nil}}
+	if tenantID != "" {
+		filter["tenant_id"] = tenantID
+	}
+	result, err := collection.UpdateOne(ctx, filter,
+		bson.M{
+			"$unset": bson.M{"deleted_at": "", "deleted_by": ""},
+			"$inc":   bson.M{"version": 1},
+		},
+	)
+	if err != nil {
+		return writeError(err)
+	}
+	if result.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// purge permanently removes documents trashed before the given time.
+func purge(ctx context.Context, collection *mongo.Collection, before time.Time) (int64, error) {
+	result, err := collection.DeleteMany(ctx, bson.M{"deleted_at": bson.M{"$lt": before}})
+	if err != nil {
+		return 0, err
+	}
+	return result.DeletedCount, nil
 }
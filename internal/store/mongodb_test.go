@@ -0,0 +1,67 @@
+package store_test
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/knakul853/accessmesh/internal/models"
+	"github.com/knakul853/accessmesh/internal/store"
+	"github.com/knakul853/accessmesh/internal/store/storetest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// TestMongoStore runs against the server in MONGO_TEST_URI. Each subtest gets
+// its own database, dropped afterwards.
+func TestMongoStore(t *testing.T) {
+	uri := os.Getenv("MONGO_TEST_URI")
+	if uri == "" {
+		t.Skip("MONGO_TEST_URI not set")
+	}
+
+	storetest.Run(t, func(t *testing.T) store.Store {
+		s, err := store.NewMongoStore(uri)
+		require.NoError(t, err)
+		s.DB = s.Client.Database("accessmesh_test_" + primitive.NewObjectID().Hex())
+		t.Cleanup(func() {
+			s.DB.Drop(context.Background())
+			s.Client.Disconnect(context.Background())
+		})
+		require.NoError(t, s.Migrate(context.Background()))
+		return s
+	})
+}
+
+func TestMongoStore_Migrate(t *testing.T) {
+	uri := os.Getenv("MONGO_TEST_URI")
+	if uri == "" {
+		t.Skip("MONGO_TEST_URI not set")
+	}
+
+	ctx := context.Background()
+	s, err := store.NewMongoStore(uri)
+	require.NoError(t, err)
+	s.DB = s.Client.Database("accessmesh_test_" + primitive.NewObjectID().Hex())
+	defer func() {
+		s.DB.Drop(ctx)
+		s.Client.Disconnect(ctx)
+	}()
+
+	// Documents written before the migration get the backfilled defaults.
+	_, err = s.DB.Collection("users").InsertOne(ctx, bson.M{"username": "legacy"})
+	require.NoError(t, err)
+
+	require.NoError(t, s.Migrate(ctx))
+	require.NoError(t, s.Migrate(ctx))
+
+	applied, err := s.DB.Collection("schema_migrations").CountDocuments(ctx, bson.M{})
+	require.NoError(t, err)
+	assert.EqualValues(t, 2, applied)
+
+	user, err := s.Users().GetByUsername(ctx, "legacy")
+	require.NoError(t, err)
+	assert.Equal(t, models.AuthSourceLocal, user.AuthSource)
+}
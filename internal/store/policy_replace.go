@@ -0,0 +1,82 @@
+package store
+
+import (
+	"reflect"
+	"time"
+
+	"github.com/knakul853/accessmesh/internal/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// planReplaceAll works out the writes of PolicyRepository.ReplaceAll from
+// every policy of the tenant, live or trashed. Each backend applies them by
+// inserting the After of the changes without a Before, and replacing the
+// stored Before of the others, provided it still has Before's version.
+func planReplaceAll(tenantID string, stored, policies []models.Policy, deletedBy string, now time.Time) []PolicyChange {
+	byID := make(map[primitive.ObjectID]*models.Policy, len(stored))
+	for i := range stored {
+		byID[stored[i].ID] = &stored[i]
+	}
+
+	var changes []PolicyChange
+	kept := make(map[primitive.ObjectID]bool, len(policies))
+	for _, policy := range policies {
+		after := clonePolicy(policy)
+		after.TenantID = tenantID
+		after.DeletedAt = nil
+		after.DeletedBy = ""
+		after.UpdatedAt = now
+
+		before, ok := byID[policy.ID]
+		if policy.ID.IsZero() || !ok {
+			if after.ID.IsZero() {
+				after.ID = primitive.NewObjectID()
+			}
+			if after.CreatedAt.IsZero() {
+				after.CreatedAt = now
+			}
+			after.Version = 1
+			kept[after.ID] = true
+			changes = append(changes, PolicyChange{After: &after})
+			continue
+		}
+
+		kept[before.ID] = true
+		if before.DeletedAt == nil && samePolicy(before, &after) {
+			continue
+		}
+		after.CreatedAt = before.CreatedAt
+		after.Version = before.Version + 1
+		changes = append(changes, PolicyChange{Before: before, After: &after})
+	}
+
+	for i := range stored {
+		before := &stored[i]
+		if kept[before.ID] || before.DeletedAt != nil {
+			continue
+		}
+		after := clonePolicy(*before)
+		after.DeletedAt = &now
+		after.DeletedBy = deletedBy
+		after.Version++
+		changes = append(changes, PolicyChange{Before: before, After: &after})
+	}
+	return changes
+}
+
+// samePolicy reports whether two policies grant the same thing.
+func samePolicy(a, b *models.Policy) bool {
+	return a.Role == b.Role && a.Group == b.Group && a.Resource == b.Resource && a.Action == b.Action &&
+		reflect.DeepEqual(normalConditions(a.Conditions), normalConditions(b.Conditions))
+}
+
+// normalConditions treats nil and empty condition lists alike.
+func normalConditions(conditions models.PolicyConditions) models.PolicyConditions {
+	if len(conditions.IPRange) == 0 {
+		conditions.IPRange = nil
+	}
+	if len(conditions.TimeRange) == 0 {
+		conditions.TimeRange = nil
+	}
+	return conditions
+}
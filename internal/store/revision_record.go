@@ -0,0 +1,68 @@
+package store
+
+import (
+	"context"
+	"time"
+
+	"github.com/knakul853/accessmesh/internal/models"
+)
+
+type revisionKey struct{}
+
+// revisionRequest is what WithRevision asks writes to record.
+type revisionRequest struct {
+	action string
+	actor  string
+}
+
+// WithRevision returns a context under which the Create, Update,
+// SoftDelete and Restore of policies and roles, and PolicyRepository's
+// ReplaceAll, also append a revision of each document as the write left it,
+// made by actor as action. The revision is written in the same transaction
+// as the document, so that neither is kept without the other; a revision
+// that cannot be written fails the write.
+func WithRevision(ctx context.Context, action, actor string) context.Context {
+	return context.WithValue(ctx, revisionKey{}, revisionRequest{action: action, actor: actor})
+}
+
+// recording reports whether writes under ctx append revisions.
+func recording(ctx context.Context) bool {
+	_, ok := ctx.Value(revisionKey{}).(revisionRequest)
+	return ok
+}
+
+// policyRevision returns the revision ctx asks for of the policy, or nil.
+func policyRevision(ctx context.Context, policy models.Policy) *models.Revision {
+	revision := newRevision(ctx, policy.TenantID, models.RevisionKindPolicy, policy.ID.Hex(), policy.Version)
+	if revision != nil {
+		policy = clonePolicy(policy)
+		revision.Policy = &policy
+	}
+	return revision
+}
+
+// roleRevision returns the revision ctx asks for of the role, or nil.
+func roleRevision(ctx context.Context, role models.Role) *models.Revision {
+	revision := newRevision(ctx, role.TenantID, models.RevisionKindRole, role.ID.Hex(), role.Version)
+	if revision != nil {
+		role = cloneRole(role)
+		revision.Role = &role
+	}
+	return revision
+}
+
+func newRevision(ctx context.Context, tenantID, kind, documentID string, version int64) *models.Revision {
+	request, ok := ctx.Value(revisionKey{}).(revisionRequest)
+	if !ok {
+		return nil
+	}
+	return &models.Revision{
+		TenantID:   tenantOf(tenantID),
+		Kind:       kind,
+		DocumentID: documentID,
+		Version:    version,
+		Action:     request.action,
+		Actor:      request.actor,
+		CreatedAt:  time.Now(),
+	}
+}
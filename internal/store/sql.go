@@ -0,0 +1,240 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// SQLStore implements Store on top of database/sql. Queries are written in
+// the SQL subset shared by the supported databases; per-database differences
+// such as error codes are supplied by the constructor. Times are written in
+// UTC so that databases storing them as text still compare them correctly.
+type SQLStore struct {
+	DB *sql.DB
+
+	// isDuplicate reports whether err is a unique constraint violation.
+	isDuplicate func(err error) bool
+}
+
+func (s *SQLStore) Tenants() TenantRepository {
+	return &sqlTenantRepository{s}
+}
+
+func (s *SQLStore) Users() UserRepository {
+	return &sqlUserRepository{s}
+}
+
+func (s *SQLStore) Roles() RoleRepository {
+	return &sqlRoleRepository{s}
+}
+
+func (s *SQLStore) Policies() PolicyRepository {
+	return &sqlPolicyRepository{s}
+}
+
+func (s *SQLStore) Groups() GroupRepository {
+	return &sqlGroupRepository{s}
+}
+
+func (s *SQLStore) Elevations() ElevationRepository {
+	return &sqlElevationRepository{s}
+}
+
+func (s *SQLStore) Tuples() TupleRepository {
+	return &sqlTupleRepository{s}
+}
+
+func (s *SQLStore) Revisions() RevisionRepository {
+	return &sqlRevisionRepository{s}
+}
+
+func (s *SQLStore) Snapshots() SnapshotRepository {
+	return &sqlSnapshotRepository{s}
+}
+
+func (s *SQLStore) MagicLinks() MagicLinkRepository {
+	return &sqlMagicLinkRepository{s}
+}
+
+func (s *SQLStore) AuditLogs() AuditRepository {
+	return &sqlAuditRepository{s}
+}
+
+func (s *SQLStore) Close() error {
+	return s.DB.Close()
+}
+
+// writeError maps driver write errors to the store's sentinel errors.
+func (s *SQLStore) writeError(err error) error {
+	if err != nil && s.isDuplicate(err) {
+		return ErrDuplicate
+	}
+	return err
+}
+
+func (s *SQLStore) withTx(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// scanner is satisfied by *sql.Row and *sql.Rows.
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// expectOne maps an update or delete that touched no rows to ErrNotFound.
+func expectOne(result sql.Result, err error) error {
+	if err != nil {
+		return err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// rowQuerier is satisfied by *sql.DB and *sql.Tx.
+type rowQuerier interface {
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// sqlExecer is satisfied by *sql.DB and *sql.Tx.
+type sqlExecer interface {
+	rowQuerier
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+// rowVersionMismatch explains why a versioned write to a live row touched no
+// rows: either the row is gone or trashed, or it has moved on to another
+// version.
+func rowVersionMismatch(ctx context.Context, q rowQuerier, table, id string) error {
+	var exists bool
+	if err := q.QueryRowContext(ctx,
+		`SELECT EXISTS (SELECT 1 FROM `+table+` WHERE id = $1 AND deleted_at IS NULL)`, id,
+	).Scan(&exists); err != nil {
+		return err
+	}
+	if !exists {
+		return ErrNotFound
+	}
+	return ErrVersionConflict
+}
+
+// deleteVersioned deletes a row if its version matches; version 0 matches
+// any.
+func (s *SQLStore) deleteVersioned(ctx context.Context, table, id string, version int64) error {
+	objID, err := objectID(id)
+	if err != nil {
+		return err
+	}
+
+	query, args := `DELETE FROM `+table+` WHERE id = $1`, []interface{}{objID.Hex()}
+	if version != 0 {
+		query += ` AND version = $2`
+		args = append(args, version)
+	}
+	err = expectOne(s.DB.ExecContext(ctx, query, args...))
+	if errors.Is(err, ErrNotFound) && version != 0 {
+		var exists bool
+		if err := s.DB.QueryRowContext(ctx,
+			`SELECT EXISTS (SELECT 1 FROM `+table+` WHERE id = $1)`, objID.Hex(),
+		).Scan(&exists); err != nil {
+			return err
+		}
+		if exists {
+			return ErrVersionConflict
+		}
+	}
+	return err
+}
+
+// softDelete moves a live row to the trash if its version matches; version 0
+// matches any.
+func (s *SQLStore) softDelete(ctx context.Context, q sqlExecer, table, id string, version int64, deletedBy string) error {
+	objID, err := objectID(id)
+	if err != nil {
+		return err
+	}
+
+	query := `UPDATE ` + table + ` SET deleted_at = $2, deleted_by = $3, version = version + 1
+		WHERE id = $1 AND deleted_at IS NULL`
+	args := []interface{}{objID.Hex(), time.Now().UTC(), deletedBy}
+	if version != 0 {
+		query += ` AND version = $4`
+		args = append(args, version)
+	}
+	err = expectOne(q.ExecContext(ctx, query, args...))
+	if errors.Is(err, ErrNotFound) {
+		return rowVersionMismatch(ctx, q, table, objID.Hex())
+	}
+	return err
+}
+
+// restore takes a row of the tenant, or of any tenant if tenantID is empty,
+// out of the trash.
+func (s *SQLStore) restore(ctx context.Context, q sqlExecer, table, id, tenantID string) error {
+	objID, err := objectID(id)
+	if err != nil {
+		return err
+	}
+	return s.writeError(expectOne(q.ExecContext(ctx, `UPDATE `+table+`
+		SET deleted_at = NULL, deleted_by = '', version = version + 1
+		WHERE id = $1 AND deleted_at IS NOT NULL AND ($2 = '' OR tenant_id = $2)`, objID.Hex(), tenantID)))
+}
+
+// purge permanently removes rows trashed before the given time.
+func (s *SQLStore) purge(ctx context.Context, table string, before time.Time) (int64, error) {
+	result, err := s.DB.ExecContext(ctx, `DELETE FROM `+table+` WHERE deleted_at < $1`, before.UTC())
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// noRows maps sql.ErrNoRows to ErrNotFound.
+func noRows(err error) error {
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrNotFound
+	}
+	return err
+}
+
+func parseObjectID(hex string) (primitive.ObjectID, error) {
+	return primitive.ObjectIDFromHex(hex)
+}
+
+func nullTime(t time.Time) sql.NullTime {
+	return sql.NullTime{Time: t.UTC(), Valid: !t.IsZero()}
+}
+
+// nullTimePtr converts an optional time to a nullable column.
+func nullTimePtr(t *time.Time) sql.NullTime {
+	if t == nil {
+		return sql.NullTime{}
+	}
+	return nullTime(*t)
+}
+
+// timePtr converts a nullable column to a pointer that is nil for NULL.
+func timePtr(t sql.NullTime) *time.Time {
+	if !t.Valid {
+		return nil
+	}
+	return &t.Time
+}
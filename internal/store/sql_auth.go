@@ -0,0 +1,120 @@
+package store
+
+import (
+	"context"
+	"time"
+
+	"github.com/knakul853/accessmesh/internal/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type sqlMagicLinkRepository struct {
+	s *SQLStore
+}
+
+func (r *sqlMagicLinkRepository) Create(ctx context.Context, link *models.MagicLink) error {
+	// Links are dropped magicLinkRetention after they expire, as the TTL
+	// index of MongoStore does.
+	if _, err := r.s.DB.ExecContext(ctx, `DELETE FROM magic_links WHERE expires_at < $1`,
+		time.Now().Add(-magicLinkRetention).UTC(),
+	); err != nil {
+		return err
+	}
+
+	id := primitive.NewObjectID()
+	if _, err := r.s.DB.ExecContext(ctx, `INSERT INTO magic_links (id, user_id, email, token_hash,
+		nonce_hash, used, expires_at, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`,
+		id.Hex(), link.UserID.Hex(), link.Email, link.TokenHash, link.NonceHash, link.Used,
+		link.ExpiresAt.UTC(), link.CreatedAt.UTC(),
+	); err != nil {
+		return r.s.writeError(err)
+	}
+
+	link.ID = id
+	return nil
+}
+
+func (r *sqlMagicLinkRepository) RecordRequest(ctx context.Context, email string, window time.Time, limit int64) (bool, error) {
+	// Windows are dropped magicLinkRetention after they start, as the TTL
+	// index of MongoStore does.
+	if _, err := r.s.DB.ExecContext(ctx, `DELETE FROM magic_link_limits WHERE window_start < $1`,
+		time.Now().Add(-magicLinkRetention).UTC(),
+	); err != nil {
+		return false, err
+	}
+
+	// The upsert only bumps a count below the limit, so concurrent requests
+	// cannot both take the last one.
+	result, err := r.s.DB.ExecContext(ctx, `INSERT INTO magic_link_limits (email, window_start, requests)
+		VALUES ($1, $2, 1)
+		ON CONFLICT (email, window_start) DO UPDATE SET requests = magic_link_limits.requests + 1
+		WHERE magic_link_limits.requests < $3`, email, window.UTC(), limit)
+	if err != nil {
+		return false, err
+	}
+	counted, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return counted > 0, nil
+}
+
+func (r *sqlMagicLinkRepository) GetActive(ctx context.Context, tokenHash string) (*models.MagicLink, error) {
+	var (
+		link       models.MagicLink
+		id, userID string
+	)
+	err := r.s.DB.QueryRowContext(ctx, `SELECT id, user_id, email, token_hash, nonce_hash, used,
+		expires_at, created_at
+		FROM magic_links
+		WHERE token_hash = $1 AND used = FALSE AND expires_at > $2
+		ORDER BY id LIMIT 1`, tokenHash, time.Now().UTC(),
+	).Scan(&id, &userID, &link.Email, &link.TokenHash, &link.NonceHash, &link.Used,
+		&link.ExpiresAt, &link.CreatedAt)
+	if err != nil {
+		return nil, noRows(err)
+	}
+
+	if link.ID, err = parseObjectID(id); err != nil {
+		return nil, err
+	}
+	if link.UserID, err = parseObjectID(userID); err != nil {
+		return nil, err
+	}
+	return &link, nil
+}
+
+func (r *sqlMagicLinkRepository) Claim(ctx context.Context, id string) error {
+	objID, err := objectID(id)
+	if err != nil {
+		return err
+	}
+
+	// Matching on used = FALSE makes the claim atomic.
+	return expectOne(r.s.DB.ExecContext(ctx,
+		`UPDATE magic_links SET used = TRUE WHERE id = $1 AND used = FALSE`, objID.Hex()))
+}
+
+type sqlAuditRepository struct {
+	s *SQLStore
+}
+
+func (r *sqlAuditRepository) Write(ctx context.Context, entry *models.AuditEntry) error {
+	if entry.CreatedAt.IsZero() {
+		entry.CreatedAt = time.Now()
+	}
+
+	id := primitive.NewObjectID()
+	if _, err := r.s.DB.ExecContext(ctx, `INSERT INTO audit_log (id, event, subject_id, subject_role,
+		actor_id, actor_role, method, path, status, client_ip, reason, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)`,
+		id.Hex(), entry.Event, entry.SubjectID, entry.SubjectRole, entry.ActorID, entry.ActorRole,
+		entry.Method, entry.Path, entry.Status, entry.ClientIP, entry.Reason, entry.CreatedAt.UTC(),
+	); err != nil {
+		return err
+	}
+
+	entry.ID = id
+	return nil
+}
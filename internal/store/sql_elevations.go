@@ -0,0 +1,143 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/knakul853/accessmesh/internal/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const elevationColumns = `e.id, e.tenant_id, e.user_id, e.role, e.hours, e.justification, e.status,
+	e.decided_by, e.decided_at, e.note, e.expires_at, e.ended_at, e.version, e.created_at, e.updated_at`
+
+type sqlElevationRepository struct {
+	s *SQLStore
+}
+
+func (r *sqlElevationRepository) Create(ctx context.Context, elevation *models.Elevation) error {
+	id := primitive.NewObjectID()
+
+	if _, err := r.s.DB.ExecContext(ctx, `INSERT INTO elevations (id, tenant_id, user_id, role, hours,
+		justification, status, decided_by, decided_at, note, expires_at, ended_at, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14)`,
+		id.Hex(), tenantOf(elevation.TenantID), elevation.UserID, elevation.Role, elevation.Hours,
+		elevation.Justification, elevation.Status, elevation.DecidedBy, nullTimePtr(elevation.DecidedAt),
+		elevation.Note, nullTimePtr(elevation.ExpiresAt), nullTimePtr(elevation.EndedAt),
+		elevation.CreatedAt.UTC(), elevation.UpdatedAt.UTC(),
+	); err != nil {
+		return r.s.writeError(err)
+	}
+
+	elevation.ID = id
+	elevation.TenantID = tenantOf(elevation.TenantID)
+	elevation.Version = 1
+	return nil
+}
+
+func (r *sqlElevationRepository) Get(ctx context.Context, id string) (*models.Elevation, error) {
+	objID, err := objectID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	elevation, err := scanElevation(r.s.DB.QueryRowContext(ctx,
+		`SELECT `+elevationColumns+` FROM elevations e WHERE e.id = $1`, objID.Hex()))
+	if err != nil {
+		return nil, noRows(err)
+	}
+	return elevation, nil
+}
+
+func (r *sqlElevationRepository) List(ctx context.Context, query ElevationQuery) (*Page[models.Elevation], error) {
+	var where sqlWhere
+	if query.TenantID != "" {
+		where.add("e.tenant_id = " + where.arg(query.TenantID))
+	}
+	if query.UserID != "" {
+		where.add("e.user_id = " + where.arg(query.UserID))
+	}
+	if query.Role != "" {
+		where.add("e.role = " + where.arg(query.Role))
+	}
+	if query.Status != "" {
+		where.add("e.status = " + where.arg(query.Status))
+	}
+	where.search(query.Search, "e.justification")
+
+	return selectPage(ctx, r.s, sqlList[models.Elevation]{
+		from:    "elevations e",
+		alias:   "e",
+		columns: elevationColumns,
+		fields:  elevationSortFields,
+		scan:    scanElevation,
+		sortKey: elevationSortKey,
+	}, where, query.ListOptions)
+}
+
+func (r *sqlElevationRepository) Update(ctx context.Context, elevation *models.Elevation) error {
+	updatedAt := time.Now()
+
+	err := expectOne(r.s.DB.ExecContext(ctx, `UPDATE elevations SET status = $2, decided_by = $3,
+		decided_at = $4, note = $5, expires_at = $6, ended_at = $7, updated_at = $8, version = version + 1
+		WHERE id = $1 AND version = $9`,
+		elevation.ID.Hex(), elevation.Status, elevation.DecidedBy, nullTimePtr(elevation.DecidedAt),
+		elevation.Note, nullTimePtr(elevation.ExpiresAt), nullTimePtr(elevation.EndedAt), updatedAt.UTC(),
+		elevation.Version,
+	))
+	if errors.Is(err, ErrNotFound) {
+		err = rowVersionMismatch(ctx, r.s.DB, "elevations", elevation.ID.Hex())
+	}
+	if err != nil {
+		return r.s.writeError(err)
+	}
+
+	elevation.Version++
+	elevation.UpdatedAt = updatedAt
+	return nil
+}
+
+func (r *sqlElevationRepository) Expired(ctx context.Context, now time.Time) ([]models.Elevation, error) {
+	rows, err := r.s.DB.QueryContext(ctx, `SELECT `+elevationColumns+` FROM elevations e
+		WHERE e.status = $1 AND e.expires_at <= $2 ORDER BY e.id`, models.ElevationApproved, now.UTC())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var expired []models.Elevation
+	for rows.Next() {
+		elevation, err := scanElevation(rows)
+		if err != nil {
+			return nil, err
+		}
+		expired = append(expired, *elevation)
+	}
+	return expired, rows.Err()
+}
+
+func scanElevation(row scanner) (*models.Elevation, error) {
+	var (
+		elevation models.Elevation
+		id        string
+		decidedAt sql.NullTime
+		expiresAt sql.NullTime
+		endedAt   sql.NullTime
+	)
+	err := row.Scan(&id, &elevation.TenantID, &elevation.UserID, &elevation.Role, &elevation.Hours,
+		&elevation.Justification, &elevation.Status, &elevation.DecidedBy, &decidedAt, &elevation.Note,
+		&expiresAt, &endedAt, &elevation.Version, &elevation.CreatedAt, &elevation.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	if elevation.ID, err = parseObjectID(id); err != nil {
+		return nil, err
+	}
+	elevation.DecidedAt = timePtr(decidedAt)
+	elevation.ExpiresAt = timePtr(expiresAt)
+	elevation.EndedAt = timePtr(endedAt)
+	return &elevation, nil
+}
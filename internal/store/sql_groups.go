@@ -0,0 +1,248 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/knakul853/accessmesh/internal/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const groupColumns = `g.id, g.tenant_id, g.name, g.description, g.version, g.created_at, g.updated_at,
+	g.deleted_at, g.deleted_by`
+
+// Kinds of group_links rows.
+const (
+	groupLinkMember   = "member"
+	groupLinkSubgroup = "subgroup"
+	groupLinkRole     = "role"
+)
+
+type sqlGroupRepository struct {
+	s *SQLStore
+}
+
+func (r *sqlGroupRepository) Create(ctx context.Context, group *models.Group) error {
+	id := primitive.NewObjectID()
+
+	err := r.s.withTx(ctx, func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, `INSERT INTO groups (id, tenant_id, name, description,
+			created_at, updated_at)
+			VALUES ($1, $2, $3, $4, $5, $6)`,
+			id.Hex(), tenantOf(group.TenantID), group.Name, group.Description,
+			group.CreatedAt.UTC(), group.UpdatedAt.UTC(),
+		); err != nil {
+			return err
+		}
+		return insertGroupLinks(ctx, tx, id.Hex(), group)
+	})
+	if err != nil {
+		return r.s.writeError(err)
+	}
+
+	group.ID = id
+	group.TenantID = tenantOf(group.TenantID)
+	group.Version = 1
+	return nil
+}
+
+func (r *sqlGroupRepository) Get(ctx context.Context, id string) (*models.Group, error) {
+	objID, err := objectID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	group, err := scanGroup(r.s.DB.QueryRowContext(ctx,
+		`SELECT `+groupColumns+` FROM groups g WHERE g.id = $1 AND g.deleted_at IS NULL`, objID.Hex()))
+	if err != nil {
+		return nil, noRows(err)
+	}
+
+	links, err := r.links(ctx, group.ID.Hex())
+	if err != nil {
+		return nil, err
+	}
+	setGroupLinks(group, links[group.ID.Hex()])
+	return group, nil
+}
+
+func (r *sqlGroupRepository) List(ctx context.Context, query GroupQuery) (*Page[models.Group], error) {
+	var where sqlWhere
+	if query.TenantID != "" {
+		where.add("g.tenant_id = " + where.arg(query.TenantID))
+	}
+	if query.Name != "" {
+		where.add("g.name = " + where.arg(query.Name))
+	}
+	for _, link := range []groupLink{
+		{groupLinkMember, query.Member},
+		{groupLinkSubgroup, query.Subgroup},
+		{groupLinkRole, query.Role},
+	} {
+		if link.value != "" {
+			where.add(`EXISTS (SELECT 1 FROM group_links l WHERE l.group_id = g.id
+				AND l.kind = ` + where.arg(link.kind) + ` AND l.value = ` + where.arg(link.value) + `)`)
+		}
+	}
+	where.search(query.Search, "g.name", "g.description")
+
+	page, err := selectPage(ctx, r.s, sqlList[models.Group]{
+		from:    "groups g",
+		alias:   "g",
+		columns: groupColumns,
+		fields:  groupSortFields,
+		scan:    scanGroup,
+		sortKey: groupSortKey,
+	}, where, query.ListOptions)
+	if err != nil {
+		return nil, err
+	}
+
+	links, err := r.links(ctx, "")
+	if err != nil {
+		return nil, err
+	}
+	for i := range page.Items {
+		setGroupLinks(&page.Items[i], links[page.Items[i].ID.Hex()])
+	}
+	return page, nil
+}
+
+func (r *sqlGroupRepository) Update(ctx context.Context, group *models.Group) error {
+	updatedAt := time.Now()
+
+	err := r.s.withTx(ctx, func(tx *sql.Tx) error {
+		err := expectOne(tx.ExecContext(ctx, `UPDATE groups SET name = $2, description = $3,
+			created_at = $4, updated_at = $5, tenant_id = $7, version = version + 1
+			WHERE id = $1 AND version = $6 AND deleted_at IS NULL`,
+			group.ID.Hex(), group.Name, group.Description, group.CreatedAt.UTC(), updatedAt.UTC(),
+			group.Version, tenantOf(group.TenantID),
+		))
+		if errors.Is(err, ErrNotFound) {
+			return rowVersionMismatch(ctx, tx, "groups", group.ID.Hex())
+		}
+		if err != nil {
+			return err
+		}
+
+		if _, err := tx.ExecContext(ctx, `DELETE FROM group_links WHERE group_id = $1`, group.ID.Hex()); err != nil {
+			return err
+		}
+		return insertGroupLinks(ctx, tx, group.ID.Hex(), group)
+	})
+	if err != nil {
+		return r.s.writeError(err)
+	}
+
+	group.Version++
+	group.UpdatedAt = updatedAt
+	return nil
+}
+
+func (r *sqlGroupRepository) SoftDelete(ctx context.Context, id string, version int64, deletedBy string) error {
+	return r.s.softDelete(ctx, r.s.DB, "groups", id, version, deletedBy)
+}
+
+func (r *sqlGroupRepository) Restore(ctx context.Context, id, tenantID string) error {
+	return r.s.restore(ctx, r.s.DB, "groups", id, tenantID)
+}
+
+func (r *sqlGroupRepository) Purge(ctx context.Context, before time.Time) (int64, error) {
+	return r.s.purge(ctx, "groups", before)
+}
+
+func (r *sqlGroupRepository) Delete(ctx context.Context, id string, version int64) error {
+	return r.s.deleteVersioned(ctx, "groups", id, version)
+}
+
+// groupLink is a group_links row.
+type groupLink struct {
+	kind, value string
+}
+
+// links returns the links of one group or, when groupID is empty, of all
+// groups, keyed by group ID and in position order.
+func (r *sqlGroupRepository) links(ctx context.Context, groupID string) (map[string][]groupLink, error) {
+	query := `SELECT group_id, kind, value FROM group_links`
+	var args []interface{}
+	if groupID != "" {
+		query += ` WHERE group_id = $1`
+		args = append(args, groupID)
+	}
+	query += ` ORDER BY group_id, position`
+
+	rows, err := r.s.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	links := map[string][]groupLink{}
+	for rows.Next() {
+		var owner string
+		var link groupLink
+		if err := rows.Scan(&owner, &link.kind, &link.value); err != nil {
+			return nil, err
+		}
+		links[owner] = append(links[owner], link)
+	}
+	return links, rows.Err()
+}
+
+func setGroupLinks(group *models.Group, links []groupLink) {
+	group.Members, group.Subgroups, group.Roles = []string{}, []string{}, []string{}
+	for _, link := range links {
+		switch link.kind {
+		case groupLinkMember:
+			group.Members = append(group.Members, link.value)
+		case groupLinkSubgroup:
+			group.Subgroups = append(group.Subgroups, link.value)
+		case groupLinkRole:
+			group.Roles = append(group.Roles, link.value)
+		}
+	}
+}
+
+func insertGroupLinks(ctx context.Context, tx *sql.Tx, groupID string, group *models.Group) error {
+	var links []groupLink
+	for _, member := range group.Members {
+		links = append(links, groupLink{groupLinkMember, member})
+	}
+	for _, subgroup := range group.Subgroups {
+		links = append(links, groupLink{groupLinkSubgroup, subgroup})
+	}
+	for _, role := range group.Roles {
+		links = append(links, groupLink{groupLinkRole, role})
+	}
+
+	for position, link := range links {
+		if _, err := tx.ExecContext(ctx, `INSERT INTO group_links (group_id, kind, value, position)
+			VALUES ($1, $2, $3, $4)`,
+			groupID, link.kind, link.value, position,
+		); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func scanGroup(row scanner) (*models.Group, error) {
+	var (
+		group     models.Group
+		id        string
+		deletedAt sql.NullTime
+	)
+	if err := row.Scan(&id, &group.TenantID, &group.Name, &group.Description, &group.Version,
+		&group.CreatedAt, &group.UpdatedAt, &deletedAt, &group.DeletedBy); err != nil {
+		return nil, err
+	}
+
+	var err error
+	if group.ID, err = parseObjectID(id); err != nil {
+		return nil, err
+	}
+	group.DeletedAt = timePtr(deletedAt)
+	return &group, nil
+}
@@ -0,0 +1,180 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+
+	"github.com/knakul853/accessmesh/internal/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type sqlRevisionRepository struct {
+	s *SQLStore
+}
+
+func (r *sqlRevisionRepository) Append(ctx context.Context, revision *models.Revision) error {
+	return r.s.appendRevision(ctx, r.s.DB, revision)
+}
+
+// appendRevision inserts the revision with q.
+func (s *SQLStore) appendRevision(ctx context.Context, q sqlExecer, revision *models.Revision) error {
+	var document interface{} = revision.Policy
+	if revision.Kind == models.RevisionKindRole {
+		document = revision.Role
+	}
+	data, err := json.Marshal(document)
+	if err != nil {
+		return err
+	}
+
+	id := primitive.NewObjectID()
+	if _, err := q.ExecContext(ctx, `INSERT INTO revisions (id, tenant_id, kind, document_id, version, action,
+		actor, document, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`,
+		id.Hex(), tenantOf(revision.TenantID), revision.Kind, revision.DocumentID, revision.Version, revision.Action,
+		revision.Actor, string(data), revision.CreatedAt.UTC(),
+	); err != nil {
+		return s.writeError(err)
+	}
+
+	revision.ID = id
+	revision.TenantID = tenantOf(revision.TenantID)
+	return nil
+}
+
+// recorded runs write and, if ctx asks for a revision, appends the one
+// revision reads back of the document as write left it. Both then run in a
+// single transaction.
+func (s *SQLStore) recorded(ctx context.Context, write func(q sqlExecer) error,
+	revision func(q rowQuerier) (*models.Revision, error),
+) error {
+	if !recording(ctx) {
+		return write(s.DB)
+	}
+	return s.withTx(ctx, func(tx *sql.Tx) error {
+		if err := write(tx); err != nil {
+			return err
+		}
+		recorded, err := revision(tx)
+		if err != nil {
+			return err
+		}
+		return s.appendRevision(ctx, tx, recorded)
+	})
+}
+
+func (r *sqlRevisionRepository) List(ctx context.Context, kind, documentID string) ([]models.Revision, error) {
+	rows, err := r.s.DB.QueryContext(ctx, `SELECT id, tenant_id, kind, document_id, version, action, actor, document,
+		created_at
+		FROM revisions WHERE kind = $1 AND document_id = $2 ORDER BY version`, kind, documentID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	revisions := []models.Revision{}
+	for rows.Next() {
+		var (
+			revision models.Revision
+			id       string
+			document []byte
+		)
+		if err := rows.Scan(&id, &revision.TenantID, &revision.Kind, &revision.DocumentID, &revision.Version,
+			&revision.Action, &revision.Actor, &document, &revision.CreatedAt); err != nil {
+			return nil, err
+		}
+		if revision.ID, err = parseObjectID(id); err != nil {
+			return nil, err
+		}
+		target := interface{}(&revision.Policy)
+		if revision.Kind == models.RevisionKindRole {
+			target = &revision.Role
+		}
+		if err := json.Unmarshal(document, target); err != nil {
+			return nil, err
+		}
+		revisions = append(revisions, revision)
+	}
+	return revisions, rows.Err()
+}
+
+type sqlSnapshotRepository struct {
+	s *SQLStore
+}
+
+const snapshotColumns = `id, tenant_id, description, policies, created_by, created_at`
+
+func (r *sqlSnapshotRepository) Create(ctx context.Context, snapshot *models.PolicySnapshot) error {
+	policies, err := json.Marshal(snapshot.Policies)
+	if err != nil {
+		return err
+	}
+
+	id := primitive.NewObjectID()
+	if _, err := r.s.DB.ExecContext(ctx, `INSERT INTO policy_snapshots (`+snapshotColumns+`)
+		VALUES ($1, $2, $3, $4, $5, $6)`,
+		id.Hex(), tenantOf(snapshot.TenantID), snapshot.Description, string(policies), snapshot.CreatedBy,
+		snapshot.CreatedAt.UTC(),
+	); err != nil {
+		return r.s.writeError(err)
+	}
+
+	snapshot.ID = id
+	snapshot.TenantID = tenantOf(snapshot.TenantID)
+	return nil
+}
+
+func (r *sqlSnapshotRepository) Get(ctx context.Context, id string) (*models.PolicySnapshot, error) {
+	objID, err := objectID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	snapshot, err := scanSnapshot(r.s.DB.QueryRowContext(ctx,
+		`SELECT `+snapshotColumns+` FROM policy_snapshots WHERE id = $1`, objID.Hex()))
+	if err != nil {
+		return nil, noRows(err)
+	}
+	return snapshot, nil
+}
+
+func (r *sqlSnapshotRepository) List(ctx context.Context, tenantID string) ([]models.PolicySnapshot, error) {
+	rows, err := r.s.DB.QueryContext(ctx, `SELECT `+snapshotColumns+` FROM policy_snapshots
+		WHERE tenant_id = $1 ORDER BY created_at DESC, id DESC`, tenantOf(tenantID))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	snapshots := []models.PolicySnapshot{}
+	for rows.Next() {
+		snapshot, err := scanSnapshot(rows)
+		if err != nil {
+			return nil, err
+		}
+		snapshots = append(snapshots, *snapshot)
+	}
+	return snapshots, rows.Err()
+}
+
+func scanSnapshot(row scanner) (*models.PolicySnapshot, error) {
+	var (
+		snapshot models.PolicySnapshot
+		id       string
+		policies []byte
+	)
+	if err := row.Scan(&id, &snapshot.TenantID, &snapshot.Description, &policies, &snapshot.CreatedBy,
+		&snapshot.CreatedAt); err != nil {
+		return nil, err
+	}
+
+	var err error
+	if snapshot.ID, err = parseObjectID(id); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(policies, &snapshot.Policies); err != nil {
+		return nil, err
+	}
+	return &snapshot, nil
+}
@@ -0,0 +1,158 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// sqlWhere accumulates AND-ed conditions with numbered placeholders.
+type sqlWhere struct {
+	clauses []string
+	args    []interface{}
+}
+
+// arg binds v and returns its placeholder.
+func (w *sqlWhere) arg(v interface{}) string {
+	w.args = append(w.args, v)
+	return fmt.Sprintf("$%d", len(w.args))
+}
+
+func (w *sqlWhere) add(clause string) {
+	w.clauses = append(w.clauses, clause)
+}
+
+// search matches a case-insensitive substring of any of columns.
+func (w *sqlWhere) search(search string, columns ...string) {
+	if search == "" {
+		return
+	}
+
+	escaped := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(strings.ToLower(search))
+	pattern := w.arg("%" + escaped + "%")
+	var or []string
+	for _, column := range columns {
+		or = append(or, fmt.Sprintf(`LOWER(%s) LIKE %s ESCAPE '\'`, column, pattern))
+	}
+	w.add("(" + strings.Join(or, " OR ") + ")")
+}
+
+// in matches column against any of values, which must not be empty.
+func (w *sqlWhere) in(column string, values []string) {
+	placeholders := make([]string, len(values))
+	for i, value := range values {
+		placeholders[i] = w.arg(value)
+	}
+	w.add(column + " IN (" + strings.Join(placeholders, ", ") + ")")
+}
+
+func (w *sqlWhere) String() string {
+	if len(w.clauses) == 0 {
+		return ""
+	}
+	return " WHERE " + strings.Join(w.clauses, " AND ")
+}
+
+func (w sqlWhere) clone() sqlWhere {
+	return sqlWhere{
+		clauses: append([]string(nil), w.clauses...),
+		args:    append([]interface{}(nil), w.args...),
+	}
+}
+
+// sqlList describes a table for selectPage.
+type sqlList[T any] struct {
+	// from is the FROM clause; alias prefixes column names when set.
+	from    string
+	alias   string
+	columns string
+	fields  map[string]string
+	scan    func(scanner) (*T, error)
+	sortKey func(row T, field string) (string, string)
+}
+
+func (l sqlList[T]) column(name string) string {
+	if l.alias == "" {
+		return name
+	}
+	return l.alias + "." + name
+}
+
+// selectPage runs a sorted, paged query over live or, with opts.Deleted,
+// trashed rows. where selects the matches counted in Page.Total; the cursor
+// condition is added on top of it.
+func selectPage[T any](ctx context.Context, s *SQLStore, l sqlList[T], where sqlWhere, opts ListOptions) (*Page[T], error) {
+	spec, err := parseSort(opts.Sort, l.fields)
+	if err != nil {
+		return nil, err
+	}
+	after, err := decodeCursor(opts.After)
+	if err != nil {
+		return nil, err
+	}
+
+	where = where.clone()
+	if opts.Deleted {
+		where.add(l.column("deleted_at") + " IS NOT NULL")
+	} else {
+		where.add(l.column("deleted_at") + " IS NULL")
+	}
+
+	page := &Page[T]{Items: []T{}}
+	if err := s.DB.QueryRowContext(ctx,
+		`SELECT COUNT(*) FROM `+l.from+where.String(), where.args...,
+	).Scan(&page.Total); err != nil {
+		return nil, err
+	}
+
+	dir, cmp := "ASC", ">"
+	if spec.Desc {
+		dir, cmp = "DESC", "<"
+	}
+	idColumn := l.column("id")
+	order := idColumn + " " + dir
+	if spec.Field != "" {
+		order = l.column(spec.Field) + " " + dir + ", " + order
+	}
+
+	query := where.clone()
+	if after != nil {
+		if spec.Field == "" {
+			query.add(fmt.Sprintf("%s %s %s", idColumn, cmp, query.arg(after.ID)))
+		} else {
+			field := l.column(spec.Field)
+			value := query.arg(after.Value)
+			query.add(fmt.Sprintf("(%s %s %s OR (%s = %s AND %s %s %s))",
+				field, cmp, value, field, value, idColumn, cmp, query.arg(after.ID)))
+		}
+	}
+
+	statement := `SELECT ` + l.columns + ` FROM ` + l.from + query.String() + ` ORDER BY ` + order
+	if opts.Limit > 0 {
+		// Fetch one extra row to learn whether another page follows.
+		statement += fmt.Sprintf(" LIMIT %d", opts.Limit+1)
+	}
+
+	rows, err := s.DB.QueryContext(ctx, statement, query.args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		item, err := l.scan(rows)
+		if err != nil {
+			return nil, err
+		}
+		page.Items = append(page.Items, *item)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if opts.Limit > 0 && len(page.Items) > opts.Limit {
+		page.Items = page.Items[:opts.Limit]
+		page.NextCursor = encodeCursor(l.sortKey(page.Items[opts.Limit-1], spec.Field))
+	}
+	return page, nil
+}
@@ -0,0 +1,72 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io/fs"
+	"log"
+	"sort"
+	"time"
+)
+
+// migrateSQL applies the *.sql files in dir, in lexical order, that are not yet
+// recorded in schema_migrations. Each file runs in its own transaction.
+func migrateSQL(ctx context.Context, db *sql.DB, migrations fs.FS, dir string) error {
+	if _, err := db.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version    TEXT PRIMARY KEY,
+		applied_at TIMESTAMP NOT NULL
+	)`); err != nil {
+		return fmt.Errorf("create schema_migrations: %w", err)
+	}
+
+	files, err := fs.Glob(migrations, dir+"/*.sql")
+	if err != nil {
+		return err
+	}
+	sort.Strings(files)
+
+	for _, file := range files {
+		version := file[len(dir)+1:]
+
+		var applied int
+		if err := db.QueryRowContext(ctx,
+			`SELECT COUNT(*) FROM schema_migrations WHERE version = $1`, version,
+		).Scan(&applied); err != nil {
+			return err
+		}
+		if applied > 0 {
+			continue
+		}
+
+		script, err := fs.ReadFile(migrations, file)
+		if err != nil {
+			return err
+		}
+
+		log.Printf("Applying migration %s...", version)
+		if err := applyMigration(ctx, db, version, string(script)); err != nil {
+			return fmt.Errorf("migration %s: %w", version, err)
+		}
+	}
+	return nil
+}
+
+func applyMigration(ctx context.Context, db *sql.DB, version, script string) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, script); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx,
+		`INSERT INTO schema_migrations (version, applied_at) VALUES ($1, $2)`,
+		version, time.Now().UTC(),
+	); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
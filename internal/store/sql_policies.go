@@ -0,0 +1,252 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/knakul853/accessmesh/internal/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const policyColumns = `id, tenant_id, role, group_id, resource, action, conditions, version, created_at, updated_at,
+	deleted_at, deleted_by`
+
+type sqlPolicyRepository struct {
+	s *SQLStore
+}
+
+func (r *sqlPolicyRepository) Create(ctx context.Context, policy *models.Policy) error {
+	conditions, err := json.Marshal(policy.Conditions)
+	if err != nil {
+		return err
+	}
+
+	id := primitive.NewObjectID()
+	if err := r.s.recorded(ctx, func(q sqlExecer) error {
+		_, err := q.ExecContext(ctx, `INSERT INTO policies (id, tenant_id, role, group_id, resource, action,
+			conditions, created_at, updated_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`,
+			id.Hex(), tenantOf(policy.TenantID), policy.Role, policy.Group, policy.Resource, policy.Action,
+			string(conditions), policy.CreatedAt.UTC(), policy.UpdatedAt.UTC(),
+		)
+		return err
+	}, r.revision(ctx, id.Hex())); err != nil {
+		return r.s.writeError(err)
+	}
+
+	policy.ID = id
+	policy.TenantID = tenantOf(policy.TenantID)
+	policy.Version = 1
+	return nil
+}
+
+func (r *sqlPolicyRepository) Get(ctx context.Context, id string) (*models.Policy, error) {
+	objID, err := objectID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	policy, err := scanPolicy(r.s.DB.QueryRowContext(ctx,
+		`SELECT `+policyColumns+` FROM policies WHERE id = $1 AND deleted_at IS NULL`, objID.Hex()))
+	if err != nil {
+		return nil, noRows(err)
+	}
+	return policy, nil
+}
+
+func (r *sqlPolicyRepository) List(ctx context.Context, query PolicyQuery) (*Page[models.Policy], error) {
+	var where sqlWhere
+	if query.TenantID != "" {
+		where.add("tenant_id = " + where.arg(query.TenantID))
+	}
+	if query.Role != "" {
+		where.add("role = " + where.arg(query.Role))
+	}
+	if query.Group != "" {
+		where.add("group_id = " + where.arg(query.Group))
+	}
+	if query.Resource != "" {
+		where.add("resource = " + where.arg(query.Resource))
+	}
+	if query.Action != "" {
+		where.add("action = " + where.arg(query.Action))
+	}
+	where.search(query.Search, "role", "resource")
+
+	return selectPage(ctx, r.s, sqlList[models.Policy]{
+		from:    "policies",
+		columns: policyColumns,
+		fields:  policySortFields,
+		scan:    scanPolicy,
+		sortKey: policySortKey,
+	}, where, query.ListOptions)
+}
+
+func (r *sqlPolicyRepository) Update(ctx context.Context, policy *models.Policy) error {
+	conditions, err := json.Marshal(policy.Conditions)
+	if err != nil {
+		return err
+	}
+
+	updatedAt := time.Now()
+	err = r.s.recorded(ctx, func(q sqlExecer) error {
+		err := expectOne(q.ExecContext(ctx, `UPDATE policies
+			SET role = $2, resource = $3, action = $4, conditions = $5, created_at = $6, updated_at = $7,
+				tenant_id = $9, group_id = $10, version = version + 1
+			WHERE id = $1 AND version = $8 AND deleted_at IS NULL`,
+			policy.ID.Hex(), policy.Role, policy.Resource, policy.Action, string(conditions),
+			policy.CreatedAt.UTC(), updatedAt.UTC(), policy.Version, tenantOf(policy.TenantID),
+			policy.Group,
+		))
+		if errors.Is(err, ErrNotFound) {
+			err = rowVersionMismatch(ctx, q, "policies", policy.ID.Hex())
+		}
+		return err
+	}, r.revision(ctx, policy.ID.Hex()))
+	if err != nil {
+		return r.s.writeError(err)
+	}
+
+	policy.Version++
+	policy.UpdatedAt = updatedAt
+	return nil
+}
+
+func (r *sqlPolicyRepository) SoftDelete(ctx context.Context, id string, version int64, deletedBy string) error {
+	objID, err := objectID(id)
+	if err != nil {
+		return err
+	}
+	return r.s.recorded(ctx, func(q sqlExecer) error {
+		return r.s.softDelete(ctx, q, "policies", id, version, deletedBy)
+	}, r.revision(ctx, objID.Hex()))
+}
+
+func (r *sqlPolicyRepository) Restore(ctx context.Context, id, tenantID string) error {
+	objID, err := objectID(id)
+	if err != nil {
+		return err
+	}
+	return r.s.recorded(ctx, func(q sqlExecer) error {
+		return r.s.restore(ctx, q, "policies", id, tenantID)
+	}, r.revision(ctx, objID.Hex()))
+}
+
+// revision reads back the policy with the given ID to record its revision.
+func (r *sqlPolicyRepository) revision(ctx context.Context, id string) func(q rowQuerier) (*models.Revision, error) {
+	return func(q rowQuerier) (*models.Revision, error) {
+		policy, err := scanPolicy(q.QueryRowContext(ctx, `SELECT `+policyColumns+` FROM policies WHERE id = $1`, id))
+		if err != nil {
+			return nil, err
+		}
+		return policyRevision(ctx, *policy), nil
+	}
+}
+
+func (r *sqlPolicyRepository) Purge(ctx context.Context, before time.Time) (int64, error) {
+	return r.s.purge(ctx, "policies", before)
+}
+
+func (r *sqlPolicyRepository) Delete(ctx context.Context, id string, version int64) error {
+	return r.s.deleteVersioned(ctx, "policies", id, version)
+}
+
+func (r *sqlPolicyRepository) ReplaceAll(ctx context.Context, tenantID string, policies []models.Policy, deletedBy string) ([]PolicyChange, error) {
+	tenantID = tenantOf(tenantID)
+
+	var changes []PolicyChange
+	err := r.s.withTx(ctx, func(tx *sql.Tx) error {
+		rows, err := tx.QueryContext(ctx, `SELECT `+policyColumns+` FROM policies WHERE tenant_id = $1`, tenantID)
+		if err != nil {
+			return err
+		}
+		var stored []models.Policy
+		for rows.Next() {
+			policy, err := scanPolicy(rows)
+			if err != nil {
+				rows.Close()
+				return err
+			}
+			stored = append(stored, *policy)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		changes = planReplaceAll(tenantID, stored, policies, deletedBy, time.Now())
+		for _, change := range changes {
+			after := change.After
+			conditions, err := json.Marshal(after.Conditions)
+			if err != nil {
+				return err
+			}
+			var deletedAt interface{}
+			if after.DeletedAt != nil {
+				deletedAt = after.DeletedAt.UTC()
+			}
+
+			if change.Before == nil {
+				_, err = tx.ExecContext(ctx, `INSERT INTO policies (`+policyColumns+`)
+					VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)`,
+					after.ID.Hex(), tenantID, after.Role, after.Group, after.Resource, after.Action, string(conditions),
+					after.Version, after.CreatedAt.UTC(), after.UpdatedAt.UTC(), deletedAt, after.DeletedBy,
+				)
+				if err != nil {
+					return r.s.writeError(err)
+				}
+				continue
+			}
+			if err := expectOne(tx.ExecContext(ctx, `UPDATE policies
+				SET role = $3, group_id = $4, resource = $5, action = $6, conditions = $7, version = $8,
+					updated_at = $9, deleted_at = $10, deleted_by = $11
+				WHERE id = $1 AND version = $2`,
+				after.ID.Hex(), change.Before.Version, after.Role, after.Group, after.Resource, after.Action,
+				string(conditions), after.Version, after.UpdatedAt.UTC(), deletedAt, after.DeletedBy,
+			)); err != nil {
+				if errors.Is(err, ErrNotFound) {
+					return ErrVersionConflict
+				}
+				return err
+			}
+		}
+		for _, change := range changes {
+			if revision := policyRevision(ctx, *change.After); revision != nil {
+				if err := r.s.appendRevision(ctx, tx, revision); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return changes, nil
+}
+
+func scanPolicy(row scanner) (*models.Policy, error) {
+	var (
+		policy     models.Policy
+		id         string
+		conditions []byte
+		deletedAt  sql.NullTime
+	)
+	if err := row.Scan(&id, &policy.TenantID, &policy.Role, &policy.Group, &policy.Resource, &policy.Action, &conditions,
+		&policy.Version, &policy.CreatedAt, &policy.UpdatedAt, &deletedAt, &policy.DeletedBy); err != nil {
+		return nil, err
+	}
+
+	var err error
+	if policy.ID, err = parseObjectID(id); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(conditions, &policy.Conditions); err != nil {
+		return nil, err
+	}
+	policy.DeletedAt = timePtr(deletedAt)
+	return &policy, nil
+}
@@ -0,0 +1,169 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/knakul853/accessmesh/internal/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const roleColumns = `id, tenant_id, name, description, permissions, version, deleted_at, deleted_by`
+
+type sqlRoleRepository struct {
+	s *SQLStore
+}
+
+func (r *sqlRoleRepository) Create(ctx context.Context, role *models.Role) error {
+	permissions, err := json.Marshal(stringList(role.Permissions))
+	if err != nil {
+		return err
+	}
+
+	id := primitive.NewObjectID()
+	if err := r.s.recorded(ctx, func(q sqlExecer) error {
+		_, err := q.ExecContext(ctx, `INSERT INTO roles (id, tenant_id, name, description, permissions)
+			VALUES ($1, $2, $3, $4, $5)`,
+			id.Hex(), tenantOf(role.TenantID), role.Name, role.Description, string(permissions),
+		)
+		return err
+	}, r.revision(ctx, id.Hex())); err != nil {
+		return r.s.writeError(err)
+	}
+
+	role.ID = id
+	role.TenantID = tenantOf(role.TenantID)
+	role.Version = 1
+	return nil
+}
+
+func (r *sqlRoleRepository) Get(ctx context.Context, id string) (*models.Role, error) {
+	objID, err := objectID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	role, err := scanRole(r.s.DB.QueryRowContext(ctx,
+		`SELECT `+roleColumns+` FROM roles WHERE id = $1 AND deleted_at IS NULL`, objID.Hex()))
+	if err != nil {
+		return nil, noRows(err)
+	}
+	return role, nil
+}
+
+func (r *sqlRoleRepository) List(ctx context.Context, query RoleQuery) (*Page[models.Role], error) {
+	var where sqlWhere
+	if query.TenantID != "" {
+		where.add("tenant_id = " + where.arg(query.TenantID))
+	}
+	if query.Name != "" {
+		where.add("name = " + where.arg(query.Name))
+	}
+	where.search(query.Search, "name", "description")
+
+	return selectPage(ctx, r.s, sqlList[models.Role]{
+		from:    "roles",
+		columns: roleColumns,
+		fields:  roleSortFields,
+		scan:    scanRole,
+		sortKey: roleSortKey,
+	}, where, query.ListOptions)
+}
+
+func (r *sqlRoleRepository) Update(ctx context.Context, role *models.Role) error {
+	permissions, err := json.Marshal(stringList(role.Permissions))
+	if err != nil {
+		return err
+	}
+
+	err = r.s.recorded(ctx, func(q sqlExecer) error {
+		err := expectOne(q.ExecContext(ctx, `UPDATE roles
+			SET name = $2, description = $3, permissions = $4, tenant_id = $6, version = version + 1
+			WHERE id = $1 AND version = $5 AND deleted_at IS NULL`,
+			role.ID.Hex(), role.Name, role.Description, string(permissions), role.Version, tenantOf(role.TenantID),
+		))
+		if errors.Is(err, ErrNotFound) {
+			err = rowVersionMismatch(ctx, q, "roles", role.ID.Hex())
+		}
+		return err
+	}, r.revision(ctx, role.ID.Hex()))
+	if err != nil {
+		return r.s.writeError(err)
+	}
+
+	role.Version++
+	return nil
+}
+
+func (r *sqlRoleRepository) SoftDelete(ctx context.Context, id string, version int64, deletedBy string) error {
+	objID, err := objectID(id)
+	if err != nil {
+		return err
+	}
+	return r.s.recorded(ctx, func(q sqlExecer) error {
+		return r.s.softDelete(ctx, q, "roles", id, version, deletedBy)
+	}, r.revision(ctx, objID.Hex()))
+}
+
+func (r *sqlRoleRepository) Restore(ctx context.Context, id, tenantID string) error {
+	objID, err := objectID(id)
+	if err != nil {
+		return err
+	}
+	return r.s.recorded(ctx, func(q sqlExecer) error {
+		return r.s.restore(ctx, q, "roles", id, tenantID)
+	}, r.revision(ctx, objID.Hex()))
+}
+
+// revision reads back the role with the given ID to record its revision.
+func (r *sqlRoleRepository) revision(ctx context.Context, id string) func(q rowQuerier) (*models.Revision, error) {
+	return func(q rowQuerier) (*models.Revision, error) {
+		role, err := scanRole(q.QueryRowContext(ctx, `SELECT `+roleColumns+` FROM roles WHERE id = $1`, id))
+		if err != nil {
+			return nil, err
+		}
+		return roleRevision(ctx, *role), nil
+	}
+}
+
+func (r *sqlRoleRepository) Purge(ctx context.Context, before time.Time) (int64, error) {
+	return r.s.purge(ctx, "roles", before)
+}
+
+func (r *sqlRoleRepository) Delete(ctx context.Context, id string, version int64) error {
+	return r.s.deleteVersioned(ctx, "roles", id, version)
+}
+
+func scanRole(row scanner) (*models.Role, error) {
+	var (
+		role        models.Role
+		id          string
+		permissions []byte
+		deletedAt   sql.NullTime
+	)
+	if err := row.Scan(&id, &role.TenantID, &role.Name, &role.Description, &permissions, &role.Version,
+		&deletedAt, &role.DeletedBy); err != nil {
+		return nil, err
+	}
+
+	var err error
+	if role.ID, err = parseObjectID(id); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(permissions, &role.Permissions); err != nil {
+		return nil, err
+	}
+	role.DeletedAt = timePtr(deletedAt)
+	return &role, nil
+}
+
+// stringList encodes nil as an empty JSON array rather than null.
+func stringList(items []string) []string {
+	if items == nil {
+		return []string{}
+	}
+	return items
+}
@@ -0,0 +1,45 @@
+package store
+
+import (
+	"context"
+
+	"github.com/knakul853/accessmesh/internal/models"
+)
+
+type sqlTenantRepository struct {
+	s *SQLStore
+}
+
+func (r *sqlTenantRepository) Create(ctx context.Context, tenant *models.Tenant) error {
+	_, err := r.s.DB.ExecContext(ctx, `INSERT INTO tenants (id, name, created_at) VALUES ($1, $2, $3)`,
+		tenant.ID, tenant.Name, tenant.CreatedAt.UTC())
+	return r.s.writeError(err)
+}
+
+func (r *sqlTenantRepository) Get(ctx context.Context, id string) (*models.Tenant, error) {
+	var tenant models.Tenant
+	err := r.s.DB.QueryRowContext(ctx, `SELECT id, name, created_at FROM tenants WHERE id = $1`, id).
+		Scan(&tenant.ID, &tenant.Name, &tenant.CreatedAt)
+	if err != nil {
+		return nil, noRows(err)
+	}
+	return &tenant, nil
+}
+
+func (r *sqlTenantRepository) List(ctx context.Context) ([]models.Tenant, error) {
+	rows, err := r.s.DB.QueryContext(ctx, `SELECT id, name, created_at FROM tenants ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tenants := []models.Tenant{}
+	for rows.Next() {
+		var tenant models.Tenant
+		if err := rows.Scan(&tenant.ID, &tenant.Name, &tenant.CreatedAt); err != nil {
+			return nil, err
+		}
+		tenants = append(tenants, tenant)
+	}
+	return tenants, rows.Err()
+}
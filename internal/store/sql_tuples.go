@@ -0,0 +1,103 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/knakul853/accessmesh/internal/models"
+)
+
+const tupleColumns = `tenant_id, object_type, object_id, relation, subject_type, subject_id, subject_relation,
+	created_rev, deleted_rev`
+
+type sqlTupleRepository struct {
+	s *SQLStore
+}
+
+func (r *sqlTupleRepository) Write(ctx context.Context, tenantID string, inserts, deletes []models.RelationTuple) (int64, error) {
+	tenantID = tenantOf(tenantID)
+
+	var revision int64
+	err := r.s.withTx(ctx, func(tx *sql.Tx) error {
+		// Bumping the tenant's revision locks its row until commit, so
+		// revisions are committed in order.
+		if err := tx.QueryRowContext(ctx, `INSERT INTO tuple_revisions (tenant_id, revision) VALUES ($1, 1)
+			ON CONFLICT (tenant_id) DO UPDATE SET revision = tuple_revisions.revision + 1
+			RETURNING revision`, tenantID).Scan(&revision); err != nil {
+			return err
+		}
+
+		for _, t := range deletes {
+			if _, err := tx.ExecContext(ctx, `UPDATE relation_tuples SET deleted_rev = $1
+				WHERE tenant_id = $2 AND object_type = $3 AND object_id = $4 AND relation = $5
+				AND subject_type = $6 AND subject_id = $7 AND subject_relation = $8 AND deleted_rev = 0`,
+				revision, tenantID, t.ObjectType, t.ObjectID, t.Relation, t.SubjectType, t.SubjectID, t.SubjectRelation,
+			); err != nil {
+				return err
+			}
+		}
+		for _, t := range inserts {
+			if _, err := tx.ExecContext(ctx, `INSERT INTO relation_tuples (`+tupleColumns+`)
+				VALUES ($1, $2, $3, $4, $5, $6, $7, $8, 0) ON CONFLICT DO NOTHING`,
+				tenantID, t.ObjectType, t.ObjectID, t.Relation, t.SubjectType, t.SubjectID, t.SubjectRelation, revision,
+			); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return revision, nil
+}
+
+func (r *sqlTupleRepository) Read(ctx context.Context, filter TupleFilter, revision int64) ([]models.RelationTuple, error) {
+	var where sqlWhere
+	where.add("tenant_id = " + where.arg(tenantOf(filter.TenantID)))
+	where.add("created_rev <= " + where.arg(revision))
+	where.add("(deleted_rev = 0 OR deleted_rev > " + where.arg(revision) + ")")
+	for column, value := range map[string]string{
+		"object_type": filter.ObjectType,
+		"object_id":   filter.ObjectID,
+		"relation":    filter.Relation,
+	} {
+		if value != "" {
+			where.add(column + " = " + where.arg(value))
+		}
+	}
+	if filter.SubjectType != "" {
+		where.add("subject_type = " + where.arg(filter.SubjectType))
+		where.add("subject_id = " + where.arg(filter.SubjectID))
+		where.add("subject_relation = " + where.arg(filter.SubjectRelation))
+	}
+
+	rows, err := r.s.DB.QueryContext(ctx, `SELECT `+tupleColumns+` FROM relation_tuples`+where.String()+`
+		ORDER BY object_type, object_id, relation, subject_type, subject_id, subject_relation`, where.args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tuples []models.RelationTuple
+	for rows.Next() {
+		var t models.RelationTuple
+		if err := rows.Scan(&t.TenantID, &t.ObjectType, &t.ObjectID, &t.Relation, &t.SubjectType, &t.SubjectID,
+			&t.SubjectRelation, &t.CreatedRevision, &t.DeletedRevision); err != nil {
+			return nil, err
+		}
+		tuples = append(tuples, t)
+	}
+	return tuples, rows.Err()
+}
+
+func (r *sqlTupleRepository) Revision(ctx context.Context, tenantID string) (int64, error) {
+	var revision int64
+	err := r.s.DB.QueryRowContext(ctx, `SELECT revision FROM tuple_revisions WHERE tenant_id = $1`,
+		tenantOf(tenantID)).Scan(&revision)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, nil
+	}
+	return revision, err
+}
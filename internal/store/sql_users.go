@@ -0,0 +1,331 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/knakul853/accessmesh/internal/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const userColumns = `u.id, u.tenant_id, u.username, u.password, u.email, u.email_verified,
+	u.verification_token, u.reset_token, u.reset_token_expiry, u.auth_source, u.attributes,
+	u.version, u.created_at, u.updated_at, u.deleted_at, u.deleted_by`
+
+type sqlUserRepository struct {
+	s *SQLStore
+}
+
+func (r *sqlUserRepository) Create(ctx context.Context, user *models.User) error {
+	id := primitive.NewObjectID()
+	attributes, err := marshalAttributes(user.Attributes)
+	if err != nil {
+		return err
+	}
+
+	err = r.s.withTx(ctx, func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, `INSERT INTO users (id, tenant_id, username, password, email,
+			email_verified, verification_token, reset_token, reset_token_expiry, auth_source,
+			attributes, created_at, updated_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)`,
+			id.Hex(), tenantOf(user.TenantID), user.Username, user.Password, user.Email,
+			user.EmailVerified, user.VerificationToken, user.ResetToken, nullTime(user.ResetTokenExpiry),
+			user.AuthSource, attributes, user.CreatedAt.UTC(), user.UpdatedAt.UTC(),
+		); err != nil {
+			return err
+		}
+		if err := insertRoles(ctx, tx, id.Hex(), user.Roles); err != nil {
+			return err
+		}
+		return insertIdentities(ctx, tx, id.Hex(), user.Identities)
+	})
+	if err != nil {
+		return r.s.writeError(err)
+	}
+
+	user.ID = id
+	user.TenantID = tenantOf(user.TenantID)
+	user.Version = 1
+	return nil
+}
+
+func (r *sqlUserRepository) Get(ctx context.Context, id string) (*models.User, error) {
+	objID, err := objectID(id)
+	if err != nil {
+		return nil, err
+	}
+	return r.findOne(ctx, `WHERE u.id = $1 AND u.deleted_at IS NULL`, objID.Hex())
+}
+
+func (r *sqlUserRepository) GetByUsername(ctx context.Context, username string) (*models.User, error) {
+	return r.findOne(ctx, `WHERE u.username = $1 AND u.deleted_at IS NULL`, username)
+}
+
+func (r *sqlUserRepository) GetByEmail(ctx context.Context, email string) (*models.User, error) {
+	return r.findOne(ctx, `WHERE u.email = $1 AND u.deleted_at IS NULL ORDER BY u.id LIMIT 1`, email)
+}
+
+func (r *sqlUserRepository) GetByIdentity(ctx context.Context, provider, subject string) (*models.User, error) {
+	return r.findOne(ctx, `JOIN user_identities i ON i.user_id = u.id
+		WHERE i.provider = $1 AND i.subject = $2 AND u.deleted_at IS NULL`, provider, subject)
+}
+
+func (r *sqlUserRepository) GetByResetToken(ctx context.Context, token string) (*models.User, error) {
+	return r.findOne(ctx, `WHERE u.reset_token = $1 AND u.reset_token_expiry > $2
+		AND u.deleted_at IS NULL ORDER BY u.id LIMIT 1`, token, time.Now().UTC())
+}
+
+func (r *sqlUserRepository) List(ctx context.Context, query UserQuery) (*Page[models.User], error) {
+	var where sqlWhere
+	if query.TenantID != "" {
+		where.add("u.tenant_id = " + where.arg(query.TenantID))
+	}
+	if query.Role != "" {
+		where.add("EXISTS (SELECT 1 FROM user_roles r WHERE r.user_id = u.id AND r.role = " + where.arg(query.Role) + ")")
+	}
+	if query.EmailVerified != nil {
+		where.add("u.email_verified = " + where.arg(*query.EmailVerified))
+	}
+	where.search(query.Search, "u.username", "u.email")
+
+	page, err := selectPage(ctx, r.s, sqlList[models.User]{
+		from:    "users u",
+		alias:   "u",
+		columns: userColumns,
+		fields:  userSortFields,
+		scan:    scanUser,
+		sortKey: userSortKey,
+	}, where, query.ListOptions)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(page.Items) == 0 {
+		return page, nil
+	}
+	ids := make([]string, len(page.Items))
+	for i := range page.Items {
+		ids[i] = page.Items[i].ID.Hex()
+	}
+	roles, err := r.roles(ctx, ids...)
+	if err != nil {
+		return nil, err
+	}
+	identities, err := r.identities(ctx, ids...)
+	if err != nil {
+		return nil, err
+	}
+	for i := range page.Items {
+		page.Items[i].Roles = roles[page.Items[i].ID.Hex()]
+		page.Items[i].Identities = identities[page.Items[i].ID.Hex()]
+	}
+	return page, nil
+}
+
+func (r *sqlUserRepository) Update(ctx context.Context, user *models.User) error {
+	updatedAt := time.Now()
+	attributes, err := marshalAttributes(user.Attributes)
+	if err != nil {
+		return err
+	}
+
+	err = r.s.withTx(ctx, func(tx *sql.Tx) error {
+		err := expectOne(tx.ExecContext(ctx, `UPDATE users SET username = $2, password = $3,
+			email = $4, email_verified = $5, verification_token = $6,
+			reset_token = $7, reset_token_expiry = $8, auth_source = $9,
+			created_at = $10, updated_at = $11, tenant_id = $13, attributes = $14, version = version + 1
+			WHERE id = $1 AND version = $12 AND deleted_at IS NULL`,
+			user.ID.Hex(), user.Username, user.Password, user.Email,
+			user.EmailVerified, user.VerificationToken, user.ResetToken, nullTime(user.ResetTokenExpiry),
+			user.AuthSource, user.CreatedAt.UTC(), updatedAt.UTC(), user.Version, tenantOf(user.TenantID), attributes,
+		))
+		if errors.Is(err, ErrNotFound) {
+			return rowVersionMismatch(ctx, tx, "users", user.ID.Hex())
+		}
+		if err != nil {
+			return err
+		}
+
+		if _, err := tx.ExecContext(ctx, `DELETE FROM user_roles WHERE user_id = $1`, user.ID.Hex()); err != nil {
+			return err
+		}
+		if err := insertRoles(ctx, tx, user.ID.Hex(), user.Roles); err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, `DELETE FROM user_identities WHERE user_id = $1`, user.ID.Hex()); err != nil {
+			return err
+		}
+		return insertIdentities(ctx, tx, user.ID.Hex(), user.Identities)
+	})
+	if err != nil {
+		return r.s.writeError(err)
+	}
+
+	user.Version++
+	user.UpdatedAt = updatedAt
+	return nil
+}
+
+func (r *sqlUserRepository) VerifyEmail(ctx context.Context, token string) error {
+	if token == "" {
+		return ErrNotFound
+	}
+
+	return expectOne(r.s.DB.ExecContext(ctx, `UPDATE users
+		SET email_verified = TRUE, verification_token = '', updated_at = $2, version = version + 1
+		WHERE verification_token = $1 AND deleted_at IS NULL`, token, time.Now().UTC()))
+}
+
+func (r *sqlUserRepository) SoftDelete(ctx context.Context, id string, version int64, deletedBy string) error {
+	return r.s.softDelete(ctx, r.s.DB, "users", id, version, deletedBy)
+}
+
+func (r *sqlUserRepository) Restore(ctx context.Context, id, tenantID string) error {
+	return r.s.restore(ctx, r.s.DB, "users", id, tenantID)
+}
+
+func (r *sqlUserRepository) Purge(ctx context.Context, before time.Time) (int64, error) {
+	return r.s.purge(ctx, "users", before)
+}
+
+func (r *sqlUserRepository) Delete(ctx context.Context, id string, version int64) error {
+	return r.s.deleteVersioned(ctx, "users", id, version)
+}
+
+// findOne loads the user selected by clause, which may join and filter on
+// the users table aliased as u.
+func (r *sqlUserRepository) findOne(ctx context.Context, clause string, args ...interface{}) (*models.User, error) {
+	user, err := scanUser(r.s.DB.QueryRowContext(ctx, `SELECT `+userColumns+` FROM users u `+clause, args...))
+	if err != nil {
+		return nil, noRows(err)
+	}
+
+	roles, err := r.roles(ctx, user.ID.Hex())
+	if err != nil {
+		return nil, err
+	}
+	identities, err := r.identities(ctx, user.ID.Hex())
+	if err != nil {
+		return nil, err
+	}
+	user.Roles = roles[user.ID.Hex()]
+	user.Identities = identities[user.ID.Hex()]
+	return user, nil
+}
+
+// roles returns the role assignments of the users keyed by user ID.
+func (r *sqlUserRepository) roles(ctx context.Context, userIDs ...string) (map[string][]models.RoleAssignment, error) {
+	var where sqlWhere
+	where.in("user_id", userIDs)
+	rows, err := r.s.DB.QueryContext(ctx, `SELECT user_id, role, starts_at, expires_at FROM user_roles`+
+		where.String()+` ORDER BY user_id, position`, where.args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	roles := map[string][]models.RoleAssignment{}
+	for rows.Next() {
+		var (
+			owner      string
+			assignment models.RoleAssignment
+			startsAt   sql.NullTime
+			expiresAt  sql.NullTime
+		)
+		if err := rows.Scan(&owner, &assignment.Role, &startsAt, &expiresAt); err != nil {
+			return nil, err
+		}
+		assignment.StartsAt = timePtr(startsAt)
+		assignment.ExpiresAt = timePtr(expiresAt)
+		roles[owner] = append(roles[owner], assignment)
+	}
+	return roles, rows.Err()
+}
+
+func insertRoles(ctx context.Context, tx *sql.Tx, userID string, roles []models.RoleAssignment) error {
+	for i, assignment := range roles {
+		if _, err := tx.ExecContext(ctx, `INSERT INTO user_roles (user_id, role, starts_at, expires_at, position)
+			VALUES ($1, $2, $3, $4, $5)`,
+			userID, assignment.Role, nullTimePtr(assignment.StartsAt), nullTimePtr(assignment.ExpiresAt), i,
+		); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// identities returns the linked identities of the users keyed by user ID.
+func (r *sqlUserRepository) identities(ctx context.Context, userIDs ...string) (map[string][]models.ExternalIdentity, error) {
+	var where sqlWhere
+	where.in("user_id", userIDs)
+	rows, err := r.s.DB.QueryContext(ctx, `SELECT user_id, provider, subject, linked_at FROM user_identities`+
+		where.String()+` ORDER BY linked_at, provider, subject`, where.args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	identities := map[string][]models.ExternalIdentity{}
+	for rows.Next() {
+		var owner string
+		var identity models.ExternalIdentity
+		if err := rows.Scan(&owner, &identity.Provider, &identity.Subject, &identity.LinkedAt); err != nil {
+			return nil, err
+		}
+		identities[owner] = append(identities[owner], identity)
+	}
+	return identities, rows.Err()
+}
+
+func insertIdentities(ctx context.Context, tx *sql.Tx, userID string, identities []models.ExternalIdentity) error {
+	for _, identity := range identities {
+		if _, err := tx.ExecContext(ctx, `INSERT INTO user_identities (provider, subject, user_id, linked_at)
+			VALUES ($1, $2, $3, $4)`,
+			identity.Provider, identity.Subject, userID, identity.LinkedAt.UTC(),
+		); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func scanUser(row scanner) (*models.User, error) {
+	var (
+		user        models.User
+		id          string
+		resetExpiry sql.NullTime
+		attributes  []byte
+		deletedAt   sql.NullTime
+	)
+	err := row.Scan(&id, &user.TenantID, &user.Username, &user.Password, &user.Email, &user.EmailVerified,
+		&user.VerificationToken, &user.ResetToken, &resetExpiry, &user.AuthSource, &attributes,
+		&user.Version, &user.CreatedAt, &user.UpdatedAt, &deletedAt, &user.DeletedBy)
+	if err != nil {
+		return nil, err
+	}
+
+	if user.ID, err = parseObjectID(id); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(attributes, &user.Attributes); err != nil {
+		return nil, err
+	}
+	if len(user.Attributes) == 0 {
+		user.Attributes = nil
+	}
+	user.ResetTokenExpiry = resetExpiry.Time
+	user.DeletedAt = timePtr(deletedAt)
+	return &user, nil
+}
+
+// marshalAttributes encodes user attributes for the JSON attributes column.
+func marshalAttributes(attributes map[string]interface{}) (string, error) {
+	if attributes == nil {
+		return "{}", nil
+	}
+	data, err := json.Marshal(attributes)
+	return string(data), err
+}
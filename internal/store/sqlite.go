@@ -0,0 +1,86 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"errors"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+//go:embed migrations/sqlite/*.sql
+var sqliteMigrations embed.FS
+
+// SQLiteStore is a SQLStore backed by a local SQLite database file, for
+// deployments that run AccessMesh without an external database.
+type SQLiteStore struct {
+	*SQLStore
+}
+
+// NewSQLiteStore opens (creating if needed) the database at path in WAL mode
+// and applies any pending schema migrations.
+func NewSQLiteStore(path string) (*SQLiteStore, error) {
+	params := url.Values{}
+	params.Add("_pragma", "journal_mode(WAL)")
+	params.Add("_pragma", "foreign_keys(1)")
+	params.Add("_pragma", "busy_timeout(5000)")
+	params.Set("_time_format", "sqlite")
+	// Take the write lock when a transaction starts so concurrent writers
+	// wait on busy_timeout instead of failing on lock upgrade.
+	params.Set("_txlock", "immediate")
+
+	db, err := sql.Open("sqlite", "file:"+path+"?"+params.Encode())
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	if err := migrateSQL(ctx, db, sqliteMigrations, "migrations/sqlite"); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &SQLiteStore{&SQLStore{DB: db, isDuplicate: isSQLiteUniqueViolation}}, nil
+}
+
+// Backup writes a consistent copy of the live database to w without blocking
+// other readers or writers.
+func (s *SQLiteStore) Backup(ctx context.Context, w io.Writer) error {
+	dir, err := os.MkdirTemp("", "accessmesh-backup-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	snapshot := filepath.Join(dir, "accessmesh.db")
+	if _, err := s.DB.ExecContext(ctx, `VACUUM INTO $1`, snapshot); err != nil {
+		return err
+	}
+
+	f, err := os.Open(snapshot)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = io.Copy(w, f)
+	return err
+}
+
+func isSQLiteUniqueViolation(err error) bool {
+	var sqliteErr *sqlite.Error
+	if !errors.As(err, &sqliteErr) {
+		return false
+	}
+	code := sqliteErr.Code()
+	return code == sqlite3.SQLITE_CONSTRAINT_UNIQUE || code == sqlite3.SQLITE_CONSTRAINT_PRIMARYKEY
+}
@@ -0,0 +1,73 @@
+package store_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/knakul853/accessmesh/internal/models"
+	"github.com/knakul853/accessmesh/internal/store"
+	"github.com/knakul853/accessmesh/internal/store/storetest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestSQLiteStore(t *testing.T) *store.SQLiteStore {
+	t.Helper()
+
+	s, err := store.NewSQLiteStore(filepath.Join(t.TempDir(), "accessmesh.db"))
+	require.NoError(t, err)
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+func TestSQLiteStore(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) store.Store {
+		return newTestSQLiteStore(t)
+	})
+}
+
+func TestSQLiteStore_Reopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "accessmesh.db")
+
+	s, err := store.NewSQLiteStore(path)
+	require.NoError(t, err)
+	require.NoError(t, s.Users().Create(context.Background(), &models.User{Username: "alice"}))
+	require.NoError(t, s.Close())
+
+	// Migrations already applied are skipped.
+	s, err = store.NewSQLiteStore(path)
+	require.NoError(t, err)
+	defer s.Close()
+	_, err = s.Users().GetByUsername(context.Background(), "alice")
+	assert.NoError(t, err)
+
+	var mode string
+	require.NoError(t, s.DB.QueryRow(`PRAGMA journal_mode`).Scan(&mode))
+	assert.Equal(t, "wal", mode)
+}
+
+func TestSQLiteStore_Backup(t *testing.T) {
+	ctx := context.Background()
+	s := newTestSQLiteStore(t)
+	require.NoError(t, s.Users().Create(ctx, &models.User{Username: "alice"}))
+
+	backupPath := filepath.Join(t.TempDir(), "backup.db")
+	f, err := os.Create(backupPath)
+	require.NoError(t, err)
+	require.NoError(t, s.Backup(ctx, f))
+	require.NoError(t, f.Close())
+
+	// Writes after the backup are not in it.
+	require.NoError(t, s.Users().Create(ctx, &models.User{Username: "bob"}))
+
+	restored, err := store.NewSQLiteStore(backupPath)
+	require.NoError(t, err)
+	defer restored.Close()
+
+	users, err := restored.Users().List(ctx, store.UserQuery{})
+	require.NoError(t, err)
+	require.Len(t, users.Items, 1)
+	assert.Equal(t, "alice", users.Items[0].Username)
+}
@@ -0,0 +1,237 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"io"
+	"time"
+
+	"github.com/knakul853/accessmesh/internal/models"
+)
+
+var (
+	// ErrNotFound is returned when no document matches the lookup.
+	ErrNotFound = errors.New("not found")
+	// ErrInvalidID is returned when an ID is not in the store's format.
+	ErrInvalidID = errors.New("invalid id")
+	// ErrDuplicate is returned when a write would violate a uniqueness
+	// constraint, such as a second user with the same username.
+	ErrDuplicate = errors.New("duplicate")
+	// ErrInvalidQuery is returned for unknown sort fields or malformed
+	// cursors.
+	ErrInvalidQuery = errors.New("invalid query")
+	// ErrVersionConflict is returned when a write names a version that is no
+	// longer the stored one because somebody else changed the document.
+	ErrVersionConflict = errors.New("version conflict")
+)
+
+// Store groups the repositories backing AccessMesh.
+type Store interface {
+	Tenants() TenantRepository
+	Users() UserRepository
+	Roles() RoleRepository
+	Policies() PolicyRepository
+	Groups() GroupRepository
+	Elevations() ElevationRepository
+	Tuples() TupleRepository
+	Revisions() RevisionRepository
+	Snapshots() SnapshotRepository
+	MagicLinks() MagicLinkRepository
+	AuditLogs() AuditRepository
+}
+
+// Users, roles, policies and groups carry a version that starts at 1 and is bumped by
+// every write. Update only succeeds if the given document's version is still
+// the stored one, and then sets it to the new version; otherwise it returns
+// ErrVersionConflict. SoftDelete and Delete take the expected version, or 0
+// to delete whatever is stored.
+//
+// SoftDelete moves a document to the trash by setting DeletedAt and
+// DeletedBy. Trashed documents are invisible to lookups, Update and List
+// unless ListOptions.Deleted is set. Restore brings them back, and Purge
+// removes those trashed before a cutoff for good, returning how many. Delete
+// removes a document immediately, trashed or not. Trashed users keep their
+// username and email reserved.
+//
+// Users, roles, policies and groups belong to a tenant. Create puts documents without
+// a TenantID in models.DefaultTenant. Restore only restores a document of the
+// given tenant, or of any tenant if tenantID is empty.
+
+// tenantOf returns the tenant a new document is created in.
+func tenantOf(tenantID string) string {
+	if tenantID == "" {
+		return models.DefaultTenant
+	}
+	return tenantID
+}
+
+// Backuper is implemented by stores that can take an online backup of their
+// data.
+type Backuper interface {
+	Backup(ctx context.Context, w io.Writer) error
+}
+
+type TenantRepository interface {
+	// Create inserts the tenant, or returns ErrDuplicate if its ID is taken.
+	Create(ctx context.Context, tenant *models.Tenant) error
+	Get(ctx context.Context, id string) (*models.Tenant, error)
+	// List returns every tenant ordered by ID.
+	List(ctx context.Context) ([]models.Tenant, error)
+}
+
+type UserRepository interface {
+	// Create inserts the user and sets its ID and version.
+	Create(ctx context.Context, user *models.User) error
+	Get(ctx context.Context, id string) (*models.User, error)
+	GetByUsername(ctx context.Context, username string) (*models.User, error)
+	GetByEmail(ctx context.Context, email string) (*models.User, error)
+	// GetByIdentity finds the user linked to an external identity provider subject.
+	GetByIdentity(ctx context.Context, provider, subject string) (*models.User, error)
+	// GetByResetToken only matches tokens that have not expired.
+	GetByResetToken(ctx context.Context, token string) (*models.User, error)
+	List(ctx context.Context, query UserQuery) (*Page[models.User], error)
+	// Update replaces the stored user with the given one and sets its
+	// UpdatedAt.
+	Update(ctx context.Context, user *models.User) error
+	// VerifyEmail marks the user holding the verification token as verified
+	// and clears the token.
+	VerifyEmail(ctx context.Context, token string) error
+	SoftDelete(ctx context.Context, id string, version int64, deletedBy string) error
+	Restore(ctx context.Context, id, tenantID string) error
+	// Purge permanently removes documents trashed before the given time and
+	// returns how many there were.
+	Purge(ctx context.Context, before time.Time) (int64, error)
+	Delete(ctx context.Context, id string, version int64) error
+}
+
+type RoleRepository interface {
+	Create(ctx context.Context, role *models.Role) error
+	Get(ctx context.Context, id string) (*models.Role, error)
+	List(ctx context.Context, query RoleQuery) (*Page[models.Role], error)
+	Update(ctx context.Context, role *models.Role) error
+	SoftDelete(ctx context.Context, id string, version int64, deletedBy string) error
+	Restore(ctx context.Context, id, tenantID string) error
+	Purge(ctx context.Context, before time.Time) (int64, error)
+	Delete(ctx context.Context, id string, version int64) error
+}
+
+type PolicyRepository interface {
+	Create(ctx context.Context, policy *models.Policy) error
+	Get(ctx context.Context, id string) (*models.Policy, error)
+	List(ctx context.Context, query PolicyQuery) (*Page[models.Policy], error)
+	// Update replaces the stored policy with the given one and sets its
+	// UpdatedAt.
+	Update(ctx context.Context, policy *models.Policy) error
+	SoftDelete(ctx context.Context, id string, version int64, deletedBy string) error
+	Restore(ctx context.Context, id, tenantID string) error
+	Purge(ctx context.Context, before time.Time) (int64, error)
+	Delete(ctx context.Context, id string, version int64) error
+	// ReplaceAll makes the given policies the tenant's live ones in a single
+	// transaction. A policy with the ID of a stored one of the tenant, live
+	// or trashed, replaces it, and one with an unknown or zero ID is created.
+	// Live policies that are not given are trashed by deletedBy. It returns
+	// the policies it changed; those already as given are left alone.
+	ReplaceAll(ctx context.Context, tenantID string, policies []models.Policy, deletedBy string) ([]PolicyChange, error)
+}
+
+// PolicyChange is a policy written by PolicyRepository.ReplaceAll. Before is
+// nil for a policy it created, and After is in the trash for one it trashed.
+type PolicyChange struct {
+	Before *models.Policy `json:"before"`
+	After  *models.Policy `json:"after"`
+}
+
+type GroupRepository interface {
+	Create(ctx context.Context, group *models.Group) error
+	Get(ctx context.Context, id string) (*models.Group, error)
+	List(ctx context.Context, query GroupQuery) (*Page[models.Group], error)
+	// Update replaces the stored group with the given one and sets its
+	// UpdatedAt.
+	Update(ctx context.Context, group *models.Group) error
+	SoftDelete(ctx context.Context, id string, version int64, deletedBy string) error
+	Restore(ctx context.Context, id, tenantID string) error
+	Purge(ctx context.Context, before time.Time) (int64, error)
+	Delete(ctx context.Context, id string, version int64) error
+}
+
+// ElevationRepository keeps role elevation requests. Elevations are
+// versioned like users but are never deleted, so that they stay on record.
+type ElevationRepository interface {
+	// Create inserts the elevation and sets its ID and version.
+	Create(ctx context.Context, elevation *models.Elevation) error
+	Get(ctx context.Context, id string) (*models.Elevation, error)
+	List(ctx context.Context, query ElevationQuery) (*Page[models.Elevation], error)
+	// Update replaces the stored elevation with the given one and sets its
+	// UpdatedAt.
+	Update(ctx context.Context, elevation *models.Elevation) error
+	// Expired returns the approved elevations of every tenant whose
+	// ExpiresAt is not after now.
+	Expired(ctx context.Context, now time.Time) ([]models.Elevation, error)
+}
+
+// TupleRepository keeps the relation tuples of each tenant with their
+// history. Every write gets the next revision of its tenant, starting at 1,
+// and reads see the tuples as they were at a revision.
+type TupleRepository interface {
+	// Write deletes and then inserts tuples of the tenant under a new
+	// revision, and returns it. Deleting an absent tuple or inserting a live
+	// one changes nothing.
+	Write(ctx context.Context, tenantID string, inserts, deletes []models.RelationTuple) (int64, error)
+	// Read returns the tuples matching filter that were live at revision,
+	// ordered by object, relation and subject.
+	Read(ctx context.Context, filter TupleFilter, revision int64) ([]models.RelationTuple, error)
+	// Revision returns the latest revision of the tenant, or 0 before its
+	// first write.
+	Revision(ctx context.Context, tenantID string) (int64, error)
+}
+
+// TupleFilter selects the tuples of a tenant. Empty fields match anything,
+// except that a SubjectType selects the subjects with exactly that type, ID
+// and relation.
+type TupleFilter struct {
+	TenantID        string
+	ObjectType      string
+	ObjectID        string
+	Relation        string
+	SubjectType     string
+	SubjectID       string
+	SubjectRelation string
+}
+
+// RevisionRepository keeps the history of policies and roles. Revisions are
+// never changed or removed, not even when their document is purged.
+type RevisionRepository interface {
+	// Append inserts the revision and sets its ID. A second revision of the
+	// same document and version is ErrDuplicate.
+	Append(ctx context.Context, revision *models.Revision) error
+	// List returns the revisions of a document, oldest first.
+	List(ctx context.Context, kind, documentID string) ([]models.Revision, error)
+}
+
+// SnapshotRepository keeps policy snapshots.
+type SnapshotRepository interface {
+	// Create inserts the snapshot and sets its ID.
+	Create(ctx context.Context, snapshot *models.PolicySnapshot) error
+	Get(ctx context.Context, id string) (*models.PolicySnapshot, error)
+	// List returns the snapshots of a tenant, newest first.
+	List(ctx context.Context, tenantID string) ([]models.PolicySnapshot, error)
+}
+
+type MagicLinkRepository interface {
+	Create(ctx context.Context, link *models.MagicLink) error
+	// RecordRequest counts a link request for the email in the rate limit
+	// window starting at window, whether or not the email belongs to an
+	// account, so that rate limiting does not reveal which ones do. The check
+	// and the count are one atomic step: if limit requests were already
+	// counted in the window, it counts nothing and returns false.
+	RecordRequest(ctx context.Context, email string, window time.Time, limit int64) (bool, error)
+	// GetActive finds an unused, unexpired link by token hash.
+	GetActive(ctx context.Context, tokenHash string) (*models.MagicLink, error)
+	// Claim marks the link used. It returns ErrNotFound if the link was
+	// already claimed, so only one caller can redeem it.
+	Claim(ctx context.Context, id string) error
+}
+
+type AuditRepository interface {
+	Write(ctx context.Context, entry *models.AuditEntry) error
+}
@@ -0,0 +1,1038 @@
+// Package storetest is a conformance suite that every store.Store
+// implementation must pass.
+package storetest
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/knakul853/accessmesh/internal/models"
+	"github.com/knakul853/accessmesh/internal/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Run runs the suite. open must return an empty store; it is called once per
+// subtest.
+func Run(t *testing.T, open func(t *testing.T) store.Store) {
+	t.Run("Users", func(t *testing.T) { testUsers(t, open(t)) })
+	t.Run("UserLookups", func(t *testing.T) { testUserLookups(t, open(t)) })
+	t.Run("Roles", func(t *testing.T) { testRoles(t, open(t)) })
+	t.Run("Policies", func(t *testing.T) { testPolicies(t, open(t)) })
+	t.Run("Versions", func(t *testing.T) { testVersions(t, open(t)) })
+	t.Run("SoftDelete", func(t *testing.T) { testSoftDelete(t, open(t)) })
+	t.Run("ListPaging", func(t *testing.T) { testListPaging(t, open(t)) })
+	t.Run("ListFilters", func(t *testing.T) { testListFilters(t, open(t)) })
+	t.Run("Tenants", func(t *testing.T) { testTenants(t, open(t)) })
+	t.Run("Groups", func(t *testing.T) { testGroups(t, open(t)) })
+	t.Run("Elevations", func(t *testing.T) { testElevations(t, open(t)) })
+	t.Run("Tuples", func(t *testing.T) { testTuples(t, open(t)) })
+	t.Run("ReplacePolicies", func(t *testing.T) { testReplacePolicies(t, open(t)) })
+	t.Run("Revisions", func(t *testing.T) { testRevisions(t, open(t)) })
+	t.Run("RecordedWrites", func(t *testing.T) { testRecordedWrites(t, open(t)) })
+	t.Run("MagicLinks", func(t *testing.T) { testMagicLinks(t, open(t)) })
+	t.Run("AuditLogs", func(t *testing.T) { testAuditLogs(t, open(t)) })
+}
+
+func testUsers(t *testing.T, s store.Store) {
+	ctx := context.Background()
+	users := s.Users()
+
+	alice := &models.User{Username: "alice", Email: "alice@example.org", VerificationToken: "verify-me", CreatedAt: time.Now()}
+	require.NoError(t, users.Create(ctx, alice))
+	assert.False(t, alice.ID.IsZero())
+
+	assert.ErrorIs(t, users.Create(ctx, &models.User{Username: "alice"}), store.ErrDuplicate)
+	assert.ErrorIs(t, users.Create(ctx, &models.User{Username: "bob", Email: "alice@example.org"}), store.ErrDuplicate)
+
+	bob := &models.User{Username: "bob"}
+	require.NoError(t, users.Create(ctx, bob))
+	bob.Username = "alice"
+	assert.ErrorIs(t, users.Update(ctx, bob), store.ErrDuplicate)
+
+	_, err := users.Get(ctx, "not-an-id")
+	assert.ErrorIs(t, err, store.ErrInvalidID)
+
+	// Returned users are copies; mutating one does not touch the store.
+	got, err := users.GetByUsername(ctx, "alice")
+	require.NoError(t, err)
+	got.Roles = models.AssignRoles("admin")
+	got, err = users.Get(ctx, alice.ID.Hex())
+	require.NoError(t, err)
+	assert.Empty(t, got.Roles)
+
+	// Role assignments keep their order and time bounds.
+	startsAt := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+	expiresAt := startsAt.Add(24 * time.Hour)
+	got.Roles = []models.RoleAssignment{
+		{Role: "support"},
+		{Role: "admin", StartsAt: &startsAt, ExpiresAt: &expiresAt},
+	}
+	require.NoError(t, users.Update(ctx, got))
+	got, err = users.Get(ctx, alice.ID.Hex())
+	require.NoError(t, err)
+	require.Len(t, got.Roles, 2)
+	assert.Equal(t, "support", got.Roles[0].Role)
+	assert.Nil(t, got.Roles[0].StartsAt)
+	assert.Nil(t, got.Roles[0].ExpiresAt)
+	assert.Equal(t, "admin", got.Roles[1].Role)
+	require.NotNil(t, got.Roles[1].StartsAt)
+	require.NotNil(t, got.Roles[1].ExpiresAt)
+	assert.True(t, startsAt.Equal(*got.Roles[1].StartsAt))
+	assert.True(t, expiresAt.Equal(*got.Roles[1].ExpiresAt))
+	assert.Equal(t, []string{"support"}, got.ActiveRoles(time.Now()))
+	assert.False(t, got.UpdatedAt.IsZero())
+	assert.Nil(t, got.Attributes)
+
+	got.Attributes = map[string]interface{}{"department": "finance", "clearance": 3}
+	require.NoError(t, users.Update(ctx, got))
+	got, err = users.Get(ctx, alice.ID.Hex())
+	require.NoError(t, err)
+	assert.Equal(t, "finance", got.Attributes["department"])
+	assert.EqualValues(t, 3, got.Attributes["clearance"])
+
+	require.NoError(t, users.VerifyEmail(ctx, "verify-me"))
+	assert.ErrorIs(t, users.VerifyEmail(ctx, "verify-me"), store.ErrNotFound)
+	assert.ErrorIs(t, users.VerifyEmail(ctx, ""), store.ErrNotFound)
+	got, err = users.GetByEmail(ctx, "alice@example.org")
+	require.NoError(t, err)
+	assert.True(t, got.EmailVerified)
+	assert.Empty(t, got.VerificationToken)
+
+	require.NoError(t, users.Delete(ctx, alice.ID.Hex(), 0))
+	assert.ErrorIs(t, users.Delete(ctx, alice.ID.Hex(), 0), store.ErrNotFound)
+	_, err = users.Get(ctx, alice.ID.Hex())
+	assert.ErrorIs(t, err, store.ErrNotFound)
+
+	list, err := users.List(ctx, store.UserQuery{})
+	require.NoError(t, err)
+	require.Len(t, list.Items, 1)
+	assert.Equal(t, "bob", list.Items[0].Username)
+}
+
+func testUserLookups(t *testing.T, s store.Store) {
+	ctx := context.Background()
+	users := s.Users()
+
+	carol := &models.User{
+		Username:   "carol",
+		Identities: []models.ExternalIdentity{{Provider: "corp", Subject: "42", LinkedAt: time.Now()}},
+	}
+	require.NoError(t, users.Create(ctx, carol))
+	require.NoError(t, users.Create(ctx, &models.User{
+		Username:         "dave",
+		ResetToken:       "expired",
+		ResetTokenExpiry: time.Now().Add(-time.Minute),
+	}))
+	require.NoError(t, users.Create(ctx, &models.User{
+		Username:         "erin",
+		ResetToken:       "valid",
+		ResetTokenExpiry: time.Now().Add(time.Hour),
+	}))
+
+	got, err := users.GetByIdentity(ctx, "corp", "42")
+	require.NoError(t, err)
+	assert.Equal(t, "carol", got.Username)
+	require.Len(t, got.Identities, 1)
+	assert.Equal(t, "42", got.Identities[0].Subject)
+
+	_, err = users.GetByIdentity(ctx, "other", "42")
+	assert.ErrorIs(t, err, store.ErrNotFound)
+
+	// Linking a second identity is a plain update.
+	got.Identities = append(got.Identities, models.ExternalIdentity{Provider: "github", Subject: "carol", LinkedAt: time.Now()})
+	require.NoError(t, users.Update(ctx, got))
+	got, err = users.GetByIdentity(ctx, "github", "carol")
+	require.NoError(t, err)
+	assert.Equal(t, carol.ID, got.ID)
+	assert.Len(t, got.Identities, 2)
+
+	_, err = users.GetByResetToken(ctx, "expired")
+	assert.ErrorIs(t, err, store.ErrNotFound)
+	got, err = users.GetByResetToken(ctx, "valid")
+	require.NoError(t, err)
+	assert.Equal(t, "erin", got.Username)
+
+	_, err = users.GetByUsername(ctx, "nobody")
+	assert.ErrorIs(t, err, store.ErrNotFound)
+	_, err = users.GetByEmail(ctx, "nobody@example.org")
+	assert.ErrorIs(t, err, store.ErrNotFound)
+}
+
+func testRoles(t *testing.T, s store.Store) {
+	ctx := context.Background()
+	roles := s.Roles()
+
+	role := &models.Role{Name: "support", Description: "Support staff", Permissions: []string{"users:read"}}
+	require.NoError(t, roles.Create(ctx, role))
+	assert.False(t, role.ID.IsZero())
+
+	got, err := roles.Get(ctx, role.ID.Hex())
+	require.NoError(t, err)
+	assert.Equal(t, role, got)
+
+	got.Permissions = append(got.Permissions, "orders:read")
+	require.NoError(t, roles.Update(ctx, got))
+
+	list, err := roles.List(ctx, store.RoleQuery{})
+	require.NoError(t, err)
+	require.Len(t, list.Items, 1)
+	assert.Equal(t, []string{"users:read", "orders:read"}, list.Items[0].Permissions)
+
+	// Live role names are unique per tenant.
+	assert.ErrorIs(t, roles.Create(ctx, &models.Role{Name: "support"}), store.ErrDuplicate)
+	require.NoError(t, roles.Create(ctx, &models.Role{TenantID: "acme", Name: "support"}))
+	auditor := &models.Role{Name: "auditor"}
+	require.NoError(t, roles.Create(ctx, auditor))
+	auditor.Name = "support"
+	assert.ErrorIs(t, roles.Update(ctx, auditor), store.ErrDuplicate)
+	require.NoError(t, roles.SoftDelete(ctx, auditor.ID.Hex(), 0, "tester"))
+	trashed := &models.Role{Name: "auditor"}
+	require.NoError(t, roles.Create(ctx, trashed))
+	assert.ErrorIs(t, roles.Restore(ctx, auditor.ID.Hex(), ""), store.ErrDuplicate)
+
+	list, err = roles.List(ctx, store.RoleQuery{})
+	require.NoError(t, err)
+	require.Len(t, list.Items, 3)
+
+	missing := &models.Role{ID: got.ID}
+	require.NoError(t, roles.Delete(ctx, role.ID.Hex(), 0))
+	assert.ErrorIs(t, roles.Update(ctx, missing), store.ErrNotFound)
+	assert.ErrorIs(t, roles.Delete(ctx, role.ID.Hex(), 0), store.ErrNotFound)
+	_, err = roles.Get(ctx, "not-an-id")
+	assert.ErrorIs(t, err, store.ErrInvalidID)
+}
+
+func testPolicies(t *testing.T, s store.Store) {
+	ctx := context.Background()
+	policies := s.Policies()
+
+	policy := &models.Policy{
+		Role:     "manager",
+		Resource: "/api/v1/orders",
+		Action:   "read",
+		Conditions: models.PolicyConditions{
+			IPRange:   []string{"10.0.0.0/16"},
+			TimeRange: []string{"08:00-20:00"},
+		},
+	}
+	require.NoError(t, policies.Create(ctx, policy))
+	require.NoError(t, policies.Create(ctx, &models.Policy{Role: "admin", Resource: "/api/v1/orders", Action: "write"}))
+
+	got, err := policies.Get(ctx, policy.ID.Hex())
+	require.NoError(t, err)
+	assert.Equal(t, policy.Conditions, got.Conditions)
+
+	got.Action = "write"
+	require.NoError(t, policies.Update(ctx, got))
+
+	list, err := policies.List(ctx, store.PolicyQuery{})
+	require.NoError(t, err)
+	require.Len(t, list.Items, 2)
+	assert.Equal(t, "manager", list.Items[0].Role)
+	assert.Equal(t, "write", list.Items[0].Action)
+
+	require.NoError(t, policies.Delete(ctx, policy.ID.Hex(), 0))
+	_, err = policies.Get(ctx, policy.ID.Hex())
+	assert.ErrorIs(t, err, store.ErrNotFound)
+}
+
+func testVersions(t *testing.T, s store.Store) {
+	ctx := context.Background()
+	policies := s.Policies()
+
+	created := time.Now().Add(-time.Hour).Truncate(time.Millisecond)
+	policy := &models.Policy{Role: "admin", Resource: "/api/v1/orders", Action: "read", CreatedAt: created, UpdatedAt: created}
+	require.NoError(t, policies.Create(ctx, policy))
+	assert.EqualValues(t, 1, policy.Version)
+
+	first, err := policies.Get(ctx, policy.ID.Hex())
+	require.NoError(t, err)
+	second, err := policies.Get(ctx, policy.ID.Hex())
+	require.NoError(t, err)
+
+	first.Action = "write"
+	require.NoError(t, policies.Update(ctx, first))
+	assert.EqualValues(t, 2, first.Version)
+	assert.True(t, first.UpdatedAt.After(created))
+
+	// The second writer still holds version 1 and must not clobber the first.
+	second.Action = "delete"
+	assert.ErrorIs(t, policies.Update(ctx, second), store.ErrVersionConflict)
+	assert.EqualValues(t, 1, second.Version)
+	assert.ErrorIs(t, policies.Delete(ctx, policy.ID.Hex(), 1), store.ErrVersionConflict)
+
+	got, err := policies.Get(ctx, policy.ID.Hex())
+	require.NoError(t, err)
+	assert.Equal(t, "write", got.Action)
+	assert.EqualValues(t, 2, got.Version)
+	assert.True(t, got.CreatedAt.Equal(created), "created_at changed to %v", got.CreatedAt)
+
+	require.NoError(t, policies.Delete(ctx, policy.ID.Hex(), 2))
+	assert.ErrorIs(t, policies.Delete(ctx, policy.ID.Hex(), 2), store.ErrNotFound)
+	assert.ErrorIs(t, policies.Update(ctx, got), store.ErrNotFound)
+
+	role := &models.Role{Name: "support"}
+	require.NoError(t, s.Roles().Create(ctx, role))
+	stale := *role
+	require.NoError(t, s.Roles().Update(ctx, role))
+	assert.EqualValues(t, 2, role.Version)
+	assert.ErrorIs(t, s.Roles().Update(ctx, &stale), store.ErrVersionConflict)
+	require.NoError(t, s.Roles().Delete(ctx, role.ID.Hex(), 0))
+
+	user := &models.User{Username: "alice", VerificationToken: "verify-me"}
+	require.NoError(t, s.Users().Create(ctx, user))
+	require.NoError(t, s.Users().VerifyEmail(ctx, "verify-me"))
+	assert.ErrorIs(t, s.Users().Update(ctx, user), store.ErrVersionConflict)
+	fresh, err := s.Users().Get(ctx, user.ID.Hex())
+	require.NoError(t, err)
+	assert.EqualValues(t, 2, fresh.Version)
+	require.NoError(t, s.Users().Update(ctx, fresh))
+	assert.EqualValues(t, 3, fresh.Version)
+	assert.ErrorIs(t, s.Users().Delete(ctx, user.ID.Hex(), 2), store.ErrVersionConflict)
+	require.NoError(t, s.Users().Delete(ctx, user.ID.Hex(), 3))
+}
+
+func testSoftDelete(t *testing.T, s store.Store) {
+	ctx := context.Background()
+	policies := s.Policies()
+
+	kept := &models.Policy{Role: "admin", Resource: "/api/v1/orders", Action: "read"}
+	trashed := &models.Policy{Role: "admin", Resource: "/api/v1/orders", Action: "write"}
+	require.NoError(t, policies.Create(ctx, kept))
+	require.NoError(t, policies.Create(ctx, trashed))
+
+	id := trashed.ID.Hex()
+	assert.ErrorIs(t, policies.SoftDelete(ctx, id, 2, "alice"), store.ErrVersionConflict)
+	require.NoError(t, policies.SoftDelete(ctx, id, 1, "alice"))
+	assert.ErrorIs(t, policies.SoftDelete(ctx, id, 0, "alice"), store.ErrNotFound)
+	_, err := policies.Get(ctx, id)
+	assert.ErrorIs(t, err, store.ErrNotFound)
+	assert.ErrorIs(t, policies.Update(ctx, trashed), store.ErrNotFound)
+
+	live, err := policies.List(ctx, store.PolicyQuery{})
+	require.NoError(t, err)
+	require.Len(t, live.Items, 1)
+	assert.Equal(t, kept.ID, live.Items[0].ID)
+
+	trash, err := policies.List(ctx, store.PolicyQuery{ListOptions: store.ListOptions{Deleted: true}})
+	require.NoError(t, err)
+	require.Len(t, trash.Items, 1)
+	assert.Equal(t, trashed.ID, trash.Items[0].ID)
+	assert.Equal(t, "alice", trash.Items[0].DeletedBy)
+	require.NotNil(t, trash.Items[0].DeletedAt)
+	assert.EqualValues(t, 2, trash.Items[0].Version)
+
+	require.NoError(t, policies.Restore(ctx, id, ""))
+	assert.ErrorIs(t, policies.Restore(ctx, id, ""), store.ErrNotFound)
+	got, err := policies.Get(ctx, id)
+	require.NoError(t, err)
+	assert.Nil(t, got.DeletedAt)
+	assert.Empty(t, got.DeletedBy)
+	assert.EqualValues(t, 3, got.Version)
+
+	// Only documents trashed before the cutoff are purged.
+	require.NoError(t, policies.SoftDelete(ctx, id, 0, "alice"))
+	purged, err := policies.Purge(ctx, time.Now().Add(-time.Hour))
+	require.NoError(t, err)
+	assert.Zero(t, purged)
+	purged, err = policies.Purge(ctx, time.Now().Add(time.Minute))
+	require.NoError(t, err)
+	assert.EqualValues(t, 1, purged)
+	assert.ErrorIs(t, policies.Restore(ctx, id, ""), store.ErrNotFound)
+	_, err = policies.Get(ctx, kept.ID.Hex())
+	require.NoError(t, err)
+
+	role := &models.Role{Name: "support"}
+	require.NoError(t, s.Roles().Create(ctx, role))
+	require.NoError(t, s.Roles().SoftDelete(ctx, role.ID.Hex(), role.Version, "alice"))
+	_, err = s.Roles().Get(ctx, role.ID.Hex())
+	assert.ErrorIs(t, err, store.ErrNotFound)
+	require.NoError(t, s.Roles().Restore(ctx, role.ID.Hex(), ""))
+	_, err = s.Roles().Get(ctx, role.ID.Hex())
+	require.NoError(t, err)
+
+	// A trashed user can no longer be found but keeps its name reserved.
+	user := &models.User{Username: "bob", Email: "bob@example.com"}
+	require.NoError(t, s.Users().Create(ctx, user))
+	require.NoError(t, s.Users().SoftDelete(ctx, user.ID.Hex(), 0, "alice"))
+	_, err = s.Users().GetByUsername(ctx, "bob")
+	assert.ErrorIs(t, err, store.ErrNotFound)
+	_, err = s.Users().GetByEmail(ctx, "bob@example.com")
+	assert.ErrorIs(t, err, store.ErrNotFound)
+	assert.ErrorIs(t, s.Users().Create(ctx, &models.User{Username: "bob"}), store.ErrDuplicate)
+	require.NoError(t, s.Users().Delete(ctx, user.ID.Hex(), 0))
+	require.NoError(t, s.Users().Create(ctx, &models.User{Username: "bob"}))
+}
+
+func testListPaging(t *testing.T, s store.Store) {
+	ctx := context.Background()
+	roles := s.Roles()
+
+	for _, name := range []string{"delta", "alpha", "echo", "charlie", "bravo"} {
+		require.NoError(t, roles.Create(ctx, &models.Role{Name: name, Description: "team"}))
+	}
+
+	collect := func(opts store.ListOptions) []string {
+		var names []string
+		for {
+			page, err := roles.List(ctx, store.RoleQuery{ListOptions: opts})
+			require.NoError(t, err)
+			assert.EqualValues(t, 5, page.Total)
+			for _, role := range page.Items {
+				names = append(names, role.Name)
+			}
+			if page.NextCursor == "" {
+				return names
+			}
+			require.Len(t, page.Items, opts.Limit)
+			opts.After = page.NextCursor
+		}
+	}
+
+	assert.Equal(t, []string{"delta", "alpha", "echo", "charlie", "bravo"}, collect(store.ListOptions{Limit: 2}))
+	assert.Equal(t, []string{"bravo", "charlie", "echo", "alpha", "delta"}, collect(store.ListOptions{Limit: 2, Sort: "-created_at"}))
+	assert.Equal(t, []string{"alpha", "bravo", "charlie", "delta", "echo"}, collect(store.ListOptions{Limit: 2, Sort: "name"}))
+	assert.Equal(t, []string{"echo", "delta", "charlie", "bravo", "alpha"}, collect(store.ListOptions{Limit: 3, Sort: "-name"}))
+	assert.Equal(t, []string{"alpha", "bravo", "charlie", "delta", "echo"}, collect(store.ListOptions{Sort: "name"}))
+
+	_, err := roles.List(ctx, store.RoleQuery{ListOptions: store.ListOptions{Sort: "permissions"}})
+	assert.ErrorIs(t, err, store.ErrInvalidQuery)
+	_, err = roles.List(ctx, store.RoleQuery{ListOptions: store.ListOptions{After: "garbage"}})
+	assert.ErrorIs(t, err, store.ErrInvalidQuery)
+}
+
+func testListFilters(t *testing.T, s store.Store) {
+	ctx := context.Background()
+	users := s.Users()
+	policies := s.Policies()
+
+	require.NoError(t, users.Create(ctx, &models.User{Username: "alice", Email: "alice@example.org", Roles: models.AssignRoles("admin"), EmailVerified: true}))
+	require.NoError(t, users.Create(ctx, &models.User{Username: "bob", Email: "bob@corp.example", Roles: models.AssignRoles("support")}))
+	require.NoError(t, users.Create(ctx, &models.User{Username: "carol_x", Email: "carol@example.org", Roles: models.AssignRoles("admin", "support"), EmailVerified: true}))
+
+	names := func(page *store.Page[models.User]) []string {
+		var names []string
+		for _, user := range page.Items {
+			names = append(names, user.Username)
+		}
+		return names
+	}
+
+	verified := true
+	page, err := users.List(ctx, store.UserQuery{Role: "support", EmailVerified: &verified})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"carol_x"}, names(page))
+	assert.EqualValues(t, 1, page.Total)
+
+	// The role filter matches any of a user's roles.
+	page, err = users.List(ctx, store.UserQuery{Role: "admin"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"alice", "carol_x"}, names(page))
+	// Listed users carry their own roles.
+	if assert.Len(t, page.Items, 2) {
+		assert.Equal(t, models.AssignRoles("admin"), page.Items[0].Roles)
+		assert.Equal(t, models.AssignRoles("admin", "support"), page.Items[1].Roles)
+	}
+
+	page, err = users.List(ctx, store.UserQuery{ListOptions: store.ListOptions{Search: "EXAMPLE.ORG", Sort: "-username"}})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"carol_x", "alice"}, names(page))
+
+	// Search is a literal substring match.
+	page, err = users.List(ctx, store.UserQuery{ListOptions: store.ListOptions{Search: "_"}})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"carol_x"}, names(page))
+	page, err = users.List(ctx, store.UserQuery{ListOptions: store.ListOptions{Search: ".*"}})
+	require.NoError(t, err)
+	assert.Empty(t, page.Items)
+	assert.EqualValues(t, 0, page.Total)
+
+	require.NoError(t, policies.Create(ctx, &models.Policy{Role: "admin", Resource: "/api/v1/orders", Action: "read"}))
+	require.NoError(t, policies.Create(ctx, &models.Policy{Role: "admin", Resource: "/api/v1/users", Action: "read"}))
+	require.NoError(t, policies.Create(ctx, &models.Policy{Role: "support", Resource: "/api/v1/orders", Action: "read"}))
+
+	list, err := policies.List(ctx, store.PolicyQuery{Resource: "/api/v1/orders", Action: "read"})
+	require.NoError(t, err)
+	require.Len(t, list.Items, 2)
+	assert.Equal(t, "admin", list.Items[0].Role)
+	assert.Equal(t, "support", list.Items[1].Role)
+
+	list, err = policies.List(ctx, store.PolicyQuery{Role: "admin", ListOptions: store.ListOptions{Search: "users", Limit: 1}})
+	require.NoError(t, err)
+	require.Len(t, list.Items, 1)
+	assert.Equal(t, "/api/v1/users", list.Items[0].Resource)
+	assert.Empty(t, list.NextCursor)
+
+	require.NoError(t, s.Roles().Create(ctx, &models.Role{Name: "support", Description: "first line"}))
+	require.NoError(t, s.Roles().Create(ctx, &models.Role{Name: "support-lead", Description: "second line"}))
+	roles, err := s.Roles().List(ctx, store.RoleQuery{Name: "support"})
+	require.NoError(t, err)
+	require.Len(t, roles.Items, 1)
+	assert.Equal(t, "first line", roles.Items[0].Description)
+}
+
+func testTenants(t *testing.T, s store.Store) {
+	ctx := context.Background()
+	tenants := s.Tenants()
+
+	def, err := tenants.Get(ctx, models.DefaultTenant)
+	require.NoError(t, err, "the default tenant always exists")
+	assert.Equal(t, models.DefaultTenant, def.ID)
+
+	require.NoError(t, tenants.Create(ctx, &models.Tenant{ID: "acme", Name: "Acme", CreatedAt: time.Now()}))
+	assert.ErrorIs(t, tenants.Create(ctx, &models.Tenant{ID: "acme"}), store.ErrDuplicate)
+	_, err = tenants.Get(ctx, "globex")
+	assert.ErrorIs(t, err, store.ErrNotFound)
+
+	all, err := tenants.List(ctx)
+	require.NoError(t, err)
+	require.Len(t, all, 2)
+	assert.Equal(t, "acme", all[0].ID)
+	assert.Equal(t, "Acme", all[0].Name)
+
+	// Documents without a tenant land in the default one.
+	legacy := &models.Policy{Role: "admin", Resource: "/api/v1/users", Action: "GET"}
+	require.NoError(t, s.Policies().Create(ctx, legacy))
+	assert.Equal(t, models.DefaultTenant, legacy.TenantID)
+
+	role := &models.Role{TenantID: "acme", Name: "admin"}
+	require.NoError(t, s.Roles().Create(ctx, role))
+	require.NoError(t, s.Roles().Create(ctx, &models.Role{Name: "admin"}))
+	user := &models.User{TenantID: "acme", Username: "wile", Roles: models.AssignRoles("admin")}
+	require.NoError(t, s.Users().Create(ctx, user))
+	require.NoError(t, s.Policies().Create(ctx,
+		&models.Policy{TenantID: "acme", Role: "admin", Resource: "/api/v1/users", Action: "GET"}))
+
+	got, err := s.Users().Get(ctx, user.ID.Hex())
+	require.NoError(t, err)
+	assert.Equal(t, "acme", got.TenantID)
+
+	roles, err := s.Roles().List(ctx, store.RoleQuery{TenantID: "acme", Name: "admin"})
+	require.NoError(t, err)
+	require.EqualValues(t, 1, roles.Total)
+	assert.Equal(t, role.ID, roles.Items[0].ID)
+	users, err := s.Users().List(ctx, store.UserQuery{TenantID: models.DefaultTenant})
+	require.NoError(t, err)
+	assert.Zero(t, users.Total)
+	policies, err := s.Policies().List(ctx, store.PolicyQuery{TenantID: "acme"})
+	require.NoError(t, err)
+	assert.EqualValues(t, 1, policies.Total)
+	policies, err = s.Policies().List(ctx, store.PolicyQuery{})
+	require.NoError(t, err)
+	assert.EqualValues(t, 2, policies.Total)
+
+	// Restoring is limited to the given tenant.
+	require.NoError(t, s.Users().SoftDelete(ctx, user.ID.Hex(), 0, "alice"))
+	assert.ErrorIs(t, s.Users().Restore(ctx, user.ID.Hex(), models.DefaultTenant), store.ErrNotFound)
+	require.NoError(t, s.Users().Restore(ctx, user.ID.Hex(), "acme"))
+}
+
+func testGroups(t *testing.T, s store.Store) {
+	ctx := context.Background()
+	groups := s.Groups()
+
+	now := time.Now().Truncate(time.Millisecond)
+	eng := &models.Group{
+		TenantID:  "acme",
+		Name:      "engineering",
+		Roles:     []string{"developer"},
+		Members:   []string{"u2", "u1"},
+		Subgroups: []string{},
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	require.NoError(t, groups.Create(ctx, eng))
+	assert.EqualValues(t, 1, eng.Version)
+	ops := &models.Group{
+		Name:      "ops",
+		Roles:     []string{"operator", "developer"},
+		Members:   []string{"u3"},
+		Subgroups: []string{eng.ID.Hex()},
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	require.NoError(t, groups.Create(ctx, ops))
+	assert.Equal(t, models.DefaultTenant, ops.TenantID)
+
+	got, err := groups.Get(ctx, eng.ID.Hex())
+	require.NoError(t, err)
+	assert.Equal(t, "acme", got.TenantID)
+	assert.Equal(t, []string{"developer"}, got.Roles)
+	assert.Equal(t, []string{"u2", "u1"}, got.Members, "members keep their order")
+	assert.Empty(t, got.Subgroups)
+
+	got.Members = append(got.Members, "u4")
+	got.Roles = nil
+	require.NoError(t, groups.Update(ctx, got))
+	assert.EqualValues(t, 2, got.Version)
+	got, err = groups.Get(ctx, eng.ID.Hex())
+	require.NoError(t, err)
+	assert.Equal(t, []string{"u2", "u1", "u4"}, got.Members)
+	assert.Empty(t, got.Roles)
+
+	count := func(query store.GroupQuery) int64 {
+		t.Helper()
+		page, err := groups.List(ctx, query)
+		require.NoError(t, err)
+		return page.Total
+	}
+	assert.EqualValues(t, 2, count(store.GroupQuery{}))
+	assert.EqualValues(t, 1, count(store.GroupQuery{TenantID: "acme"}))
+	assert.EqualValues(t, 1, count(store.GroupQuery{Member: "u4"}))
+	assert.EqualValues(t, 0, count(store.GroupQuery{Member: "u3", TenantID: "acme"}))
+	assert.EqualValues(t, 1, count(store.GroupQuery{Subgroup: eng.ID.Hex()}))
+	assert.EqualValues(t, 1, count(store.GroupQuery{Role: "developer"}))
+	assert.EqualValues(t, 1, count(store.GroupQuery{Name: "ops", Role: "operator"}))
+	assert.EqualValues(t, 1, count(store.GroupQuery{ListOptions: store.ListOptions{Search: "ENGIN"}}))
+
+	page, err := groups.List(ctx, store.GroupQuery{ListOptions: store.ListOptions{Sort: "-name"}})
+	require.NoError(t, err)
+	require.Len(t, page.Items, 2)
+	assert.Equal(t, "ops", page.Items[0].Name)
+	assert.Equal(t, []string{eng.ID.Hex()}, page.Items[0].Subgroups)
+	assert.Equal(t, []string{"operator", "developer"}, page.Items[0].Roles)
+
+	// Policies can apply to a group instead of a role.
+	require.NoError(t, s.Policies().Create(ctx, &models.Policy{
+		TenantID: "acme", Group: eng.ID.Hex(), Resource: "/api/v1/builds", Action: "POST",
+	}))
+	policies, err := s.Policies().List(ctx, store.PolicyQuery{Group: eng.ID.Hex()})
+	require.NoError(t, err)
+	require.EqualValues(t, 1, policies.Total)
+	assert.Equal(t, "/api/v1/builds", policies.Items[0].Resource)
+	assert.Empty(t, policies.Items[0].Role)
+
+	require.NoError(t, groups.SoftDelete(ctx, eng.ID.Hex(), got.Version, "alice"))
+	_, err = groups.Get(ctx, eng.ID.Hex())
+	assert.ErrorIs(t, err, store.ErrNotFound)
+	assert.EqualValues(t, 1, count(store.GroupQuery{ListOptions: store.ListOptions{Deleted: true}}))
+	assert.ErrorIs(t, groups.Restore(ctx, eng.ID.Hex(), models.DefaultTenant), store.ErrNotFound)
+	require.NoError(t, groups.Restore(ctx, eng.ID.Hex(), "acme"))
+
+	require.NoError(t, groups.SoftDelete(ctx, ops.ID.Hex(), 0, "alice"))
+	purged, err := groups.Purge(ctx, time.Now().Add(time.Minute))
+	require.NoError(t, err)
+	assert.EqualValues(t, 1, purged)
+
+	assert.ErrorIs(t, groups.Delete(ctx, eng.ID.Hex(), 1), store.ErrVersionConflict)
+	require.NoError(t, groups.Delete(ctx, eng.ID.Hex(), 0))
+	assert.Zero(t, count(store.GroupQuery{}))
+}
+
+func testElevations(t *testing.T, s store.Store) {
+	ctx := context.Background()
+	elevations := s.Elevations()
+
+	now := time.Now().UTC().Truncate(time.Second)
+	request := &models.Elevation{
+		TenantID:      "acme",
+		UserID:        "u1",
+		Role:          "dba",
+		Hours:         2,
+		Justification: "restore the orders table",
+		Status:        models.ElevationPending,
+		CreatedAt:     now,
+		UpdatedAt:     now,
+	}
+	require.NoError(t, elevations.Create(ctx, request))
+	assert.EqualValues(t, 1, request.Version)
+	other := &models.Elevation{UserID: "u2", Role: "dba", Hours: 1, Status: models.ElevationPending, CreatedAt: now, UpdatedAt: now}
+	require.NoError(t, elevations.Create(ctx, other))
+	assert.Equal(t, models.DefaultTenant, other.TenantID)
+
+	_, err := elevations.Get(ctx, "not-an-id")
+	assert.ErrorIs(t, err, store.ErrInvalidID)
+
+	got, err := elevations.Get(ctx, request.ID.Hex())
+	require.NoError(t, err)
+	assert.Equal(t, "restore the orders table", got.Justification)
+	assert.Nil(t, got.ExpiresAt)
+
+	// Approving one that has since expired.
+	expiresAt := now.Add(-time.Minute)
+	got.Status = models.ElevationApproved
+	got.DecidedBy = "u9"
+	got.DecidedAt = &now
+	got.ExpiresAt = &expiresAt
+	require.NoError(t, elevations.Update(ctx, got))
+	assert.EqualValues(t, 2, got.Version)
+
+	stale := *request
+	stale.Status = models.ElevationDenied
+	assert.ErrorIs(t, elevations.Update(ctx, &stale), store.ErrVersionConflict)
+
+	got, err = elevations.Get(ctx, request.ID.Hex())
+	require.NoError(t, err)
+	assert.Equal(t, models.ElevationApproved, got.Status)
+	assert.Equal(t, "u9", got.DecidedBy)
+	require.NotNil(t, got.ExpiresAt)
+	assert.True(t, expiresAt.Equal(*got.ExpiresAt))
+
+	expired, err := elevations.Expired(ctx, now)
+	require.NoError(t, err)
+	require.Len(t, expired, 1)
+	assert.Equal(t, request.ID, expired[0].ID)
+	expired, err = elevations.Expired(ctx, now.Add(-time.Hour))
+	require.NoError(t, err)
+	assert.Empty(t, expired)
+
+	page, err := elevations.List(ctx, store.ElevationQuery{TenantID: "acme", Status: models.ElevationApproved})
+	require.NoError(t, err)
+	require.EqualValues(t, 1, page.Total)
+	assert.Equal(t, request.ID, page.Items[0].ID)
+	page, err = elevations.List(ctx, store.ElevationQuery{Role: "dba", UserID: "u2"})
+	require.NoError(t, err)
+	require.EqualValues(t, 1, page.Total)
+	assert.Equal(t, other.ID, page.Items[0].ID)
+	page, err = elevations.List(ctx, store.ElevationQuery{ListOptions: store.ListOptions{Search: "ORDERS"}})
+	require.NoError(t, err)
+	assert.EqualValues(t, 1, page.Total)
+}
+
+func testTuples(t *testing.T, s store.Store) {
+	ctx := context.Background()
+	tuples := s.Tuples()
+
+	parse := func(raw ...string) []models.RelationTuple {
+		var out []models.RelationTuple
+		for _, r := range raw {
+			tuple, err := models.ParseTuple(r)
+			require.NoError(t, err)
+			out = append(out, tuple)
+		}
+		return out
+	}
+	read := func(filter store.TupleFilter, revision int64) []string {
+		got, err := tuples.Read(ctx, filter, revision)
+		require.NoError(t, err)
+		var out []string
+		for _, tuple := range got {
+			out = append(out, tuple.String())
+		}
+		return out
+	}
+
+	revision, err := tuples.Revision(ctx, "acme")
+	require.NoError(t, err)
+	assert.Zero(t, revision)
+
+	first, err := tuples.Write(ctx, "acme", parse(
+		"document:42#owner@user:alice",
+		"document:42#viewer@group:eng#member",
+		"group:eng#member@user:bob",
+	), nil)
+	require.NoError(t, err)
+	assert.EqualValues(t, 1, first)
+	_, err = tuples.Write(ctx, "globex", parse("document:42#owner@user:mallory"), nil)
+	require.NoError(t, err)
+
+	// Deleting a missing tuple and re-inserting a live one are no-ops, but
+	// still take a revision.
+	second, err := tuples.Write(ctx, "acme",
+		parse("document:42#owner@user:alice", "document:7#owner@user:alice"),
+		parse("document:42#viewer@group:eng#member", "document:42#owner@user:nobody"))
+	require.NoError(t, err)
+	assert.EqualValues(t, 2, second)
+	revision, err = tuples.Revision(ctx, "acme")
+	require.NoError(t, err)
+	assert.Equal(t, second, revision)
+
+	assert.Equal(t, []string{
+		"document:42#owner@user:alice",
+		"document:7#owner@user:alice",
+		"group:eng#member@user:bob",
+	}, read(store.TupleFilter{TenantID: "acme"}, second))
+	assert.Equal(t, []string{
+		"document:42#owner@user:alice",
+		"document:42#viewer@group:eng#member",
+		"group:eng#member@user:bob",
+	}, read(store.TupleFilter{TenantID: "acme"}, first), "reads at an older revision see deleted tuples")
+	assert.Empty(t, read(store.TupleFilter{TenantID: "acme"}, 0))
+
+	assert.Equal(t, []string{"document:42#owner@user:alice"},
+		read(store.TupleFilter{TenantID: "acme", ObjectType: "document", ObjectID: "42", Relation: "owner"}, second))
+	assert.Equal(t, []string{"document:42#owner@user:alice", "document:7#owner@user:alice"},
+		read(store.TupleFilter{TenantID: "acme", SubjectType: "user", SubjectID: "alice"}, second))
+	assert.Equal(t, []string{"document:42#viewer@group:eng#member"},
+		read(store.TupleFilter{TenantID: "acme", SubjectType: "group", SubjectID: "eng", SubjectRelation: "member"}, first))
+	assert.Empty(t, read(store.TupleFilter{TenantID: "acme", SubjectType: "group", SubjectID: "eng"}, first),
+		"a subject filter matches the subject relation exactly")
+
+	// A deleted tuple can be written again.
+	third, err := tuples.Write(ctx, "acme", parse("document:42#viewer@group:eng#member"), nil)
+	require.NoError(t, err)
+	assert.Len(t, read(store.TupleFilter{TenantID: "acme", Relation: "viewer"}, third), 1)
+	assert.Empty(t, read(store.TupleFilter{TenantID: "acme", Relation: "viewer"}, second))
+}
+
+func testReplacePolicies(t *testing.T, s store.Store) {
+	ctx := context.Background()
+	policies := s.Policies()
+
+	now := time.Now().UTC().Truncate(time.Second)
+	kept := &models.Policy{TenantID: "acme", Role: "viewer", Resource: "/docs", Action: "read", CreatedAt: now, UpdatedAt: now}
+	edited := &models.Policy{TenantID: "acme", Role: "editor", Resource: "/docs", Action: "write", CreatedAt: now, UpdatedAt: now}
+	dropped := &models.Policy{TenantID: "acme", Role: "intern", Resource: "/docs", Action: "write", CreatedAt: now, UpdatedAt: now}
+	trashed := &models.Policy{TenantID: "acme", Role: "auditor", Resource: "/logs", Action: "read", CreatedAt: now, UpdatedAt: now}
+	other := &models.Policy{TenantID: "globex", Role: "intern", Resource: "/docs", Action: "write", CreatedAt: now, UpdatedAt: now}
+	for _, p := range []*models.Policy{kept, edited, dropped, trashed, other} {
+		require.NoError(t, policies.Create(ctx, p))
+	}
+	require.NoError(t, policies.SoftDelete(ctx, trashed.ID.Hex(), 0, "u1"))
+
+	wantEdited := *edited
+	wantEdited.Conditions.IPRange = []string{"10.0.0.0/8"}
+	wantTrashed := *trashed
+	added := models.Policy{Role: "viewer", Resource: "/wiki", Action: "read"}
+	changes, err := policies.ReplaceAll(ctx, "acme", []models.Policy{*kept, wantEdited, wantTrashed, added}, "u2")
+	require.NoError(t, err)
+	assert.Len(t, changes, 4, "the unchanged policy is left alone")
+
+	byRole := map[string]store.PolicyChange{}
+	for _, change := range changes {
+		byRole[change.After.Role+change.After.Resource] = change
+	}
+	require.NotNil(t, byRole["viewer/wiki"].After)
+	assert.Nil(t, byRole["viewer/wiki"].Before)
+	assert.EqualValues(t, 2, byRole["editor/docs"].After.Version)
+	assert.NotNil(t, byRole["intern/docs"].After.DeletedAt)
+	assert.Equal(t, "u2", byRole["intern/docs"].After.DeletedBy)
+	assert.Nil(t, byRole["auditor/logs"].After.DeletedAt)
+
+	live, err := policies.List(ctx, store.PolicyQuery{TenantID: "acme"})
+	require.NoError(t, err)
+	var got []string
+	for _, p := range live.Items {
+		got = append(got, p.Role+p.Resource)
+	}
+	assert.ElementsMatch(t, []string{"viewer/docs", "editor/docs", "auditor/logs", "viewer/wiki"}, got)
+
+	stored, err := policies.Get(ctx, edited.ID.Hex())
+	require.NoError(t, err)
+	assert.Equal(t, []string{"10.0.0.0/8"}, stored.Conditions.IPRange)
+	assert.EqualValues(t, 2, stored.Version)
+	stored, err = policies.Get(ctx, kept.ID.Hex())
+	require.NoError(t, err)
+	assert.EqualValues(t, 1, stored.Version)
+	_, err = policies.Get(ctx, other.ID.Hex())
+	assert.NoError(t, err, "other tenants are untouched")
+
+	// Replacing with what is stored changes nothing.
+	live, err = policies.List(ctx, store.PolicyQuery{TenantID: "acme"})
+	require.NoError(t, err)
+	changes, err = policies.ReplaceAll(ctx, "acme", live.Items, "u2")
+	require.NoError(t, err)
+	assert.Empty(t, changes)
+}
+
+func testRevisions(t *testing.T, s store.Store) {
+	ctx := context.Background()
+	revisions := s.Revisions()
+
+	now := time.Now().UTC().Truncate(time.Second)
+	policy := models.Policy{ID: primitive.NewObjectID(), TenantID: "acme", Role: "viewer", Resource: "/docs", Action: "read",
+		Conditions: models.PolicyConditions{Expression: `subject.department == "eng"`}, Version: 1, CreatedAt: now, UpdatedAt: now}
+	for _, version := range []int64{2, 1} {
+		revision := policy
+		revision.Version = version
+		require.NoError(t, revisions.Append(ctx, &models.Revision{
+			TenantID: "acme", Kind: models.RevisionKindPolicy, DocumentID: policy.ID.Hex(), Version: version,
+			Action: models.RevisionUpdate, Actor: "u1", Policy: &revision, CreatedAt: now,
+		}))
+	}
+	duplicate := &models.Revision{Kind: models.RevisionKindPolicy, DocumentID: policy.ID.Hex(), Version: 2, Policy: &policy, CreatedAt: now}
+	assert.ErrorIs(t, revisions.Append(ctx, duplicate), store.ErrDuplicate)
+
+	role := models.Role{ID: primitive.NewObjectID(), TenantID: "acme", Name: "viewer", Permissions: []string{"read"}, Version: 1}
+	require.NoError(t, revisions.Append(ctx, &models.Revision{
+		TenantID: "acme", Kind: models.RevisionKindRole, DocumentID: role.ID.Hex(), Version: 1,
+		Action: models.RevisionCreate, Role: &role, CreatedAt: now,
+	}))
+
+	history, err := revisions.List(ctx, models.RevisionKindPolicy, policy.ID.Hex())
+	require.NoError(t, err)
+	require.Len(t, history, 2)
+	assert.EqualValues(t, 1, history[0].Version)
+	assert.EqualValues(t, 2, history[1].Version)
+	assert.Equal(t, "u1", history[1].Actor)
+	require.NotNil(t, history[1].Policy)
+	assert.Equal(t, policy.Conditions, history[1].Policy.Conditions)
+	assert.True(t, now.Equal(history[1].CreatedAt))
+
+	history, err = revisions.List(ctx, models.RevisionKindRole, role.ID.Hex())
+	require.NoError(t, err)
+	require.Len(t, history, 1)
+	require.NotNil(t, history[0].Role)
+	assert.Equal(t, []string{"read"}, history[0].Role.Permissions)
+	history, err = revisions.List(ctx, models.RevisionKindRole, policy.ID.Hex())
+	require.NoError(t, err)
+	assert.Empty(t, history)
+
+	snapshots := s.Snapshots()
+	first := &models.PolicySnapshot{TenantID: "acme", Description: "before the migration", Policies: []models.Policy{policy},
+		CreatedBy: "u1", CreatedAt: now}
+	require.NoError(t, snapshots.Create(ctx, first))
+	second := &models.PolicySnapshot{TenantID: "acme", Policies: []models.Policy{}, CreatedAt: now.Add(time.Minute)}
+	require.NoError(t, snapshots.Create(ctx, second))
+	require.NoError(t, snapshots.Create(ctx, &models.PolicySnapshot{TenantID: "globex", CreatedAt: now}))
+
+	got, err := snapshots.Get(ctx, first.ID.Hex())
+	require.NoError(t, err)
+	assert.Equal(t, "before the migration", got.Description)
+	require.Len(t, got.Policies, 1)
+	assert.Equal(t, policy.ID, got.Policies[0].ID)
+	assert.Equal(t, policy.Conditions, got.Policies[0].Conditions)
+	_, err = snapshots.Get(ctx, primitive.NewObjectID().Hex())
+	assert.ErrorIs(t, err, store.ErrNotFound)
+
+	list, err := snapshots.List(ctx, "acme")
+	require.NoError(t, err)
+	require.Len(t, list, 2)
+	assert.Equal(t, second.ID, list[0].ID, "newest first")
+}
+
+func testRecordedWrites(t *testing.T, s store.Store) {
+	ctx := context.Background()
+	recorded := store.WithRevision(ctx, models.RevisionUpdate, "u1")
+	policies, roles, revisions := s.Policies(), s.Roles(), s.Revisions()
+
+	policy := &models.Policy{TenantID: "acme", Role: "viewer", Resource: "/docs", Action: "read"}
+	require.NoError(t, policies.Create(recorded, policy))
+	policy.Action = "write"
+	require.NoError(t, policies.Update(recorded, policy))
+	require.NoError(t, policies.SoftDelete(recorded, policy.ID.Hex(), 0, "u1"))
+	require.NoError(t, policies.Restore(recorded, policy.ID.Hex(), "acme"))
+	history, err := revisions.List(ctx, models.RevisionKindPolicy, policy.ID.Hex())
+	require.NoError(t, err)
+	require.Len(t, history, 4)
+	assert.Equal(t, "u1", history[1].Actor)
+	require.NotNil(t, history[1].Policy)
+	assert.Equal(t, "write", history[1].Policy.Action)
+	assert.NotNil(t, history[2].Policy.DeletedAt)
+	assert.Nil(t, history[3].Policy.DeletedAt)
+
+	// Writes without WithRevision are not recorded.
+	policy, err = policies.Get(ctx, policy.ID.Hex())
+	require.NoError(t, err)
+	policy.Action = "delete"
+	require.NoError(t, policies.Update(ctx, policy))
+	history, err = revisions.List(ctx, models.RevisionKindPolicy, policy.ID.Hex())
+	require.NoError(t, err)
+	assert.Len(t, history, 4)
+
+	// A revision that cannot be written undoes the write.
+	require.NoError(t, revisions.Append(ctx, &models.Revision{
+		Kind: models.RevisionKindPolicy, DocumentID: policy.ID.Hex(), Version: policy.Version + 1,
+	}))
+	policy.Action = "admin"
+	assert.ErrorIs(t, policies.Update(recorded, policy), store.ErrDuplicate)
+	stored, err := policies.Get(ctx, policy.ID.Hex())
+	require.NoError(t, err)
+	assert.Equal(t, "delete", stored.Action)
+	assert.EqualValues(t, 5, stored.Version)
+	assert.ErrorIs(t, policies.SoftDelete(recorded, policy.ID.Hex(), 0, "u1"), store.ErrDuplicate)
+	stored, err = policies.Get(ctx, policy.ID.Hex())
+	require.NoError(t, err)
+	assert.Nil(t, stored.DeletedAt)
+
+	role := &models.Role{TenantID: "acme", Name: "viewer", Permissions: []string{"read"}}
+	require.NoError(t, roles.Create(recorded, role))
+	require.NoError(t, revisions.Append(ctx, &models.Revision{
+		Kind: models.RevisionKindRole, DocumentID: role.ID.Hex(), Version: 2,
+	}))
+	role.Permissions = []string{"read", "write"}
+	assert.ErrorIs(t, roles.Update(recorded, role), store.ErrDuplicate)
+	storedRole, err := roles.Get(ctx, role.ID.Hex())
+	require.NoError(t, err)
+	assert.Equal(t, []string{"read"}, storedRole.Permissions)
+	assert.EqualValues(t, 1, storedRole.Version)
+	history, err = revisions.List(ctx, models.RevisionKindRole, role.ID.Hex())
+	require.NoError(t, err)
+	require.Len(t, history, 2)
+	assert.Equal(t, []string{"read"}, history[0].Role.Permissions)
+}
+
+func testMagicLinks(t *testing.T, s store.Store) {
+	ctx := context.Background()
+	links := s.MagicLinks()
+
+	user := &models.User{Username: "alice", Email: "a@example.org"}
+	require.NoError(t, s.Users().Create(ctx, user))
+
+	now := time.Now()
+	active := &models.MagicLink{UserID: user.ID, Email: user.Email, TokenHash: "active", ExpiresAt: now.Add(time.Minute), CreatedAt: now}
+	expired := &models.MagicLink{UserID: user.ID, Email: user.Email, TokenHash: "expired", ExpiresAt: now.Add(-time.Minute), CreatedAt: now.Add(-2 * time.Hour)}
+	require.NoError(t, links.Create(ctx, active))
+	require.NoError(t, links.Create(ctx, expired))
+
+	// Requests are counted per email and window, whether or not the email
+	// has an account.
+	window := now.Truncate(time.Hour)
+	record := func(email string, window time.Time) bool {
+		allowed, err := links.RecordRequest(ctx, email, window, 2)
+		require.NoError(t, err)
+		return allowed
+	}
+	assert.True(t, record(user.Email, window))
+	assert.True(t, record(user.Email, window.Add(-time.Hour)))
+	assert.True(t, record(user.Email, window))
+	assert.False(t, record(user.Email, window))
+	assert.True(t, record("nobody@example.org", window))
+
+	// Of concurrent requests, only as many as the limit allows are counted.
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	counted := 0
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			allowed, err := links.RecordRequest(ctx, "carol@example.org", window, 3)
+			assert.NoError(t, err)
+			if allowed {
+				mu.Lock()
+				counted++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, 3, counted)
+
+	_, err := links.GetActive(ctx, "expired")
+	assert.ErrorIs(t, err, store.ErrNotFound)
+
+	link, err := links.GetActive(ctx, "active")
+	require.NoError(t, err)
+	assert.Equal(t, user.ID, link.UserID)
+
+	// Only one of several concurrent claims wins.
+	claimed := 0
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if links.Claim(ctx, link.ID.Hex()) == nil {
+				mu.Lock()
+				claimed++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, 1, claimed)
+
+	_, err = links.GetActive(ctx, "active")
+	assert.ErrorIs(t, err, store.ErrNotFound)
+}
+
+func testAuditLogs(t *testing.T, s store.Store) {
+	entry := &models.AuditEntry{Event: models.AuditEventImpersonationStart, SubjectID: "target", ActorID: "admin", Status: 200}
+	require.NoError(t, s.AuditLogs().Write(context.Background(), entry))
+	assert.False(t, entry.ID.IsZero())
+	assert.False(t, entry.CreatedAt.IsZero())
+}
@@ -0,0 +1,591 @@
+package abac
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Limits that keep conditions cheap to store and evaluate.
+const (
+	MaxLength = 2048
+	maxDepth  = 32
+)
+
+var (
+	// ErrInvalidCondition is returned for conditions that do not parse or
+	// type-check.
+	ErrInvalidCondition = errors.New("invalid condition")
+	// ErrMissingAttribute is returned when a condition refers to an
+	// attribute the request does not have.
+	ErrMissingAttribute = errors.New("missing attribute")
+)
+
+// Attributes are the values a condition is evaluated against, by
+// namespace.
+type Attributes struct {
+	Subject  map[string]interface{}
+	Resource map[string]interface{}
+	Env      map[string]interface{}
+}
+
+func (a Attributes) get(namespace, name string) (interface{}, bool) {
+	var values map[string]interface{}
+	switch namespace {
+	case NamespaceSubject:
+		values = a.Subject
+	case NamespaceResource:
+		values = a.Resource
+	case NamespaceEnv:
+		values = a.Env
+	}
+	value, ok := values[name]
+	return value, ok
+}
+
+// Condition is a parsed and type-checked condition.
+//
+// The grammar, loosest binding first:
+//
+//	or      = and { "||" and }
+//	and     = not { "&&" not }
+//	not     = "!" not | compare
+//	compare = operand [ ( "==" | "!=" | "<" | "<=" | ">" | ">=" | "in" ) operand ]
+//	operand = string | number | "true" | "false" | attribute
+//	        | "[" [ operand { "," operand } ] "]" | "(" or ")"
+//
+// Strings are double or single quoted. == and != compare strings, numbers
+// or bools of the same type; the orderings compare numbers, or strings
+// lexically; "in" tests a string for membership of a list.
+type Condition struct {
+	source string
+	root   node
+}
+
+// Compile parses source and type-checks it against schema. The condition
+// must be boolean.
+func Compile(source string, schema *Schema) (*Condition, error) {
+	if len(source) > MaxLength {
+		return nil, fmt.Errorf("%w: longer than %d characters", ErrInvalidCondition, MaxLength)
+	}
+
+	tokens, err := lex(source)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{tokens: tokens}
+	root, err := p.or(0)
+	if err != nil {
+		return nil, err
+	}
+	if next := p.peek(); next.kind != tokenEOF {
+		return nil, invalid(next.pos, "unexpected %s", next)
+	}
+
+	typ, err := typeOf(root, schema)
+	if err != nil {
+		return nil, err
+	}
+	if typ != TypeBool {
+		return nil, invalid(0, "condition is a %s, not a bool", typ)
+	}
+	return &Condition{source: source, root: root}, nil
+}
+
+// String returns the source of the condition.
+func (c *Condition) String() string {
+	return c.source
+}
+
+// Eval reports whether the condition holds for attrs. It returns
+// ErrMissingAttribute if it needs an attribute attrs lacks, or one whose
+// value does not have the declared type.
+func (c *Condition) Eval(attrs Attributes) (bool, error) {
+	value, err := c.root.eval(attrs)
+	if err != nil {
+		return false, err
+	}
+	return value.(bool), nil
+}
+
+func invalid(pos int, format string, args ...interface{}) error {
+	return fmt.Errorf("%w: %s at position %d", ErrInvalidCondition, fmt.Sprintf(format, args...), pos)
+}
+
+// Lexer
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenIdent
+	tokenString
+	tokenNumber
+	tokenOp
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+func (t token) String() string {
+	if t.kind == tokenEOF {
+		return "end of condition"
+	}
+	return fmt.Sprintf("%q", t.text)
+}
+
+var operators = []string{"&&", "||", "==", "!=", "<=", ">=", "<", ">", "!", "(", ")", "[", "]", ","}
+
+func lex(source string) ([]token, error) {
+	var tokens []token
+	for i := 0; i < len(source); {
+		c := rune(source[i])
+		switch {
+		case unicode.IsSpace(c):
+			i++
+
+		case c == '"' || c == '\'':
+			end := i + 1
+			for end < len(source) && rune(source[end]) != c {
+				if source[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			if end >= len(source) {
+				return nil, invalid(i, "unterminated string")
+			}
+			text, err := unquote(source[i : end+1])
+			if err != nil {
+				return nil, invalid(i, "bad string: %v", err)
+			}
+			tokens = append(tokens, token{kind: tokenString, text: text, pos: i})
+			i = end + 1
+
+		case unicode.IsDigit(c) || c == '-' && i+1 < len(source) && unicode.IsDigit(rune(source[i+1])):
+			end := i + 1
+			for end < len(source) && (unicode.IsDigit(rune(source[end])) || source[end] == '.') {
+				end++
+			}
+			tokens = append(tokens, token{kind: tokenNumber, text: source[i:end], pos: i})
+			i = end
+
+		case c == '_' || unicode.IsLetter(c):
+			end := i
+			for end < len(source) && (source[end] == '_' || source[end] == '.' ||
+				unicode.IsLetter(rune(source[end])) || unicode.IsDigit(rune(source[end]))) {
+				end++
+			}
+			tokens = append(tokens, token{kind: tokenIdent, text: source[i:end], pos: i})
+			i = end
+
+		default:
+			op := ""
+			for _, candidate := range operators {
+				if strings.HasPrefix(source[i:], candidate) {
+					op = candidate
+					break
+				}
+			}
+			if op == "" {
+				return nil, invalid(i, "unexpected character %q", c)
+			}
+			tokens = append(tokens, token{kind: tokenOp, text: op, pos: i})
+			i += len(op)
+		}
+	}
+	return append(tokens, token{kind: tokenEOF, pos: len(source)}), nil
+}
+
+// unquote decodes a double or single quoted string, in which a backslash
+// escapes \\, \", \', \n and \t.
+func unquote(quoted string) (string, error) {
+	body := quoted[1 : len(quoted)-1]
+	var b strings.Builder
+	for i := 0; i < len(body); i++ {
+		if body[i] != '\\' {
+			b.WriteByte(body[i])
+			continue
+		}
+		i++
+		switch body[i] {
+		case '\\', '"', '\'':
+			b.WriteByte(body[i])
+		case 'n':
+			b.WriteByte('\n')
+		case 't':
+			b.WriteByte('\t')
+		default:
+			return "", fmt.Errorf("unknown escape \\%c", body[i])
+		}
+	}
+	return b.String(), nil
+}
+
+// Parser
+
+type parser struct {
+	tokens []token
+	next   int
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.next]
+}
+
+func (p *parser) take() token {
+	t := p.tokens[p.next]
+	if t.kind != tokenEOF {
+		p.next++
+	}
+	return t
+}
+
+// accept takes the next token if it is the operator or keyword text.
+func (p *parser) accept(text string) (token, bool) {
+	t := p.peek()
+	if (t.kind == tokenOp || t.kind == tokenIdent) && t.text == text {
+		return p.take(), true
+	}
+	return t, false
+}
+
+func (p *parser) or(depth int) (node, error) {
+	return p.binary(depth, "||", p.and)
+}
+
+func (p *parser) and(depth int) (node, error) {
+	return p.binary(depth, "&&", p.not)
+}
+
+func (p *parser) binary(depth int, op string, operand func(int) (node, error)) (node, error) {
+	left, err := operand(depth)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		t, ok := p.accept(op)
+		if !ok {
+			return left, nil
+		}
+		right, err := operand(depth)
+		if err != nil {
+			return nil, err
+		}
+		left = &binaryNode{at: t.pos, op: op, left: left, right: right}
+	}
+}
+
+func (p *parser) not(depth int) (node, error) {
+	t, ok := p.accept("!")
+	if !ok {
+		return p.compare(depth)
+	}
+	if depth >= maxDepth {
+		return nil, invalid(t.pos, "nested too deeply")
+	}
+	operand, err := p.not(depth + 1)
+	if err != nil {
+		return nil, err
+	}
+	return &notNode{at: t.pos, operand: operand}, nil
+}
+
+var comparisons = []string{"==", "!=", "<", "<=", ">", ">=", "in"}
+
+func (p *parser) compare(depth int) (node, error) {
+	left, err := p.operand(depth)
+	if err != nil {
+		return nil, err
+	}
+	t := p.peek()
+	if (t.kind != tokenOp && t.kind != tokenIdent) || !slices.Contains(comparisons, t.text) {
+		return left, nil
+	}
+	p.take()
+	right, err := p.operand(depth)
+	if err != nil {
+		return nil, err
+	}
+	return &binaryNode{at: t.pos, op: t.text, left: left, right: right}, nil
+}
+
+func (p *parser) operand(depth int) (node, error) {
+	t := p.take()
+	switch t.kind {
+	case tokenString:
+		return &literalNode{at: t.pos, typ: TypeString, value: t.text}, nil
+
+	case tokenNumber:
+		n, err := strconv.ParseFloat(t.text, 64)
+		if err != nil {
+			return nil, invalid(t.pos, "bad number %q", t.text)
+		}
+		return &literalNode{at: t.pos, typ: TypeNumber, value: n}, nil
+
+	case tokenIdent:
+		switch t.text {
+		case "true", "false":
+			return &literalNode{at: t.pos, typ: TypeBool, value: t.text == "true"}, nil
+		}
+		namespace, name, ok := strings.Cut(t.text, ".")
+		if !ok || name == "" || strings.Contains(name, ".") {
+			return nil, invalid(t.pos, "%s is not an attribute; write subject.<name>, resource.<name> or env.<name>", t)
+		}
+		return &attributeNode{at: t.pos, namespace: namespace, name: name}, nil
+
+	case tokenOp:
+		if (t.text == "(" || t.text == "[") && depth >= maxDepth {
+			return nil, invalid(t.pos, "nested too deeply")
+		}
+		switch t.text {
+		case "(":
+			inner, err := p.or(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			if closing, ok := p.accept(")"); !ok {
+				return nil, invalid(closing.pos, "expected \")\", found %s", closing)
+			}
+			return inner, nil
+
+		case "[":
+			list := &listNode{at: t.pos}
+			if _, ok := p.accept("]"); ok {
+				return list, nil
+			}
+			for {
+				item, err := p.operand(depth + 1)
+				if err != nil {
+					return nil, err
+				}
+				list.items = append(list.items, item)
+				if _, ok := p.accept(","); ok {
+					continue
+				}
+				if closing, ok := p.accept("]"); !ok {
+					return nil, invalid(closing.pos, "expected \",\" or \"]\", found %s", closing)
+				}
+				return list, nil
+			}
+		}
+	}
+	return nil, invalid(t.pos, "unexpected %s", t)
+}
+
+// Syntax tree
+
+type node interface {
+	pos() int
+	eval(attrs Attributes) (interface{}, error)
+}
+
+type literalNode struct {
+	at    int
+	typ   Type
+	value interface{}
+}
+
+type attributeNode struct {
+	at        int
+	namespace string
+	name      string
+	typ       Type // set by typeOf
+}
+
+type listNode struct {
+	at    int
+	items []node
+}
+
+type notNode struct {
+	at      int
+	operand node
+}
+
+type binaryNode struct {
+	at          int
+	op          string
+	left, right node
+}
+
+func (n *literalNode) pos() int   { return n.at }
+func (n *attributeNode) pos() int { return n.at }
+func (n *listNode) pos() int      { return n.at }
+func (n *notNode) pos() int       { return n.at }
+func (n *binaryNode) pos() int    { return n.at }
+
+// Type checking
+
+func typeOf(n node, schema *Schema) (Type, error) {
+	switch n := n.(type) {
+	case *literalNode:
+		return n.typ, nil
+
+	case *attributeNode:
+		switch n.namespace {
+		case NamespaceSubject, NamespaceResource, NamespaceEnv:
+		default:
+			return TypeInvalid, invalid(n.at, "unknown attribute namespace %q", n.namespace)
+		}
+		typ, ok := schema.Lookup(n.namespace, n.name)
+		if !ok {
+			return TypeInvalid, invalid(n.at, "unknown attribute %s.%s", n.namespace, n.name)
+		}
+		n.typ = typ
+		return typ, nil
+
+	case *listNode:
+		for _, item := range n.items {
+			typ, err := typeOf(item, schema)
+			if err != nil {
+				return TypeInvalid, err
+			}
+			if typ != TypeString {
+				return TypeInvalid, invalid(item.pos(), "list items must be strings, not %s", typ)
+			}
+		}
+		return TypeList, nil
+
+	case *notNode:
+		typ, err := typeOf(n.operand, schema)
+		if err != nil {
+			return TypeInvalid, err
+		}
+		if typ != TypeBool {
+			return TypeInvalid, invalid(n.at, "! needs a bool, not a %s", typ)
+		}
+		return TypeBool, nil
+
+	case *binaryNode:
+		left, err := typeOf(n.left, schema)
+		if err != nil {
+			return TypeInvalid, err
+		}
+		right, err := typeOf(n.right, schema)
+		if err != nil {
+			return TypeInvalid, err
+		}
+
+		ok := false
+		switch n.op {
+		case "&&", "||":
+			ok = left == TypeBool && right == TypeBool
+		case "==", "!=":
+			ok = left == right && left != TypeList
+		case "<", "<=", ">", ">=":
+			ok = left == right && (left == TypeNumber || left == TypeString)
+		case "in":
+			ok = left == TypeString && right == TypeList
+		}
+		if !ok {
+			return TypeInvalid, invalid(n.at, "cannot apply %s to %s and %s", n.op, left, right)
+		}
+		return TypeBool, nil
+	}
+	return TypeInvalid, invalid(n.pos(), "unknown expression")
+}
+
+// Evaluation
+
+func (n *literalNode) eval(Attributes) (interface{}, error) {
+	return n.value, nil
+}
+
+func (n *attributeNode) eval(attrs Attributes) (interface{}, error) {
+	raw, ok := attrs.get(n.namespace, n.name)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s.%s", ErrMissingAttribute, n.namespace, n.name)
+	}
+	value, ok := convert(raw, n.typ)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s.%s is not a %s", ErrMissingAttribute, n.namespace, n.name, n.typ)
+	}
+	return value, nil
+}
+
+func (n *listNode) eval(attrs Attributes) (interface{}, error) {
+	list := make([]string, len(n.items))
+	for i, item := range n.items {
+		value, err := item.eval(attrs)
+		if err != nil {
+			return nil, err
+		}
+		list[i] = value.(string)
+	}
+	return list, nil
+}
+
+func (n *notNode) eval(attrs Attributes) (interface{}, error) {
+	value, err := n.operand.eval(attrs)
+	if err != nil {
+		return nil, err
+	}
+	return !value.(bool), nil
+}
+
+func (n *binaryNode) eval(attrs Attributes) (interface{}, error) {
+	left, err := n.left.eval(attrs)
+	if err != nil {
+		return nil, err
+	}
+	switch n.op {
+	case "&&":
+		if !left.(bool) {
+			return false, nil
+		}
+		return n.right.eval(attrs)
+	case "||":
+		if left.(bool) {
+			return true, nil
+		}
+		return n.right.eval(attrs)
+	}
+
+	right, err := n.right.eval(attrs)
+	if err != nil {
+		return nil, err
+	}
+	switch n.op {
+	case "==":
+		return left == right, nil
+	case "!=":
+		return left != right, nil
+	case "in":
+		return slices.Contains(right.([]string), left.(string)), nil
+	}
+
+	var order int
+	switch left := left.(type) {
+	case float64:
+		order = compareNumbers(left, right.(float64))
+	case string:
+		order = strings.Compare(left, right.(string))
+	}
+	switch n.op {
+	case "<":
+		return order < 0, nil
+	case "<=":
+		return order <= 0, nil
+	case ">":
+		return order > 0, nil
+	default:
+		return order >= 0, nil
+	}
+}
+
+func compareNumbers(a, b float64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
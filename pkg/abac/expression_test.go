@@ -0,0 +1,120 @@
+package abac
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testSchema = &Schema{
+	Subject:  map[string]Type{"department": TypeString, "clearance": TypeNumber, "teams": TypeList, "contractor": TypeBool},
+	Resource: map[string]Type{"department": TypeString, "classification": TypeNumber, "owner": TypeString},
+}
+
+func TestCompileRejects(t *testing.T) {
+	for source, reason := range map[string]string{
+		``:                                     "unexpected end of condition",
+		`subject.department`:                   "condition is a string, not a bool",
+		`subject.clearance >= "3"`:             "cannot apply >= to number and string",
+		`subject.department == 1`:              "cannot apply == to string and number",
+		`subject.teams == ["a"]`:               "cannot apply == to list and list",
+		`subject.clearance in subject.teams`:   "cannot apply in to number and list",
+		`!subject.department`:                  "! needs a bool, not a string",
+		`["a", 1] == ["a"]`:                    "list items must be strings, not number",
+		`subject.salary > 10`:                  "unknown attribute subject.salary",
+		`resource.owner == subject.id && true`: "",
+		`user.name == "x"`:                     "unknown attribute namespace \"user\"",
+		`department == "x"`:                    "\"department\" is not an attribute",
+		`subject.department == "x`:             "unterminated string",
+		`subject.department == "x" &&`:         "unexpected end of condition",
+		`(subject.contractor`:                  "expected \")\", found end of condition",
+		`subject.contractor; true`:             "unexpected character ';'",
+		`exec("rm")`:                           "\"exec\" is not an attribute",
+	} {
+		t.Run(source, func(t *testing.T) {
+			_, err := Compile(source, testSchema)
+			if reason == "" {
+				assert.NoError(t, err)
+				return
+			}
+			require.ErrorIs(t, err, ErrInvalidCondition)
+			assert.Contains(t, err.Error(), reason)
+		})
+	}
+}
+
+func TestEval(t *testing.T) {
+	attrs := Attributes{
+		Subject: map[string]interface{}{
+			"id": "u1", "department": "finance", "clearance": int32(3),
+			"teams": []interface{}{"payroll", "oncall"}, "contractor": false,
+		},
+		Resource: map[string]interface{}{"department": "finance", "classification": 2.0, "owner": "u2"},
+		Env:      Env("10.0.0.1", time.Date(2026, 3, 2, 14, 30, 0, 0, time.UTC)),
+	}
+
+	for source, want := range map[string]bool{
+		`subject.department == resource.department`:                     true,
+		`subject.clearance >= resource.classification`:                  true,
+		`subject.clearance > 3`:                                         false,
+		`"oncall" in subject.teams && !subject.contractor`:              true,
+		`resource.owner == subject.id || subject.department == 'legal'`: false,
+		`env.hour >= 9 && env.hour < 17 && env.weekday == "monday"`:     true,
+		`env.time < "09:00"`:                                            false,
+		`resource.department in ["finance", "legal"]`:                   true,
+		`!(subject.clearance < -1)`:                                     true,
+	} {
+		t.Run(source, func(t *testing.T) {
+			condition, err := Compile(source, testSchema)
+			require.NoError(t, err)
+			got, err := condition.Eval(attrs)
+			require.NoError(t, err)
+			assert.Equal(t, want, got)
+		})
+	}
+
+	condition, err := Compile(`subject.contractor || subject.department == "finance"`, testSchema)
+	require.NoError(t, err)
+	_, err = condition.Eval(Attributes{Subject: map[string]interface{}{"department": "finance"}})
+	assert.ErrorIs(t, err, ErrMissingAttribute)
+	_, err = condition.Eval(Attributes{Subject: map[string]interface{}{"contractor": "no"}})
+	assert.ErrorIs(t, err, ErrMissingAttribute, "values of the wrong type count as missing")
+}
+
+func TestSchemaCheck(t *testing.T) {
+	values, err := testSchema.Check(NamespaceSubject, map[string]interface{}{"clearance": int64(2), "teams": []string{"a"}})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"clearance": 2.0, "teams": []string{"a"}}, values)
+
+	_, err = testSchema.Check(NamespaceSubject, map[string]interface{}{"clearance": "high"})
+	assert.ErrorIs(t, err, ErrInvalidAttributes)
+	_, err = testSchema.Check(NamespaceSubject, map[string]interface{}{"id": "u9"})
+	assert.ErrorIs(t, err, ErrInvalidAttributes, "built-in attributes cannot be set")
+	_, err = testSchema.Check(NamespaceResource, map[string]interface{}{"clearance": 1})
+	assert.ErrorIs(t, err, ErrInvalidAttributes)
+}
+
+func TestProviders(t *testing.T) {
+	var providers Providers
+	attrs, err := providers.ResourceAttributes(context.Background(), "acme", "/docs/1")
+	require.NoError(t, err)
+	assert.Nil(t, attrs)
+
+	named := func(name string) Provider {
+		return ProviderFunc(func(ctx context.Context, tenant, resource string) (map[string]interface{}, error) {
+			return map[string]interface{}{"owner": name + ":" + tenant + resource}, nil
+		})
+	}
+	providers.Register("/docs/", named("docs"))
+	providers.Register("/docs/secret/", named("secret"))
+
+	attrs, err = providers.ResourceAttributes(context.Background(), "acme", "/docs/secret/1")
+	require.NoError(t, err)
+	assert.Equal(t, "secret:acme/docs/secret/1", attrs["owner"])
+	attrs, err = providers.ResourceAttributes(context.Background(), "acme", "/docs/1")
+	require.NoError(t, err)
+	assert.Equal(t, "docs:acme/docs/1", attrs["owner"])
+}
@@ -0,0 +1,147 @@
+package abac
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Provider looks up the attributes of a resource in its system of record,
+// for checks whose caller does not know them.
+type Provider interface {
+	ResourceAttributes(ctx context.Context, tenant, resource string) (map[string]interface{}, error)
+}
+
+// ProviderFunc adapts a function to a Provider.
+type ProviderFunc func(ctx context.Context, tenant, resource string) (map[string]interface{}, error)
+
+func (f ProviderFunc) ResourceAttributes(ctx context.Context, tenant, resource string) (map[string]interface{}, error) {
+	return f(ctx, tenant, resource)
+}
+
+// Providers routes each resource to the provider registered for the
+// longest prefix of it. The zero value has no providers and is ready to use.
+type Providers struct {
+	mu       sync.RWMutex
+	byPrefix map[string]Provider
+}
+
+// Register makes provider answer for the resources starting with prefix,
+// replacing any provider registered for the same prefix.
+func (p *Providers) Register(prefix string, provider Provider) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.byPrefix == nil {
+		p.byPrefix = map[string]Provider{}
+	}
+	p.byPrefix[prefix] = provider
+}
+
+// ResourceAttributes asks the provider of resource for its attributes. It
+// returns nil if no provider matches.
+func (p *Providers) ResourceAttributes(ctx context.Context, tenant, resource string) (map[string]interface{}, error) {
+	p.mu.RLock()
+	var match string
+	var provider Provider
+	for prefix, candidate := range p.byPrefix {
+		if strings.HasPrefix(resource, prefix) && (provider == nil || len(prefix) > len(match)) {
+			match, provider = prefix, candidate
+		}
+	}
+	p.mu.RUnlock()
+
+	if provider == nil {
+		return nil, nil
+	}
+	return provider.ResourceAttributes(ctx, tenant, resource)
+}
+
+// HTTPProvider looks resource attributes up in another service with
+// GET {URL}?tenant=...&resource=..., which answers with a JSON object of
+// attributes, or 404 if it knows none.
+type HTTPProvider struct {
+	URL    string
+	Client *http.Client
+}
+
+func (p *HTTPProvider) ResourceAttributes(ctx context.Context, tenant, resource string) (map[string]interface{}, error) {
+	query := url.Values{"tenant": {tenant}, "resource": {resource}}
+	separator := "?"
+	if strings.Contains(p.URL, "?") {
+		separator = "&"
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.URL+separator+query.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := p.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("%s answered %s", p.URL, resp.Status)
+	}
+
+	var attrs map[string]interface{}
+	decoder := json.NewDecoder(io.LimitReader(resp.Body, 1<<20))
+	decoder.UseNumber()
+	if err := decoder.Decode(&attrs); err != nil {
+		return nil, fmt.Errorf("decode answer of %s: %w", p.URL, err)
+	}
+	return attrs, nil
+}
+
+// ProviderConfig configures an HTTPProvider answering for the resources
+// starting with Prefix.
+type ProviderConfig struct {
+	Prefix string `json:"prefix"`
+	URL    string `json:"url"`
+}
+
+// LoadProviders reads providers such as
+//
+//	[{"prefix": "/api/v1/documents/", "url": "https://docs.internal/attributes"}]
+//
+// from a JSON file and returns them by prefix. An empty path gives no
+// providers.
+func LoadProviders(path string) (map[string]Provider, error) {
+	providers := map[string]Provider{}
+	if path == "" {
+		return providers, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var configs []ProviderConfig
+	if err := json.Unmarshal(data, &configs); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+
+	client := &http.Client{Timeout: 5 * time.Second}
+	for _, c := range configs {
+		if c.Prefix == "" || c.URL == "" {
+			return nil, fmt.Errorf("parse %s: attribute provider requires prefix and url", path)
+		}
+		if _, exists := providers[c.Prefix]; exists {
+			return nil, fmt.Errorf("parse %s: duplicate attribute provider for %q", path, c.Prefix)
+		}
+		providers[c.Prefix] = &HTTPProvider{URL: c.URL, Client: client}
+	}
+	return providers, nil
+}
@@ -0,0 +1,72 @@
+package abac
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHTTPProvider(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Query().Get("resource") {
+		case "/documents/1":
+			assert.Equal(t, "acme", r.URL.Query().Get("tenant"))
+			json.NewEncoder(w).Encode(map[string]interface{}{"owner": "ann", "classification": 3})
+		case "/documents/2":
+			http.NotFound(w, r)
+		default:
+			http.Error(w, "boom", http.StatusInternalServerError)
+		}
+	}))
+	defer server.Close()
+
+	providers := &Providers{}
+	providers.Register("/documents/", &HTTPProvider{URL: server.URL, Client: server.Client()})
+	ctx := context.Background()
+
+	attrs, err := providers.ResourceAttributes(ctx, "acme", "/documents/1")
+	require.NoError(t, err)
+	values, err := testSchema.Check(NamespaceResource, attrs)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"owner": "ann", "classification": float64(3)}, values)
+
+	attrs, err = providers.ResourceAttributes(ctx, "acme", "/documents/2")
+	require.NoError(t, err)
+	assert.Nil(t, attrs)
+
+	_, err = providers.ResourceAttributes(ctx, "acme", "/documents/3")
+	assert.Error(t, err)
+}
+
+func TestLoadProviders(t *testing.T) {
+	providers, err := LoadProviders("")
+	require.NoError(t, err)
+	assert.Empty(t, providers)
+
+	write := func(content string) string {
+		path := filepath.Join(t.TempDir(), "providers.json")
+		require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+		return path
+	}
+
+	providers, err = LoadProviders(write(`[{"prefix": "/documents/", "url": "https://docs.internal/attributes"}]`))
+	require.NoError(t, err)
+	require.Contains(t, providers, "/documents/")
+	assert.Equal(t, "https://docs.internal/attributes", providers["/documents/"].(*HTTPProvider).URL)
+
+	for _, content := range []string{
+		`[{"prefix": "/documents/"}]`,
+		`[{"prefix": "/documents/", "url": "https://a"}, {"prefix": "/documents/", "url": "https://b"}]`,
+		`{`,
+	} {
+		_, err := LoadProviders(write(content))
+		assert.Error(t, err, content)
+	}
+}
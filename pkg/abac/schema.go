@@ -0,0 +1,232 @@
+// Package abac evaluates the conditions of attribute-based policies.
+//
+// A condition is a boolean expression over the attributes of the subject
+// (the user asking), the resource and the environment of the request,
+// written as subject.<name>, resource.<name> and env.<name>:
+//
+//	subject.department == resource.department && subject.clearance >= 3
+//	"oncall" in subject.teams || env.hour < 9
+//
+// Expressions are parsed and type-checked against a Schema when a policy is
+// written, and evaluated without access to anything but the attributes they
+// are given.
+package abac
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Attribute namespaces.
+const (
+	NamespaceSubject  = "subject"
+	NamespaceResource = "resource"
+	NamespaceEnv      = "env"
+)
+
+// Type is the type of an attribute or of an expression.
+type Type int
+
+const (
+	TypeInvalid Type = iota
+	TypeString
+	TypeNumber
+	TypeBool
+	// TypeList is a list of strings.
+	TypeList
+)
+
+var typeNames = map[Type]string{
+	TypeString: "string",
+	TypeNumber: "number",
+	TypeBool:   "bool",
+	TypeList:   "list",
+}
+
+func (t Type) String() string {
+	if name, ok := typeNames[t]; ok {
+		return name
+	}
+	return "invalid"
+}
+
+func (t Type) MarshalJSON() ([]byte, error) {
+	return json.Marshal(t.String())
+}
+
+func (t *Type) UnmarshalJSON(data []byte) error {
+	var name string
+	if err := json.Unmarshal(data, &name); err != nil {
+		return err
+	}
+	for typ, typeName := range typeNames {
+		if typeName == name {
+			*t = typ
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown attribute type %q", name)
+}
+
+// Built-in attributes, which exist whatever the schema declares.
+var (
+	subjectBuiltins = map[string]Type{
+		"id":       TypeString,
+		"username": TypeString,
+		"roles":    TypeList,
+	}
+	envBuiltins = map[string]Type{
+		"ip":      TypeString,
+		"time":    TypeString,
+		"hour":    TypeNumber,
+		"weekday": TypeString,
+	}
+)
+
+// Schema declares the subject and resource attributes conditions may use,
+// on top of the built-in subject.id, subject.username, subject.roles and
+// env.* attributes.
+type Schema struct {
+	Subject  map[string]Type `json:"subject"`
+	Resource map[string]Type `json:"resource"`
+}
+
+// LoadSchema reads a schema such as
+//
+//	{"subject": {"department": "string", "clearance": "number"},
+//	 "resource": {"owner": "string", "tags": "list"}}
+//
+// from a JSON file. An empty path gives a schema of only the built-in
+// attributes.
+func LoadSchema(path string) (*Schema, error) {
+	schema := &Schema{}
+	if path == "" {
+		return schema, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, schema); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	for name := range schema.Subject {
+		if _, ok := subjectBuiltins[name]; ok {
+			return nil, fmt.Errorf("parse %s: subject.%s is a built-in attribute", path, name)
+		}
+	}
+	return schema, nil
+}
+
+// Lookup returns the type of the attribute namespace.name.
+func (s *Schema) Lookup(namespace, name string) (Type, bool) {
+	var typ Type
+	var ok bool
+	switch namespace {
+	case NamespaceSubject:
+		if typ, ok = subjectBuiltins[name]; !ok {
+			typ, ok = s.Subject[name]
+		}
+	case NamespaceResource:
+		typ, ok = s.Resource[name]
+	case NamespaceEnv:
+		typ, ok = envBuiltins[name]
+	}
+	return typ, ok
+}
+
+// ErrInvalidAttributes is returned for attribute values the schema does not
+// declare or that have the wrong type.
+var ErrInvalidAttributes = errors.New("invalid attributes")
+
+// Check verifies that every value in attrs is a declared subject or
+// resource attribute of its type, and returns the values converted to the
+// types conditions compare. Built-in subject attributes cannot be set.
+func (s *Schema) Check(namespace string, attrs map[string]interface{}) (map[string]interface{}, error) {
+	declared := s.Resource
+	if namespace == NamespaceSubject {
+		declared = s.Subject
+	}
+
+	names := make([]string, 0, len(attrs))
+	for name := range attrs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	values := make(map[string]interface{}, len(attrs))
+	for _, name := range names {
+		typ, ok := declared[name]
+		if !ok {
+			return nil, fmt.Errorf("%w: %s.%s is not declared", ErrInvalidAttributes, namespace, name)
+		}
+		value, ok := convert(attrs[name], typ)
+		if !ok {
+			return nil, fmt.Errorf("%w: %s.%s must be a %s", ErrInvalidAttributes, namespace, name, typ)
+		}
+		values[name] = value
+	}
+	return values, nil
+}
+
+// Env returns the env.* attributes of a request from ip at now: the IP, the
+// UTC time of day as "15:04", its hour and the lower-case weekday.
+func Env(ip string, now time.Time) map[string]interface{} {
+	now = now.UTC()
+	return map[string]interface{}{
+		"ip":      ip,
+		"time":    now.Format("15:04"),
+		"hour":    float64(now.Hour()),
+		"weekday": strings.ToLower(now.Weekday().String()),
+	}
+}
+
+// convert returns value as the Go type expressions use for typ: string,
+// float64, bool or []string. Stores and JSON decoding hand numbers and lists
+// over in several representations, all of which are accepted.
+func convert(value interface{}, typ Type) (interface{}, bool) {
+	switch typ {
+	case TypeString:
+		s, ok := value.(string)
+		return s, ok
+	case TypeBool:
+		b, ok := value.(bool)
+		return b, ok
+	case TypeNumber:
+		if n, ok := value.(json.Number); ok {
+			f, err := n.Float64()
+			return f, err == nil
+		}
+		v := reflect.ValueOf(value)
+		switch v.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			return float64(v.Int()), true
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			return float64(v.Uint()), true
+		case reflect.Float32, reflect.Float64:
+			return v.Float(), true
+		}
+	case TypeList:
+		v := reflect.ValueOf(value)
+		if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+			return nil, false
+		}
+		list := make([]string, v.Len())
+		for i := range list {
+			s, ok := v.Index(i).Interface().(string)
+			if !ok {
+				return nil, false
+			}
+			list[i] = s
+		}
+		return list, true
+	}
+	return nil, false
+}
@@ -5,24 +5,103 @@ import (
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/knakul853/accessmesh/internal/models"
 )
 
 var secretKey = []byte("your-secret-key")
 
+// ImpersonationTTL bounds how long an impersonation token stays valid.
+const ImpersonationTTL = time.Hour
+
 type Claims struct {
-	Role string `json:"role"`
+	// Roles are the roles the token grants.
+	Roles []string `json:"roles,omitempty"`
+	// Role is the single role of tokens issued before users could hold
+	// several.
+	Role string `json:"role,omitempty"`
+	// Tenant is the tenant the user belongs to, and the Casbin domain its
+	// role is enforced in. Tokens issued before tenants existed have none.
+	Tenant string `json:"tenant,omitempty"`
+	// Act identifies the real caller when the token was minted through
+	// impersonation (RFC 8693 actor claim). It is nil for normal logins.
+	Act *Actor `json:"act,omitempty"`
 	jwt.RegisteredClaims
 }
 
+// Actor is the identity acting on behalf of the token subject.
+type Actor struct {
+	Subject string   `json:"sub"`
+	Roles   []string `json:"roles"`
+}
+
+// UserTTL bounds how long a login token stays valid.
+const UserTTL = 24 * time.Hour
+
+// Domain returns the Casbin domain the token's role is enforced in.
+func (c *Claims) Domain() string {
+	if c.Tenant == "" {
+		return models.DefaultTenant
+	}
+	return c.Tenant
+}
+
+// RoleNames returns the roles the token grants.
+func (c *Claims) RoleNames() []string {
+	if len(c.Roles) == 0 && c.Role != "" {
+		return []string{c.Role}
+	}
+	return c.Roles
+}
+
+// IsImpersonated reports whether the token was issued to an actor on behalf of another user.
+func (c *Claims) IsImpersonated() bool {
+	return c.Act != nil
+}
+
 func GenerateToken(role string) (string, error) {
-	claims := Claims{
-		Role: role,
+	return GenerateUserToken("", []string{role}, "")
+}
+
+// GenerateUserToken issues a token for the given user ID, roles and tenant.
+func GenerateUserToken(userID string, roles []string, tenant string) (string, error) {
+	now := time.Now()
+	return signClaims(userClaims(userID, roles, tenant, now, now.Add(UserTTL)))
+}
+
+// IssueUserToken issues a login token for the given user ID, roles and
+// tenant that expires at expiresAt. Callers pass the roles active now and
+// let the token expire, at the latest after UserTTL, when they next change,
+// so that the next login picks up the change.
+func IssueUserToken(userID string, roles []string, tenant string, expiresAt time.Time) (string, error) {
+	return signClaims(userClaims(userID, roles, tenant, time.Now(), expiresAt))
+}
+
+// GenerateImpersonationToken issues a token for the target user's ID, roles
+// and tenant that carries the actor's identity in the act claim. It expires
+// at expiresAt, which should be at most ImpersonationTTL away.
+func GenerateImpersonationToken(targetID string, roles []string, tenant string, expiresAt time.Time, actor Actor) (string, error) {
+	if actor.Subject == "" {
+		return "", errors.New("actor subject is required")
+	}
+
+	claims := userClaims(targetID, roles, tenant, time.Now(), expiresAt)
+	claims.Act = &actor
+	return signClaims(claims)
+}
+
+func userClaims(userID string, roles []string, tenant string, issuedAt, expiresAt time.Time) Claims {
+	return Claims{
+		Roles:  roles,
+		Tenant: tenant,
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(24 * time.Hour)),
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			Subject:   userID,
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+			IssuedAt:  jwt.NewNumericDate(issuedAt),
 		},
 	}
+}
 
+func signClaims(claims Claims) (string, error) {
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 	return token.SignedString(secretKey)
 }
@@ -5,6 +5,7 @@ import (
 	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestJWTTokenFlow(t *testing.T) {
@@ -17,8 +18,32 @@ func TestJWTTokenFlow(t *testing.T) {
 	// Test token validation
 	claims, err := ValidateToken(token)
 	assert.NoError(t, err)
-	assert.Equal(t, role, claims.Role)
+	assert.Equal(t, []string{role}, claims.RoleNames())
+	assert.Equal(t, "default", claims.Domain())
 	assert.True(t, claims.ExpiresAt.Time.After(time.Now()))
+
+	token, err = GenerateUserToken("user-1", []string{role, "billing"}, "acme")
+	assert.NoError(t, err)
+	claims, err = ValidateToken(token)
+	assert.NoError(t, err)
+	assert.Equal(t, "acme", claims.Domain())
+	assert.Equal(t, []string{"admin", "billing"}, claims.RoleNames())
+
+	// Tokens from before multiple roles carry a single role claim.
+	legacy := Claims{Role: "support"}
+	assert.Equal(t, []string{"support"}, legacy.RoleNames())
+}
+
+func TestIssueUserToken(t *testing.T) {
+	expiresAt := time.Now().Add(time.Hour)
+	token, err := IssueUserToken("user-1", []string{"support", "billing"}, "acme", expiresAt)
+	require.NoError(t, err)
+	claims, err := ValidateToken(token)
+	require.NoError(t, err)
+	assert.Equal(t, "user-1", claims.Subject)
+	assert.Equal(t, []string{"support", "billing"}, claims.RoleNames())
+	assert.Equal(t, "acme", claims.Domain())
+	assert.WithinDuration(t, expiresAt, claims.ExpiresAt.Time, time.Second)
 }
 
 func TestInvalidToken(t *testing.T) {
@@ -34,6 +59,25 @@ func TestInvalidToken(t *testing.T) {
 	assert.Error(t, err)
 }
 
+func TestImpersonationToken(t *testing.T) {
+	actor := Actor{Subject: "support-1", Roles: []string{"support"}}
+	expiresAt := time.Now().Add(ImpersonationTTL)
+	token, err := GenerateImpersonationToken("customer-1", []string{"customer"}, "acme", expiresAt, actor)
+	assert.NoError(t, err)
+
+	claims, err := ValidateToken(token)
+	assert.NoError(t, err)
+	assert.True(t, claims.IsImpersonated())
+	assert.Equal(t, []string{"customer"}, claims.RoleNames())
+	assert.Equal(t, "customer-1", claims.Subject)
+	assert.Equal(t, "acme", claims.Domain())
+	assert.Equal(t, actor, *claims.Act)
+	assert.WithinDuration(t, expiresAt, claims.ExpiresAt.Time, time.Second)
+
+	_, err = GenerateImpersonationToken("customer-1", []string{"customer"}, "acme", expiresAt, Actor{})
+	assert.Error(t, err)
+}
+
 // func setupTestStore(t *testing.T) *store.MongoStore {
 // 	store, err := store.NewMongoStore("mongodb://localhost:27017/pbac_test")
 // 	if err != nil {
@@ -0,0 +1,204 @@
+// Package bundle reads and writes policy bundles: the roles, groups and
+// policies of a tenant in a form that can be kept in git and imported into
+// another deployment.
+//
+// Bundles refer to roles and groups by name rather than by ID, since IDs
+// differ between deployments. Group members are users of one deployment, so
+// they are not part of a bundle.
+//
+//	version: 1
+//	roles:
+//	  - name: manager
+//	    description: Manages orders
+//	groups:
+//	  - name: eng
+//	    roles: [manager]
+//	    subgroups: [eng-oncall]
+//	  - name: eng-oncall
+//	policies:
+//	  - role: manager
+//	    resource: /api/v1/orders
+//	    action: read
+//	  - group: eng
+//	    resource: /api/v1/deploys
+//	    action: create
+//	    conditions:
+//	      time_range: ["08:00-20:00"]
+package bundle
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/knakul853/accessmesh/internal/models"
+)
+
+// Version is the bundle format written by this package and the only one it
+// reads.
+const Version = 1
+
+// ErrInvalid is returned for a bundle that is malformed or inconsistent.
+var ErrInvalid = errors.New("invalid bundle")
+
+// Bundle is the roles, groups and policies of a tenant.
+type Bundle struct {
+	Version int `json:"version" yaml:"version"`
+	// Tenant is the tenant the bundle was exported from. It is informative:
+	// a bundle is imported into the importer's tenant.
+	Tenant     string     `json:"tenant,omitempty" yaml:"tenant,omitempty"`
+	ExportedAt *time.Time `json:"exported_at,omitempty" yaml:"exported_at,omitempty"`
+	Roles      []Role     `json:"roles" yaml:"roles"`
+	Groups     []Group    `json:"groups" yaml:"groups"`
+	Policies   []Policy   `json:"policies" yaml:"policies"`
+}
+
+type Role struct {
+	Name        string   `json:"name" yaml:"name"`
+	Description string   `json:"description,omitempty" yaml:"description,omitempty"`
+	Permissions []string `json:"permissions,omitempty" yaml:"permissions,omitempty"`
+}
+
+// Group is a group without its members. Roles and Subgroups are names.
+type Group struct {
+	Name        string   `json:"name" yaml:"name"`
+	Description string   `json:"description,omitempty" yaml:"description,omitempty"`
+	Roles       []string `json:"roles,omitempty" yaml:"roles,omitempty"`
+	Subgroups   []string `json:"subgroups,omitempty" yaml:"subgroups,omitempty"`
+}
+
+// Policy applies to either a role or a group, both given by name.
+type Policy struct {
+	Role       string     `json:"role,omitempty" yaml:"role,omitempty"`
+	Group      string     `json:"group,omitempty" yaml:"group,omitempty"`
+	Resource   string     `json:"resource" yaml:"resource"`
+	Action     string     `json:"action" yaml:"action"`
+	Conditions Conditions `json:"conditions,omitempty" yaml:"conditions,omitempty"`
+}
+
+// Conditions are models.PolicyConditions as written in a bundle.
+type Conditions struct {
+	IPRange    []string `json:"ip_range,omitempty" yaml:"ip_range,omitempty"`
+	TimeRange  []string `json:"time_range,omitempty" yaml:"time_range,omitempty"`
+	Expression string   `json:"expression,omitempty" yaml:"expression,omitempty"`
+}
+
+// IsZero reports whether there are no conditions, so that encoders leave
+// them out.
+func (c Conditions) IsZero() bool {
+	return len(c.IPRange) == 0 && len(c.TimeRange) == 0 && c.Expression == ""
+}
+
+// ConditionsOf converts stored policy conditions.
+func ConditionsOf(conditions models.PolicyConditions) Conditions {
+	return Conditions{
+		IPRange:    slices.Clone(conditions.IPRange),
+		TimeRange:  slices.Clone(conditions.TimeRange),
+		Expression: conditions.Expression,
+	}
+}
+
+// Model converts the conditions to stored policy conditions.
+func (c Conditions) Model() models.PolicyConditions {
+	return models.PolicyConditions{
+		IPRange:    slices.Clone(c.IPRange),
+		TimeRange:  slices.Clone(c.TimeRange),
+		Expression: c.Expression,
+	}
+}
+
+// Key identifies the policy within a bundle: two policies with the same key
+// grant the same thing and may differ only in their conditions.
+func (p Policy) Key() string {
+	subject := "role:" + p.Role
+	if p.Group != "" {
+		subject = "group:" + p.Group
+	}
+	return subject + " " + p.Resource + " " + p.Action
+}
+
+// Validate checks that the bundle is of a known version, that names are
+// given and unique, that each policy names a role or a group but not both,
+// and that groups of the bundle do not contain themselves. It does not check
+// that referenced roles and groups exist; they may already exist where the
+// bundle is imported. All problems are reported together.
+func (b *Bundle) Validate() error {
+	var problems []string
+	if b.Version != Version {
+		problems = append(problems, fmt.Sprintf("unsupported version %d, want %d", b.Version, Version))
+	}
+
+	roles := map[string]bool{}
+	for i, role := range b.Roles {
+		switch {
+		case role.Name == "":
+			problems = append(problems, fmt.Sprintf("roles[%d]: name is required", i))
+		case roles[role.Name]:
+			problems = append(problems, fmt.Sprintf("roles[%d]: duplicate role %q", i, role.Name))
+		}
+		roles[role.Name] = true
+	}
+
+	groups := map[string]*Group{}
+	for i := range b.Groups {
+		group := &b.Groups[i]
+		switch {
+		case group.Name == "":
+			problems = append(problems, fmt.Sprintf("groups[%d]: name is required", i))
+		case groups[group.Name] != nil:
+			problems = append(problems, fmt.Sprintf("groups[%d]: duplicate group %q", i, group.Name))
+		}
+		groups[group.Name] = group
+	}
+	for _, group := range b.Groups {
+		if cycle := findCycle(groups, group.Name); cycle != nil {
+			problems = append(problems, fmt.Sprintf("group %q contains itself: %s", group.Name, strings.Join(cycle, " > ")))
+			break
+		}
+	}
+
+	policies := map[string]bool{}
+	for i, policy := range b.Policies {
+		switch {
+		case (policy.Role == "") == (policy.Group == ""):
+			problems = append(problems, fmt.Sprintf("policies[%d]: exactly one of role and group is required", i))
+		case policy.Resource == "" || policy.Action == "":
+			problems = append(problems, fmt.Sprintf("policies[%d]: resource and action are required", i))
+		case policies[policy.Key()]:
+			problems = append(problems, fmt.Sprintf("policies[%d]: duplicate policy %s", i, policy.Key()))
+		}
+		policies[policy.Key()] = true
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("%w: %s", ErrInvalid, strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// findCycle returns the path by which the named group contains itself
+// through the subgroups of groups, or nil if it does not.
+func findCycle(groups map[string]*Group, name string) []string {
+	var visit func(path []string) []string
+	visit = func(path []string) []string {
+		group := groups[path[len(path)-1]]
+		if group == nil {
+			return nil
+		}
+		for _, subgroup := range group.Subgroups {
+			if subgroup == name {
+				return append(slices.Clone(path), subgroup)
+			}
+			if slices.Contains(path, subgroup) {
+				continue
+			}
+			if cycle := visit(append(path, subgroup)); cycle != nil {
+				return cycle
+			}
+		}
+		return nil
+	}
+	return visit([]string{name})
+}
@@ -0,0 +1,112 @@
+package bundle
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testBundle() *Bundle {
+	return &Bundle{
+		Version: Version,
+		Tenant:  "acme",
+		Roles:   []Role{{Name: "manager"}, {Name: "viewer"}},
+		Groups: []Group{
+			{Name: "eng", Roles: []string{"manager"}, Subgroups: []string{"eng-oncall"}},
+			{Name: "eng-oncall", Roles: []string{"viewer"}},
+		},
+		Policies: []Policy{
+			{Role: "manager", Resource: "/api/v1/orders", Action: "read"},
+			{Group: "eng", Resource: "/api/v1/deploys", Action: "create"},
+		},
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	for _, format := range []Format{FormatYAML, FormatJSON, FormatCSV} {
+		t.Run(string(format), func(t *testing.T) {
+			data, err := Marshal(testBundle(), format)
+			require.NoError(t, err)
+			decoded, err := Decode(bytes.NewReader(data), format)
+			require.NoError(t, err)
+			require.NoError(t, decoded.Validate())
+
+			want := testBundle()
+			assert.Equal(t, want.Tenant, decoded.Tenant)
+			assert.ElementsMatch(t, want.Roles, decoded.Roles)
+			assert.ElementsMatch(t, want.Groups, decoded.Groups)
+			assert.Equal(t, want.Policies, decoded.Policies)
+		})
+	}
+}
+
+func TestCSV(t *testing.T) {
+	data, err := Marshal(testBundle(), FormatCSV)
+	require.NoError(t, err)
+	assert.Equal(t, `# accessmesh bundle version 1
+p, manager, acme, /api/v1/orders, read
+p, group:eng, acme, /api/v1/deploys, create
+g, group:eng, manager, acme
+g, group:eng-oncall, group:eng, acme
+g, group:eng-oncall, viewer, acme
+`, string(data))
+
+	conditional := testBundle()
+	conditional.Policies[0].Conditions.TimeRange = []string{"08:00-20:00"}
+	_, err = Marshal(conditional, FormatCSV)
+	assert.ErrorIs(t, err, ErrInvalid)
+
+	for _, rules := range []string{
+		"g, user:1, manager, acme",
+		"p, manager, acme, /api/v1/orders",
+		"p, manager, acme, /a, read\np, manager, globex, /b, read",
+		"x, manager, acme",
+	} {
+		_, err := Decode(strings.NewReader(rules), FormatCSV)
+		assert.ErrorIs(t, err, ErrInvalid, rules)
+	}
+}
+
+func TestDecodeRejectsUnknownFields(t *testing.T) {
+	_, err := Decode(strings.NewReader("version: 1\npolicies:\n  - role: manager\n    resouce: /a\n"), FormatYAML)
+	assert.ErrorIs(t, err, ErrInvalid)
+	_, err = Decode(strings.NewReader(`{"version": 1, "rolez": []}`), FormatJSON)
+	assert.ErrorIs(t, err, ErrInvalid)
+}
+
+func TestValidate(t *testing.T) {
+	b := testBundle()
+	require.NoError(t, b.Validate())
+
+	b.Version = 2
+	b.Roles = append(b.Roles, Role{Name: "manager"})
+	b.Groups[1].Subgroups = []string{"eng"}
+	b.Policies = append(b.Policies,
+		Policy{Role: "manager", Group: "eng", Resource: "/a", Action: "read"},
+		Policy{Role: "manager", Resource: "/api/v1/orders", Action: "read"})
+	err := b.Validate()
+	require.ErrorIs(t, err, ErrInvalid)
+	for _, problem := range []string{
+		"unsupported version 2",
+		`duplicate role "manager"`,
+		`group "eng" contains itself: eng > eng-oncall > eng`,
+		"policies[2]: exactly one of role and group",
+		"policies[3]: duplicate policy role:manager /api/v1/orders read",
+	} {
+		assert.Contains(t, err.Error(), problem)
+	}
+}
+
+func TestFormatOf(t *testing.T) {
+	format, err := FormatOf("application/yaml; charset=utf-8")
+	require.NoError(t, err)
+	assert.Equal(t, FormatYAML, format)
+	format, err = ParseFormat("yml")
+	require.NoError(t, err)
+	assert.Equal(t, FormatYAML, format)
+	_, err = FormatOf("text/plain")
+	assert.ErrorIs(t, err, ErrUnknownFormat)
+}
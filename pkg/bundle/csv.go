@@ -0,0 +1,170 @@
+package bundle
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/knakul853/accessmesh/internal/models"
+)
+
+// groupPrefix marks group subjects in Casbin rules, as pkg/enforcer does,
+// with the group's name in place of its ID.
+const groupPrefix = "group:"
+
+// EncodeCSV writes the bundle as Casbin rules in the bundle's tenant:
+//
+//	p, manager, acme, /api/v1/orders, read
+//	p, group:eng, acme, /api/v1/deploys, create
+//	g, group:eng, manager, acme
+//	g, group:eng-oncall, group:eng, acme
+//
+// Casbin rules carry no descriptions or permissions, and roles and groups
+// without rules are left out. Conditional policies have no rule, so a bundle
+// with conditions cannot be written as CSV.
+func EncodeCSV(w io.Writer, b *Bundle) error {
+	for _, policy := range b.Policies {
+		if !policy.Conditions.IsZero() {
+			return fmt.Errorf("%w: policy %s has conditions, which CSV cannot hold", ErrInvalid, policy.Key())
+		}
+	}
+
+	tenant := b.Tenant
+	if tenant == "" {
+		tenant = models.DefaultTenant
+	}
+	lines := [][]string{}
+	for _, policy := range b.Policies {
+		subject := policy.Role
+		if policy.Group != "" {
+			subject = groupPrefix + policy.Group
+		}
+		lines = append(lines, []string{"p", subject, tenant, policy.Resource, policy.Action})
+	}
+	for _, group := range b.Groups {
+		for _, role := range group.Roles {
+			lines = append(lines, []string{"g", groupPrefix + group.Name, role, tenant})
+		}
+		for _, subgroup := range group.Subgroups {
+			lines = append(lines, []string{"g", groupPrefix + subgroup, groupPrefix + group.Name, tenant})
+		}
+	}
+
+	if _, err := fmt.Fprintf(w, "# accessmesh bundle version %d\n", Version); err != nil {
+		return err
+	}
+	for _, line := range lines {
+		for i := range line {
+			line[i] = quoteCSV(line[i])
+		}
+		if _, err := io.WriteString(w, strings.Join(line, ", ")+"\n"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// quoteCSV quotes a field the way encoding/csv reads it back.
+func quoteCSV(field string) string {
+	if !strings.ContainsAny(field, ",\"\r\n") && strings.TrimSpace(field) == field {
+		return field
+	}
+	return `"` + strings.ReplaceAll(field, `"`, `""`) + `"`
+}
+
+// DecodeCSV reads Casbin rules written as EncodeCSV writes them. Every role
+// and group a rule names becomes part of the bundle, and the rules' domain
+// its tenant. Rules linking users to roles or groups are rejected, since
+// bundles hold no users.
+func DecodeCSV(r io.Reader) (*Bundle, error) {
+	reader := csv.NewReader(r)
+	reader.Comment = '#'
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	b := &Bundle{Version: Version}
+	roles := map[string]bool{}
+	groups := map[string]*Group{}
+	var order []string
+	addRole := func(name string) {
+		if !roles[name] {
+			roles[name] = true
+			b.Roles = append(b.Roles, Role{Name: name})
+		}
+	}
+	group := func(name string) *Group {
+		if groups[name] == nil {
+			groups[name] = &Group{Name: name}
+			order = append(order, name)
+		}
+		return groups[name]
+	}
+	setTenant := func(line int, domain string) error {
+		if b.Tenant != "" && b.Tenant != domain {
+			return fmt.Errorf("%w: line %d: rules of more than one domain (%q and %q)", ErrInvalid, line, b.Tenant, domain)
+		}
+		b.Tenant = domain
+		return nil
+	}
+
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalid, err)
+		}
+		line, _ := reader.FieldPos(0)
+		for i := range record {
+			record[i] = strings.TrimSpace(record[i])
+		}
+
+		switch record[0] {
+		case "p":
+			if len(record) != 5 {
+				return nil, fmt.Errorf("%w: line %d: want p, subject, domain, object, action", ErrInvalid, line)
+			}
+			if err := setTenant(line, record[2]); err != nil {
+				return nil, err
+			}
+			policy := Policy{Resource: record[3], Action: record[4]}
+			if name, ok := strings.CutPrefix(record[1], groupPrefix); ok {
+				group(name)
+				policy.Group = name
+			} else {
+				addRole(record[1])
+				policy.Role = record[1]
+			}
+			b.Policies = append(b.Policies, policy)
+		case "g":
+			if len(record) != 4 {
+				return nil, fmt.Errorf("%w: line %d: want g, subject, role or group, domain", ErrInvalid, line)
+			}
+			if err := setTenant(line, record[3]); err != nil {
+				return nil, err
+			}
+			name, ok := strings.CutPrefix(record[1], groupPrefix)
+			if !ok {
+				return nil, fmt.Errorf("%w: line %d: only groups can be given roles in a bundle, not %q", ErrInvalid, line, record[1])
+			}
+			member := group(name)
+			if parent, ok := strings.CutPrefix(record[2], groupPrefix); ok {
+				container := group(parent)
+				container.Subgroups = append(container.Subgroups, member.Name)
+			} else {
+				addRole(record[2])
+				member.Roles = append(member.Roles, record[2])
+			}
+		default:
+			return nil, fmt.Errorf("%w: line %d: unknown rule type %q", ErrInvalid, line, record[0])
+		}
+	}
+
+	for _, name := range order {
+		b.Groups = append(b.Groups, *groups[name])
+	}
+	return b, nil
+}
@@ -0,0 +1,120 @@
+package bundle
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Format is an encoding of a bundle.
+type Format string
+
+const (
+	FormatYAML Format = "yaml"
+	FormatJSON Format = "json"
+	// FormatCSV is Casbin's own policy file format. It only holds what
+	// Casbin rules hold; see EncodeCSV.
+	FormatCSV Format = "csv"
+)
+
+// ErrUnknownFormat is returned for a format name or media type that is not
+// one of the bundle formats.
+var ErrUnknownFormat = errors.New("unknown bundle format")
+
+// ParseFormat returns the format named name, such as "yaml".
+func ParseFormat(name string) (Format, error) {
+	switch Format(name) {
+	case FormatYAML, FormatJSON, FormatCSV:
+		return Format(name), nil
+	case "yml":
+		return FormatYAML, nil
+	}
+	return "", fmt.Errorf("%w %q", ErrUnknownFormat, name)
+}
+
+// FormatOf returns the format of a media type, such as application/yaml.
+func FormatOf(mediaType string) (Format, error) {
+	parsed, _, err := mime.ParseMediaType(mediaType)
+	if err != nil {
+		return "", fmt.Errorf("%w %q", ErrUnknownFormat, mediaType)
+	}
+	switch parsed {
+	case "application/yaml", "application/x-yaml", "text/yaml", "text/x-yaml":
+		return FormatYAML, nil
+	case "application/json":
+		return FormatJSON, nil
+	case "text/csv":
+		return FormatCSV, nil
+	}
+	return "", fmt.Errorf("%w %q", ErrUnknownFormat, mediaType)
+}
+
+// MediaType returns the media type bundles of the format are served as.
+func (f Format) MediaType() string {
+	switch f {
+	case FormatJSON:
+		return "application/json"
+	case FormatCSV:
+		return "text/csv"
+	}
+	return "application/yaml"
+}
+
+// Encode writes the bundle in the format.
+func Encode(w io.Writer, b *Bundle, format Format) error {
+	switch format {
+	case FormatYAML:
+		encoder := yaml.NewEncoder(w)
+		encoder.SetIndent(2)
+		if err := encoder.Encode(b); err != nil {
+			return err
+		}
+		return encoder.Close()
+	case FormatJSON:
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(b)
+	case FormatCSV:
+		return EncodeCSV(w, b)
+	}
+	return fmt.Errorf("%w %q", ErrUnknownFormat, format)
+}
+
+// Decode reads a bundle in the format. Unknown fields are rejected, so that
+// a misspelt field is not silently dropped. The bundle is not validated.
+func Decode(r io.Reader, format Format) (*Bundle, error) {
+	var b Bundle
+	switch format {
+	case FormatYAML:
+		decoder := yaml.NewDecoder(r)
+		decoder.KnownFields(true)
+		if err := decoder.Decode(&b); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalid, err)
+		}
+	case FormatJSON:
+		decoder := json.NewDecoder(r)
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&b); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalid, err)
+		}
+	case FormatCSV:
+		return DecodeCSV(r)
+	default:
+		return nil, fmt.Errorf("%w %q", ErrUnknownFormat, format)
+	}
+	return &b, nil
+}
+
+// Marshal returns the bundle encoded in the format.
+func Marshal(b *Bundle, format Format) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := Encode(&buf, b, format); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -1,26 +1,67 @@
 package enforcer
 
 import (
+	"context"
+	"database/sql"
 	"log"
+	"slices"
+	"time"
 
 	"github.com/casbin/casbin/v2"
+	"github.com/casbin/casbin/v2/persist"
 	mongodbadapter "github.com/casbin/mongodb-adapter/v3"
+	"github.com/knakul853/accessmesh/internal/models"
 	"github.com/knakul853/accessmesh/internal/store"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
 )
 
+// Enforcer is safe for concurrent use: rule changes, including those the
+// MongoWatcher applies, take the write lock while checks hold the read lock.
 type Enforcer struct {
-	*casbin.Enforcer
+	*casbin.SyncedEnforcer
 }
 
 func NewCasbinEnforcer(store *store.MongoStore) (*Enforcer, error) {
 	log.Println("Creating Casbin enforcer...")
+	if err := upgradeMongoRules(store); err != nil {
+		log.Printf("Error upgrading Casbin rules: %v", err)
+		return nil, err
+	}
+
 	adapter, err := mongodbadapter.NewAdapter(store.GetURI())
 	if err != nil {
 		log.Printf("Error creating MongoDB adapter: %v", err)
 		return nil, err
 	}
 
-	enforcer, err := casbin.NewEnforcer("model.conf", adapter)
+	return newEnforcer(adapter)
+}
+
+// NewMemoryEnforcer creates an enforcer whose policy rules live in memory.
+func NewMemoryEnforcer() (*Enforcer, error) {
+	log.Println("Creating in-memory Casbin enforcer...")
+	return newEnforcer(NewMemoryAdapter())
+}
+
+// NewSQLEnforcer creates an enforcer storing policy rules in db.
+func NewSQLEnforcer(db *sql.DB) (*Enforcer, error) {
+	log.Println("Creating SQL Casbin enforcer...")
+	adapter, err := NewSQLAdapter(db)
+	if err != nil {
+		log.Printf("Error creating SQL adapter: %v", err)
+		return nil, err
+	}
+	if err := upgradeSQLRules(db); err != nil {
+		log.Printf("Error upgrading Casbin rules: %v", err)
+		return nil, err
+	}
+
+	return newEnforcer(adapter)
+}
+
+func newEnforcer(adapter persist.Adapter) (*Enforcer, error) {
+	enforcer, err := casbin.NewSyncedEnforcer("model.conf", adapter)
 	if err != nil {
 		log.Printf("Error creating Casbin enforcer: %v", err)
 		return nil, err
@@ -29,3 +70,81 @@ func NewCasbinEnforcer(store *store.MongoStore) (*Enforcer, error) {
 	log.Println("Casbin enforcer created successfully.")
 	return &Enforcer{enforcer}, nil
 }
+
+// upgradeSQLRules moves rules written before tenants existed,
+// "p, role, obj, act", into the default tenant's domain as
+// "p, role, default, obj, act" so the enforcer can load them. Rules that
+// already have a domain are left alone.
+func upgradeSQLRules(db *sql.DB) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	_, err := db.ExecContext(ctx, `UPDATE casbin_rule SET v1 = $1, v2 = v1, v3 = v2
+		WHERE ptype = 'p' AND v2 <> '' AND v3 = ''`, models.DefaultTenant)
+	return err
+}
+
+// upgradeMongoRules does what upgradeSQLRules does for the rules of the
+// MongoDB adapter.
+func upgradeMongoRules(s *store.MongoStore) error {
+	rules, err := mongoRules(s)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	_, err = rules.UpdateMany(ctx,
+		bson.M{
+			"ptype": "p",
+			"v2":    bson.M{"$nin": bson.A{nil, ""}},
+			"v3":    bson.M{"$in": bson.A{nil, ""}},
+		},
+		mongo.Pipeline{{{Key: "$set", Value: bson.M{"v1": models.DefaultTenant, "v2": "$v1", "v3": "$v2"}}}},
+	)
+	return err
+}
+
+// EnforceAny reports whether any of roles may perform act on obj in domain.
+func (e *Enforcer) EnforceAny(roles []string, domain, obj, act string) (bool, error) {
+	for _, role := range roles {
+		allowed, err := e.Enforce(role, domain, obj, act)
+		if err != nil || allowed {
+			return allowed, err
+		}
+	}
+	return false, nil
+}
+
+// Covers reports whether every permission granted to any of the target
+// subjects in domain is also granted to one of the actor subjects, i.e. the
+// targets hold no privilege there that the actors lack. To compare users,
+// pass the subject sets Subjects returns, so that privileges held through
+// groups count on both sides.
+func (e *Enforcer) Covers(actors, targets []string, domain string) (bool, error) {
+	for _, target := range targets {
+		if slices.Contains(actors, target) {
+			continue
+		}
+
+		permissions, err := e.GetFilteredPolicy(0, target, domain)
+		if err != nil {
+			return false, err
+		}
+		for _, p := range permissions {
+			if len(p) < 4 {
+				continue
+			}
+			allowed, err := e.EnforceAny(actors, domain, p[2], p[3])
+			if err != nil {
+				return false, err
+			}
+			if !allowed {
+				return false, nil
+			}
+		}
+	}
+
+	return true, nil
+}
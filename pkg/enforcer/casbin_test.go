@@ -0,0 +1,141 @@
+package enforcer
+
+import (
+	"os"
+	"testing"
+
+	"github.com/casbin/casbin/v2"
+	"github.com/casbin/casbin/v2/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestEnforcer(t *testing.T, policies ...[]string) *Enforcer {
+	t.Helper()
+
+	conf, err := os.ReadFile("../../model.conf")
+	require.NoError(t, err)
+
+	m, err := model.NewModelFromString(string(conf))
+	require.NoError(t, err)
+
+	e, err := casbin.NewSyncedEnforcer(m, NewMemoryAdapter())
+	require.NoError(t, err)
+
+	for _, p := range policies {
+		_, err := e.AddPolicy(p)
+		require.NoError(t, err)
+	}
+	return &Enforcer{e}
+}
+
+func TestCovers(t *testing.T) {
+	e := newTestEnforcer(t,
+		[]string{"admin", "default", "/api/v1/users", "GET"},
+		[]string{"admin", "default", "/api/v1/users", "DELETE"},
+		[]string{"support", "default", "/api/v1/users", "GET"},
+		[]string{"customer", "default", "/api/v1/orders", "GET"},
+		[]string{"support", "acme", "/api/v1/users", "DELETE"},
+	)
+
+	covers, err := e.Covers([]string{"admin"}, []string{"support"}, "default")
+	assert.NoError(t, err)
+	assert.True(t, covers)
+
+	covers, err = e.Covers([]string{"support"}, []string{"admin"}, "default")
+	assert.NoError(t, err)
+	assert.False(t, covers)
+
+	covers, err = e.Covers([]string{"support"}, []string{"customer"}, "default")
+	assert.NoError(t, err)
+	assert.False(t, covers)
+
+	covers, err = e.Covers([]string{"support"}, []string{"support"}, "default")
+	assert.NoError(t, err)
+	assert.True(t, covers)
+
+	covers, err = e.Covers([]string{"support"}, []string{"guest"}, "default")
+	assert.NoError(t, err)
+	assert.True(t, covers)
+
+	// Several roles pool their permissions.
+	covers, err = e.Covers([]string{"support", "customer"}, []string{"customer"}, "default")
+	assert.NoError(t, err)
+	assert.True(t, covers)
+	covers, err = e.Covers([]string{"admin"}, []string{"support", "customer"}, "default")
+	assert.NoError(t, err)
+	assert.False(t, covers)
+	covers, err = e.Covers([]string{"admin", "customer"}, []string{"support", "customer"}, "default")
+	assert.NoError(t, err)
+	assert.True(t, covers)
+
+	// Grants in another domain do not count.
+	covers, err = e.Covers([]string{"admin"}, []string{"support"}, "acme")
+	assert.NoError(t, err)
+	assert.False(t, covers)
+
+	// Privileges held through groups count once subjects are expanded.
+	_, err = e.AddGroupingPolicy(UserSubject("bob"), GroupSubject("ops"), "default")
+	require.NoError(t, err)
+	_, err = e.AddGroupingPolicy(GroupSubject("ops"), "admin", "default")
+	require.NoError(t, err)
+	targets, err := e.Subjects("bob", []string{"support"}, "default")
+	require.NoError(t, err)
+	covers, err = e.Covers([]string{"support"}, targets, "default")
+	assert.NoError(t, err)
+	assert.False(t, covers)
+	actors, err := e.Subjects("bob", nil, "default")
+	require.NoError(t, err)
+	covers, err = e.Covers(actors, targets, "default")
+	assert.NoError(t, err)
+	assert.True(t, covers)
+}
+
+func TestDomains(t *testing.T) {
+	e := newTestEnforcer(t,
+		[]string{"admin", "acme", "/api/v1/users", "GET"},
+		[]string{"admin", "default", "/api/v1/tenants", "POST"},
+	)
+
+	allowed := func(sub, dom, obj, act string) bool {
+		ok, err := e.Enforce(sub, dom, obj, act)
+		require.NoError(t, err)
+		return ok
+	}
+	assert.True(t, allowed("admin", "acme", "/api/v1/users", "GET"))
+	assert.False(t, allowed("admin", "globex", "/api/v1/users", "GET"))
+	assert.False(t, allowed("admin", "acme", "/api/v1/tenants", "POST"))
+
+	// Roles inherit within a domain only.
+	_, err := e.AddGroupingPolicy("owner", "admin", "acme")
+	require.NoError(t, err)
+	assert.True(t, allowed("owner", "acme", "/api/v1/users", "GET"))
+	assert.False(t, allowed("owner", "default", "/api/v1/tenants", "POST"))
+}
+
+func TestMemoryAdapter(t *testing.T) {
+	adapter := NewMemoryAdapter()
+	conf, err := os.ReadFile("../../model.conf")
+	require.NoError(t, err)
+	m, err := model.NewModelFromString(string(conf))
+	require.NoError(t, err)
+
+	e, err := casbin.NewEnforcer(m, adapter)
+	require.NoError(t, err)
+	_, err = e.AddPolicies([][]string{
+		{"admin", "default", "/api/v1/users", "GET"},
+		{"admin", "default", "/api/v1/users", "DELETE"},
+		{"support", "default", "/api/v1/users", "GET"},
+	})
+	require.NoError(t, err)
+	_, err = e.RemovePolicy("admin", "default", "/api/v1/users", "DELETE")
+	require.NoError(t, err)
+	_, err = e.RemoveFilteredPolicy(0, "support")
+	require.NoError(t, err)
+
+	// Reloading reads back only what the adapter persisted.
+	require.NoError(t, e.LoadPolicy())
+	policies, err := e.GetPolicy()
+	require.NoError(t, err)
+	assert.Equal(t, [][]string{{"admin", "default", "/api/v1/users", "GET"}}, policies)
+}
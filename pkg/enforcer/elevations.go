@@ -0,0 +1,22 @@
+package enforcer
+
+import (
+	"github.com/knakul853/accessmesh/internal/models"
+)
+
+// An approved elevation links the user's subject to the elevated role in the
+// elevation's domain, so the role applies through EnforceUser without a new
+// token.
+
+// GrantElevation gives the user of an approved elevation its role.
+func (e *Enforcer) GrantElevation(elevation *models.Elevation) error {
+	_, err := e.AddGroupingPolicy(UserSubject(elevation.UserID), elevation.Role, elevation.TenantID)
+	return err
+}
+
+// RevokeElevation takes the elevated role away from the user again. It is a
+// no-op if the role was not granted.
+func (e *Enforcer) RevokeElevation(elevation *models.Elevation) error {
+	_, err := e.RemoveGroupingPolicy(UserSubject(elevation.UserID), elevation.Role, elevation.TenantID)
+	return err
+}
@@ -0,0 +1,68 @@
+package enforcer
+
+import (
+	"testing"
+	"time"
+
+	"github.com/knakul853/accessmesh/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestGroups(t *testing.T) {
+	e := newTestEnforcer(t,
+		[]string{"developer", "acme", "/api/v1/builds", "GET"},
+		[]string{"operator", "acme", "/api/v1/deploys", "POST"},
+	)
+	allowed := func(user, obj, act string) bool {
+		ok, err := e.EnforceUser(user, nil, "acme", obj, act)
+		require.NoError(t, err)
+		return ok
+	}
+
+	backend := &models.Group{ID: primitive.NewObjectID(), TenantID: "acme", Roles: []string{"developer"}, Members: []string{"u1"}}
+	eng := &models.Group{ID: primitive.NewObjectID(), TenantID: "acme", Members: []string{"u2"}, Subgroups: []string{backend.ID.Hex()}}
+	require.NoError(t, e.SyncGroup(nil, backend))
+	require.NoError(t, e.SyncGroup(nil, eng))
+	_, err := e.AddPolicy(GroupSubject(eng.ID.Hex()), "acme", "/api/v1/wiki", "PUT")
+	require.NoError(t, err)
+
+	assert.True(t, allowed("u1", "/api/v1/builds", "GET"), "roles of the group")
+	assert.True(t, allowed("u1", "/api/v1/wiki", "PUT"), "policies of a parent group")
+	assert.True(t, allowed("u2", "/api/v1/wiki", "PUT"))
+	assert.False(t, allowed("u2", "/api/v1/builds", "GET"), "subgroup roles do not flow up")
+	assert.False(t, allowed("u3", "/api/v1/wiki", "PUT"))
+
+	ok, err := e.EnforceUser("u1", nil, "globex", "/api/v1/builds", "GET")
+	require.NoError(t, err)
+	assert.False(t, ok, "groups only apply in their tenant")
+	ok, err = e.EnforceUser("", []string{"billing", "operator"}, "acme", "/api/v1/deploys", "POST")
+	require.NoError(t, err)
+	assert.True(t, ok, "any of the roles counts")
+
+	// Changing a group only touches the rules that changed.
+	previous := *backend
+	backend.Roles = []string{"operator"}
+	backend.Members = []string{"u1", "u3"}
+	require.NoError(t, e.SyncGroup(&previous, backend))
+	assert.False(t, allowed("u1", "/api/v1/builds", "GET"))
+	assert.True(t, allowed("u1", "/api/v1/deploys", "POST"))
+	assert.True(t, allowed("u3", "/api/v1/wiki", "PUT"))
+
+	// Trashed groups grant nothing.
+	trashed := *backend
+	now := time.Now()
+	trashed.DeletedAt = &now
+	require.NoError(t, e.SyncGroup(backend, &trashed))
+	assert.False(t, allowed("u1", "/api/v1/deploys", "POST"))
+	assert.False(t, allowed("u1", "/api/v1/wiki", "PUT"))
+	assert.True(t, allowed("u2", "/api/v1/wiki", "PUT"))
+
+	rules, err := e.GetGroupingPolicy()
+	require.NoError(t, err)
+	assert.ElementsMatch(t, [][]string{
+		{UserSubject("u2"), GroupSubject(eng.ID.Hex()), "acme"},
+		{GroupSubject(backend.ID.Hex()), GroupSubject(eng.ID.Hex()), "acme"},
+	}, rules)
+}
@@ -0,0 +1,110 @@
+package enforcer
+
+import (
+	"slices"
+	"sync"
+
+	"github.com/casbin/casbin/v2/model"
+	"github.com/casbin/casbin/v2/persist"
+)
+
+// MemoryAdapter is a Casbin adapter that keeps policy rules in process
+// memory. Rules survive enforcer reloads but not restarts.
+//
+// It implements persist.BatchAdapter as well as persist.Adapter.
+type MemoryAdapter struct {
+	mu    sync.RWMutex
+	rules [][]string
+}
+
+func NewMemoryAdapter() *MemoryAdapter {
+	return &MemoryAdapter{}
+}
+
+func (a *MemoryAdapter) LoadPolicy(m model.Model) error {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	for _, rule := range a.rules {
+		if err := persist.LoadPolicyArray(rule, m); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (a *MemoryAdapter) SavePolicy(m model.Model) error {
+	var rules [][]string
+	for _, sec := range []string{"p", "g"} {
+		for ptype, assertion := range m[sec] {
+			for _, rule := range assertion.Policy {
+				rules = append(rules, append([]string{ptype}, rule...))
+			}
+		}
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.rules = rules
+	return nil
+}
+
+func (a *MemoryAdapter) AddPolicy(sec string, ptype string, rule []string) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.rules = append(a.rules, append([]string{ptype}, rule...))
+	return nil
+}
+
+func (a *MemoryAdapter) RemovePolicy(sec string, ptype string, rule []string) error {
+	line := append([]string{ptype}, rule...)
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.rules = slices.DeleteFunc(a.rules, func(r []string) bool {
+		return slices.Equal(r, line)
+	})
+	return nil
+}
+
+func (a *MemoryAdapter) AddPolicies(sec string, ptype string, rules [][]string) error {
+	for _, rule := range rules {
+		if err := a.AddPolicy(sec, ptype, rule); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (a *MemoryAdapter) RemovePolicies(sec string, ptype string, rules [][]string) error {
+	for _, rule := range rules {
+		if err := a.RemovePolicy(sec, ptype, rule); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (a *MemoryAdapter) RemoveFilteredPolicy(sec string, ptype string, fieldIndex int, fieldValues ...string) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.rules = slices.DeleteFunc(a.rules, func(r []string) bool {
+		if r[0] != ptype {
+			return false
+		}
+		fields := r[1:]
+		for i, value := range fieldValues {
+			if value == "" {
+				continue
+			}
+			if fieldIndex+i >= len(fields) || fields[fieldIndex+i] != value {
+				return false
+			}
+		}
+		return true
+	})
+	return nil
+}
@@ -0,0 +1,420 @@
+package enforcer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/casbin/casbin/v2/model"
+	"github.com/knakul853/accessmesh/internal/store"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/x/mongo/driver/connstring"
+)
+
+// Server error codes the watcher reacts to.
+const (
+	// codeChangeStreamsUnsupported is returned by standalone servers, which
+	// have no oplog to stream from.
+	codeChangeStreamsUnsupported = 40573
+	// codeChangeStreamHistoryLost means the resume token has fallen off the
+	// oplog.
+	codeChangeStreamHistoryLost = 286
+	// codeInvalidResumeToken means the resume token cannot be used at all.
+	codeInvalidResumeToken = 260
+)
+
+var errChangeStreamsUnsupported = errors.New("change streams are not supported by this server")
+
+// MongoWatcher keeps the enforcer's in-memory rules in step with the
+// casbin_rule collection, so rules written by other replicas take effect
+// without a restart. It follows the collection's change stream and falls
+// back to polling on standalone servers. The stream's resume token is saved
+// per replica after every change so a restarted replica picks up where it
+// left off.
+type MongoWatcher struct {
+	cache    *ruleCache
+	rules    *mongo.Collection
+	tokens   *mongo.Collection
+	replica  string
+	interval time.Duration
+	loaded   bool
+}
+
+// NewMongoWatcher watches the rules the MongoDB adapter of NewCasbinEnforcer
+// stores for s. replica identifies this instance's resume token, and
+// interval is both the polling period and the delay before reconnecting.
+func NewMongoWatcher(e *Enforcer, s *store.MongoStore, replica string, interval time.Duration) (*MongoWatcher, error) {
+	rules, err := mongoRules(s)
+	if err != nil {
+		return nil, err
+	}
+
+	return &MongoWatcher{
+		cache:    newRuleCache(e),
+		rules:    rules,
+		tokens:   s.DB.Collection("enforcer_watchers"),
+		replica:  replica,
+		interval: interval,
+	}, nil
+}
+
+// mongoRules returns the collection the MongoDB adapter keeps its rules in:
+// casbin_rule in the database named in the URI, or "casbin".
+func mongoRules(s *store.MongoStore) (*mongo.Collection, error) {
+	uri := s.GetURI()
+	if !strings.HasPrefix(uri, "mongodb://") && !strings.HasPrefix(uri, "mongodb+srv://") {
+		uri = "mongodb://" + uri
+	}
+	conn, err := connstring.ParseAndValidate(uri)
+	if err != nil {
+		return nil, err
+	}
+
+	database := conn.Database
+	if database == "" {
+		database = "casbin"
+	}
+	return s.Client.Database(database).Collection("casbin_rule"), nil
+}
+
+// Run applies rule changes until ctx is cancelled.
+func (w *MongoWatcher) Run(ctx context.Context) {
+	for ctx.Err() == nil {
+		err := w.watch(ctx)
+		if errors.Is(err, errChangeStreamsUnsupported) {
+			log.Printf("Change streams unavailable, polling Casbin rules every %s", w.interval)
+			w.poll(ctx)
+			return
+		}
+		if err != nil && ctx.Err() == nil {
+			log.Printf("Error watching Casbin rules, retrying in %s: %v", w.interval, err)
+		}
+
+		select {
+		case <-ctx.Done():
+		case <-time.After(w.interval):
+		}
+	}
+}
+
+// changeEvent is the part of a change stream event the watcher uses.
+type changeEvent struct {
+	OperationType string `bson:"operationType"`
+	DocumentKey   struct {
+		ID interface{} `bson:"_id"`
+	} `bson:"documentKey"`
+	FullDocument *ruleDoc `bson:"fullDocument"`
+}
+
+// watch follows the change stream until it fails or ctx is cancelled.
+func (w *MongoWatcher) watch(ctx context.Context) error {
+	token, err := w.loadToken(ctx)
+	if err != nil {
+		return err
+	}
+
+	opts := options.ChangeStream().SetFullDocument(options.UpdateLookup)
+	if token != nil {
+		opts.SetResumeAfter(token)
+	}
+	stream, err := w.rules.Watch(ctx, mongo.Pipeline{}, opts)
+	if hasErrorCode(err, codeChangeStreamsUnsupported) {
+		return errChangeStreamsUnsupported
+	}
+	if token != nil && hasErrorCode(err, codeChangeStreamHistoryLost, codeInvalidResumeToken) {
+		// Start over from the current state rather than from the token.
+		log.Printf("Casbin rule resume token expired, reloading rules")
+		w.loaded = false
+		return w.saveToken(ctx, nil)
+	}
+	if err != nil {
+		return err
+	}
+	defer stream.Close(ctx)
+
+	// The stream is already open, so nothing written after this load is
+	// missed. Replayed events are harmless.
+	if !w.loaded {
+		if err := w.reload(ctx); err != nil {
+			return err
+		}
+	}
+
+	for stream.Next(ctx) {
+		var event changeEvent
+		if err := stream.Decode(&event); err != nil {
+			return err
+		}
+
+		switch event.OperationType {
+		case "insert", "update", "replace":
+			if event.FullDocument == nil {
+				err = w.cache.remove(fmt.Sprint(event.DocumentKey.ID))
+			} else {
+				err = w.cache.put(*event.FullDocument)
+			}
+		case "delete":
+			err = w.cache.remove(fmt.Sprint(event.DocumentKey.ID))
+		case "invalidate":
+			// The collection was dropped or renamed, e.g. by SavePolicy.
+			// The stream cannot be resumed past this point.
+			w.loaded = false
+			return w.saveToken(ctx, nil)
+		}
+		if err != nil {
+			return err
+		}
+
+		if err := w.saveToken(ctx, stream.ResumeToken()); err != nil {
+			return err
+		}
+	}
+	return stream.Err()
+}
+
+// poll applies the difference between the collection and the cache every
+// interval.
+func (w *MongoWatcher) poll(ctx context.Context) {
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	for {
+		var err error
+		if w.loaded {
+			var docs []ruleDoc
+			if docs, err = w.snapshot(ctx); err == nil {
+				err = w.cache.sync(docs)
+			}
+		} else {
+			err = w.reload(ctx)
+		}
+		if err != nil && ctx.Err() == nil {
+			log.Printf("Error polling Casbin rules: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// reload replaces the enforcer's rules with what is stored.
+func (w *MongoWatcher) reload(ctx context.Context) error {
+	if err := w.cache.enforcer.LoadPolicy(); err != nil {
+		return err
+	}
+	docs, err := w.snapshot(ctx)
+	if err != nil {
+		return err
+	}
+	w.cache.reset(docs)
+	w.loaded = true
+	return nil
+}
+
+func (w *MongoWatcher) snapshot(ctx context.Context) ([]ruleDoc, error) {
+	cursor, err := w.rules.Find(ctx, bson.M{})
+	if err != nil {
+		return nil, err
+	}
+	var docs []ruleDoc
+	if err := cursor.All(ctx, &docs); err != nil {
+		return nil, err
+	}
+	return docs, nil
+}
+
+func (w *MongoWatcher) loadToken(ctx context.Context) (bson.Raw, error) {
+	var saved struct {
+		Token bson.Raw `bson:"resume_token"`
+	}
+	err := w.tokens.FindOne(ctx, bson.M{"_id": w.replica}).Decode(&saved)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, nil
+	}
+	return saved.Token, err
+}
+
+// saveToken records where this replica's stream is, or forgets it when
+// token is nil.
+func (w *MongoWatcher) saveToken(ctx context.Context, token bson.Raw) error {
+	if token == nil {
+		_, err := w.tokens.DeleteOne(ctx, bson.M{"_id": w.replica})
+		return err
+	}
+	_, err := w.tokens.UpdateOne(ctx,
+		bson.M{"_id": w.replica},
+		bson.M{"$set": bson.M{"resume_token": token, "updated_at": time.Now()}},
+		options.Update().SetUpsert(true),
+	)
+	return err
+}
+
+func hasErrorCode(err error, codes ...int) bool {
+	var serverErr mongo.ServerError
+	if !errors.As(err, &serverErr) {
+		return false
+	}
+	for _, code := range codes {
+		if serverErr.HasErrorCode(code) {
+			return true
+		}
+	}
+	return false
+}
+
+// ruleDoc is a rule as the MongoDB adapter stores it.
+type ruleDoc struct {
+	ID    interface{} `bson:"_id"`
+	PType string      `bson:"ptype"`
+	V0    string      `bson:"v0"`
+	V1    string      `bson:"v1"`
+	V2    string      `bson:"v2"`
+	V3    string      `bson:"v3"`
+	V4    string      `bson:"v4"`
+	V5    string      `bson:"v5"`
+}
+
+// rule returns the values of the rule without the trailing empty ones, as
+// the adapter loads it.
+func (d *ruleDoc) rule() []string {
+	values := []string{d.V0, d.V1, d.V2, d.V3, d.V4, d.V5}
+	for len(values) > 0 && values[len(values)-1] == "" {
+		values = values[:len(values)-1]
+	}
+	return values
+}
+
+func (d *ruleDoc) key() string {
+	return d.PType + "\x00" + strings.Join(d.rule(), "\x00")
+}
+
+// ruleCache applies stored rules to the enforcer's in-memory model without
+// writing them back through the adapter. It remembers each document's rule,
+// because delete events only carry the document ID, and how many documents
+// hold each rule, because the adapter allows duplicates.
+type ruleCache struct {
+	enforcer *Enforcer
+	docs     map[string]ruleDoc
+	holders  map[string]int
+}
+
+func newRuleCache(e *Enforcer) *ruleCache {
+	return &ruleCache{enforcer: e, docs: map[string]ruleDoc{}, holders: map[string]int{}}
+}
+
+// reset forgets everything and records docs, assuming the enforcer already
+// holds their rules.
+func (c *ruleCache) reset(docs []ruleDoc) {
+	c.docs = make(map[string]ruleDoc, len(docs))
+	c.holders = make(map[string]int, len(docs))
+	for _, doc := range docs {
+		c.docs[fmt.Sprint(doc.ID)] = doc
+		c.holders[doc.key()]++
+	}
+}
+
+// put records a new or changed document and grants its rule.
+func (c *ruleCache) put(doc ruleDoc) error {
+	id := fmt.Sprint(doc.ID)
+	if old, ok := c.docs[id]; ok {
+		if old.key() == doc.key() {
+			return nil
+		}
+		if err := c.remove(id); err != nil {
+			return err
+		}
+	}
+
+	c.docs[id] = doc
+	c.holders[doc.key()]++
+	if c.holders[doc.key()] > 1 {
+		return nil
+	}
+	return c.apply(model.PolicyAdd, doc)
+}
+
+// remove forgets a document and revokes its rule unless another document
+// still holds it.
+func (c *ruleCache) remove(id string) error {
+	doc, ok := c.docs[id]
+	if !ok {
+		return nil
+	}
+
+	delete(c.docs, id)
+	c.holders[doc.key()]--
+	if c.holders[doc.key()] > 0 {
+		return nil
+	}
+	delete(c.holders, doc.key())
+	return c.apply(model.PolicyRemove, doc)
+}
+
+// sync applies the difference between docs, a full snapshot of the
+// collection, and what the cache has seen.
+func (c *ruleCache) sync(docs []ruleDoc) error {
+	current := make(map[string]bool, len(docs))
+	for _, doc := range docs {
+		current[fmt.Sprint(doc.ID)] = true
+		if err := c.put(doc); err != nil {
+			return err
+		}
+	}
+	for id := range c.docs {
+		if !current[id] {
+			if err := c.remove(id); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (c *ruleCache) apply(op model.PolicyOp, doc ruleDoc) error {
+	if doc.PType == "" {
+		return nil
+	}
+	sec, rule := doc.PType[:1], doc.rule()
+
+	// The model is changed directly, so the enforcer's lock is taken here
+	// and only the unsynchronised methods are used while it is held.
+	lock := c.enforcer.GetLock()
+	lock.Lock()
+	defer lock.Unlock()
+	inner := c.enforcer.SyncedEnforcer.Enforcer
+
+	// Rule types the model does not define are skipped.
+	m := inner.GetModel()
+	if _, ok := m[sec][doc.PType]; !ok {
+		return nil
+	}
+
+	switch op {
+	case model.PolicyAdd:
+		has, err := m.HasPolicy(sec, doc.PType, rule)
+		if err != nil || has {
+			return err
+		}
+		if err := m.AddPolicy(sec, doc.PType, rule); err != nil {
+			return err
+		}
+	case model.PolicyRemove:
+		removed, err := m.RemovePolicy(sec, doc.PType, rule)
+		if err != nil || !removed {
+			return err
+		}
+	}
+
+	if sec == "g" {
+		return inner.BuildIncrementalRoleLinks(op, doc.PType, [][]string{rule})
+	}
+	return nil
+}
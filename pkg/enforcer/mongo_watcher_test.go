@@ -0,0 +1,95 @@
+package enforcer
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestRuleCache(t *testing.T) {
+	e := newTestEnforcer(t, []string{"admin", "default", "/api/v1/users", "GET"})
+	allowed := func(sub, obj, act string) bool {
+		ok, err := e.Enforce(sub, "default", obj, act)
+		require.NoError(t, err)
+		return ok
+	}
+	rule := func(sub, obj, act string) ruleDoc {
+		return ruleDoc{ID: primitive.NewObjectID(), PType: "p", V0: sub, V1: "default", V2: obj, V3: act}
+	}
+
+	admin := rule("admin", "/api/v1/users", "GET")
+	cache := newRuleCache(e)
+	cache.reset([]ruleDoc{admin})
+
+	// Another replica grants support the same thing twice.
+	support := rule("support", "/api/v1/users", "GET")
+	duplicate := rule("support", "/api/v1/users", "GET")
+	require.NoError(t, cache.put(support))
+	require.NoError(t, cache.put(duplicate))
+	assert.True(t, allowed("support", "/api/v1/users", "GET"))
+
+	require.NoError(t, cache.remove(fmt.Sprint(support.ID)))
+	assert.True(t, allowed("support", "/api/v1/users", "GET"), "duplicate still grants the rule")
+
+	// An update replaces the document's rule.
+	duplicate.V3 = "DELETE"
+	require.NoError(t, cache.put(duplicate))
+	assert.False(t, allowed("support", "/api/v1/users", "GET"))
+	assert.True(t, allowed("support", "/api/v1/users", "DELETE"))
+
+	// Polling applies only the difference from a full snapshot.
+	customer := rule("customer", "/api/v1/orders", "GET")
+	require.NoError(t, cache.sync([]ruleDoc{admin, customer}))
+	assert.True(t, allowed("admin", "/api/v1/users", "GET"))
+	assert.True(t, allowed("customer", "/api/v1/orders", "GET"))
+	assert.False(t, allowed("support", "/api/v1/users", "DELETE"))
+
+	// Removing unknown documents and rule types the model lacks is a no-op.
+	require.NoError(t, cache.remove("missing"))
+	require.NoError(t, cache.put(ruleDoc{ID: primitive.NewObjectID(), PType: "g2", V0: "alice", V1: "admin"}))
+
+	policies, err := e.GetPolicy()
+	require.NoError(t, err)
+	assert.Len(t, policies, 2)
+}
+
+func TestRuleCacheConcurrentEnforce(t *testing.T) {
+	e := newTestEnforcer(t)
+	cache := newRuleCache(e)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 200; i++ {
+			policy := ruleDoc{ID: i, PType: "p", V0: "support", V1: "default", V2: fmt.Sprintf("/api/v1/users/%d", i), V3: "GET"}
+			member := ruleDoc{ID: -1 - i, PType: "g", V0: fmt.Sprintf("user:%d", i), V1: "support", V2: "default"}
+			if err := cache.put(policy); err != nil {
+				t.Error(err)
+			}
+			if err := cache.put(member); err != nil {
+				t.Error(err)
+			}
+			if err := cache.remove(fmt.Sprint(member.ID)); err != nil {
+				t.Error(err)
+			}
+		}
+	}()
+
+	for {
+		select {
+		case <-done:
+			ok, err := e.Enforce("support", "default", "/api/v1/users/199", "GET")
+			require.NoError(t, err)
+			assert.True(t, ok)
+			return
+		default:
+			_, err := e.Enforce("user:1", "default", "/api/v1/users/1", "GET")
+			require.NoError(t, err)
+			_, err = e.GetImplicitRolesForUser("user:1", "default")
+			require.NoError(t, err)
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package enforcer
+
+import (
+	"context"
+
+	"github.com/knakul853/accessmesh/internal/models"
+	"github.com/knakul853/accessmesh/internal/store"
+)
+
+// Grant adds the rule for a stored policy, in the domain of its tenant.
+// Conditional policies have no rule: they only grant access through
+// services.Access, which evaluates their expression.
+func (e *Enforcer) Grant(policy *models.Policy) error {
+	if policy.Conditional() {
+		return nil
+	}
+	_, err := e.AddPolicy(PolicySubject(policy), policy.TenantID, policy.Resource, policy.Action)
+	return err
+}
+
+// Revoke removes the rule for a stored policy that was changed, trashed or
+// deleted, unless another live unconditional policy of the tenant still
+// grants the same thing. Call it after the store write.
+func (e *Enforcer) Revoke(ctx context.Context, policies store.PolicyRepository, policy *models.Policy) error {
+	page, err := policies.List(ctx, store.PolicyQuery{
+		TenantID: policy.TenantID,
+		Role:     policy.Role,
+		Group:    policy.Group,
+		Resource: policy.Resource,
+		Action:   policy.Action,
+	})
+	if err != nil {
+		return err
+	}
+	for i := range page.Items {
+		if !page.Items[i].Conditional() {
+			return nil
+		}
+	}
+
+	_, err = e.RemovePolicy(PolicySubject(policy), policy.TenantID, policy.Resource, policy.Action)
+	return err
+}
+
+// GrantRole adds the rules of every live policy for the tenant's role.
+func (e *Enforcer) GrantRole(ctx context.Context, policies store.PolicyRepository, tenant, role string) error {
+	page, err := policies.List(ctx, store.PolicyQuery{TenantID: tenant, Role: role})
+	if err != nil {
+		return err
+	}
+	for i := range page.Items {
+		if err := e.Grant(&page.Items[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,181 @@
+package enforcer
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/casbin/casbin/v2/model"
+	"github.com/casbin/casbin/v2/persist"
+)
+
+// casbinFields is the number of value columns (v0..v5) in casbin_rule.
+const casbinFields = 6
+
+// SQLAdapter stores Casbin policy rules in the casbin_rule table of a
+// database/sql database. The table is created on first use.
+//
+// It implements persist.BatchAdapter as well as persist.Adapter.
+type SQLAdapter struct {
+	db *sql.DB
+}
+
+func NewSQLAdapter(db *sql.DB) (*SQLAdapter, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if _, err := db.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS casbin_rule (
+		ptype TEXT NOT NULL,
+		v0    TEXT NOT NULL DEFAULT '',
+		v1    TEXT NOT NULL DEFAULT '',
+		v2    TEXT NOT NULL DEFAULT '',
+		v3    TEXT NOT NULL DEFAULT '',
+		v4    TEXT NOT NULL DEFAULT '',
+		v5    TEXT NOT NULL DEFAULT ''
+	)`); err != nil {
+		return nil, fmt.Errorf("create casbin_rule: %w", err)
+	}
+	return &SQLAdapter{db: db}, nil
+}
+
+func (a *SQLAdapter) LoadPolicy(m model.Model) error {
+	rows, err := a.db.Query(`SELECT ptype, v0, v1, v2, v3, v4, v5 FROM casbin_rule`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		line := make([]string, casbinFields+1)
+		dest := make([]interface{}, len(line))
+		for i := range line {
+			dest[i] = &line[i]
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return err
+		}
+
+		// Trailing empty columns are padding, not part of the rule.
+		for len(line) > 1 && line[len(line)-1] == "" {
+			line = line[:len(line)-1]
+		}
+		if err := persist.LoadPolicyArray(line, m); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+func (a *SQLAdapter) SavePolicy(m model.Model) error {
+	tx, err := a.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM casbin_rule`); err != nil {
+		return err
+	}
+	for _, sec := range []string{"p", "g"} {
+		for ptype, assertion := range m[sec] {
+			for _, rule := range assertion.Policy {
+				if err := insertRule(tx, ptype, rule); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return tx.Commit()
+}
+
+func (a *SQLAdapter) AddPolicy(sec string, ptype string, rule []string) error {
+	return a.AddPolicies(sec, ptype, [][]string{rule})
+}
+
+func (a *SQLAdapter) AddPolicies(sec string, ptype string, rules [][]string) error {
+	tx, err := a.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, rule := range rules {
+		if err := insertRule(tx, ptype, rule); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (a *SQLAdapter) RemovePolicy(sec string, ptype string, rule []string) error {
+	return a.RemovePolicies(sec, ptype, [][]string{rule})
+}
+
+func (a *SQLAdapter) RemovePolicies(sec string, ptype string, rules [][]string) error {
+	tx, err := a.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, rule := range rules {
+		values, err := ruleValues(rule)
+		if err != nil {
+			return err
+		}
+		args := append([]interface{}{ptype}, values...)
+		if _, err := tx.Exec(`DELETE FROM casbin_rule WHERE ptype = $1
+			AND v0 = $2 AND v1 = $3 AND v2 = $4 AND v3 = $5 AND v4 = $6 AND v5 = $7`, args...); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (a *SQLAdapter) RemoveFilteredPolicy(sec string, ptype string, fieldIndex int, fieldValues ...string) error {
+	query := `DELETE FROM casbin_rule WHERE ptype = $1`
+	args := []interface{}{ptype}
+	for i, value := range fieldValues {
+		if value == "" {
+			continue
+		}
+		field := fieldIndex + i
+		if field >= casbinFields {
+			return fmt.Errorf("casbin_rule has no field v%d", field)
+		}
+		args = append(args, value)
+		query += fmt.Sprintf(" AND v%d = $%d", field, len(args))
+	}
+
+	_, err := a.db.Exec(query, args...)
+	return err
+}
+
+func insertRule(tx *sql.Tx, ptype string, rule []string) error {
+	values, err := ruleValues(rule)
+	if err != nil {
+		return err
+	}
+	args := append([]interface{}{ptype}, values...)
+	_, err = tx.Exec(`INSERT INTO casbin_rule (ptype, v0, v1, v2, v3, v4, v5)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)`, args...)
+	return err
+}
+
+// ruleValues pads rule to the casbin_rule column count.
+func ruleValues(rule []string) ([]interface{}, error) {
+	if len(rule) > casbinFields {
+		return nil, fmt.Errorf("rule %s has more than %d fields", strings.Join(rule, ", "), casbinFields)
+	}
+
+	values := make([]interface{}, casbinFields)
+	for i := range values {
+		values[i] = ""
+	}
+	for i, v := range rule {
+		values[i] = v
+	}
+	return values, nil
+}
@@ -0,0 +1,84 @@
+package enforcer
+
+import (
+	"database/sql"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/casbin/casbin/v2"
+	"github.com/casbin/casbin/v2/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	_ "modernc.org/sqlite"
+)
+
+func TestSQLAdapter(t *testing.T) {
+	db, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "casbin.db"))
+	require.NoError(t, err)
+	defer db.Close()
+
+	adapter, err := NewSQLAdapter(db)
+	require.NoError(t, err)
+
+	conf, err := os.ReadFile("../../model.conf")
+	require.NoError(t, err)
+	m, err := model.NewModelFromString(string(conf))
+	require.NoError(t, err)
+
+	e, err := casbin.NewEnforcer(m, adapter)
+	require.NoError(t, err)
+	_, err = e.AddPolicies([][]string{
+		{"admin", "default", "/api/v1/users", "GET"},
+		{"admin", "default", "/api/v1/users", "DELETE"},
+		{"support", "default", "/api/v1/users", "GET"},
+	})
+	require.NoError(t, err)
+	_, err = e.RemovePolicy("admin", "default", "/api/v1/users", "DELETE")
+	require.NoError(t, err)
+	_, err = e.RemoveFilteredPolicy(0, "support")
+	require.NoError(t, err)
+
+	want := [][]string{{"admin", "default", "/api/v1/users", "GET"}}
+
+	require.NoError(t, e.LoadPolicy())
+	policies, err := e.GetPolicy()
+	require.NoError(t, err)
+	assert.Equal(t, want, policies)
+
+	require.NoError(t, e.SavePolicy())
+	require.NoError(t, e.LoadPolicy())
+	policies, err = e.GetPolicy()
+	require.NoError(t, err)
+	assert.Equal(t, want, policies)
+}
+
+func TestUpgradeSQLRules(t *testing.T) {
+	db, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "casbin.db"))
+	require.NoError(t, err)
+	defer db.Close()
+
+	adapter, err := NewSQLAdapter(db)
+	require.NoError(t, err)
+	_, err = db.Exec(`INSERT INTO casbin_rule (ptype, v0, v1, v2, v3) VALUES
+		('p', 'admin', '/api/v1/users', 'GET', ''),
+		('p', 'admin', 'acme', '/api/v1/users', 'GET')`)
+	require.NoError(t, err)
+
+	require.NoError(t, upgradeSQLRules(db))
+	require.NoError(t, upgradeSQLRules(db), "upgrading twice is harmless")
+
+	conf, err := os.ReadFile("../../model.conf")
+	require.NoError(t, err)
+	m, err := model.NewModelFromString(string(conf))
+	require.NoError(t, err)
+	e, err := casbin.NewEnforcer(m, adapter)
+	require.NoError(t, err)
+
+	policies, err := e.GetPolicy()
+	require.NoError(t, err)
+	assert.Equal(t, [][]string{
+		{"admin", "default", "/api/v1/users", "GET"},
+		{"admin", "acme", "/api/v1/users", "GET"},
+	}, policies)
+}
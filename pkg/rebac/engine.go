@@ -0,0 +1,345 @@
+package rebac
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/knakul853/accessmesh/internal/models"
+	"github.com/knakul853/accessmesh/internal/store"
+)
+
+// MaxDepth bounds how many relations a check or expansion follows from the
+// one asked about, so that long chains of nested usersets fail instead of
+// tying up the store.
+const MaxDepth = 25
+
+// ErrDepthExceeded is returned when answering a request would follow more
+// than MaxDepth relations.
+var ErrDepthExceeded = errors.New("relation depth limit exceeded")
+
+// Operations of an expansion Tree.
+const (
+	OpThis            = "this"
+	OpComputedUserset = "computed_userset"
+	OpTupleToUserset  = "tuple_to_userset"
+	OpUnion           = "union"
+)
+
+// Tree is the expansion of a relation: a node per rewrite, with the
+// relation's own subjects at the "this" leaves. Subjects that are usersets,
+// such as group:eng#member, are left for the caller to expand in turn.
+type Tree struct {
+	// Userset is the object#relation the node expands, for the nodes of a
+	// relation rather than of a part of its rewrite.
+	Userset   string   `json:"userset,omitempty"`
+	Operation string   `json:"operation"`
+	Subjects  []string `json:"subjects,omitempty"`
+	Children  []*Tree  `json:"children,omitempty"`
+}
+
+// Engine answers check, expand and list-objects requests over relation
+// tuples, and writes tuples the namespace configuration allows.
+type Engine struct {
+	tuples     store.TupleRepository
+	namespaces Namespaces
+}
+
+// NewEngine returns an Engine over the tuples of a store.
+func NewEngine(tuples store.TupleRepository, namespaces Namespaces) *Engine {
+	return &Engine{tuples: tuples, namespaces: namespaces}
+}
+
+// Namespaces returns the namespace configuration.
+func (e *Engine) Namespaces() Namespaces {
+	return e.namespaces
+}
+
+// Write inserts and deletes tuples of a tenant as one revision and returns
+// its consistency token. Inserting a tuple that exists or deleting one that
+// does not is not an error.
+func (e *Engine) Write(ctx context.Context, tenantID string, inserts, deletes []models.RelationTuple) (string, error) {
+	tenantID = tenantOrDefault(tenantID)
+	for _, t := range inserts {
+		if err := e.namespaces.CheckTuple(t); err != nil {
+			return "", err
+		}
+	}
+	revision, err := e.tuples.Write(ctx, tenantID, inserts, deletes)
+	if err != nil {
+		return "", err
+	}
+	return EncodeToken(tenantID, revision), nil
+}
+
+// Read returns the tuples of filter's tenant that match it, and the
+// consistency token of the revision they were read at.
+func (e *Engine) Read(ctx context.Context, filter store.TupleFilter, consistency Consistency) ([]models.RelationTuple, string, error) {
+	filter.TenantID = tenantOrDefault(filter.TenantID)
+	revision, err := e.revision(ctx, filter.TenantID, consistency)
+	if err != nil {
+		return nil, "", err
+	}
+	tuples, err := e.tuples.Read(ctx, filter, revision)
+	return tuples, EncodeToken(filter.TenantID, revision), err
+}
+
+// Check reports whether subject has relation to object.
+func (e *Engine) Check(ctx context.Context, tenantID string, object models.ObjectRef, relation string, subject models.SubjectRef, consistency Consistency) (bool, string, error) {
+	tenantID = tenantOrDefault(tenantID)
+	revision, err := e.revision(ctx, tenantID, consistency)
+	if err != nil {
+		return false, "", err
+	}
+	if _, err := e.namespaces.rewrite(object.Type, relation); err != nil {
+		return false, "", err
+	}
+
+	c := &checker{engine: e, tenantID: tenantID, revision: revision, subject: subject}
+	allowed, err := c.check(ctx, object, relation, nil)
+	return allowed, EncodeToken(tenantID, revision), err
+}
+
+// Expand returns the tree of the subjects having relation to object.
+func (e *Engine) Expand(ctx context.Context, tenantID string, object models.ObjectRef, relation string, consistency Consistency) (*Tree, string, error) {
+	tenantID = tenantOrDefault(tenantID)
+	revision, err := e.revision(ctx, tenantID, consistency)
+	if err != nil {
+		return nil, "", err
+	}
+
+	c := &checker{engine: e, tenantID: tenantID, revision: revision}
+	tree, err := c.expand(ctx, object, relation, nil)
+	return tree, EncodeToken(tenantID, revision), err
+}
+
+// ListObjects returns the IDs of the objects of objectType that subject has
+// relation to. Every object of the type that appears in a tuple is checked,
+// so its cost grows with the number of such objects.
+func (e *Engine) ListObjects(ctx context.Context, tenantID, objectType, relation string, subject models.SubjectRef, consistency Consistency) ([]string, string, error) {
+	tenantID = tenantOrDefault(tenantID)
+	revision, err := e.revision(ctx, tenantID, consistency)
+	if err != nil {
+		return nil, "", err
+	}
+	if _, err := e.namespaces.rewrite(objectType, relation); err != nil {
+		return nil, "", err
+	}
+
+	tuples, err := e.tuples.Read(ctx, store.TupleFilter{TenantID: tenantID, ObjectType: objectType}, revision)
+	if err != nil {
+		return nil, "", err
+	}
+	var candidates []string
+	for _, t := range tuples {
+		// Tuples come sorted by object.
+		if len(candidates) == 0 || candidates[len(candidates)-1] != t.ObjectID {
+			candidates = append(candidates, t.ObjectID)
+		}
+	}
+
+	c := &checker{engine: e, tenantID: tenantID, revision: revision, subject: subject}
+	ids := []string{}
+	for _, id := range candidates {
+		allowed, err := c.check(ctx, models.ObjectRef{Type: objectType, ID: id}, relation, nil)
+		if err != nil {
+			return nil, "", err
+		}
+		if allowed {
+			ids = append(ids, id)
+		}
+	}
+	return ids, EncodeToken(tenantID, revision), nil
+}
+
+func (e *Engine) revision(ctx context.Context, tenantID string, consistency Consistency) (int64, error) {
+	latest, err := e.tuples.Revision(ctx, tenantID)
+	if err != nil {
+		return 0, err
+	}
+	return consistency.revision(tenantID, latest)
+}
+
+func tenantOrDefault(tenantID string) string {
+	if tenantID == "" {
+		return models.DefaultTenant
+	}
+	return tenantID
+}
+
+// checker evaluates one request at one revision.
+type checker struct {
+	engine   *Engine
+	tenantID string
+	revision int64
+	subject  models.SubjectRef
+}
+
+// direct reads the tuples of object#relation.
+func (c *checker) direct(ctx context.Context, object models.ObjectRef, relation string) ([]models.RelationTuple, error) {
+	return c.engine.tuples.Read(ctx, store.TupleFilter{
+		TenantID:   c.tenantID,
+		ObjectType: object.Type,
+		ObjectID:   object.ID,
+		Relation:   relation,
+	}, c.revision)
+}
+
+// follow returns path extended with object#relation, or false if
+// object#relation is already on it, so that cyclic tuples end.
+func follow(path []string, object models.ObjectRef, relation string) ([]string, bool, error) {
+	userset := object.String() + "#" + relation
+	if slices.Contains(path, userset) {
+		return nil, false, nil
+	}
+	if len(path) >= MaxDepth {
+		return nil, false, fmt.Errorf("%w at %s", ErrDepthExceeded, userset)
+	}
+	return append(slices.Clip(path), userset), true, nil
+}
+
+func (c *checker) check(ctx context.Context, object models.ObjectRef, relation string, path []string) (bool, error) {
+	path, ok, err := follow(path, object, relation)
+	if err != nil || !ok {
+		return false, err
+	}
+	rewrite, err := c.engine.namespaces.rewrite(object.Type, relation)
+	if errors.Is(err, ErrUnknownRelation) {
+		// A tuple-to-userset may point at objects without the relation.
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return c.checkRewrite(ctx, object, relation, rewrite, path)
+}
+
+func (c *checker) checkRewrite(ctx context.Context, object models.ObjectRef, relation string, rewrite *Rewrite, path []string) (bool, error) {
+	switch {
+	case rewrite.ComputedUserset != "":
+		return c.check(ctx, object, rewrite.ComputedUserset, path)
+
+	case rewrite.TupleToUserset != nil:
+		tuples, err := c.direct(ctx, object, rewrite.TupleToUserset.Tupleset)
+		if err != nil {
+			return false, err
+		}
+		for _, t := range tuples {
+			allowed, err := c.check(ctx, t.Subject().ObjectRef, rewrite.TupleToUserset.ComputedUserset, path)
+			if err != nil || allowed {
+				return allowed, err
+			}
+		}
+		return false, nil
+
+	case rewrite.Union != nil:
+		for _, child := range rewrite.Union {
+			if child == nil {
+				child = &Rewrite{This: true}
+			}
+			allowed, err := c.checkRewrite(ctx, object, relation, child, path)
+			if err != nil || allowed {
+				return allowed, err
+			}
+		}
+		return false, nil
+	}
+
+	tuples, err := c.direct(ctx, object, relation)
+	if err != nil {
+		return false, err
+	}
+	for _, t := range tuples {
+		if t.Subject() == c.subject {
+			return true, nil
+		}
+	}
+	for _, t := range tuples {
+		if t.SubjectRelation == "" {
+			continue
+		}
+		allowed, err := c.check(ctx, t.Subject().ObjectRef, t.SubjectRelation, path)
+		if err != nil || allowed {
+			return allowed, err
+		}
+	}
+	return false, nil
+}
+
+func (c *checker) expand(ctx context.Context, object models.ObjectRef, relation string, path []string) (*Tree, error) {
+	path, ok, err := follow(path, object, relation)
+	if err != nil || !ok {
+		return nil, err
+	}
+	rewrite, err := c.engine.namespaces.rewrite(object.Type, relation)
+	if err != nil {
+		return nil, err
+	}
+	tree, err := c.expandRewrite(ctx, object, relation, rewrite, path)
+	if err != nil {
+		return nil, err
+	}
+	tree.Userset = object.String() + "#" + relation
+	return tree, nil
+}
+
+func (c *checker) expandRewrite(ctx context.Context, object models.ObjectRef, relation string, rewrite *Rewrite, path []string) (*Tree, error) {
+	switch {
+	case rewrite.ComputedUserset != "":
+		tree := &Tree{Operation: OpComputedUserset}
+		child, err := c.expand(ctx, object, rewrite.ComputedUserset, path)
+		if err != nil {
+			return nil, err
+		}
+		if child != nil {
+			tree.Children = append(tree.Children, child)
+		}
+		return tree, nil
+
+	case rewrite.TupleToUserset != nil:
+		tree := &Tree{Operation: OpTupleToUserset}
+		tuples, err := c.direct(ctx, object, rewrite.TupleToUserset.Tupleset)
+		if err != nil {
+			return nil, err
+		}
+		for _, t := range tuples {
+			target := t.Subject().ObjectRef
+			if !c.engine.namespaces.defines(target.Type, rewrite.TupleToUserset.ComputedUserset) {
+				continue
+			}
+			child, err := c.expand(ctx, target, rewrite.TupleToUserset.ComputedUserset, path)
+			if err != nil {
+				return nil, err
+			}
+			if child != nil {
+				tree.Children = append(tree.Children, child)
+			}
+		}
+		return tree, nil
+
+	case rewrite.Union != nil:
+		tree := &Tree{Operation: OpUnion}
+		for _, child := range rewrite.Union {
+			if child == nil {
+				child = &Rewrite{This: true}
+			}
+			subtree, err := c.expandRewrite(ctx, object, relation, child, path)
+			if err != nil {
+				return nil, err
+			}
+			tree.Children = append(tree.Children, subtree)
+		}
+		return tree, nil
+	}
+
+	tuples, err := c.direct(ctx, object, relation)
+	if err != nil {
+		return nil, err
+	}
+	tree := &Tree{Operation: OpThis}
+	for _, t := range tuples {
+		tree.Subjects = append(tree.Subjects, t.Subject().String())
+	}
+	return tree, nil
+}
@@ -0,0 +1,221 @@
+package rebac
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/knakul853/accessmesh/internal/models"
+	"github.com/knakul853/accessmesh/internal/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testNamespaces = `{
+	"user": {},
+	"group": {"relations": {"member": null}},
+	"folder": {"relations": {
+		"parent": null,
+		"viewer": {"union": [
+			{"this": true},
+			{"tuple_to_userset": {"tupleset": "parent", "computed_userset": "viewer"}}]}}},
+	"document": {"relations": {
+		"parent": null,
+		"owner": null,
+		"editor": {"union": [{"this": true}, {"computed_userset": "owner"}]},
+		"viewer": {"union": [
+			{},
+			{"computed_userset": "editor"},
+			{"tuple_to_userset": {"tupleset": "parent", "computed_userset": "viewer"}}]}}}
+}`
+
+func newTestEngine(t *testing.T) *Engine {
+	var namespaces Namespaces
+	require.NoError(t, json.Unmarshal([]byte(testNamespaces), &namespaces))
+	require.NoError(t, namespaces.Validate())
+	return NewEngine(store.NewMemoryStore().Tuples(), namespaces)
+}
+
+func tuples(t *testing.T, raw ...string) []models.RelationTuple {
+	var out []models.RelationTuple
+	for _, r := range raw {
+		tuple, err := models.ParseTuple(r)
+		require.NoError(t, err)
+		out = append(out, tuple)
+	}
+	return out
+}
+
+func TestValidateNamespaces(t *testing.T) {
+	for name, config := range map[string]string{
+		"unknown computed userset": `{"doc": {"relations": {"viewer": {"computed_userset": "owner"}}}}`,
+		"unknown tupleset":         `{"doc": {"relations": {"viewer": {"tuple_to_userset": {"tupleset": "parent", "computed_userset": "viewer"}}}}}`,
+		"two operations":           `{"doc": {"relations": {"owner": null, "viewer": {"this": true, "computed_userset": "owner"}}}}`,
+		"empty union":              `{"doc": {"relations": {"viewer": {"union": []}}}}`,
+		"computed cycle":           `{"doc": {"relations": {"viewer": {"union": [{"computed_userset": "editor"}]}, "editor": {"computed_userset": "viewer"}}}}`,
+		"bad name":                 `{"doc#x": {}}`,
+	} {
+		var namespaces Namespaces
+		require.NoError(t, json.Unmarshal([]byte(config), &namespaces), name)
+		assert.Error(t, namespaces.Validate(), name)
+	}
+}
+
+func TestCheck(t *testing.T) {
+	ctx := context.Background()
+	e := newTestEngine(t)
+
+	_, err := e.Write(ctx, "acme", tuples(t, "document:1#reader@user:alice"), nil)
+	assert.ErrorIs(t, err, ErrInvalidTuple)
+	_, err = e.Write(ctx, "acme", tuples(t, "document:1#viewer@robot:r2"), nil)
+	assert.ErrorIs(t, err, ErrInvalidTuple)
+	_, err = e.Write(ctx, "acme", tuples(t, "document:1#viewer@group:eng#admin"), nil)
+	assert.ErrorIs(t, err, ErrInvalidTuple)
+
+	_, err = e.Write(ctx, "acme", tuples(t,
+		"document:1#owner@user:alice",
+		"document:1#parent@folder:a",
+		"folder:a#parent@folder:root",
+		"folder:root#viewer@group:eng#member",
+		"group:eng#member@user:bob",
+		"group:eng#member@group:sre#member",
+		"group:sre#member@user:carol",
+		// A cycle of groups must not loop forever.
+		"group:sre#member@group:eng#member",
+		"document:2#viewer@user:dave",
+	), nil)
+	require.NoError(t, err)
+
+	for _, tc := range []struct {
+		object, relation, subject string
+		want                      bool
+	}{
+		{"document:1", "owner", "user:alice", true},
+		{"document:1", "editor", "user:alice", true},
+		{"document:1", "viewer", "user:alice", true},
+		{"document:1", "editor", "user:bob", false},
+		{"document:1", "viewer", "user:bob", true},
+		{"document:1", "viewer", "user:carol", true},
+		{"document:1", "viewer", "group:eng#member", true},
+		{"document:1", "viewer", "user:dave", false},
+		{"document:2", "viewer", "user:dave", true},
+		{"document:2", "viewer", "user:mallory", false},
+	} {
+		object, err := models.ParseObject(tc.object)
+		require.NoError(t, err)
+		subject, err := models.ParseSubject(tc.subject)
+		require.NoError(t, err)
+		allowed, token, err := e.Check(ctx, "acme", object, tc.relation, subject, Consistency{})
+		require.NoError(t, err)
+		assert.Equal(t, tc.want, allowed, "%s#%s@%s", tc.object, tc.relation, tc.subject)
+		assert.NotEmpty(t, token)
+	}
+
+	_, _, err = e.Check(ctx, "acme", models.ObjectRef{Type: "document", ID: "1"}, "reader",
+		models.SubjectRef{ObjectRef: models.ObjectRef{Type: "user", ID: "alice"}}, Consistency{})
+	assert.ErrorIs(t, err, ErrUnknownRelation)
+
+	// Tuples are per tenant.
+	allowed, _, err := e.Check(ctx, "globex", models.ObjectRef{Type: "document", ID: "1"}, "owner",
+		models.SubjectRef{ObjectRef: models.ObjectRef{Type: "user", ID: "alice"}}, Consistency{})
+	require.NoError(t, err)
+	assert.False(t, allowed)
+
+	ids, _, err := e.ListObjects(ctx, "acme", "document", "viewer",
+		models.SubjectRef{ObjectRef: models.ObjectRef{Type: "user", ID: "carol"}}, Consistency{})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"1"}, ids)
+	ids, _, err = e.ListObjects(ctx, "acme", "folder", "viewer",
+		models.SubjectRef{ObjectRef: models.ObjectRef{Type: "user", ID: "bob"}}, Consistency{})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a", "root"}, ids)
+}
+
+func TestDepthLimit(t *testing.T) {
+	ctx := context.Background()
+	e := newTestEngine(t)
+
+	var chain []string
+	for i := 0; i <= MaxDepth; i++ {
+		chain = append(chain, "folder:"+string(rune('a'+i))+"#parent@folder:"+string(rune('a'+i+1)))
+	}
+	_, err := e.Write(ctx, "acme", tuples(t, chain...), nil)
+	require.NoError(t, err)
+
+	_, _, err = e.Check(ctx, "acme", models.ObjectRef{Type: "folder", ID: "a"}, "viewer",
+		models.SubjectRef{ObjectRef: models.ObjectRef{Type: "user", ID: "alice"}}, Consistency{})
+	assert.ErrorIs(t, err, ErrDepthExceeded)
+}
+
+func TestExpand(t *testing.T) {
+	ctx := context.Background()
+	e := newTestEngine(t)
+	_, err := e.Write(ctx, "acme", tuples(t,
+		"document:1#owner@user:alice",
+		"document:1#viewer@group:eng#member",
+		"document:1#parent@folder:a",
+		"folder:a#viewer@user:bob",
+	), nil)
+	require.NoError(t, err)
+
+	tree, _, err := e.Expand(ctx, "acme", models.ObjectRef{Type: "document", ID: "1"}, "viewer", Consistency{})
+	require.NoError(t, err)
+	assert.Equal(t, &Tree{Userset: "document:1#viewer", Operation: OpUnion, Children: []*Tree{
+		{Operation: OpThis, Subjects: []string{"group:eng#member"}},
+		{Operation: OpComputedUserset, Children: []*Tree{
+			{Userset: "document:1#editor", Operation: OpUnion, Children: []*Tree{
+				{Operation: OpThis},
+				{Operation: OpComputedUserset, Children: []*Tree{
+					{Userset: "document:1#owner", Operation: OpThis, Subjects: []string{"user:alice"}},
+				}},
+			}},
+		}},
+		{Operation: OpTupleToUserset, Children: []*Tree{
+			{Userset: "folder:a#viewer", Operation: OpUnion, Children: []*Tree{
+				{Operation: OpThis, Subjects: []string{"user:bob"}},
+				{Operation: OpTupleToUserset},
+			}},
+		}},
+	}}, tree)
+}
+
+func TestConsistency(t *testing.T) {
+	ctx := context.Background()
+	e := newTestEngine(t)
+	object := models.ObjectRef{Type: "document", ID: "1"}
+	alice := models.SubjectRef{ObjectRef: models.ObjectRef{Type: "user", ID: "alice"}}
+
+	granted, err := e.Write(ctx, "acme", tuples(t, "document:1#owner@user:alice"), nil)
+	require.NoError(t, err)
+	revoked, err := e.Write(ctx, "acme", nil, tuples(t, "document:1#owner@user:alice"))
+	require.NoError(t, err)
+
+	allowed, token, err := e.Check(ctx, "acme", object, "owner", alice, Consistency{AtLeastAsFresh: granted})
+	require.NoError(t, err)
+	assert.False(t, allowed, "at_least_as_fresh evaluates at the latest revision")
+	assert.Equal(t, revoked, token)
+
+	allowed, token, err = e.Check(ctx, "acme", object, "owner", alice, Consistency{AtExactSnapshot: granted})
+	require.NoError(t, err)
+	assert.True(t, allowed, "at_exact_snapshot evaluates at the token's revision")
+	assert.Equal(t, granted, token)
+
+	read, _, err := e.Read(ctx, store.TupleFilter{TenantID: "acme"}, Consistency{AtExactSnapshot: granted})
+	require.NoError(t, err)
+	assert.Len(t, read, 1)
+
+	for _, consistency := range []Consistency{
+		{AtLeastAsFresh: "not-a-token"},
+		{AtLeastAsFresh: EncodeToken("globex", 1)},
+		{AtExactSnapshot: EncodeToken("acme", 99)},
+		{AtLeastAsFresh: granted, AtExactSnapshot: granted},
+	} {
+		_, _, err := e.Check(ctx, "acme", object, "owner", alice, consistency)
+		assert.ErrorIs(t, err, ErrInvalidToken, "%+v", consistency)
+	}
+
+	tenant, revision, err := DecodeToken(EncodeToken("team:a", 7))
+	require.NoError(t, err)
+	assert.Equal(t, "team:a", tenant)
+	assert.EqualValues(t, 7, revision)
+}
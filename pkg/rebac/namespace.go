@@ -0,0 +1,241 @@
+// Package rebac answers relationship-based access questions from relation
+// tuples, in the manner of Zanzibar.
+//
+// A tuple such as document:42#viewer@user:alice states a relation directly.
+// Namespace configuration declares the relations of each object type and how
+// a relation is computed from others through userset rewrites, so that a
+// folder's viewers can be the viewers of each document in it without a tuple
+// per document:
+//
+//	{"user": {},
+//	 "folder": {"relations": {"viewer": null}},
+//	 "document": {"relations": {
+//	   "parent": null,
+//	   "owner": null,
+//	   "viewer": {"union": [
+//	     {"this": true},
+//	     {"computed_userset": "owner"},
+//	     {"tuple_to_userset": {"tupleset": "parent", "computed_userset": "viewer"}}]}}}}
+//
+// Relation tuples live in the store next to the Casbin policies and are
+// evaluated separately from them.
+package rebac
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/knakul853/accessmesh/internal/models"
+)
+
+// ErrInvalidTuple is returned when writing a tuple the namespace
+// configuration does not allow.
+var ErrInvalidTuple = errors.New("invalid relation tuple")
+
+// ErrUnknownRelation is returned when asking about a relation the namespace
+// configuration does not declare.
+var ErrUnknownRelation = errors.New("unknown relation")
+
+// Rewrite computes the subjects of a relation. Exactly one field is set,
+// except in the empty rewrite, which means This.
+type Rewrite struct {
+	// This is the subjects of the relation's own tuples.
+	This bool `json:"this,omitempty"`
+	// ComputedUserset is the subjects of another relation of the same
+	// object.
+	ComputedUserset string `json:"computed_userset,omitempty"`
+	// TupleToUserset is the subjects of a relation of the objects the
+	// object is related to.
+	TupleToUserset *TupleToUserset `json:"tuple_to_userset,omitempty"`
+	// Union is the subjects of any of the rewrites.
+	Union []*Rewrite `json:"union,omitempty"`
+}
+
+// TupleToUserset follows the object's Tupleset relation to other objects and
+// takes the subjects of their ComputedUserset relation.
+type TupleToUserset struct {
+	Tupleset        string `json:"tupleset"`
+	ComputedUserset string `json:"computed_userset"`
+}
+
+// Namespace declares the relations of an object type. A nil rewrite means
+// the relation is only what its tuples state.
+type Namespace struct {
+	Relations map[string]*Rewrite `json:"relations"`
+}
+
+// Namespaces is the namespace configuration, keyed by object type.
+type Namespaces map[string]*Namespace
+
+// LoadNamespaces reads the namespace configuration from a JSON file. An
+// empty path gives no namespaces, so that every tuple write is rejected.
+func LoadNamespaces(path string) (Namespaces, error) {
+	namespaces := Namespaces{}
+	if path == "" {
+		return namespaces, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &namespaces); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	if err := namespaces.Validate(); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	return namespaces, nil
+}
+
+// Validate checks that every rewrite sets one operation and refers to
+// relations that exist.
+func (n Namespaces) Validate() error {
+	for name, namespace := range n {
+		if name == "" || strings.ContainsAny(name, ":#@") {
+			return fmt.Errorf("invalid namespace name %q", name)
+		}
+		if namespace == nil {
+			n[name] = &Namespace{}
+			continue
+		}
+		for relation, rewrite := range namespace.Relations {
+			if relation == "" || strings.ContainsAny(relation, ":#@") {
+				return fmt.Errorf("%s: invalid relation name %q", name, relation)
+			}
+			if err := n.validateRewrite(name, rewrite); err != nil {
+				return fmt.Errorf("%s#%s: %w", name, relation, err)
+			}
+		}
+		if err := n.checkComputedCycles(name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (n Namespaces) validateRewrite(namespace string, rewrite *Rewrite) error {
+	if rewrite == nil {
+		return nil
+	}
+
+	set := 0
+	for _, isSet := range []bool{rewrite.This, rewrite.ComputedUserset != "", rewrite.TupleToUserset != nil, rewrite.Union != nil} {
+		if isSet {
+			set++
+		}
+	}
+	if set > 1 {
+		return errors.New("a rewrite sets more than one of this, computed_userset, tuple_to_userset and union")
+	}
+
+	switch {
+	case rewrite.ComputedUserset != "":
+		if !n.defines(namespace, rewrite.ComputedUserset) {
+			return fmt.Errorf("computed_userset: unknown relation %q", rewrite.ComputedUserset)
+		}
+	case rewrite.TupleToUserset != nil:
+		// The computed userset is a relation of the objects the tupleset
+		// points at, which may be of any type, so only the tupleset can be
+		// checked here.
+		ttu := rewrite.TupleToUserset
+		if !n.defines(namespace, ttu.Tupleset) {
+			return fmt.Errorf("tuple_to_userset: unknown tupleset relation %q", ttu.Tupleset)
+		}
+		if ttu.ComputedUserset == "" {
+			return errors.New("tuple_to_userset: computed_userset is required")
+		}
+	case rewrite.Union != nil:
+		if len(rewrite.Union) == 0 {
+			return errors.New("union: no rewrites")
+		}
+		for _, child := range rewrite.Union {
+			if err := n.validateRewrite(namespace, child); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// checkComputedCycles rejects relations that are computed from themselves
+// within an object, such as viewer from editor and editor from viewer,
+// which no tuple could ever end.
+func (n Namespaces) checkComputedCycles(namespace string) error {
+	relations := n[namespace].Relations
+	var visit func(relation string, path []string) error
+	visit = func(relation string, path []string) error {
+		for _, seen := range path {
+			if seen == relation {
+				return fmt.Errorf("%s: relations computed from each other: %s", namespace,
+					strings.Join(append(path, relation), " -> "))
+			}
+		}
+		for _, next := range computedFrom(relations[relation]) {
+			if err := visit(next, append(path, relation)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	for relation := range relations {
+		if err := visit(relation, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func computedFrom(rewrite *Rewrite) []string {
+	switch {
+	case rewrite == nil:
+		return nil
+	case rewrite.ComputedUserset != "":
+		return []string{rewrite.ComputedUserset}
+	}
+	var relations []string
+	for _, child := range rewrite.Union {
+		relations = append(relations, computedFrom(child)...)
+	}
+	return relations
+}
+
+func (n Namespaces) defines(namespace, relation string) bool {
+	ns, ok := n[namespace]
+	if !ok {
+		return false
+	}
+	_, ok = ns.Relations[relation]
+	return ok
+}
+
+// rewrite returns the rewrite of namespace#relation, This if it has none.
+func (n Namespaces) rewrite(namespace, relation string) (*Rewrite, error) {
+	if !n.defines(namespace, relation) {
+		return nil, fmt.Errorf("%w %s#%s", ErrUnknownRelation, namespace, relation)
+	}
+	rewrite := n[namespace].Relations[relation]
+	if rewrite == nil || (!rewrite.This && rewrite.ComputedUserset == "" && rewrite.TupleToUserset == nil && rewrite.Union == nil) {
+		return &Rewrite{This: true}, nil
+	}
+	return rewrite, nil
+}
+
+// CheckTuple checks that the tuple's object type and relation are declared,
+// and that its subject is of a declared type, with a declared relation if
+// it names one.
+func (n Namespaces) CheckTuple(t models.RelationTuple) error {
+	if !n.defines(t.ObjectType, t.Relation) {
+		return fmt.Errorf("%w %s: %s#%s is not declared", ErrInvalidTuple, t.String(), t.ObjectType, t.Relation)
+	}
+	if _, ok := n[t.SubjectType]; !ok {
+		return fmt.Errorf("%w %s: namespace %q is not declared", ErrInvalidTuple, t.String(), t.SubjectType)
+	}
+	if t.SubjectRelation != "" && !n.defines(t.SubjectType, t.SubjectRelation) {
+		return fmt.Errorf("%w %s: %s#%s is not declared", ErrInvalidTuple, t.String(), t.SubjectType, t.SubjectRelation)
+	}
+	return nil
+}
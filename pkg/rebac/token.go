@@ -0,0 +1,72 @@
+package rebac
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ErrInvalidToken is returned for a consistency token that is malformed,
+// was issued for another tenant, or is newer than any revision the store
+// has.
+var ErrInvalidToken = errors.New("invalid consistency token")
+
+const tokenPrefix = "v1:"
+
+// Consistency chooses the revision of the tenant's tuples a request is
+// evaluated at. AtLeastAsFresh evaluates at the latest revision, provided it
+// includes the token's; it is how a client reads its own writes.
+// AtExactSnapshot evaluates at the token's revision, ignoring later writes.
+// With neither, requests are evaluated at the latest revision.
+type Consistency struct {
+	AtLeastAsFresh  string `json:"at_least_as_fresh,omitempty"`
+	AtExactSnapshot string `json:"at_exact_snapshot,omitempty"`
+}
+
+// EncodeToken returns the opaque consistency token of a tenant's revision.
+func EncodeToken(tenantID string, revision int64) string {
+	return base64.RawURLEncoding.EncodeToString(
+		[]byte(tokenPrefix + strconv.FormatInt(revision, 10) + ":" + tenantID))
+}
+
+// DecodeToken returns the tenant and revision of a consistency token.
+func DecodeToken(token string) (string, int64, error) {
+	data, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil || !strings.HasPrefix(string(data), tokenPrefix) {
+		return "", 0, ErrInvalidToken
+	}
+	rawRevision, tenantID, ok := strings.Cut(strings.TrimPrefix(string(data), tokenPrefix), ":")
+	revision, err := strconv.ParseInt(rawRevision, 10, 64)
+	if !ok || err != nil || revision < 0 {
+		return "", 0, ErrInvalidToken
+	}
+	return tenantID, revision, nil
+}
+
+// revision resolves c against the tenant's latest revision.
+func (c Consistency) revision(tenantID string, latest int64) (int64, error) {
+	if c.AtLeastAsFresh != "" && c.AtExactSnapshot != "" {
+		return 0, fmt.Errorf("%w: set at most one of at_least_as_fresh and at_exact_snapshot", ErrInvalidToken)
+	}
+
+	token := c.AtLeastAsFresh + c.AtExactSnapshot
+	if token == "" {
+		return latest, nil
+	}
+	tokenTenant, revision, err := DecodeToken(token)
+	if err != nil {
+		return 0, err
+	}
+	if tokenTenant != tenantID {
+		return 0, fmt.Errorf("%w: issued for another tenant", ErrInvalidToken)
+	}
+	if revision > latest {
+		return 0, fmt.Errorf("%w: revision %d is newer than the latest, %d", ErrInvalidToken, revision, latest)
+	}
+	if c.AtExactSnapshot != "" {
+		return revision, nil
+	}
+	return latest, nil
+}